@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// AnnotateCommand is an external checker (--annotate-cmd), e.g. "aspell list". It
+// receives a block's text on stdin and prints one finding per line.
+var AnnotateCommand string
+
+// runAnnotator runs AnnotateCommand over text and returns its non-empty output lines.
+func runAnnotator(text string) ([]string, error) {
+	fields := strings.Fields(AnnotateCommand)
+	cmd := exec.Command(fields[0], fields[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", AnnotateCommand, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	var findings []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			findings = append(findings, line)
+		}
+	}
+	return findings, nil
+}
+
+// annotateEntries attaches the checker's findings to NEW and changed entries. For
+// changed blocks, findings the File A text already had are dropped, so only
+// problems introduced by the revision remain.
+func annotateEntries(diffs []DiffEntry) error {
+	for i := range diffs {
+		e := &diffs[i]
+		if e.BlockB == nil || (e.Type != Added && e.Similarity == 0) {
+			continue // Deleted, or identical text
+		}
+		findings, err := runAnnotator(e.BlockB.OriginalText)
+		if err != nil {
+			return err
+		}
+		if e.BlockA != nil && len(findings) > 0 {
+			before, err := runAnnotator(e.BlockA.OriginalText)
+			if err != nil {
+				return err
+			}
+			existing := make(map[string]int)
+			for _, f := range before {
+				existing[f]++
+			}
+			var introduced []string
+			for _, f := range findings {
+				if existing[f] > 0 {
+					existing[f]--
+					continue
+				}
+				introduced = append(introduced, f)
+			}
+			findings = introduced
+		}
+		e.Annotations = findings
+	}
+	return nil
+}
+
+// printAnnotations prints the ANNOTATIONS section listing every annotated entry.
+func printAnnotations(diffs []DiffEntry) {
+	fmt.Printf("\n# ANNOTATIONS (%s)\n", AnnotateCommand)
+	found := false
+	for _, e := range diffs {
+		if len(e.Annotations) == 0 {
+			continue
+		}
+		found = true
+		fmt.Printf("  [%s] File B L%d-%d: %s\n", e.Type, e.BlockB.LineStart, e.BlockB.LineEnd, summarizedText(e.BlockB.OriginalText, true))
+		for _, f := range e.Annotations {
+			fmt.Printf("    ! %s\n", f)
+		}
+	}
+	if !found {
+		fmt.Println("  No new findings.")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runApply implements "go-semantic-diff apply": it rebuilds File B of a result
+// saved with --save-session by applying its block operations to a file. Only
+// the exact File A of the session can be patched; other files are refused, as
+// the entries locate blocks by their File A lines.
+func runApply(args []string) int {
+	fs := flag.NewFlagSet("apply", flag.ContinueOnError)
+	outPath := fs.String("output", "", "Write the patched file to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return ExitTrouble
+	}
+	if fs.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: go-semantic-diff apply [--output file] <session-file> <file>")
+		return ExitTrouble
+	}
+	session, diffs, err := loadSession(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: apply: %v\n", err)
+		return ExitTrouble
+	}
+	if session.Partial {
+		fmt.Fprintf(os.Stderr, "Error: apply: %s holds a partial result, cancelled at --timeout\n", fs.Arg(0))
+		return ExitTrouble
+	}
+	content, err := readInputFile(fs.Arg(1), 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: apply: %v\n", err)
+		return ExitTrouble
+	}
+	if !identicalInputs(content, session.ContentA) {
+		fmt.Fprintf(os.Stderr, "Error: apply: %s is not File A of the session (%s); only the file that was diffed can be patched\n", fs.Arg(1), session.FileA)
+		return ExitTrouble
+	}
+
+	patched, approximate := applySession(session, diffs)
+	if approximate > 0 {
+		fmt.Fprintf(noteWriter(), "Note: %d lines differ from the saved File B only in spacing or text the diff ignored (--ignore-numbers, --mask); they keep their File A form.\n", approximate)
+	}
+	if *outPath == "" {
+		fmt.Print(patched)
+		return ExitIdentical
+	}
+	if err := os.WriteFile(*outPath, []byte(patched), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: apply: %v\n", err)
+		return ExitTrouble
+	}
+	return ExitIdentical
+}
+
+// applySession rebuilds File B of a session line by line from the operations
+// of its entries (see rebuildBlock). Lines in no block are the blank lines
+// between blocks. A block whose operation does not rebuild its line count, or
+// whose line diff does not apply, takes its File B text. It also returns how
+// many lines differ from the saved File B.
+func applySession(session SessionFile, diffs []DiffEntry) (string, int) {
+	linesB := strings.Split(strings.ReplaceAll(session.ContentB, "\r\n", "\n"), "\n")
+	patched := make([]string, len(linesB))
+	for _, e := range diffs {
+		if e.BlockB == nil {
+			continue
+		}
+		text, _, err := rebuildBlock(e)
+		rebuilt, refs := strings.Split(text, "\n"), e.BlockB.SourceLineRefs
+		if err != nil || len(rebuilt) != len(refs) {
+			rebuilt = rebuilt[:0]
+			for _, ref := range refs {
+				rebuilt = append(rebuilt, ref.OriginalText)
+			}
+		}
+		for k, ref := range refs {
+			if ref.OriginalLineNum >= 1 && ref.OriginalLineNum <= len(patched) {
+				patched[ref.OriginalLineNum-1] = rebuilt[k]
+			}
+		}
+	}
+	approximate := 0
+	for k := range patched {
+		if patched[k] != linesB[k] {
+			approximate++
+		}
+	}
+	newline := "\n"
+	if strings.Contains(session.ContentB, "\r\n") {
+		newline = "\r\n"
+	}
+	return strings.Join(patched, newline), approximate
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ShowAssetChanges forces the asset/link section for non-Markdown inputs (--asset-changes).
+var ShowAssetChanges bool
+
+// Markdown references, matched in this order; each match is blanked out before
+// the next pattern runs so a badge is not also reported as an image and a link.
+var (
+	markdownBadgeRe = regexp.MustCompile(`\[!\[([^\]]*)\]\(\s*<?([^)\s>]+)>?(?:\s+"[^"]*")?\s*\)\]\(\s*<?([^)\s>]+)>?(?:\s+"[^"]*")?\s*\)`)
+	markdownImageRe = regexp.MustCompile(`!\[([^\]]*)\]\(\s*<?([^)\s>]+)>?(?:\s+"[^"]*")?\s*\)`)
+	markdownLinkRe  = regexp.MustCompile(`\[([^\]]*)\]\(\s*<?([^)\s>]+)>?(?:\s+"[^"]*")?\s*\)`)
+	markdownRefDef  = regexp.MustCompile(`^\s{0,3}\[([^\]]+)\]:\s*<?(\S+?)>?(?:\s+["'(].*)?$`)
+)
+
+// MarkdownAsset is one image, link, badge or reference definition in a Markdown file.
+type MarkdownAsset struct {
+	Kind   string // "badge", "image", "link" or "reference"
+	Label  string // Alt text, link text or reference ID
+	URL    string // Image source for badges and images, target otherwise
+	Target string // Link target of a badge
+	Line   int
+}
+
+// AssetChange is an asset present in only one file, or present in both with a new URL.
+type AssetChange struct {
+	Old, New *MarkdownAsset // Old is nil when added, New is nil when removed
+}
+
+func isMarkdownPath(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown", ".mdown", ".mkd":
+		return true
+	}
+	return false
+}
+
+// extractMarkdownAssets returns the assets of content in document order.
+func extractMarkdownAssets(content string) []MarkdownAsset {
+	var assets []MarkdownAsset
+	inFence := false
+	for i, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		if m := markdownRefDef.FindStringSubmatch(line); m != nil {
+			assets = append(assets, MarkdownAsset{Kind: "reference", Label: m[1], URL: m[2], Line: i + 1})
+			continue
+		}
+		blank := func(loc []int) { line = line[:loc[0]] + strings.Repeat(" ", loc[1]-loc[0]) + line[loc[1]:] }
+		for _, m := range markdownBadgeRe.FindAllStringSubmatchIndex(line, -1) {
+			assets = append(assets, MarkdownAsset{Kind: "badge", Label: line[m[2]:m[3]], URL: line[m[4]:m[5]], Target: line[m[6]:m[7]], Line: i + 1})
+			blank(m)
+		}
+		for _, m := range markdownImageRe.FindAllStringSubmatchIndex(line, -1) {
+			assets = append(assets, MarkdownAsset{Kind: "image", Label: line[m[2]:m[3]], URL: line[m[4]:m[5]], Line: i + 1})
+			blank(m)
+		}
+		for _, m := range markdownLinkRe.FindAllStringSubmatchIndex(line, -1) {
+			assets = append(assets, MarkdownAsset{Kind: "link", Label: line[m[2]:m[3]], URL: line[m[4]:m[5]], Line: i + 1})
+		}
+	}
+	return assets
+}
+
+func assetKey(a MarkdownAsset) string {
+	return a.Kind + "\x00" + strings.ToLower(strings.Join(strings.Fields(a.Label), " "))
+}
+
+// diffMarkdownAssets compares the assets of both files. Assets with the same kind
+// and label are paired in document order, after setting aside those whose URLs
+// are also unchanged; a remaining pair is a retargeted asset.
+func diffMarkdownAssets(assetsA, assetsB []MarkdownAsset) []AssetChange {
+	full := func(a MarkdownAsset) string { return assetKey(a) + "\x00" + a.URL + "\x00" + a.Target }
+	inA := make(map[string]int)
+	for _, a := range assetsA {
+		inA[full(a)]++
+	}
+	unchanged := make(map[string]int) // Occurrences found unchanged in both files
+	var restB []*MarkdownAsset
+	for i := range assetsB {
+		if k := full(assetsB[i]); inA[k] > unchanged[k] {
+			unchanged[k]++
+			continue
+		}
+		restB = append(restB, &assetsB[i])
+	}
+	var restA []*MarkdownAsset
+	restAByKey := make(map[string][]*MarkdownAsset)
+	for i := range assetsA {
+		if k := full(assetsA[i]); unchanged[k] > 0 {
+			unchanged[k]--
+			continue
+		}
+		restA = append(restA, &assetsA[i])
+		restAByKey[assetKey(assetsA[i])] = append(restAByKey[assetKey(assetsA[i])], &assetsA[i])
+	}
+
+	var changes []AssetChange
+	pairedA := make(map[*MarkdownAsset]bool)
+	for _, b := range restB {
+		candidates := restAByKey[assetKey(*b)]
+		if len(candidates) == 0 {
+			changes = append(changes, AssetChange{New: b})
+			continue
+		}
+		restAByKey[assetKey(*b)] = candidates[1:]
+		pairedA[candidates[0]] = true
+		changes = append(changes, AssetChange{Old: candidates[0], New: b})
+	}
+	for _, a := range restA {
+		if !pairedA[a] {
+			changes = append(changes, AssetChange{Old: a})
+		}
+	}
+	return changes
+}
+
+func describeAssetURLs(a *MarkdownAsset) string {
+	if a.Kind == "badge" {
+		return fmt.Sprintf("%s (links to %s)", a.URL, a.Target)
+	}
+	return a.URL
+}
+
+// printAssetChanges prints the ASSET/LINK CHANGES section: retargeted (~),
+// removed (-) and added (+) images, links, badges and reference definitions.
+func printAssetChanges(changes []AssetChange) {
+	heading, item := "\n# ASSET/LINK CHANGES\n", "  "
+	if OutputFormat == "markdown" {
+		heading, item = "\n## ASSET/LINK CHANGES\n\n", "- "
+	}
+	fmt.Print(heading)
+	if len(changes) == 0 {
+		fmt.Printf("%sNo images, links or badges changed.\n", item)
+		return
+	}
+	for _, c := range changes {
+		switch {
+		case c.Old != nil && c.New != nil:
+			fmt.Printf("%s~ %s %q (A L%d -> B L%d): %s -> %s\n", item, c.New.Kind, c.New.Label, c.Old.Line, c.New.Line, describeAssetURLs(c.Old), describeAssetURLs(c.New))
+		case c.Old != nil:
+			fmt.Printf("%s- %s %q (A L%d): %s\n", item, c.Old.Kind, c.Old.Label, c.Old.Line, describeAssetURLs(c.Old))
+		default:
+			fmt.Printf("%s+ %s %q (B L%d): %s\n", item, c.New.Kind, c.New.Label, c.New.Line, describeAssetURLs(c.New))
+		}
+	}
+}
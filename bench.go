@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+)
+
+// benchEdit is what a synthetic benchmark document did to one paragraph.
+type benchEdit int
+
+const (
+	benchUntouched benchEdit = iota
+	benchMoved
+	benchRewritten
+	benchDeleted
+	benchInserted
+)
+
+var benchEditNames = []string{"untouched", "moved", "rewritten", "deleted", "inserted"}
+
+// benchExpected is the entry type a correct diff reports for each edit, and
+// benchStages the stages that decide it.
+var benchExpected = []DiffType{Unchanged, Moved, Modified, Deleted, Added}
+var benchStages = []string{"megablock matching", "megablock matching, classification", "semantic matching", "semantic matching", "semantic matching"}
+
+var benchWords = strings.Fields(`the a contract party supplier customer service
+	agreement term notice payment invoice within days shall may must not any all
+	each other under this that such written consent period date fee rate amount
+	data report system process review update change request approval delivery
+	schedule quality standard level support response time hours business year
+	month week client vendor project team manager document section clause right
+	obligation liability limit damages claim breach remedy termination renewal
+	price cost budget plan scope work product material information security access
+	control policy procedure audit record account balance credit debit transfer
+	order unit item quantity value total annual monthly quarterly provide perform
+	maintain ensure comply notify deliver accept reject confirm submit approve`)
+
+// benchConfig describes the synthetic documents of a benchmark.
+type benchConfig struct {
+	paragraphs, lines                 int
+	moves, rewrites, inserts, deletes int
+	rewriteFraction                   float64
+}
+
+// benchParagraph is a paragraph whose fate is checked: its first line in File
+// A, or in File B for an inserted paragraph.
+type benchParagraph struct {
+	edit benchEdit
+	line int
+}
+
+func benchLine(rng *rand.Rand) string {
+	words := make([]string, 8+rng.Intn(6))
+	for k := range words {
+		words[k] = benchWords[rng.Intn(len(benchWords))]
+	}
+	return strings.Join(words, " ") + "."
+}
+
+func benchText(rng *rand.Rand, lines int) []string {
+	text := make([]string, lines)
+	for k := range text {
+		text[k] = benchLine(rng)
+	}
+	return text
+}
+
+// benchRewrite replaces the given fraction of the words of every line.
+func benchRewrite(rng *rand.Rand, text []string, fraction float64) []string {
+	rewritten := make([]string, len(text))
+	for k, line := range text {
+		words := strings.Fields(strings.TrimSuffix(line, "."))
+		for n := 0; n < int(float64(len(words))*fraction+0.5); n++ {
+			words[rng.Intn(len(words))] = benchWords[rng.Intn(len(benchWords))]
+		}
+		rewritten[k] = strings.Join(words, " ") + "."
+	}
+	return rewritten
+}
+
+// joinParagraphs joins paragraphs with blank lines, returning the text and the
+// first line number of each paragraph.
+func joinParagraphs(paragraphs [][]string) (string, []int) {
+	var lines []string
+	starts := make([]int, len(paragraphs))
+	for k, p := range paragraphs {
+		if k > 0 {
+			lines = append(lines, "")
+		}
+		starts[k] = len(lines) + 1
+		lines = append(lines, p...)
+	}
+	return strings.Join(lines, "\n") + "\n", starts
+}
+
+// generateBenchDocs writes File A and a File B edited as configured. Moved
+// paragraphs go at least a quarter of the document away, so that the diff
+// with the fewest moves is the one that moves them.
+func generateBenchDocs(rng *rand.Rand, cfg benchConfig) (string, string, []benchParagraph) {
+	paragraphsA := make([][]string, cfg.paragraphs)
+	for k := range paragraphsA {
+		paragraphsA[k] = benchText(rng, cfg.lines)
+	}
+	edits := make([]benchEdit, cfg.paragraphs)
+	order := rng.Perm(cfg.paragraphs)
+	for k, n := range order {
+		switch {
+		case k < cfg.moves:
+			edits[n] = benchMoved
+		case k < cfg.moves+cfg.rewrites:
+			edits[n] = benchRewritten
+		case k < cfg.moves+cfg.rewrites+cfg.deletes:
+			edits[n] = benchDeleted
+		}
+	}
+
+	// File B as indices into paragraphsA, -1 for an inserted paragraph
+	var layout []int
+	for n, edit := range edits {
+		if edit != benchDeleted && edit != benchMoved {
+			layout = append(layout, n)
+		}
+	}
+	minDistance := cfg.paragraphs / 4
+	for n, edit := range edits {
+		if edit != benchMoved {
+			continue
+		}
+		at := rng.Intn(len(layout) + 1)
+		for tries := 0; tries < 100 && abs(at-n) < minDistance; tries++ {
+			at = rng.Intn(len(layout) + 1)
+		}
+		layout = append(layout[:at], append([]int{n}, layout[at:]...)...)
+	}
+	for k := 0; k < cfg.inserts; k++ {
+		at := rng.Intn(len(layout) + 1)
+		layout = append(layout[:at], append([]int{-1}, layout[at:]...)...)
+	}
+
+	paragraphsB := make([][]string, len(layout))
+	for k, n := range layout {
+		switch {
+		case n < 0:
+			paragraphsB[k] = benchText(rng, cfg.lines)
+		case edits[n] == benchRewritten:
+			paragraphsB[k] = benchRewrite(rng, paragraphsA[n], cfg.rewriteFraction)
+		default:
+			paragraphsB[k] = paragraphsA[n]
+		}
+	}
+	textA, startsA := joinParagraphs(paragraphsA)
+	textB, startsB := joinParagraphs(paragraphsB)
+	var truth []benchParagraph
+	for n, edit := range edits {
+		truth = append(truth, benchParagraph{edit, startsA[n]})
+	}
+	for k, n := range layout {
+		if n < 0 {
+			truth = append(truth, benchParagraph{benchInserted, startsB[k]})
+		}
+	}
+	return textA, textB, truth
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// runBench implements "go-semantic-diff bench": it diffs synthetic documents
+// with known edits and reports the time each stage took and how many edits
+// were reported as what they are.
+func runBench(args []string) int {
+	cfg := benchConfig{}
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.IntVar(&cfg.paragraphs, "paragraphs", 200, "Paragraphs in File A")
+	fs.IntVar(&cfg.lines, "lines", 4, "Lines per paragraph")
+	fs.IntVar(&cfg.moves, "moves", 5, "Paragraphs moved elsewhere in File B")
+	fs.IntVar(&cfg.rewrites, "rewrites", 10, "Paragraphs rewritten in place")
+	fs.Float64Var(&cfg.rewriteFraction, "rewrite-fraction", 0.2, "Fraction of the words of a rewritten paragraph that are replaced")
+	fs.IntVar(&cfg.inserts, "inserts", 5, "New paragraphs inserted in File B")
+	fs.IntVar(&cfg.deletes, "deletes", 5, "Paragraphs deleted from File A")
+	seed := fs.Int64("seed", 1, "Random seed of the documents")
+	runs := fs.Int("runs", 3, "Diffs to time; stage times are averaged")
+	opts := DefaultOptions()
+	fs.Float64Var(&opts.SimilarityThreshold, "threshold", opts.SimilarityThreshold, "Similarity threshold for semantic matching")
+	writeInputs := fs.String("write-inputs", "", "Also write the documents to <prefix>A.txt and <prefix>B.txt")
+	if err := fs.Parse(args); err != nil {
+		return ExitTrouble
+	}
+	if fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: go-semantic-diff bench [--paragraphs N] [--lines N] [--moves N] [--rewrites N [--rewrite-fraction f]] [--inserts N] [--deletes N] [--seed N] [--runs N] [--threshold value] [--write-inputs prefix]")
+		return ExitTrouble
+	}
+	switch {
+	case cfg.paragraphs < 1 || cfg.lines < 1 || *runs < 1:
+		fmt.Fprintln(os.Stderr, "Error: --paragraphs, --lines and --runs must be positive")
+		return ExitTrouble
+	case cfg.moves < 0 || cfg.rewrites < 0 || cfg.inserts < 0 || cfg.deletes < 0:
+		fmt.Fprintln(os.Stderr, "Error: --moves, --rewrites, --inserts and --deletes must not be negative")
+		return ExitTrouble
+	case cfg.moves+cfg.rewrites+cfg.deletes > cfg.paragraphs:
+		fmt.Fprintln(os.Stderr, "Error: --moves, --rewrites and --deletes add up to more than --paragraphs")
+		return ExitTrouble
+	case cfg.rewriteFraction < 0 || cfg.rewriteFraction > 1:
+		fmt.Fprintln(os.Stderr, "Error: --rewrite-fraction must be between 0 and 1")
+		return ExitTrouble
+	}
+
+	textA, textB, truth := generateBenchDocs(rand.New(rand.NewSource(*seed)), cfg)
+	if *writeInputs != "" {
+		for name, text := range map[string]string{"A.txt": textA, "B.txt": textB} {
+			if err := os.WriteFile(*writeInputs+name, []byte(text), 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: --write-inputs: %v\n", err)
+				return ExitTrouble
+			}
+		}
+	}
+	linesA, linesB := strings.Count(textA, "\n"), strings.Count(textB, "\n")
+
+	currentTimings = &runTimings{start: time.Now(), stages: make(map[string]time.Duration)}
+	defer func() { currentTimings = nil }()
+	var diffs []DiffEntry
+	for run := 0; run < *runs; run++ {
+		var err error
+		if diffs, err = PerformDiff(context.Background(), textA, textB, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: bench: %v\n", err)
+			return ExitTrouble
+		}
+	}
+	elapsed := time.Since(currentTimings.start) / time.Duration(*runs)
+
+	// The reported type of each line of either file
+	reported := [2]map[int]DiffType{{}, {}}
+	for _, e := range diffs {
+		for side, cb := range []*ContentBlock{e.BlockA, e.BlockB} {
+			if cb == nil || side == 1 && e.BlockA != nil {
+				continue
+			}
+			for _, line := range cb.SourceLineRefs {
+				reported[side][line.OriginalLineNum] = e.Type
+			}
+		}
+	}
+	var correct, total [benchInserted + 1]int
+	var misses []string
+	for _, p := range truth {
+		side := 0
+		if p.edit == benchInserted {
+			side = 1
+		}
+		total[p.edit]++
+		got, ok := reported[side][p.line]
+		if ok && got == benchExpected[p.edit] {
+			correct[p.edit]++
+			continue
+		}
+		what := "not reported"
+		if ok {
+			what = got.String()
+		}
+		misses = append(misses, fmt.Sprintf("%s paragraph at %s line %d reported as %s", benchEditNames[p.edit], []string{"A", "B"}[side], p.line, what))
+	}
+
+	fmt.Printf("Benchmark: %d paragraphs of %d lines (A %d lines, B %d lines), seed %d, threshold %.2f, %d runs\n", cfg.paragraphs, cfg.lines, linesA, linesB, *seed, opts.SimilarityThreshold, *runs)
+	fmt.Printf("  Edits: %d moved, %d rewritten (%.0f%% of words), %d inserted, %d deleted\n", cfg.moves, cfg.rewrites, 100*cfg.rewriteFraction, cfg.inserts, cfg.deletes)
+	fmt.Println("  Time by stage (per run; throughput in lines of A+B per second):")
+	for _, stage := range UsageStages {
+		d := currentTimings.stages[stage] / time.Duration(*runs)
+		fmt.Printf("    %-20s %12s %12.0f lines/s\n", stage, d.Round(time.Microsecond), float64(linesA+linesB)/d.Seconds())
+	}
+	fmt.Printf("    %-20s %12s %12.0f lines/s\n", "total", elapsed.Round(time.Microsecond), float64(linesA+linesB)/elapsed.Seconds())
+	fmt.Println("  Accuracy by edit (paragraphs reported as expected):")
+	for edit, name := range benchEditNames {
+		if total[edit] == 0 {
+			continue
+		}
+		fmt.Printf("    %-10s %5d/%-5d %5.1f%%  as %s (%s)\n", name, correct[edit], total[edit], 100*float64(correct[edit])/float64(total[edit]), benchExpected[edit], benchStages[edit])
+	}
+	if len(misses) > 0 {
+		fmt.Println("  Misreported:")
+		for k, miss := range misses {
+			if k == 10 {
+				fmt.Printf("    ... and %d more\n", len(misses)-k)
+				break
+			}
+			fmt.Printf("    %s\n", miss)
+		}
+	}
+	return ExitIdentical
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// RTLHint (--rtl) isolates all content as right-to-left instead of auto-detecting direction.
+var RTLHint bool
+
+const (
+	bidiFirstStrongIsolate = "\u2068" // FSI: direction taken from the first strong character
+	bidiRightToLeftIsolate = "\u2067" // RLI
+	bidiPopIsolate         = "\u2069" // PDI
+)
+
+// containsRTL reports whether text has characters from a right-to-left script.
+func containsRTL(text string) bool {
+	for _, r := range text {
+		if unicode.In(r, unicode.Hebrew, unicode.Arabic, unicode.Syriac, unicode.Thaana, unicode.Nko) {
+			return true
+		}
+	}
+	return false
+}
+
+// bidiIsolate wraps text in a Unicode directional isolate when it contains RTL
+// script (or --rtl is set), so it cannot reorder the surrounding labels and markers.
+func bidiIsolate(text string) string {
+	if text == "" || (!RTLHint && !containsRTL(text)) {
+		return text
+	}
+	if RTLHint {
+		return bidiRightToLeftIsolate + text + bidiPopIsolate
+	}
+	return bidiFirstStrongIsolate + text + bidiPopIsolate
+}
+
+// bidiIsolateLines isolates each line of a "↵ "-joined summary separately, keeping
+// the line-break marker between runs rather than inside an RTL run.
+func bidiIsolateLines(summary string) string {
+	if !RTLHint && !containsRTL(summary) {
+		return summary
+	}
+	parts := strings.Split(summary, "↵ ")
+	for i, part := range parts {
+		parts[i] = bidiIsolate(part)
+	}
+	return strings.Join(parts, "↵ ")
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BlockStorePath is a shared store of backend embeddings keyed by block checksum
+// (--block-store): a local directory, or an s3:// or gs:// prefix. Blocks seen in
+// earlier runs, by anyone sharing the store, are not sent to --embedding-url
+// again. BlockStoreMaxSize caps a local store (--block-store-max-size); 0 means
+// unlimited.
+var BlockStorePath string
+var BlockStoreMaxSize int64
+
+// BlockStoreConcurrency bounds parallel block store reads and writes.
+const BlockStoreConcurrency = 8
+
+// StoredBlock is one block store entry. Embeddings depend on the backend, so
+// each backend has its own namespace in the store.
+type StoredBlock struct {
+	Checksum       string    `json:"checksum"`
+	Backend        string    `json:"backend"`
+	NormalizedText string    `json:"normalized_text"`
+	Embedding      []float32 `json:"embedding"`
+}
+
+// blockStoreKey returns the store-relative path of a block's entry, e.g.
+// "3f9a0c1b2d4e5f60/ab/ab12....json".
+func blockStoreKey(backend, checksum string) string {
+	namespace := sha256.Sum256([]byte(backend))
+	return path.Join(hex.EncodeToString(namespace[:8]), checksum[:2], checksum+".json")
+}
+
+// blockStoreObject returns the object a key is stored as under an s3:// or gs:// store prefix.
+func blockStoreObject(key string) (objectRef, error) {
+	u, err := url.Parse(BlockStorePath)
+	if err != nil {
+		return objectRef{}, err
+	}
+	return objectRef{Scheme: u.Scheme, Bucket: u.Host, Key: path.Join(strings.Trim(u.Path, "/"), key)}, nil
+}
+
+// loadStoredBlock reads a block's entry; found is false for a miss. A local hit
+// refreshes the entry's modification time, which size-limited collection uses
+// to evict least recently used entries first.
+func loadStoredBlock(backend, checksum string) (block StoredBlock, found bool, err error) {
+	key := blockStoreKey(backend, checksum)
+	var data []byte
+	if isObjectURI(BlockStorePath) {
+		ref, errRef := blockStoreObject(key)
+		if errRef != nil {
+			return block, false, errRef
+		}
+		data, err = getObject(ref)
+		if errors.Is(err, errObjectNotFound) {
+			return block, false, nil
+		}
+	} else {
+		file := filepath.Join(BlockStorePath, filepath.FromSlash(key))
+		data, err = os.ReadFile(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			return block, false, nil
+		}
+		if err == nil {
+			now := time.Now()
+			os.Chtimes(file, now, now) // Best effort; a stale time only makes eviction earlier
+		}
+	}
+	if err != nil {
+		return block, false, err
+	}
+	if err := json.Unmarshal(data, &block); err != nil || block.Checksum != checksum || block.Backend != backend {
+		return block, false, nil // A damaged or foreign entry is a miss and gets rewritten
+	}
+	return block, true, nil
+}
+
+// saveStoredBlock writes a block's entry. Local entries are written to a temporary
+// file and renamed, so concurrent runs sharing the directory never read a partial entry.
+func saveStoredBlock(block StoredBlock) error {
+	data, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+	key := blockStoreKey(block.Backend, block.Checksum)
+	if isObjectURI(BlockStorePath) {
+		ref, err := blockStoreObject(key)
+		if err != nil {
+			return err
+		}
+		return putObject(ref, data)
+	}
+	file := filepath.Join(BlockStorePath, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if errClose := tmp.Close(); err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// storedEmbeddings looks up the blocks in the store, in parallel, and returns
+// the embeddings found, by checksum. Lookup errors count as misses; the first
+// one is returned so callers can report it.
+func storedEmbeddings(backend string, blocks []*ContentBlock) (map[string][]float32, error) {
+	found := make(map[string][]float32)
+	var firstErr error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, BlockStoreConcurrency)
+	seen := make(map[string]bool)
+	for _, cb := range blocks {
+		if seen[cb.Checksum] {
+			continue
+		}
+		seen[cb.Checksum] = true
+		wg.Add(1)
+		go func(checksum string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			block, ok, err := loadStoredBlock(backend, checksum)
+			<-sem
+			mu.Lock()
+			defer mu.Unlock()
+			if ok {
+				found[checksum] = block.Embedding
+			} else if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}(cb.Checksum)
+	}
+	wg.Wait()
+	return found, firstErr
+}
+
+// storeEmbeddings saves the embeddings of the given blocks, in parallel, and
+// returns the first error.
+func storeEmbeddings(backend string, blocks []*ContentBlock) error {
+	var firstErr error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, BlockStoreConcurrency)
+	for _, cb := range blocks {
+		wg.Add(1)
+		go func(block StoredBlock) {
+			defer wg.Done()
+			sem <- struct{}{}
+			err := saveStoredBlock(block)
+			<-sem
+			mu.Lock()
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			mu.Unlock()
+		}(StoredBlock{Checksum: cb.Checksum, Backend: backend, NormalizedText: cb.NormalizedText, Embedding: cb.Embedding})
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// collectBlockStore deletes the least recently used entries of a local store
+// until it holds at most maxSize bytes. It returns the number of entries deleted.
+func collectBlockStore(dir string, maxSize int64) (int, error) {
+	type entry struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var entries []entry
+	var total int64
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(p, ".json") {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // Removed by a concurrent run
+		}
+		entries = append(entries, entry{p, info.Size(), info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+	removed := 0
+	for _, e := range entries {
+		if total <= maxSize {
+			break
+		}
+		if err := os.Remove(e.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, err
+		}
+		total -= e.size
+		removed++
+	}
+	return removed, nil
+}
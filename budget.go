@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Cumulative shares of the remaining budget at which each PerformDiff stage must be
+// done. Time a stage does not use carries over to the stages after it.
+const (
+	BudgetShareMegablocks   = 0.40
+	BudgetShareSegmentation = 0.50
+	BudgetShareSemanticFull = 0.75 // After this, semantic matching only scores nearby candidates
+	BudgetShareSemantic     = 1.00
+)
+
+// BudgetPrunedCandidates is how many B blocks around the expected position an A block
+// is compared against once semantic matching runs short of time.
+const BudgetPrunedCandidates = 8
+
+// diffBudget tracks the --budget deadline across every PerformDiff call of one run,
+// along with the shortcuts taken to meet it. A run has one when Options.TimeBudget
+// is set (see DiffRun).
+type diffBudget struct {
+	total        time.Duration
+	deadline     time.Time
+	degradations []string
+	verbosity    int
+}
+
+func startBudget(total time.Duration, verbosity int) *diffBudget {
+	if total <= 0 {
+		return nil
+	}
+	return &diffBudget{total: total, deadline: time.Now().Add(total), verbosity: verbosity}
+}
+
+// stageDeadline returns the point by which a stage ending at the given cumulative
+// share of the remaining budget should be finished. A nil budget never expires.
+func (b *diffBudget) stageDeadline(share float64) time.Time {
+	if b == nil {
+		return time.Time{}
+	}
+	now := time.Now()
+	remaining := b.deadline.Sub(now)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return now.Add(time.Duration(float64(remaining) * share))
+}
+
+// exhausted reports whether the whole budget has been used.
+func (b *diffBudget) exhausted() bool {
+	return b != nil && !time.Now().Before(b.deadline)
+}
+
+// degrade records a shortcut once, however many PerformDiff calls take it.
+func (b *diffBudget) degrade(what string) {
+	for _, d := range b.degradations {
+		if d == what {
+			return
+		}
+	}
+	b.degradations = append(b.degradations, what)
+	debugf(b.verbosity, VerbosityDecisions, "budget", map[string]any{"shortcut": what}, "Budget: %s", what)
+}
+
+// note summarizes the shortcuts taken, or "" if the diff finished within budget.
+func (b *diffBudget) note() string {
+	if b == nil || len(b.degradations) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Time budget of %s exceeded; best-effort result (%s).", b.total, strings.Join(b.degradations, "; "))
+}
+
+// withStageDeadline derives a context that is also done at a stage deadline from
+// stageDeadline; a zero deadline leaves ctx as it is.
+func withStageDeadline(ctx context.Context, deadline time.Time) (context.Context, context.CancelFunc) {
+	if deadline.IsZero() {
+		return ctx, func() {}
+	}
+	return context.WithDeadline(ctx, deadline)
+}
+
+// pastDeadline reports whether a stage deadline from stageDeadline has passed.
+func pastDeadline(deadline time.Time) bool {
+	return !deadline.IsZero() && time.Now().After(deadline)
+}
+
+// prunedCandidateRange returns the window of B gap block indices around the
+// position proportional to A block i, used once matching runs short of time.
+func prunedCandidateRange(i, numA, numB int) (int, int) {
+	center := 0
+	if numA > 0 {
+		center = i * numB / numA
+	}
+	lo := max(center-BudgetPrunedCandidates/2, 0)
+	hi := min(lo+BudgetPrunedCandidates, numB)
+	return lo, hi
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ShowClauseMap enables the CLAUSE MAP section (--clause-map).
+var ShowClauseMap bool
+
+// clauseHeadingRe matches a line starting a numbered clause: "Section 7.2",
+// "Article 3", "7.2 Payment", "7.2. Payment" or "7) Payment". A bare number needs
+// a trailing "." or ")" so lines starting with a count are not taken for clauses.
+var clauseHeadingRe = regexp.MustCompile(`^\s*(?:(?i:section|clause|article|§)\s*(\d{1,3}(?:\.\d{1,3})*)[.)]?|(\d{1,3}(?:\.\d{1,3})+)[.)]?|(\d{1,3})[.)])(?:\s+\S|\s*$)`)
+
+// Clause is a numbered clause, running from its heading line to the line before
+// the next clause heading.
+type Clause struct {
+	Number             string
+	LineStart, LineEnd int
+	Body               string // Normalized text without the clause number
+	Index              int    // Position among the clauses of its file
+}
+
+// ClauseMapping pairs a File A clause with the File B clause most of its lines
+// were aligned to. A or B is nil for a deleted or new clause.
+type ClauseMapping struct {
+	A, B       *Clause
+	Moved      bool
+	Similarity float32 // Of the clause bodies; 1 when unchanged
+}
+
+// findClauses splits content into its numbered clauses.
+func findClauses(content string, opts Options) []*Clause {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	var clauses []*Clause
+	var body []string
+	finish := func(end int) {
+		if len(clauses) > 0 {
+			c := clauses[len(clauses)-1]
+			c.LineEnd = end
+			c.Body = opts.normalize(strings.Join(body, "\n"))
+		}
+	}
+	for i, line := range lines {
+		m := clauseHeadingRe.FindStringSubmatchIndex(line)
+		if m == nil {
+			body = append(body, line)
+			continue
+		}
+		finish(i)
+		for g := 2; g < 8; g += 2 {
+			if m[g] >= 0 {
+				clauses = append(clauses, &Clause{Number: line[m[g]:m[g+1]], LineStart: i + 1, Index: len(clauses)})
+				body = []string{line[:m[g]] + line[m[g+1]:]}
+				break
+			}
+		}
+	}
+	finish(len(lines))
+	return clauses
+}
+
+// clauseAt returns the clause containing line, or nil.
+func clauseAt(clauses []*Clause, line int) *Clause {
+	for _, c := range clauses {
+		if line >= c.LineStart && line <= c.LineEnd {
+			return c
+		}
+	}
+	return nil
+}
+
+// mapClauses maps each File A clause to the File B clause that most of its lines
+// were aligned to by the diff (as lined up in side-by-side output), and lists File B clauses nothing mapped to as new,
+// after the mapping preceding them in File B.
+func mapClauses(diffs []DiffEntry, rawContentA, rawContentB string, opts Options) []ClauseMapping {
+	clausesA, clausesB := findClauses(rawContentA, opts), findClauses(rawContentB, opts)
+	var mappings []ClauseMapping
+	mapped := make(map[*Clause]bool)
+	for _, a := range clausesA {
+		votes := make(map[*Clause]int)
+		moved := make(map[*Clause]bool)
+		for _, e := range diffs {
+			if e.BlockA == nil || e.BlockB == nil || e.BlockA.LineEnd < a.LineStart || e.BlockA.LineStart > a.LineEnd {
+				continue
+			}
+			for _, r := range sideBySideRows(e) {
+				if r.lineA < a.LineStart || r.lineA > a.LineEnd || r.lineB == 0 {
+					continue
+				}
+				if b := clauseAt(clausesB, r.lineB); b != nil {
+					votes[b]++
+					moved[b] = moved[b] || e.Type == Moved || e.Type == MovedModified
+				}
+			}
+		}
+		m := ClauseMapping{A: a}
+		for b, n := range votes {
+			if m.B == nil || n > votes[m.B] || n == votes[m.B] && b.Index < m.B.Index {
+				m.B = b
+			}
+		}
+		if m.B != nil {
+			mapped[m.B] = true
+			m.Moved = moved[m.B]
+			m.Similarity = 1
+			if a.Body != m.B.Body {
+				m.Similarity = TextSimilarityNormalized(a.Body, m.B.Body)
+			}
+		}
+		mappings = append(mappings, m)
+	}
+	for _, b := range clausesB {
+		if mapped[b] {
+			continue
+		}
+		at := 0
+		for k, m := range mappings {
+			if m.B != nil && m.B.Index < b.Index {
+				at = k + 1
+			}
+		}
+		mappings = append(mappings[:at], append([]ClauseMapping{{B: b}}, mappings[at:]...)...)
+	}
+	return mappings
+}
+
+// Change describes a mapping, e.g. "renumbered, modified".
+func (m ClauseMapping) Change() string {
+	switch {
+	case m.B == nil:
+		return "deleted"
+	case m.A == nil:
+		return "new"
+	}
+	var parts []string
+	if m.A.Number != m.B.Number {
+		parts = append(parts, "renumbered")
+	}
+	if m.Moved {
+		parts = append(parts, "moved")
+	}
+	if m.Similarity < 1 {
+		parts = append(parts, "modified")
+	}
+	if len(parts) == 0 {
+		return "unchanged"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// printClauseMap prints the CLAUSE MAP section as a table of old -> new clause
+// numbers, or a Markdown table with --format markdown.
+func printClauseMap(mappings []ClauseMapping) {
+	number := func(c *Clause) string {
+		if c == nil {
+			return "-"
+		}
+		return c.Number
+	}
+	similarity := func(m ClauseMapping) string {
+		if m.A == nil || m.B == nil || m.Similarity == 1 {
+			return ""
+		}
+		return fmt.Sprintf("%.2f", m.Similarity)
+	}
+	if OutputFormat == "markdown" {
+		fmt.Print("\n## CLAUSE MAP\n\n")
+		if len(mappings) == 0 {
+			fmt.Println("- No numbered clauses found.")
+			return
+		}
+		fmt.Println("| Old | New | Change | Similarity |")
+		fmt.Println("| --- | --- | --- | --- |")
+		for _, m := range mappings {
+			fmt.Printf("| %s | %s | %s | %s |\n", number(m.A), number(m.B), m.Change(), similarity(m))
+		}
+		return
+	}
+	fmt.Print("\n# CLAUSE MAP\n")
+	if len(mappings) == 0 {
+		fmt.Println("  No numbered clauses found.")
+		return
+	}
+	fmt.Printf("  %-10s    %-10s %-24s %s\n", "Old", "New", "Change", "Similarity")
+	for _, m := range mappings {
+		fmt.Println(strings.TrimRight(fmt.Sprintf("  %-10s -> %-10s %-24s %s", number(m.A), number(m.B), m.Change(), similarity(m)), " "))
+	}
+}
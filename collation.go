@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// CollateLocale, when set via --collate, orders entries within each report
+// section alphabetically by content using that locale's collation rules.
+var CollateLocale string
+
+// newCollator returns a case-insensitive collator for a BCP 47 locale tag such as "de" or "sv-SE".
+func newCollator(locale string) (*collate.Collator, error) {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return nil, err
+	}
+	return collate.New(tag, collate.IgnoreCase), nil
+}
+
+// entrySortText is the text an entry is collated by: its File A content, or File B for NEW blocks.
+func entrySortText(e DiffEntry) string {
+	if e.BlockA != nil {
+		return strings.TrimSpace(e.BlockA.OriginalText)
+	}
+	if e.BlockB != nil {
+		return strings.TrimSpace(e.BlockB.OriginalText)
+	}
+	return ""
+}
+
+// sortEntriesByCollation stably sorts entries by content in collator order.
+func sortEntriesByCollation(entries []DiffEntry, c *collate.Collator) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return c.CompareString(entrySortText(entries[i]), entrySortText(entries[j])) < 0
+	})
+}
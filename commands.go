@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// StatsOnly prints the --stats summary without the report (the stats
+// subcommand).
+var StatsOnly bool
+
+// subcommand is a command of the CLI, "go-semantic-diff <name> ...". Commands
+// that diff two files rewrite their arguments into the options of the default
+// command, so every diff option works with them.
+type subcommand struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) int // Nil for the commands handled by dispatchSubcommand
+}
+
+var subcommands = []subcommand{
+	{"diff", "diff [options] <fileA> <fileB>", "Diff two files (the default command)", nil},
+	{"focus", "focus <n,m> [options] <fileA> <fileB>", "Report the fate of File A lines n to m", nil},
+	{"stats", "stats [options] <fileA> <fileB>", "Print only the statistics summary of a diff", nil},
+	{"stats report", "stats report [file]", "Summarize the runs recorded with --usage-stats", runStatsReport},
+	{"query", "query [options] <session-file>", "Print a view of a result saved with --save-session", runQuery},
+	{"apply", "apply [--output file] <session-file> <file>", "Rebuild File B of a saved session by applying its changes to File A", runApply},
+	{"match", "match [options] <file> <candidate>...", "Rank candidate files (or quoted glob patterns) by similarity to a file", nil},
+	{"dirs", "dirs [--resume file] [options] <dirA> <dirB>", "Diff every file of a directory tree against the same path in another", nil},
+	{"bench", "bench [--paragraphs N] [--moves N] [--rewrites N] [--inserts N] [--deletes N] [options]", "Time and score the diff on synthetic documents with known edits", runBench},
+	{"serve", "serve [--grpc] [--listen addr] [--max-body-size size] [--timeout duration]", "Serve diffs over HTTP or gRPC", runServe},
+	{"help", "help", "List the commands", nil},
+}
+
+// dispatchSubcommand runs the subcommand named by the first arguments, if it
+// is one that does not diff, and reports its exit code. The diffing commands
+// rewrite os.Args for the flags of the default command and return false, as
+// does a command line without a subcommand.
+func dispatchSubcommand() (int, bool) {
+	if len(os.Args) < 2 {
+		return 0, false
+	}
+	args := os.Args[2:]
+	switch name := os.Args[1]; name {
+	case "diff":
+		os.Args = append(os.Args[:1], args...)
+		return 0, false
+	case "focus":
+		if len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "Usage: go-semantic-diff focus <n,m> [options] <fileA> <fileB>")
+			return ExitTrouble, true
+		}
+		os.Args = append([]string{os.Args[0], "--focus", args[0]}, args[1:]...)
+		return 0, false
+	case "match":
+		MatchMode = true
+		os.Args = append(os.Args[:1], args...)
+		return 0, false
+	case "dirs":
+		DirsMode = true
+		os.Args = append(os.Args[:1], args...)
+		return 0, false
+	case "help":
+		printSubcommands()
+		return ExitIdentical, true
+	case "stats":
+		if len(args) > 0 && args[0] == "report" {
+			return runStatsReport(args[1:]), true
+		}
+		StatsOnly = true
+		os.Args = append([]string{os.Args[0], "--stats"}, args...)
+		return 0, false
+	default:
+		for _, c := range subcommands {
+			if c.name == name && c.run != nil {
+				return c.run(args), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// printSubcommands lists the subcommands on stderr.
+func printSubcommands() {
+	fmt.Fprintln(os.Stderr, "Commands (without one, go-semantic-diff diffs <fileA> <fileB>):")
+	for _, c := range subcommands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n      go-semantic-diff %s\n", c.name, c.summary, c.usage)
+	}
+	fmt.Fprintln(os.Stderr, "Run go-semantic-diff --help for the diff options; a file named like a command can be given as ./name.")
+}
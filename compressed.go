@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressionExtensions are stripped from input names before their type is
+// judged by extension, so "page.html.gz" is an HTML page.
+var compressionExtensions = []string{".gz", ".gzip", ".bz2", ".zst", ".zstd"}
+
+// compressionOf names the compression of an input by its leading bytes, or
+// returns "" for uncompressed input.
+func compressionOf(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return "gzip"
+	case bytes.HasPrefix(head, []byte("BZh")):
+		return "bzip2"
+	case bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return "zstd"
+	}
+	return ""
+}
+
+// decompressReader returns a reader of the decompressed content of a gzip,
+// bzip2 or zstd stream, detected by its magic bytes, or of r itself.
+func decompressReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(4)
+	switch compressionOf(head) {
+	case "gzip":
+		return gzip.NewReader(br)
+	case "bzip2":
+		return io.NopCloser(bzip2.NewReader(br)), nil
+	case "zstd":
+		d, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+	return io.NopCloser(br), nil
+}
+
+// decompressInput returns the decompressed content of a compressed input, or
+// the input itself.
+func decompressInput(data []byte) ([]byte, error) {
+	if compressionOf(data) == "" {
+		return data, nil
+	}
+	rc, err := decompressReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// openInput opens a local input for streaming, decompressing it if needed.
+func openInput(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := decompressReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{rc, closers{rc, f}}, nil
+}
+
+// closers closes each of its members, returning the first error.
+type closers []io.Closer
+
+func (cs closers) Close() error {
+	var first error
+	for _, c := range cs {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AmbiguityMargin: a semantic match whose runner-up scored within this margin is ambiguous.
+const AmbiguityMargin = 0.05
+
+// DiffConfidence holds self-assessment indicators for a diff result.
+type DiffConfidence struct {
+	ExactCoverage          float64 `json:"exact_coverage"`           // Fraction of non-blank lines (A+B) inside exact matches
+	SemanticMatches        int     `json:"semantic_matches"`         // Pairs found by similarity rather than exact lines
+	MeanSemanticSimilarity float32 `json:"mean_semantic_similarity"` // Mean similarity of those pairs
+	AmbiguousPairings      int     `json:"ambiguous_pairings"`       // Semantic pairs whose runner-up was within AmbiguityMargin
+	Level                  string  `json:"level"`                    // "high", "medium" or "low"
+}
+
+func countNonBlankLines(content string) int {
+	n := 0
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// computeDiffConfidence derives confidence indicators from a diff of rawContentA and rawContentB.
+func computeDiffConfidence(diffs []DiffEntry, rawContentA, rawContentB string, threshold float64) DiffConfidence {
+	var conf DiffConfidence
+	exactLines := 0
+	var simSum float32
+	for _, e := range diffs {
+		if e.BlockA == nil || e.BlockB == nil {
+			continue
+		}
+		if e.Similarity == 0 {
+			exactLines += countNonBlankLines(e.BlockA.OriginalText) + countNonBlankLines(e.BlockB.OriginalText)
+			continue
+		}
+		conf.SemanticMatches++
+		simSum += e.Similarity
+		if e.RunnerUpSimilarity > 0 && e.Similarity-e.RunnerUpSimilarity < AmbiguityMargin {
+			conf.AmbiguousPairings++
+		}
+	}
+	if total := countNonBlankLines(rawContentA) + countNonBlankLines(rawContentB); total > 0 {
+		conf.ExactCoverage = float64(exactLines) / float64(total)
+	}
+	if conf.SemanticMatches > 0 {
+		conf.MeanSemanticSimilarity = simSum / float32(conf.SemanticMatches)
+	}
+
+	switch {
+	case conf.SemanticMatches > 0 && float64(conf.AmbiguousPairings) > 0.25*float64(conf.SemanticMatches),
+		conf.SemanticMatches > 0 && float64(conf.MeanSemanticSimilarity) < threshold+0.05,
+		conf.SemanticMatches == 0 && conf.ExactCoverage < 0.1:
+		conf.Level = "low"
+	case conf.AmbiguousPairings == 0 && (conf.ExactCoverage >= 0.5 || conf.MeanSemanticSimilarity >= 0.8):
+		conf.Level = "high"
+	default:
+		conf.Level = "medium"
+	}
+	return conf
+}
+
+func printDiffConfidence(conf DiffConfidence) {
+	fmt.Printf("\n# DIFF CONFIDENCE: %s\n", strings.ToUpper(conf.Level))
+	fmt.Printf("  Lines covered by exact matches: %.1f%%\n", 100*conf.ExactCoverage)
+	if conf.SemanticMatches > 0 {
+		fmt.Printf("  Semantic matches: %d (mean similarity %.2f)\n", conf.SemanticMatches, conf.MeanSemanticSimilarity)
+		fmt.Printf("  Ambiguous pairings (runner-up within %.2f): %d\n", AmbiguityMargin, conf.AmbiguousPairings)
+	} else {
+		fmt.Println("  Semantic matches: 0")
+	}
+	if conf.Level == "low" {
+		fmt.Println("  Results for this pair are likely unreliable; consider --dump-matrix to inspect scores.")
+	}
+}
@@ -7,45 +7,68 @@ import (
 	"strings"
 )
 
+// BlockLevel is the structural level of a block. Diff entries are paragraph
+// blocks; sections and sentences are their parents and children.
+type BlockLevel int
+
+const (
+	ParagraphLevel BlockLevel = iota
+	SectionLevel
+	SentenceLevel
+)
+
 type ContentBlock struct {
-	ID             int
-	OriginalText   string
-	NormalizedText string
-	Checksum       string
-	Embedding      []float32
-	LineStart      int
-	LineEnd        int
-	FileOrigin     string
-	SourceLineRefs []LineInfo
+	ID             int        `json:"id"`
+	OriginalText   string     `json:"original_text"`
+	NormalizedText string     `json:"normalized_text"`
+	Checksum       string     `json:"checksum"`
+	Embedding      []float32  `json:"embedding,omitempty"`
+	LineStart      int        `json:"line_start"`
+	LineEnd        int        `json:"line_end"`
+	FileOrigin     string     `json:"file_origin"`
+	SourceLineRefs []LineInfo `json:"source_lines,omitempty"`
+	Level          BlockLevel `json:"level"`
+	// Parent is the enclosing block: a paragraph's section in --hierarchical mode,
+	// a sentence's paragraph. It is nil when the structure is unknown. JSON leaves
+	// it out, since it would repeat a whole section for each of its blocks.
+	Parent *ContentBlock `json:"-"`
+	Title  string        `json:"title,omitempty"` // Heading of a section block
 }
 
 type LineInfo struct {
-	OriginalText    string
-	TrimmedText     string
-	Checksum        string
-	OriginalLineNum int
-	FileOrigin      string
-	IsPartOfMega    bool
-	MegaBlockRefID  int
+	OriginalText    string `json:"original_text"`
+	TrimmedText     string `json:"trimmed_text"`
+	Checksum        string `json:"checksum"`
+	OriginalLineNum int    `json:"line"`
+	FileOrigin      string `json:"file_origin"`
+	IsPartOfMega    bool   `json:"part_of_megablock,omitempty"`
+	MegaBlockRefID  int    `json:"megablock_id,omitempty"`
 }
 
 var spaceNormalizerContentBlock = regexp.MustCompile(`\s+`)
 
+// numberPatternContentBlock matches the numeric literals (figures, version
+// numbers, counters) masked by Options.IgnoreNumbers.
+var numberPatternContentBlock = regexp.MustCompile(`\d+(?:[.,]\d+)*`)
+
+// NormalizeTextBlock lowercases text and collapses its whitespace. The engine
+// normalizes through Options.normalize, which applies --mask and
+// --ignore-numbers first.
 func NormalizeTextBlock(text string) string {
 	text = strings.ToLower(text)
 	text = spaceNormalizerContentBlock.ReplaceAllString(text, " ")
 	return strings.TrimSpace(text)
 }
 
-func CalculateLineChecksum(lineText string) string {
-	normalizedLine := NormalizeTextBlock(lineText)
+// CalculateLineChecksum hashes the normalized text of a line.
+func CalculateLineChecksum(normalizedLine string) string {
 	hasher := sha256.New()
 	hasher.Write([]byte(normalizedLine))
 	return hex.EncodeToString(hasher.Sum(nil))
 }
 
-func CalculateBlockChecksum(blockText string) string {
-	normalized := NormalizeTextBlock(blockText)
+// CalculateBlockChecksum hashes the normalized text of a block.
+func CalculateBlockChecksum(normalized string) string {
 	hasher := sha256.New()
 	hasher.Write([]byte(normalized))
 	return hex.EncodeToString(hasher.Sum(nil))
@@ -82,7 +105,52 @@ func StubbedGetEmbedding(text string) []float32 {
 
 var paragraphSeparatorForGapsContentBlock = regexp.MustCompile(`\n\s*\n`)
 
-func SegmentGapText(gapLines []LineInfo, fileOrigin string, startBlockID int) ([]ContentBlock, int) {
+// sentenceEndContentBlock matches a line that closes a sentence; used to pick
+// natural cut points when an oversized paragraph has to be windowed.
+var sentenceEndContentBlock = regexp.MustCompile(`[.!?;:]["')\]]*\s*$`)
+
+// newParagraphBlock builds a gap ContentBlock from already-trimmed text and the lines it spans.
+func newParagraphBlock(id int, text string, fileOrigin string, lines []LineInfo, opts Options) ContentBlock {
+	normalized := opts.normalize(text)
+	return ContentBlock{
+		ID:             id,
+		OriginalText:   text,
+		NormalizedText: normalized,
+		Checksum:       CalculateBlockChecksum(normalized),
+		Embedding:      StubbedGetEmbedding(normalized),
+		LineStart:      lines[0].OriginalLineNum,
+		LineEnd:        lines[len(lines)-1].OriginalLineNum,
+		FileOrigin:     fileOrigin,
+		SourceLineRefs: lines, // Store the actual LineInfo objects
+	}
+}
+
+// splitOversizedParagraph breaks a paragraph of more than maxLines lines into
+// windows of at most maxLines lines. Within the second half of each window it
+// prefers to cut after a line that ends a sentence, so windows stay readable.
+func splitOversizedParagraph(paraLines []LineInfo, maxLines int) [][]LineInfo {
+	var windows [][]LineInfo
+	for len(paraLines) > maxLines {
+		cut := maxLines
+		for k := maxLines; k > maxLines/2; k-- {
+			if sentenceEndContentBlock.MatchString(paraLines[k-1].OriginalText) {
+				cut = k
+				break
+			}
+		}
+		windows = append(windows, paraLines[:cut])
+		paraLines = paraLines[cut:]
+	}
+	if len(paraLines) > 0 {
+		windows = append(windows, paraLines)
+	}
+	return windows
+}
+
+// SegmentGapText splits gap lines into paragraph blocks on blank lines. Paragraphs
+// longer than opts.MaxBlockLines (when > 0) fall back to sentence-aware line windows,
+// so documents without blank lines don't collapse into a single block.
+func SegmentGapText(gapLines []LineInfo, fileOrigin string, startBlockID int, opts Options) ([]ContentBlock, int) {
 	if len(gapLines) == 0 {
 		return []ContentBlock{}, startBlockID
 	}
@@ -146,20 +214,26 @@ func SegmentGapText(gapLines []LineInfo, fileOrigin string, startBlockID int) ([
 			continue
 		}
 
-		normalized := NormalizeTextBlock(trimmedPara)
-
-		block := ContentBlock{
-			ID:             blockIDCounter,
-			OriginalText:   trimmedPara,
-			NormalizedText: normalized,
-			Checksum:       CalculateBlockChecksum(trimmedPara),
-			Embedding:      StubbedGetEmbedding(normalized),
-			LineStart:      currentParaLines[0].OriginalLineNum,
-			LineEnd:        currentParaLines[len(currentParaLines)-1].OriginalLineNum,
-			FileOrigin:     fileOrigin,
-			SourceLineRefs: currentParaLines, // Store the actual LineInfo objects
+		if opts.MaxBlockLines > 0 && len(currentParaLines) > opts.MaxBlockLines {
+			for _, window := range splitOversizedParagraph(currentParaLines, opts.MaxBlockLines) {
+				var windowText strings.Builder
+				for k, li := range window {
+					if k > 0 {
+						windowText.WriteString("\n")
+					}
+					windowText.WriteString(li.OriginalText)
+				}
+				trimmedWindow := strings.TrimSpace(windowText.String())
+				if trimmedWindow == "" {
+					continue
+				}
+				finalBlocks = append(finalBlocks, newParagraphBlock(blockIDCounter, trimmedWindow, fileOrigin, window, opts))
+				blockIDCounter++
+			}
+			continue
 		}
-		finalBlocks = append(finalBlocks, block)
+
+		finalBlocks = append(finalBlocks, newParagraphBlock(blockIDCounter, trimmedPara, fileOrigin, currentParaLines, opts))
 		blockIDCounter++
 	}
 	return finalBlocks, blockIDCounter
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ContextLines is how many surrounding lines the detailed NEW, DELETED and
+// CHANGED entries of the text report show before and after their blocks
+// (-C, --context).
+var ContextLines int
+
+// contextFileLines splits a file into lines for context output, or returns nil
+// when no context was requested.
+func contextFileLines(rawContent string) []string {
+	if ContextLines <= 0 || rawContent == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(rawContent, "\r\n", "\n"), "\n"), "\n")
+}
+
+// printContextLines prints lines from..to (1-based, clipped to the file) as
+// context, marked like unchanged content.
+func printContextLines(lines []string, from, to int) {
+	for n := max(from, 1); n <= min(to, len(lines)); n++ {
+		fmt.Println(strings.TrimRight(fmt.Sprintf("    = L%d | %s", n, bidiIsolate(lines[n-1])), " "))
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CSVKeyColumns names the columns identifying a row in --mode csv (--csv-key);
+// without them rows are paired by content. CSVDelimiter is the field separator
+// (--csv-delimiter); empty means tab for .tsv and .tab files, else comma.
+var CSVKeyColumns string
+var CSVDelimiter string
+
+// csvTable is a parsed CSV file: a header row and records with their lines.
+type csvTable struct {
+	Header []string
+	Rows   [][]string
+	Lines  []int // Line of each row in the file
+}
+
+// CSVCellChange is a changed cell of a modified row.
+type CSVCellChange struct {
+	Column   string
+	Old, New string
+}
+
+// CSVRowChange is a row that was added, deleted, moved or changed. RowA is -1
+// for a NEW row and RowB for a DELETED one.
+type CSVRowChange struct {
+	Type       DiffType
+	RowA, RowB int // Row indices in the tables
+	Key        string
+	Cells      []CSVCellChange
+	Similarity float32
+}
+
+// csvDelimiter returns the separator for a file.
+func csvDelimiter(path string) (rune, error) {
+	switch CSVDelimiter {
+	case "":
+		if ext := strings.ToLower(filepath.Ext(inputName(path))); ext == ".tsv" || ext == ".tab" {
+			return '\t', nil
+		}
+		return ',', nil
+	case `\t`, "tab":
+		return '\t', nil
+	}
+	if r := []rune(CSVDelimiter); len(r) == 1 {
+		return r[0], nil
+	}
+	return 0, fmt.Errorf("--csv-delimiter must be one character or \\t, got %q", CSVDelimiter)
+}
+
+// parseCSVTable reads a CSV file whose first row is the header.
+func parseCSVTable(content string, delimiter rune) (*csvTable, error) {
+	r := csv.NewReader(strings.NewReader(content))
+	r.Comma = delimiter
+	r.FieldsPerRecord = -1
+	t := &csvTable{}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if t.Header == nil {
+			t.Header = record
+			continue
+		}
+		line, _ := r.FieldPos(0)
+		t.Rows = append(t.Rows, record)
+		t.Lines = append(t.Lines, line)
+	}
+	if t.Header == nil {
+		return nil, fmt.Errorf("no header row")
+	}
+	return t, nil
+}
+
+// column returns the index of a header name, or -1.
+func (t *csvTable) column(name string) int {
+	for k, h := range t.Header {
+		if h == name {
+			return k
+		}
+	}
+	return -1
+}
+
+// cell returns a row's value in a column, or "" for a short row.
+func (t *csvTable) cell(row, col int) string {
+	if col < 0 || col >= len(t.Rows[row]) {
+		return ""
+	}
+	return t.Rows[row][col]
+}
+
+// diffCSVTables pairs the rows of two tables, by the key columns when given
+// and otherwise by identical content first and then by similarity of the
+// common columns. Paired rows outside the longest run in the same order have
+// moved. It also returns the columns only in A and only in B.
+func diffCSVTables(a, b *csvTable, keyColumns []string, opts Options) (changes []CSVRowChange, removedColumns, addedColumns []string, err error) {
+	var common [][2]int // Column index in A and B, in A order
+	for i, h := range a.Header {
+		if j := b.column(h); j >= 0 {
+			common = append(common, [2]int{i, j})
+		} else {
+			removedColumns = append(removedColumns, h)
+		}
+	}
+	for _, h := range b.Header {
+		if a.column(h) < 0 {
+			addedColumns = append(addedColumns, h)
+		}
+	}
+	var keysA, keysB []int
+	for _, name := range keyColumns {
+		i, j := a.column(name), b.column(name)
+		if i < 0 || j < 0 {
+			return nil, nil, nil, fmt.Errorf("key column %q is not in both headers", name)
+		}
+		keysA, keysB = append(keysA, i), append(keysB, j)
+	}
+	rowKey := func(t *csvTable, row int, cols []int) string {
+		parts := make([]string, len(cols))
+		for k, col := range cols {
+			parts[k] = keyColumns[k] + "=" + t.cell(row, col)
+		}
+		return strings.Join(parts, ", ")
+	}
+	rowText := func(t *csvTable, row int, side int) string {
+		parts := make([]string, len(common))
+		for k, c := range common {
+			parts[k] = opts.normalize(t.cell(row, c[side]))
+		}
+		return strings.Join(parts, " | ")
+	}
+
+	partnerOfA := make(map[int]int)
+	pairedB := make(map[int]bool)
+	byContent := make(map[string][]int)
+	for j := range b.Rows {
+		key := rowText(b, j, 1)
+		if len(keyColumns) > 0 {
+			key = rowKey(b, j, keysB)
+		}
+		byContent[key] = append(byContent[key], j)
+	}
+	for i := range a.Rows {
+		key := rowText(a, i, 0)
+		if len(keyColumns) > 0 {
+			key = rowKey(a, i, keysA)
+		}
+		if queue := byContent[key]; len(queue) > 0 {
+			partnerOfA[i], pairedB[queue[0]] = queue[0], true
+			byContent[key] = queue[1:]
+		}
+	}
+	scores := make(map[[2]int]float32)
+	if len(keyColumns) == 0 {
+		type candidate struct {
+			i, j  int
+			score float32
+		}
+		var candidates []candidate
+		for i := range a.Rows {
+			if _, ok := partnerOfA[i]; ok {
+				continue
+			}
+			textA := rowText(a, i, 0)
+			for j := range b.Rows {
+				if pairedB[j] {
+					continue
+				}
+				if score := TextSimilarityNormalized(textA, rowText(b, j, 1)); float64(score) >= opts.SimilarityThreshold {
+					candidates = append(candidates, candidate{i, j, score})
+				}
+			}
+		}
+		sort.SliceStable(candidates, func(x, y int) bool { return candidates[x].score > candidates[y].score })
+		for _, c := range candidates {
+			if _, ok := partnerOfA[c.i]; !ok && !pairedB[c.j] {
+				partnerOfA[c.i], pairedB[c.j] = c.j, true
+				scores[[2]int{c.i, c.j}] = c.score
+			}
+		}
+	}
+
+	var order [][2]int
+	for i := range a.Rows {
+		if j, ok := partnerOfA[i]; ok {
+			order = append(order, [2]int{i, j})
+		}
+	}
+	inOrder := longestIncreasingB(order)
+	for i := range a.Rows {
+		j, ok := partnerOfA[i]
+		if !ok {
+			c := CSVRowChange{Type: Deleted, RowA: i, RowB: -1}
+			if len(keyColumns) > 0 {
+				c.Key = rowKey(a, i, keysA)
+			}
+			changes = append(changes, c)
+			continue
+		}
+		c := CSVRowChange{RowA: i, RowB: j, Similarity: 1}
+		if len(keyColumns) > 0 {
+			c.Key = rowKey(a, i, keysA)
+		}
+		for _, col := range common {
+			oldValue, newValue := a.cell(i, col[0]), b.cell(j, col[1])
+			if opts.normalize(oldValue) != opts.normalize(newValue) {
+				c.Cells = append(c.Cells, CSVCellChange{Column: a.Header[col[0]], Old: oldValue, New: newValue})
+			}
+		}
+		if len(c.Cells) > 0 {
+			if c.Similarity = scores[[2]int{i, j}]; c.Similarity == 0 {
+				c.Similarity = TextSimilarityNormalized(rowText(a, i, 0), rowText(b, j, 1))
+			}
+		}
+		switch {
+		case inOrder[i] && len(c.Cells) == 0:
+			continue
+		case inOrder[i]:
+			c.Type = Modified
+		case len(c.Cells) == 0:
+			c.Type = Moved
+		default:
+			c.Type = MovedModified
+		}
+		changes = append(changes, c)
+	}
+	for j := range b.Rows {
+		if !pairedB[j] {
+			c := CSVRowChange{Type: Added, RowA: -1, RowB: j}
+			if len(keyColumns) > 0 {
+				c.Key = rowKey(b, j, keysB)
+			}
+			changes = append(changes, c)
+		}
+	}
+	return changes, removedColumns, addedColumns, nil
+}
+
+// reportCSV diffs two CSV or TSV inputs row by row and prints the row and
+// cell changes, returning the process exit code.
+func reportCSV(fileAPath, fileBPath string, opts Options) int {
+	rawContentA, rawContentB, err := readInputs(fileAPath, fileBPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return ExitTrouble
+	}
+	var tables [2]*csvTable
+	for k, input := range []struct{ path, content string }{{fileAPath, rawContentA}, {fileBPath, rawContentB}} {
+		delimiter, err := csvDelimiter(input.path)
+		if err == nil {
+			tables[k], err = parseCSVTable(input.content, delimiter)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --mode csv: %s: %v\n", input.path, err)
+			return ExitTrouble
+		}
+	}
+	var keyColumns []string
+	if CSVKeyColumns != "" {
+		for _, name := range strings.Split(CSVKeyColumns, ",") {
+			keyColumns = append(keyColumns, strings.TrimSpace(name))
+		}
+	}
+	changes, removedColumns, addedColumns, err := diffCSVTables(tables[0], tables[1], keyColumns, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --csv-key: %v\n", err)
+		return ExitTrouble
+	}
+	if len(changes) == 0 && len(removedColumns) == 0 && len(addedColumns) == 0 {
+		fmt.Println("Files are semantically identical (same rows and cells).")
+		return ExitIdentical
+	}
+	printCSVChanges(tables[0], tables[1], changes, removedColumns, addedColumns)
+	return ExitDifferent
+}
+
+// printCSVChanges prints the column changes, then the row changes grouped by
+// type like the block report.
+func printCSVChanges(a, b *csvTable, changes []CSVRowChange, removedColumns, addedColumns []string) {
+	heading, item, sub := "\n# %s\n", "  ", "      "
+	if OutputFormat == "markdown" {
+		heading, item, sub = "\n## %s\n\n", "- ", "  - "
+	}
+	if len(removedColumns) > 0 || len(addedColumns) > 0 {
+		fmt.Printf(heading, "COLUMNS")
+		for _, name := range addedColumns {
+			fmt.Printf("%s+ %q\n", item, name)
+		}
+		for _, name := range removedColumns {
+			fmt.Printf("%s- %q\n", item, name)
+		}
+	}
+	row := func(t *csvTable, side string, k int, key string) string {
+		s := fmt.Sprintf("%s L%d", side, t.Lines[k])
+		if key != "" {
+			s += " (" + key + ")"
+		}
+		return s
+	}
+	values := func(t *csvTable, k int) string {
+		text := strings.Join(t.Rows[k], ", ")
+		if FullContent {
+			return text
+		}
+		return summarizedText(text, true)
+	}
+	grouped := make(map[DiffType][]CSVRowChange)
+	for _, c := range changes {
+		grouped[c.Type] = append(grouped[c.Type], c)
+	}
+	for _, t := range []DiffType{Added, Deleted, Moved, MovedModified, Modified} {
+		if len(grouped[t]) == 0 {
+			continue
+		}
+		fmt.Printf(heading, t.String()+" ROWS")
+		for _, c := range grouped[t] {
+			switch t {
+			case Added:
+				fmt.Printf("%s+ %s: %s\n", item, row(b, "B", c.RowB, c.Key), values(b, c.RowB))
+			case Deleted:
+				fmt.Printf("%s- %s: %s\n", item, row(a, "A", c.RowA, c.Key), values(a, c.RowA))
+			case Moved:
+				fmt.Printf("%s> %s -> B L%d\n", item, row(a, "A", c.RowA, c.Key), b.Lines[c.RowB])
+			default:
+				fmt.Printf("%s~ %s -> B L%d [Sim: %.2f]\n", item, row(a, "A", c.RowA, c.Key), b.Lines[c.RowB], c.Similarity)
+				for _, cell := range c.Cells {
+					fmt.Printf("%s%s: %q -> %q\n", sub, cell.Column, cell.Old, cell.New)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DaemonSocket is the Unix socket a --daemon listens on.
+var DaemonSocket string
+
+// Limits of the warm cache of a --daemon; a full cache is emptied and refilled.
+const (
+	DaemonMaxResults    = 64
+	DaemonMaxScores     = 1 << 20
+	DaemonMaxEmbeddings = 1 << 16
+)
+
+// daemonRequest is one line sent to a --daemon: the documents as text (a, b),
+// as paths (file_a, file_b) or one of each, with the POST /diff options.
+type daemonRequest struct {
+	DiffRequest
+	FileA string `json:"file_a,omitempty"`
+	FileB string `json:"file_b,omitempty"`
+}
+
+// daemonResponse is the line answering a request: the POST /diff response, or
+// the error.
+type daemonResponse struct {
+	SchemaVersion int `json:"schema_version"` // Also on error responses
+	*DiffResponse
+	Cached bool   `json:"cached,omitempty"` // Answered from the result cache
+	Error  string `json:"error,omitempty"`
+}
+
+// warmCache keeps what a --daemon has computed for later requests: the text of
+// each input file until it changes, recent results, the embeddings fetched and
+// the similarity scores of block pairs by checksum. Its methods do nothing on a
+// nil cache.
+type warmCache struct {
+	mu         sync.Mutex
+	files      map[string]warmFile
+	results    map[[sha256.Size]byte]DiffResponse
+	scores     map[warmScoreKey]float32
+	embeddings map[string][]float32 // By backend and block checksum
+}
+
+type warmFile struct {
+	modTime time.Time
+	size    int64
+	content string
+}
+
+type warmScoreKey struct {
+	metric               string
+	checksumA, checksumB string
+}
+
+// currentWarmCache is set by runDaemon.
+var currentWarmCache *warmCache
+
+func newWarmCache() *warmCache {
+	return &warmCache{
+		files:      make(map[string]warmFile),
+		results:    make(map[[sha256.Size]byte]DiffResponse),
+		scores:     make(map[warmScoreKey]float32),
+		embeddings: make(map[string][]float32),
+	}
+}
+
+// readFile reads an input like readInputFile, reusing the text read before
+// while the file's size and modification time are unchanged.
+func (c *warmCache) readFile(path string, side int) (string, error) {
+	info, err := os.Stat(path)
+	if c == nil || isObjectURI(path) || err != nil {
+		return readInputFile(path, side)
+	}
+	c.mu.Lock()
+	cached, ok := c.files[path]
+	c.mu.Unlock()
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.content, nil
+	}
+	content, err := readInputFile(path, side)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.files[path] = warmFile{modTime: info.ModTime(), size: info.Size(), content: content}
+	c.mu.Unlock()
+	return content, nil
+}
+
+// scorer returns a metric that remembers the scores of s. Corpus-dependent
+// metrics (tfidf, combined) are returned as they are.
+func (c *warmCache) scorer(s Similarity) Similarity {
+	switch s.(type) {
+	case LevenshteinSimilarity, JaccardSimilarity, ShingleSimilarity, CosineSimilarity:
+		if c != nil {
+			return warmSimilarity{cache: c, inner: s}
+		}
+	}
+	return s
+}
+
+// warmSimilarity looks scores up in a warmCache before computing them.
+type warmSimilarity struct {
+	cache *warmCache
+	inner Similarity
+}
+
+func (w warmSimilarity) Score(a, b *ContentBlock) float32 {
+	if a.Checksum == "" || b.Checksum == "" {
+		return w.inner.Score(a, b)
+	}
+	key := warmScoreKey{similarityName(w.inner), a.Checksum, b.Checksum}
+	if shingle, ok := w.inner.(ShingleSimilarity); ok {
+		key.metric = fmt.Sprintf("shingle-%d", shingle.Size)
+	}
+	w.cache.mu.Lock()
+	score, ok := w.cache.scores[key]
+	w.cache.mu.Unlock()
+	if ok {
+		return score
+	}
+	score = w.inner.Score(a, b)
+	w.cache.mu.Lock()
+	if len(w.cache.scores) >= DaemonMaxScores {
+		w.cache.scores = make(map[warmScoreKey]float32)
+	}
+	w.cache.scores[key] = score
+	w.cache.mu.Unlock()
+	return score
+}
+
+// embeddingsOf returns the cached embeddings of blocks by checksum.
+func (c *warmCache) embeddingsOf(backend string, blocks []*ContentBlock) map[string][]float32 {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	found := make(map[string][]float32)
+	for _, cb := range blocks {
+		if embedding, ok := c.embeddings[backend+"\x00"+cb.Checksum]; ok {
+			found[cb.Checksum] = embedding
+		}
+	}
+	return found
+}
+
+// keepEmbeddings caches the embeddings of blocks.
+func (c *warmCache) keepEmbeddings(backend string, blocks []*ContentBlock) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.embeddings)+len(blocks) > DaemonMaxEmbeddings {
+		c.embeddings = make(map[string][]float32)
+	}
+	for _, cb := range blocks {
+		c.embeddings[backend+"\x00"+cb.Checksum] = cb.Embedding
+	}
+}
+
+// result returns a cached response.
+func (c *warmCache) result(key [sha256.Size]byte) (DiffResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resp, ok := c.results[key]
+	return resp, ok
+}
+
+func (c *warmCache) keepResult(key [sha256.Size]byte, resp DiffResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.results) >= DaemonMaxResults {
+		c.results = make(map[[sha256.Size]byte]DiffResponse)
+	}
+	c.results[key] = resp
+}
+
+// runDaemon serves diff requests on a Unix socket until interrupted, one JSON
+// request per line, each answered by one JSON line. Requests are diffed one at
+// a time, with opts and the other command-line settings as defaults.
+func runDaemon(socket string, opts Options) int {
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		fmt.Fprintf(os.Stderr, "Error: --daemon: a daemon is already listening on %s\n", socket)
+		return ExitTrouble
+	}
+	os.Remove(socket) // Left behind by a daemon that did not exit cleanly
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --daemon: %v\n", err)
+		return ExitTrouble
+	}
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupted
+		listener.Close() // Also removes the socket file
+	}()
+
+	currentWarmCache = newWarmCache()
+	var diffing sync.Mutex // Requests share the warm cache
+	fmt.Fprintf(os.Stderr, "Listening on %s\n", socket)
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return ExitIdentical
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --daemon: %v\n", err)
+			return ExitTrouble
+		}
+		go func() {
+			defer conn.Close()
+			scanner := bufio.NewScanner(conn)
+			scanner.Buffer(nil, 1<<30)
+			enc := json.NewEncoder(conn)
+			for scanner.Scan() {
+				diffing.Lock()
+				resp := handleDaemonRequest(scanner.Bytes(), opts)
+				diffing.Unlock()
+				resp.SchemaVersion = SchemaVersion
+				if enc.Encode(resp) != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// handleDaemonRequest answers one request line.
+func handleDaemonRequest(line []byte, defaults Options) daemonResponse {
+	var req daemonRequest
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		return daemonResponse{Error: "invalid request: " + err.Error()}
+	}
+	opts, err := req.Options.applyTo(defaults)
+	if err != nil {
+		return daemonResponse{Error: err.Error()}
+	}
+	req.Options.Hierarchical = req.Options.Hierarchical || HierarchicalMode
+	for side, path := range []string{req.FileA, req.FileB} {
+		if path == "" {
+			continue
+		}
+		content, err := currentWarmCache.readFile(path, side)
+		if err != nil {
+			return daemonResponse{Error: err.Error()}
+		}
+		if side == 0 {
+			req.A = content
+		} else {
+			req.B = content
+		}
+	}
+
+	key := sha256.Sum256([]byte(fmt.Sprintf("%d %s\x00%d %s\x00%+v %t", len(req.A), req.A, len(req.B), req.B, opts, req.Options.Hierarchical)))
+	if resp, ok := currentWarmCache.result(key); ok {
+		return daemonResponse{DiffResponse: &resp, Cached: true}
+	}
+	blockStoreWarned.Store(false)
+	diffs, note, err := runDiffRequest(context.Background(), req.DiffRequest, opts, DiffTimeout)
+	if err != nil {
+		return daemonResponse{Error: fmt.Sprintf("diff did not finish: %v", err)}
+	}
+	resp := newDiffResponse(diffs, note)
+	currentWarmCache.keepResult(key, resp)
+	return daemonResponse{DiffResponse: &resp}
+}
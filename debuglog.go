@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Verbosity levels of -v, -vv and -vvv (--debug is -vvv). Debug messages are
+// printed on stderr, so they never mix with the report on stdout.
+const (
+	VerbositySummary   = 1 // Settings, block counts and stage timings
+	VerbosityDecisions = 2 // Escalations, budget shortcuts, backend fallbacks and section alignment
+	VerbosityMatches   = 3 // Every semantic match decision
+)
+
+// LogFilePath receives every debug event as a JSON line, whatever the
+// verbosity (--log-file). The events are diagnostics: their names and fields
+// may change between releases.
+var LogFilePath string
+
+// DebugEvent is a line of the --log-file.
+type DebugEvent struct {
+	Time    time.Time      `json:"time"`
+	Level   int            `json:"level"`
+	Event   string         `json:"event"`
+	Message string         `json:"message"`
+	Fields  map[string]any `json:"fields,omitempty"`
+}
+
+// debugLog writes events to the --log-file; diffs running in parallel share it.
+type debugLog struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// currentDebugLog is set by main when --log-file is given, nil otherwise.
+var currentDebugLog *debugLog
+
+func openDebugLog(path string) (*debugLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &debugLog{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+func (l *debugLog) write(event DebugEvent) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enc.Encode(event)
+}
+
+// debugEnabled reports whether an event of the given level is printed at the
+// verbosity or logged, so callers can skip building messages nobody reads.
+func debugEnabled(verbosity, level int) bool {
+	return level <= verbosity || currentDebugLog != nil
+}
+
+// debugf prints a debug message on stderr if the verbosity reaches its level,
+// and logs it with its fields as the named event to the --log-file.
+func debugf(verbosity, level int, event string, fields map[string]any, format string, args ...any) {
+	if !debugEnabled(verbosity, level) {
+		return
+	}
+	message := fmt.Sprintf(format, args...)
+	if level <= verbosity {
+		fmt.Fprintln(os.Stderr, message)
+	}
+	currentDebugLog.write(DebugEvent{Time: time.Now(), Level: level, Event: event, Message: message, Fields: fields})
+}
+
+// stageTimer reports how long each PerformDiff stage took, like the stage
+// timings of a UsageRecord.
+type stageTimer struct {
+	verbosity int
+	stage     string
+	start     time.Time
+}
+
+// mark ends the current stage, if any, and starts the named one; "" ends the last.
+func (t *stageTimer) mark(stage string) {
+	now := time.Now()
+	if t.stage != "" {
+		elapsed := now.Sub(t.start)
+		currentTimings.add(t.stage, elapsed)
+		debugf(t.verbosity, VerbositySummary, "stage", map[string]any{"stage": t.stage, "seconds": elapsed.Seconds()}, "Stage %s: %v", t.stage, elapsed.Round(time.Microsecond))
+	}
+	t.stage, t.start = stage, now
+}
@@ -2,6 +2,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"strings"
@@ -17,18 +18,37 @@ const (
 	Modified
 	Moved
 	Unchanged
+	// MovedModified is a block that moved and whose content also changed.
+	MovedModified
 )
 
+// LineDiffOp is one operation of a line-level diff; in JSON, the operation is
+// "equal", "insert" or "delete".
 type LineDiffOp struct {
-	Operation diffmatchpatch.Operation
-	Text      string
+	Operation diffmatchpatch.Operation `json:"op"`
+	Text      string                   `json:"text"`
 }
 type DiffEntry struct {
-	Type       DiffType
-	BlockA     *ContentBlock
-	BlockB     *ContentBlock
-	Similarity float32
-	LineDiffs  []LineDiffOp
+	Type       DiffType      `json:"type"`
+	BlockA     *ContentBlock `json:"a,omitempty"`
+	BlockB     *ContentBlock `json:"b,omitempty"`
+	Similarity float32       `json:"similarity,omitempty"`
+	LineDiffs  []LineDiffOp  `json:"line_diffs,omitempty"`
+	// RunnerUpSimilarity is the score of the second-best B candidate for a semantic
+	// match (0 if there was none); a value close to Similarity means the pairing was ambiguous.
+	RunnerUpSimilarity float32 `json:"runner_up_similarity,omitempty"`
+	// Annotations are findings of the --annotate-cmd checker that are new in File B.
+	Annotations []string `json:"annotations,omitempty"`
+	// Related is the block on the other side of a DELETED or NEW entry that the
+	// --rescue-threshold pass found possibly related, scoring RelatedSimilarity.
+	Related           *ContentBlock `json:"related,omitempty"`
+	RelatedSimilarity float32       `json:"related_similarity,omitempty"`
+	// NearMiss is the best File B candidate of a DELETED block when it scored less
+	// than --near-miss-margin below the threshold, with NearMissSimilarity.
+	NearMiss           *ContentBlock `json:"near_miss,omitempty"`
+	NearMissSimilarity float32       `json:"near_miss_similarity,omitempty"`
+	// Explanation records why a semantic or --pair-adjacent pair was made (--explain).
+	Explanation *MatchExplanation `json:"explanation,omitempty"`
 }
 
 // String representation for DiffType (Stable)
@@ -44,6 +64,8 @@ func (dt DiffType) String() string {
 		return "MOVED"
 	case Unchanged:
 		return "UNCHANGED_IN_PLACE"
+	case MovedModified:
+		return "MOVED_AND_CHANGED"
 	default:
 		return "UNKNOWN"
 	}
@@ -111,14 +133,14 @@ func findLISIndices(pairedMatches []DiffEntry) []int {
 }
 
 // getLinesWithInfo processes raw content into LineInfo objects (Stable)
-func getLinesWithInfo(content string, fileOrigin string) []LineInfo {
+func getLinesWithInfo(content string, fileOrigin string, opts Options) []LineInfo {
 	rawLines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
 	lineInfos := make([]LineInfo, len(rawLines))
 	for i, lineText := range rawLines {
 		lineInfos[i] = LineInfo{
 			OriginalText:    lineText,
 			TrimmedText:     strings.TrimSpace(lineText),
-			Checksum:        CalculateLineChecksum(lineText), // Assuming CalculateLineChecksum exists
+			Checksum:        CalculateLineChecksum(opts.normalize(lineText)),
 			OriginalLineNum: i + 1,
 			FileOrigin:      fileOrigin,
 			IsPartOfMega:    false,
@@ -127,119 +149,204 @@ func getLinesWithInfo(content string, fileOrigin string) []LineInfo {
 	return lineInfos
 }
 
-const MinMegaBlockLength = 3
-const MinParagraphLinesForSemanticMatch = 3 // Minimum lines for a gap paragraph to be considered for semantic matching
+const MinMegaBlockLength = 3                // Default minimum megablock length (--min-anchor-lines)
+const MinParagraphLinesForSemanticMatch = 3 // Default minimum lines for a gap paragraph to be considered for semantic matching (--min-paragraph-lines)
 
-// findNextGreedyMegaMatch finds the next longest contiguous block of identical lines.
-// Removed an empty 'if DebugMode {}' block.
-func findNextGreedyMegaMatch(linesA, linesB []LineInfo) (aStart, bStart, length int, found bool) {
+// megablockMatchLines returns the lines megablock matching runs on: all lines, or
+// with ignoreBlank a copy of the non-blank ones along with their indexes in lines.
+func megablockMatchLines(lines []LineInfo, ignoreBlank bool) ([]LineInfo, []int) {
+	if !ignoreBlank {
+		return lines, nil
+	}
+	var matchLines []LineInfo
+	var index []int
+	for i, li := range lines {
+		if li.TrimmedText != "" {
+			matchLines = append(matchLines, li)
+			index = append(index, i)
+		}
+	}
+	return matchLines, index
+}
+
+// lineIndex maps an index into megablockMatchLines' result back to the full line list.
+func lineIndex(index []int, k int) int {
+	if index == nil {
+		return k
+	}
+	return index[k]
+}
+
+// lineChecksumIndex maps each line checksum to the indices of the lines with it,
+// in order.
+func lineChecksumIndex(lines []LineInfo) map[string][]int {
+	index := make(map[string][]int)
+	for j, li := range lines {
+		index[li.Checksum] = append(index[li.Checksum], j)
+	}
+	return index
+}
+
+// findNextGreedyMegaMatch finds the next longest contiguous block of identical lines,
+// if it is at least minLength lines long. indexB is lineChecksumIndex(linesB).
+// It gives up (found is false) once ctx is done.
+func findNextGreedyMegaMatch(ctx context.Context, linesA, linesB []LineInfo, indexB map[string][]int, minLength int) (aStart, bStart, length int, found bool) {
 	bestLen := 0
 	foundAStart, foundBStart := -1, -1
 
 	for i := 0; i < len(linesA); i++ {
+		if i%64 == 0 && ctx.Err() != nil {
+			return -1, -1, 0, false
+		}
 		if linesA[i].IsPartOfMega {
 			continue
 		}
-		for j := 0; j < len(linesB); j++ {
+		for _, j := range indexB[linesA[i].Checksum] {
 			if linesB[j].IsPartOfMega {
 				continue
 			}
-			if linesA[i].Checksum == linesB[j].Checksum {
-				// Potential start of a match
-				currentLen := 0
-				for k := 0; i+k < len(linesA) && j+k < len(linesB); k++ {
-					if linesA[i+k].IsPartOfMega || linesB[j+k].IsPartOfMega {
-						break // One of the lines is already part of a megablock
-					}
-					if linesA[i+k].Checksum == linesB[j+k].Checksum {
-						currentLen++
-					} else {
-						break // Mismatch
-					}
+			// Potential start of a match
+			currentLen := 0
+			for k := 0; i+k < len(linesA) && j+k < len(linesB); k++ {
+				if linesA[i+k].IsPartOfMega || linesB[j+k].IsPartOfMega {
+					break // One of the lines is already part of a megablock
 				}
-				if currentLen > bestLen {
-					bestLen = currentLen
-					foundAStart = i
-					foundBStart = j
+				if linesA[i+k].Checksum == linesB[j+k].Checksum {
+					currentLen++
+				} else {
+					break // Mismatch
 				}
 			}
+			if currentLen > bestLen {
+				bestLen = currentLen
+				foundAStart = i
+				foundBStart = j
+			}
 		}
 	}
 
-	if bestLen >= MinMegaBlockLength {
+	if bestLen >= minLength {
 		return foundAStart, foundBStart, bestLen, true
 	}
 	return -1, -1, 0, false
 }
 
 // PerformDiff is the main diffing logic.
-// Removed several empty 'if DebugMode {}' blocks for clarity.
-// The 'NO SEMANTIC MATCH' debug prints remain correctly guarded by 'else if DebugMode'.
-func PerformDiff(rawContentA string, rawContentB string) []DiffEntry {
+// If ctx is cancelled, the remaining stages are cut short and the partial result
+// (unmatched content reported as NEW/DELETED) is returned along with ctx.Err().
+// Debug messages (-v) report each stage's counts and timing; -vvv adds every match decision.
+func PerformDiff(ctx context.Context, rawContentA string, rawContentB string, opts Options) ([]DiffEntry, error) {
+	opts = opts.begin()
+	budget := opts.Run.budget
+
 	// Stage 1: Preprocessing - Get LineInfo for both files
-	allLinesA := getLinesWithInfo(rawContentA, "A")
-	allLinesB := getLinesWithInfo(rawContentB, "B")
+	allLinesA := getLinesWithInfo(rawContentA, "A", opts)
+	allLinesB := getLinesWithInfo(rawContentB, "B", opts)
 
 	var megablockDiffs []DiffEntry
 	blockGlobalIDCounter := 0 // Used to assign unique IDs to blocks as they are created
 
+	// Stage deadlines for --budget (zero, i.e. never, when no budget is set)
+	megablockDeadline := budget.stageDeadline(BudgetShareMegablocks)
+	segmentationDeadline := budget.stageDeadline(BudgetShareSegmentation)
+	semanticFullDeadline := budget.stageDeadline(BudgetShareSemanticFull)
+	semanticDeadline := budget.stageDeadline(BudgetShareSemantic)
+
 	// Stage 2: Greedy Megablock Matching
-	for {
-		aStart, bStart, length, found := findNextGreedyMegaMatch(allLinesA, allLinesB)
+	currentUsage.mark("megablock matching")
+	defer currentUsage.mark("")
+	stages := &stageTimer{verbosity: opts.Verbosity}
+	stages.mark("megablock matching")
+	defer stages.mark("")
+	defer currentRecovery.begin()()
+	finishedMegablocks := func() []DiffEntry { return megablockDiffs }
+	currentRecovery.publish("megablock matching", finishedMegablocks)
+	megablockLines := 0
+	megablockCtx, cancelMegablocks := withStageDeadline(ctx, megablockDeadline)
+	defer cancelMegablocks()
+	matchLinesA, indexA := megablockMatchLines(allLinesA, opts.IgnoreBlankLines)
+	matchLinesB, indexB := megablockMatchLines(allLinesB, opts.IgnoreBlankLines)
+	checksumsB := lineChecksumIndex(matchLinesB)
+	for !opts.Pipeline.SkipExactMatch {
+		matchStartA, matchStartB, length, found := findNextGreedyMegaMatch(megablockCtx, matchLinesA, matchLinesB, checksumsB, opts.MinAnchorLines)
 		if !found {
+			if ctx.Err() == nil && megablockCtx.Err() != nil {
+				budget.degrade("megablock matching stopped early")
+			}
 			break
 		}
+		// The megablock spans the matched lines plus, with --ignore-blank-lines, the
+		// blank lines between them, which may differ between the files.
+		aStart, aEnd := lineIndex(indexA, matchStartA), lineIndex(indexA, matchStartA+length-1)+1
+		bStart, bEnd := lineIndex(indexB, matchStartB), lineIndex(indexB, matchStartB+length-1)+1
 
 		// Create ContentBlocks for the megamatch
 		var textAblockLines []string
-		for k := 0; k < length; k++ {
-			textAblockLines = append(textAblockLines, allLinesA[aStart+k].OriginalText)
+		for k := aStart; k < aEnd; k++ {
+			textAblockLines = append(textAblockLines, allLinesA[k].OriginalText)
 		}
 		blockAText := strings.Join(textAblockLines, "\n")
+		normalizedA := opts.normalize(blockAText)
 		cbA := ContentBlock{
 			ID:             blockGlobalIDCounter,
 			OriginalText:   blockAText,
-			NormalizedText: NormalizeTextBlock(blockAText),
-			Checksum:       CalculateBlockChecksum(blockAText),
-			Embedding:      StubbedGetEmbedding(NormalizeTextBlock(blockAText)),
+			NormalizedText: normalizedA,
+			Checksum:       CalculateBlockChecksum(normalizedA),
+			Embedding:      StubbedGetEmbedding(normalizedA),
 			LineStart:      allLinesA[aStart].OriginalLineNum,
-			LineEnd:        allLinesA[aStart+length-1].OriginalLineNum,
+			LineEnd:        allLinesA[aEnd-1].OriginalLineNum,
 			FileOrigin:     "A",
-			SourceLineRefs: allLinesA[aStart : aStart+length], // Store involved lines
+			SourceLineRefs: allLinesA[aStart:aEnd], // Store involved lines
 		}
 		blockGlobalIDCounter++
 
 		var textBblockLines []string
-		for k := 0; k < length; k++ {
-			textBblockLines = append(textBblockLines, allLinesB[bStart+k].OriginalText)
+		for k := bStart; k < bEnd; k++ {
+			textBblockLines = append(textBblockLines, allLinesB[k].OriginalText)
 		}
 		blockBText := strings.Join(textBblockLines, "\n")
+		normalizedB := opts.normalize(blockBText)
 		cbB := ContentBlock{
 			ID:             blockGlobalIDCounter,
 			OriginalText:   blockBText,
-			NormalizedText: NormalizeTextBlock(blockBText),
-			Checksum:       CalculateBlockChecksum(blockBText),
-			Embedding:      StubbedGetEmbedding(NormalizeTextBlock(blockBText)),
+			NormalizedText: normalizedB,
+			Checksum:       CalculateBlockChecksum(normalizedB),
+			Embedding:      StubbedGetEmbedding(normalizedB),
 			LineStart:      allLinesB[bStart].OriginalLineNum,
-			LineEnd:        allLinesB[bStart+length-1].OriginalLineNum,
+			LineEnd:        allLinesB[bEnd-1].OriginalLineNum,
 			FileOrigin:     "B",
-			SourceLineRefs: allLinesB[bStart : bStart+length], // Store involved lines
+			SourceLineRefs: allLinesB[bStart:bEnd], // Store involved lines
 		}
 		blockGlobalIDCounter++
 
 		megablockDiffs = append(megablockDiffs, DiffEntry{Type: Unchanged, BlockA: &cbA, BlockB: &cbB})
+		megablockLines += length
+		currentProgress.update("megablock matching", ProgressStartMegablocks, ProgressStartSegmentation, megablockLines, min(len(allLinesA), len(allLinesB)))
 
 		// Mark lines as consumed by megablocks
 		for k := 0; k < length; k++ {
-			allLinesA[aStart+k].IsPartOfMega = true
-			allLinesB[bStart+k].IsPartOfMega = true
+			matchLinesA[matchStartA+k].IsPartOfMega = true
+			matchLinesB[matchStartB+k].IsPartOfMega = true
+		}
+		for k := aStart; k < aEnd; k++ {
+			allLinesA[k].IsPartOfMega = true
+		}
+		for k := bStart; k < bEnd; k++ {
+			allLinesB[k].IsPartOfMega = true
 		}
 	}
-	if DebugMode {
-		fmt.Printf("Megablocks found: %d\n", len(megablockDiffs))
-	}
+	debugf(opts.Verbosity, VerbositySummary, "megablocks", map[string]any{"count": len(megablockDiffs)}, "Megablocks found: %d", len(megablockDiffs))
 
 	// Stage 3: Segment Gaps into Paragraphs
+	currentUsage.mark("segmentation")
+	stages.mark("segmentation")
+	currentRecovery.publish("segmentation", finishedMegablocks)
+	currentProgress.update("segmentation", ProgressStartSegmentation, ProgressStartSemantic, 0, 1)
+	segmentOpts := opts
+	if opts.MaxBlockLines > 0 && pastDeadline(segmentationDeadline) {
+		budget.degrade("oversized paragraphs not windowed")
+		segmentOpts.MaxBlockLines = 0 // Coarser blocks mean fewer pairs to score
+	}
 	var gapBlocksA, gapBlocksB []ContentBlock
 	currentGapA := []LineInfo{}
 	for i := 0; i < len(allLinesA); i++ {
@@ -248,7 +355,7 @@ func PerformDiff(rawContentA string, rawContentB string) []DiffEntry {
 		} else {
 			if len(currentGapA) > 0 {
 				var segmented []ContentBlock
-				segmented, blockGlobalIDCounter = SegmentGapText(currentGapA, "A", blockGlobalIDCounter)
+				segmented, blockGlobalIDCounter = SegmentGapText(currentGapA, "A", blockGlobalIDCounter, segmentOpts)
 				gapBlocksA = append(gapBlocksA, segmented...)
 				currentGapA = []LineInfo{}
 			}
@@ -256,7 +363,7 @@ func PerformDiff(rawContentA string, rawContentB string) []DiffEntry {
 	}
 	if len(currentGapA) > 0 { // Process any trailing gap
 		var segmented []ContentBlock
-		segmented, blockGlobalIDCounter = SegmentGapText(currentGapA, "A", blockGlobalIDCounter)
+		segmented, blockGlobalIDCounter = SegmentGapText(currentGapA, "A", blockGlobalIDCounter, segmentOpts)
 		gapBlocksA = append(gapBlocksA, segmented...)
 	}
 
@@ -267,7 +374,7 @@ func PerformDiff(rawContentA string, rawContentB string) []DiffEntry {
 		} else {
 			if len(currentGapB) > 0 {
 				var segmented []ContentBlock
-				segmented, blockGlobalIDCounter = SegmentGapText(currentGapB, "B", blockGlobalIDCounter)
+				segmented, blockGlobalIDCounter = SegmentGapText(currentGapB, "B", blockGlobalIDCounter, segmentOpts)
 				gapBlocksB = append(gapBlocksB, segmented...)
 				currentGapB = []LineInfo{}
 			}
@@ -275,84 +382,183 @@ func PerformDiff(rawContentA string, rawContentB string) []DiffEntry {
 	}
 	if len(currentGapB) > 0 { // Process any trailing gap
 		var segmented []ContentBlock
-		segmented, blockGlobalIDCounter = SegmentGapText(currentGapB, "B", blockGlobalIDCounter)
+		segmented, blockGlobalIDCounter = SegmentGapText(currentGapB, "B", blockGlobalIDCounter, segmentOpts)
 		gapBlocksB = append(gapBlocksB, segmented...)
 	}
 
-	if DebugMode {
-		fmt.Printf("Gap blocks in A: %d, Gap blocks in B: %d\n", len(gapBlocksA), len(gapBlocksB))
-	}
+	debugf(opts.Verbosity, VerbositySummary, "gap_blocks", map[string]any{"a": len(gapBlocksA), "b": len(gapBlocksB)}, "Gap blocks in A: %d, Gap blocks in B: %d", len(gapBlocksA), len(gapBlocksB))
 
 	// Stage 4: Semantic Matching of Gap Paragraphs
+	currentUsage.mark("semantic matching")
+	stages.mark("semantic matching")
+	useBackendEmbeddings := !opts.Pipeline.SkipSemanticMatch && similarityUsesEmbeddings(opts) && applyBackendEmbeddings(gapBlocksA, gapBlocksB, opts)
+	scorer := currentWarmCache.scorer(selectSimilarity(useBackendEmbeddings, gapBlocksA, gapBlocksB, opts))
+	if !useBackendEmbeddings {
+		opts.Run.Embedding.Backend = similarityName(scorer)
+	}
+	if opts.SimilarityMatrix {
+		opts.Run.Matrix = computeSimilarityMatrix(gapBlocksA, gapBlocksB, scorer, opts.SimilarityThreshold)
+	}
 	var semanticGapMatches []DiffEntry
+	finishedMatches := func() []DiffEntry { return append(append([]DiffEntry(nil), megablockDiffs...), semanticGapMatches...) }
+	currentRecovery.publish("semantic matching", finishedMatches)
+	nearMisses := make(map[int]DiffEntry)    // Gap A block ID -> its best candidate below the threshold
 	processedGapA_byID := make(map[int]bool) // Tracks Gap A blocks already matched
 	processedGapB_byID := make(map[int]bool) // Tracks Gap B blocks already matched
-	dmp := diffmatchpatch.New()
+	lsh := newLSHIndex(gapBlocksA, gapBlocksB, opts.NoLSH)
+	scoredPairs := 0
 
 	// Sort gapBlocksA by ID to ensure deterministic processing if needed, though order of finding best match doesn't strictly require it.
 	sort.Slice(gapBlocksA, func(i, j int) bool { return gapBlocksA[i].ID < gapBlocksA[j].ID })
 
 	for i := range gapBlocksA {
 		gapA_ptr := &gapBlocksA[i]
+		currentProgress.update("semantic matching", ProgressStartSemantic, 100, i, len(gapBlocksA))
 		// Skip very short paragraphs for semantic matching to reduce noise (already part of logic)
 		numLinesInGapA := strings.Count(gapA_ptr.OriginalText, "\n") + 1
-		if numLinesInGapA < MinParagraphLinesForSemanticMatch {
+		if numLinesInGapA < opts.MinParagraphLines {
 			continue
 		}
+		if ctx.Err() != nil || opts.Pipeline.SkipSemanticMatch {
+			break
+		}
+		if pastDeadline(semanticDeadline) {
+			budget.degrade("semantic matching stopped early, remaining paragraphs reported as NEW/DELETED")
+			break
+		}
+		candidatesFrom, candidatesTo := 0, len(gapBlocksB)
+		if pastDeadline(semanticFullDeadline) {
+			budget.degrade(fmt.Sprintf("semantic matching limited to %d nearby candidates", BudgetPrunedCandidates))
+			candidatesFrom, candidatesTo = prunedCandidateRange(i, len(gapBlocksA), len(gapBlocksB))
+		}
 
 		bestMatchGapB_ptr := (*ContentBlock)(nil)
 		highestSimilarity := float32(-1.0)
+		runnerUpSimilarity := float32(0.0)
 
-		for j := range gapBlocksB {
+		var candidates []*ContentBlock
+		for _, j := range lsh.candidates(gapA_ptr, candidatesFrom, candidatesTo) {
 			gapB_ptr := &gapBlocksB[j]
 			if processedGapB_byID[gapB_ptr.ID] { // Already matched this B block
 				continue
 			}
 			numLinesInGapB := strings.Count(gapB_ptr.OriginalText, "\n") + 1
-			if numLinesInGapB < MinParagraphLinesForSemanticMatch {
+			if numLinesInGapB < opts.MinParagraphLines {
 				continue // Skip very short B paragraphs
 			}
+			candidates = append(candidates, gapB_ptr)
+		}
 
-			similarity := TextSimilarityNormalized(gapA_ptr.NormalizedText, gapB_ptr.NormalizedText)
+		scoredPairs += len(candidates)
+		// Scores are computed in parallel but reduced in candidate order, so ties
+		// resolve exactly as in a serial scan.
+		scores := scoreCandidates(gapA_ptr, candidates, scorer)
+		for k, similarity := range scores {
 			if similarity > highestSimilarity {
+				if bestMatchGapB_ptr != nil {
+					runnerUpSimilarity = highestSimilarity
+				}
 				highestSimilarity = similarity
-				bestMatchGapB_ptr = gapB_ptr
+				bestMatchGapB_ptr = candidates[k]
+			} else if similarity > runnerUpSimilarity {
+				runnerUpSimilarity = similarity
 			}
 		}
 
-		if bestMatchGapB_ptr != nil && highestSimilarity >= float32(SimilarityThreshold) {
-			entry := DiffEntry{Type: Modified, BlockA: gapA_ptr, BlockB: bestMatchGapB_ptr, Similarity: highestSimilarity}
-			// Perform line-level diff for MODIFIED blocks
-			diffsFromDMP := dmp.DiffMain(gapA_ptr.OriginalText, bestMatchGapB_ptr.OriginalText, true) // true for line mode
-			dmp.DiffCleanupSemantic(diffsFromDMP)                                                     // Optional: clean up semantic noise
-			var lineDiffs []LineDiffOp
-			for _, d := range diffsFromDMP {
-				lineDiffs = append(lineDiffs, LineDiffOp{Operation: d.Type, Text: d.Text})
+		if bestMatchGapB_ptr != nil && highestSimilarity < float32(opts.SimilarityThreshold) && opts.NearMissMargin > 0 && highestSimilarity >= float32(opts.SimilarityThreshold-opts.NearMissMargin) {
+			nearMisses[gapA_ptr.ID] = DiffEntry{NearMiss: bestMatchGapB_ptr, NearMissSimilarity: highestSimilarity}
+		}
+		if bestMatchGapB_ptr != nil && highestSimilarity >= float32(opts.SimilarityThreshold) {
+			entry := DiffEntry{Type: Modified, BlockA: gapA_ptr, BlockB: bestMatchGapB_ptr, Similarity: highestSimilarity, RunnerUpSimilarity: runnerUpSimilarity}
+			if debugEnabled(opts.Verbosity, VerbosityMatches) {
+				fields := map[string]any{"a": gapA_ptr.ID, "b": bestMatchGapB_ptr.ID, "similarity": highestSimilarity, "runner_up": runnerUpSimilarity}
+				if combined, ok := scorer.(CombinedSimilarity); ok {
+					components := combined.describe(combined.ComponentScores(gapA_ptr, bestMatchGapB_ptr))
+					fields["components"] = components
+					debugf(opts.Verbosity, VerbosityMatches, "match", fields, "  Combined match A ID %d ~ B ID %d: %.4f (%s)", gapA_ptr.ID, bestMatchGapB_ptr.ID, highestSimilarity, components)
+				} else {
+					debugf(opts.Verbosity, VerbosityMatches, "match", fields, "  Match A ID %d ~ B ID %d: %.4f", gapA_ptr.ID, bestMatchGapB_ptr.ID, highestSimilarity)
+				}
 			}
-			entry.LineDiffs = lineDiffs
+			if opts.Explain {
+				entry.Explanation = explainSemanticMatch(scorer, opts.SimilarityThreshold, gapA_ptr, bestMatchGapB_ptr, candidates, scores)
+			}
+			// Perform line-level diff for MODIFIED blocks
+			entry.LineDiffs = blockLineDiffs(gapA_ptr.OriginalText, bestMatchGapB_ptr.OriginalText)
 			semanticGapMatches = append(semanticGapMatches, entry)
 			processedGapA_byID[gapA_ptr.ID] = true
 			processedGapB_byID[bestMatchGapB_ptr.ID] = true
-		} else if DebugMode {
-			// This is the specific debug message block from user's output.
-			// It is correctly guarded by 'DebugMode'.
-			// If these messages appear without --debug, it implies the running code
-			// differs from this version in this specific 'else if' condition.
+		} else if debugEnabled(opts.Verbosity, VerbosityMatches) {
+			fields := map[string]any{"a": gapA_ptr.ID, "similarity": highestSimilarity, "threshold": opts.SimilarityThreshold}
 			if bestMatchGapB_ptr != nil {
-				fmt.Printf("  NO SEMANTIC MATCH for Gap A ID %d (Highest sim: %.4f with B ID %d, Thresh: %.2f)\n", gapA_ptr.ID, highestSimilarity, bestMatchGapB_ptr.ID, float32(SimilarityThreshold))
+				fields["b"] = bestMatchGapB_ptr.ID
+				debugf(opts.Verbosity, VerbosityMatches, "no_match", fields, "  NO SEMANTIC MATCH for Gap A ID %d (Highest sim: %.4f with B ID %d, Thresh: %.2f)", gapA_ptr.ID, highestSimilarity, bestMatchGapB_ptr.ID, float32(opts.SimilarityThreshold))
 			} else {
-				fmt.Printf("  NO SEMANTIC MATCH for Gap A ID %d (Highest sim: %.4f, No B candidate found, Thresh: %.2f)\n", gapA_ptr.ID, highestSimilarity, float32(SimilarityThreshold))
+				debugf(opts.Verbosity, VerbosityMatches, "no_match", fields, "  NO SEMANTIC MATCH for Gap A ID %d (Highest sim: %.4f, No B candidate found, Thresh: %.2f)", gapA_ptr.ID, highestSimilarity, float32(opts.SimilarityThreshold))
 			}
 		}
 	}
-	if DebugMode {
-		fmt.Printf("Semantic matches between gap blocks: %d\n", len(semanticGapMatches))
+	debugf(opts.Verbosity, VerbositySummary, "semantic_matches", map[string]any{"count": len(semanticGapMatches)}, "Semantic matches between gap blocks: %d", len(semanticGapMatches))
+	if lsh != nil {
+		debugf(opts.Verbosity, VerbositySummary, "minhash", map[string]any{"scored": scoredPairs, "pairs": len(gapBlocksA) * len(gapBlocksB)}, "MinHash pruning: scored %d of %d gap block pairs", scoredPairs, len(gapBlocksA)*len(gapBlocksB))
 	}
 
 	// Stage 5: LIS for Positional Analysis (Moved vs. Unchanged/Modified-in-place)
+	currentUsage.mark("classification")
+	stages.mark("classification")
+	currentRecovery.publish("classification", finishedMatches)
 	allPairedMatches := append([]DiffEntry{}, megablockDiffs...)
 	allPairedMatches = append(allPairedMatches, semanticGapMatches...)
 
+	finalDiffs := allPairedMatches
+	if !opts.Pipeline.SkipClassify {
+		finalDiffs = classifyPairedMatches(allPairedMatches)
+	}
+
+	// Stage 6: Identify Added/Deleted Gap Paragraphs
+	for i := range gapBlocksA {
+		if !processedGapA_byID[gapBlocksA[i].ID] { // If not part of megablock and not semantically matched
+			entry := nearMisses[gapBlocksA[i].ID]
+			entry.Type, entry.BlockA = Deleted, &gapBlocksA[i]
+			finalDiffs = append(finalDiffs, entry)
+		}
+	}
+	for i := range gapBlocksB {
+		if !processedGapB_byID[gapBlocksB[i].ID] { // If not part of megablock and not semantically matched
+			finalDiffs = append(finalDiffs, DiffEntry{Type: Added, BlockB: &gapBlocksB[i]})
+		}
+	}
+	if opts.PairAdjacent {
+		var paired int
+		finalDiffs, paired = pairAdjacentReplacements(finalDiffs, scorer, blockLineDiffs)
+		debugf(opts.Verbosity, VerbositySummary, "pair_adjacent", map[string]any{"paired": paired}, "Paired %d DELETED/NEW blocks between the same anchors as MODIFIED", paired)
+	}
+	if opts.RescueThreshold > 0 {
+		linked := linkPossiblyRelated(ctx, finalDiffs, scorer, opts.RescueThreshold)
+		debugf(opts.Verbosity, VerbositySummary, "rescue", map[string]any{"linked": linked, "threshold": opts.RescueThreshold}, "Rescue pass linked %d DELETED/NEW pairs at threshold %.2f", linked, opts.RescueThreshold)
+	}
+
+	// Stage 7: Sort finalDiffs for consistent output
+	sortDiffEntries(finalDiffs)
+
+	return finalDiffs, ctx.Err()
+}
+
+// blockLineDiffs computes the line-level diff shown for a MODIFIED pair.
+func blockLineDiffs(textA, textB string) []LineDiffOp {
+	dmp := diffmatchpatch.New()
+	diffsFromDMP := dmp.DiffMain(textA, textB, true)     // true for line mode
+	diffsFromDMP = dmp.DiffCleanupSemantic(diffsFromDMP) // Optional: clean up semantic noise
+	var lineDiffs []LineDiffOp
+	for _, d := range diffsFromDMP {
+		lineDiffs = append(lineDiffs, LineDiffOp{Operation: d.Type, Text: d.Text})
+	}
+	return lineDiffs
+}
+
+// classifyPairedMatches sorts paired entries by File A position and runs LIS on their
+// File B positions; pairs outside the LIS become Moved, the rest keep their type.
+func classifyPairedMatches(allPairedMatches []DiffEntry) []DiffEntry {
 	// Sort allPairedMatches by BlockA's start line to prepare for LIS
 	sort.Slice(allPairedMatches, func(i, j int) bool {
 		if allPairedMatches[i].BlockA.LineStart != allPairedMatches[j].BlockA.LineStart {
@@ -374,27 +580,23 @@ func PerformDiff(rawContentA string, rawContentB string) []DiffEntry {
 				// Type remains Unchanged (for megablocks) or Modified (for semantic matches)
 				finalDiffs = append(finalDiffs, matchEntry)
 			} else {
-				// Not in LIS, so it's MOVED
+				// Not in LIS, so it's MOVED, or MOVED_AND_CHANGED for a semantic match
+				// whose content differs
 				movedEntry := matchEntry
 				movedEntry.Type = Moved
+				if movedEntry.Similarity > 0 && movedEntry.Similarity < 0.9999 {
+					movedEntry.Type = MovedModified
+				}
 				finalDiffs = append(finalDiffs, movedEntry)
 			}
 		}
 	}
 
-	// Stage 6: Identify Added/Deleted Gap Paragraphs
-	for i := range gapBlocksA {
-		if !processedGapA_byID[gapBlocksA[i].ID] { // If not part of megablock and not semantically matched
-			finalDiffs = append(finalDiffs, DiffEntry{Type: Deleted, BlockA: &gapBlocksA[i]})
-		}
-	}
-	for i := range gapBlocksB {
-		if !processedGapB_byID[gapBlocksB[i].ID] { // If not part of megablock and not semantically matched
-			finalDiffs = append(finalDiffs, DiffEntry{Type: Added, BlockB: &gapBlocksB[i]})
-		}
-	}
+	return finalDiffs
+}
 
-	// Stage 7: Sort finalDiffs for consistent output
+// sortDiffEntries orders entries by type, then File A position, then File B position.
+func sortDiffEntries(finalDiffs []DiffEntry) {
 	sort.Slice(finalDiffs, func(i, j int) bool {
 		// Primary sort by DiffType
 		if finalDiffs[i].Type != finalDiffs[j].Type {
@@ -420,6 +622,67 @@ func PerformDiff(rawContentA string, rawContentB string) []DiffEntry {
 		}
 		return false // Should not happen if blocks are well-formed
 	})
+}
 
-	return finalDiffs
+const EscalationMaxBlockLines = 5    // Window size used when escalating to finer granularity
+const EscalationThresholdStep = 0.15 // How far the threshold is lowered when escalating
+const EscalationMinThreshold = 0.30  // Escalation never lowers the threshold below this
+
+// isLowInformationDiff reports whether a diff paired nothing at all, i.e. both
+// files reduced to Deleted and Added blocks only.
+func isLowInformationDiff(diffs []DiffEntry) bool {
+	hasAdded, hasDeleted := false, false
+	for _, d := range diffs {
+		switch d.Type {
+		case Added:
+			hasAdded = true
+		case Deleted:
+			hasDeleted = true
+		default:
+			return false
+		}
+	}
+	return hasAdded && hasDeleted
+}
+
+// PerformDiffWithEscalation runs PerformDiff and, if the result is low-information,
+// retries first at finer granularity and then at a lower threshold. The returned
+// note describes the escalation that produced the result ("" if none was needed).
+// Retries are skipped once ctx is done.
+func PerformDiffWithEscalation(ctx context.Context, rawContentA string, rawContentB string, opts Options) ([]DiffEntry, string, error) {
+	opts = opts.begin()
+	diffs, err := PerformDiff(ctx, rawContentA, rawContentB, opts)
+	if err != nil || !isLowInformationDiff(diffs) || opts.Run.budget.exhausted() {
+		return diffs, "", err
+	}
+
+	retryOpts := opts
+	if opts.MaxBlockLines == 0 || opts.MaxBlockLines > EscalationMaxBlockLines {
+		retryOpts.MaxBlockLines = EscalationMaxBlockLines
+		debugf(opts.Verbosity, VerbosityDecisions, "escalation", map[string]any{"max_block_lines": retryOpts.MaxBlockLines}, "Escalation: no matches found, retrying with --max-block-lines %d", retryOpts.MaxBlockLines)
+		retry, err := PerformDiff(ctx, rawContentA, rawContentB, retryOpts)
+		if err != nil {
+			return diffs, "", err // The first, complete result beats a partial retry
+		}
+		if !isLowInformationDiff(retry) {
+			return retry, fmt.Sprintf("No matches at the initial settings; re-ran with --max-block-lines %d.", retryOpts.MaxBlockLines), nil
+		}
+	}
+
+	if opts.Run.budget.exhausted() {
+		return diffs, "", nil // The budget note explains the incomplete result
+	}
+	if opts.SimilarityThreshold-EscalationThresholdStep >= EscalationMinThreshold {
+		retryOpts.SimilarityThreshold = opts.SimilarityThreshold - EscalationThresholdStep
+		debugf(opts.Verbosity, VerbosityDecisions, "escalation", map[string]any{"threshold": retryOpts.SimilarityThreshold}, "Escalation: still no matches, retrying with threshold %.2f", retryOpts.SimilarityThreshold)
+		retry, err := PerformDiff(ctx, rawContentA, rawContentB, retryOpts)
+		if err != nil {
+			return diffs, "", err
+		}
+		if !isLowInformationDiff(retry) {
+			return retry, fmt.Sprintf("No matches at the initial settings; re-ran with --max-block-lines %d and --threshold %.2f.", retryOpts.MaxBlockLines, retryOpts.SimilarityThreshold), nil
+		}
+	}
+
+	return diffs, "No matches found even after escalating granularity and threshold; the files appear unrelated.", nil
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GitDifftool takes the inputs the way git passes them to an external diff
+// tool and exits 0 when they differ, so `git difftool --trust-exit-code` only
+// stops on errors (--git-difftool). It is turned on by itself under
+// `git difftool -x`.
+var GitDifftool bool
+
+// gitDifftoolCommand reports whether the process was started by
+// `git difftool -x` or `--extcmd`, which set GIT_DIFFTOOL_EXTCMD.
+func gitDifftoolCommand() bool {
+	return os.Getenv("GIT_DIFFTOOL_EXTCMD") != ""
+}
+
+// gitDifftoolInputs returns the files to compare and the repository path they
+// are versions of. It accepts "<local> <remote>" as git difftool passes them
+// (or none, reading $LOCAL and $REMOTE) and the seven or nine arguments of
+// GIT_EXTERNAL_DIFF ("path old-file old-hex old-mode new-file new-hex new-mode
+// [new-path rename-info]").
+func gitDifftoolInputs(args []string) (fileA, fileB, name string, err error) {
+	switch len(args) {
+	case 0:
+		fileA, fileB = os.Getenv("LOCAL"), os.Getenv("REMOTE")
+		if fileA == "" || fileB == "" {
+			return "", "", "", fmt.Errorf("expected <local> <remote> or the LOCAL and REMOTE environment variables")
+		}
+	case 2:
+		fileA, fileB = args[0], args[1]
+	case 7:
+		return args[1], args[4], args[0], nil
+	case 9:
+		return args[1], args[4], args[7], nil
+	default:
+		return "", "", "", fmt.Errorf("expected <local> <remote> or the 7 or 9 arguments of GIT_EXTERNAL_DIFF, got %d arguments", len(args))
+	}
+	// MERGED is set for configured difftools and BASE for -x commands.
+	for _, v := range []string{"MERGED", "BASE"} {
+		if name = os.Getenv(v); name != "" {
+			return fileA, fileB, name, nil
+		}
+	}
+	return fileA, fileB, fileB, nil
+}
+
+// gitDifftoolPreset returns the preset for a repository path, "difftool." and
+// its extension (e.g. difftool.md), or "" if no such preset was saved.
+func gitDifftoolPreset(name string) string {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(inputName(name))), ".")
+	if ext == "" {
+		return ""
+	}
+	preset := "difftool." + ext
+	path, err := presetPath(preset)
+	if err != nil {
+		return ""
+	}
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return preset
+}
+
+// printGitDifftoolHeader names the compared path above its report, since git
+// runs the tool once per changed file and passes temporary files. Markdown
+// block reports have a title of their own.
+func printGitDifftoolHeader(name string) {
+	if OutputFormat == "markdown" && InputMode == "text" {
+		return
+	}
+	if OutputFormat == "markdown" {
+		fmt.Printf("# `%s`\n\n", name)
+		return
+	}
+	fmt.Printf("diff --semantic a/%s b/%s\n", name, name)
+}
+
+// gitDifftoolExitCode maps the diff exit code for git: differences are not a
+// failure of the tool.
+func gitDifftoolExitCode(code int) int {
+	if GitDifftool && code == ExitDifferent {
+		return ExitIdentical
+	}
+	return code
+}
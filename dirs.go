@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DirsMode diffs every file of one directory tree against the file at the same
+// relative path in another. It is set by the dirs subcommand, and when both
+// inputs are directories.
+var DirsMode bool
+
+// ResumePath records every pair a directory diff finishes, so that a run
+// interrupted overnight can be resumed without diffing them again (--resume).
+var ResumePath string
+
+// Statuses of a relative path in a directory diff.
+const (
+	PairIdentical = "identical"
+	PairChanged   = "changed"
+	PairOnlyA     = "only in A"
+	PairOnlyB     = "only in B"
+	PairFailed    = "error"
+)
+
+// dirPair is the outcome of one relative path of a directory diff. Stats is
+// set for paths diffed in both trees.
+type dirPair struct {
+	Path   string     `json:"path"`
+	Status string     `json:"status"`
+	Stats  *DiffStats `json:"stats,omitempty"`
+}
+
+// isDirectory reports whether path names a directory.
+func isDirectory(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// treeFiles returns the slash-separated paths of the regular files under root,
+// relative to it. Hidden directories such as .git are skipped.
+func treeFiles(root string) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+		return nil
+	})
+	return paths, err
+}
+
+// dirsResumeRecord is a line of the --resume file: a finished pair with the
+// checksums of its inputs and the options it was diffed with.
+type dirsResumeRecord struct {
+	SchemaVersion int    `json:"schema_version"`
+	SumA          string `json:"sum_a"`
+	SumB          string `json:"sum_b"`
+	Options       string `json:"options"`
+	dirPair
+}
+
+// dirsResume is the --resume file: the records of earlier runs, and the file
+// the pairs of this run are appended to.
+type dirsResume struct {
+	done    map[string]dirsResumeRecord
+	file    *os.File
+	options string
+}
+
+// openDirsResume reads the records of path, creating it if needed. A line
+// cut short by an interrupted run is ignored.
+func openDirsResume(path string, opts Options) (*dirsResume, error) {
+	opts.Verbosity, opts.DetailsSections, opts.FocusRange = 0, nil, FocusRange{} // Report settings only
+	r := &dirsResume{done: map[string]dirsResumeRecord{}, options: fmt.Sprintf("%+v %s", opts, SimilarityCommand)}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var rec dirsResumeRecord
+		if json.Unmarshal(scanner.Bytes(), &rec) == nil && rec.Path != "" {
+			r.done[rec.Path] = rec
+		}
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return nil, err
+		}
+	}
+	if r.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// lookup returns the recorded outcome of path if its inputs and the options
+// are unchanged since it was recorded.
+func (r *dirsResume) lookup(path, sumA, sumB string) (dirPair, bool) {
+	rec, ok := r.done[path]
+	if !ok || rec.SumA != sumA || rec.SumB != sumB || rec.Options != r.options {
+		return dirPair{}, false
+	}
+	return rec.dirPair, true
+}
+
+// record appends a finished pair and flushes it to disk.
+func (r *dirsResume) record(pair dirPair, sumA, sumB string) error {
+	line, err := json.Marshal(dirsResumeRecord{SchemaVersion: SchemaVersion, SumA: sumA, SumB: sumB, Options: r.options, dirPair: pair})
+	if err != nil {
+		return err
+	}
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return r.file.Sync()
+}
+
+func contentSum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// diffDirPair diffs the files at one relative path of both trees.
+func diffDirPair(contentA, contentB, pathB string, opts Options) (string, *DiffStats, error) {
+	if identicalInputs(contentA, contentB) {
+		stats := computeDiffStats(nil, nil)
+		return PairIdentical, &stats, nil
+	}
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if DiffTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, DiffTimeout)
+	}
+	defer cancel()
+	opts.Run = &DiffRun{}
+	diffs, _, err := runDiff(ctx, contentA, contentB, opts)
+	if err == nil {
+		err = similarityPluginErr()
+	}
+	if err != nil {
+		return PairFailed, nil, fmt.Errorf("diffing %s: %v", pathB, err)
+	}
+	stats := computeDiffStats(diffs, opts.Run)
+	if diffExitCode(diffs) == ExitIdentical {
+		return PairIdentical, &stats, nil
+	}
+	return PairChanged, &stats, nil
+}
+
+// runDirs diffs the files of dirA against those at the same relative paths in
+// dirB, and lists the paths that differ. It exits 0 if every file is in both
+// trees and unchanged, 1 otherwise, and 2 if a file could not be diffed.
+func runDirs(dirA, dirB string, opts Options) int {
+	var files [2][]string
+	for side, dir := range []string{dirA, dirB} {
+		if !isDirectory(dir) {
+			fmt.Fprintf(os.Stderr, "Error: dirs: %s is not a directory\n", dir)
+			return ExitTrouble
+		}
+		var err error
+		if files[side], err = treeFiles(dir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitTrouble
+		}
+	}
+	inA, inB := map[string]bool{}, map[string]bool{}
+	for _, path := range files[0] {
+		inA[path] = true
+	}
+	for _, path := range files[1] {
+		inB[path] = true
+	}
+	paths := append([]string{}, files[0]...)
+	for _, path := range files[1] {
+		if !inA[path] {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var resume *dirsResume
+	if ResumePath != "" {
+		var err error
+		if resume, err = openDirsResume(ResumePath, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --resume: %v\n", err)
+			return ExitTrouble
+		}
+		defer resume.file.Close()
+	}
+	pairs := make([]dirPair, 0, len(paths))
+	resumed := 0
+	for _, path := range paths {
+		pair := dirPair{Path: path}
+		switch {
+		case !inB[path]:
+			pair.Status = PairOnlyA
+		case !inA[path]:
+			pair.Status = PairOnlyB
+		default:
+			var err error
+			pair, err = dirsPair(path, dirA, dirB, resume, &resumed, opts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+		}
+		debugf(opts.Verbosity, VerbositySummary, "dirs_pair", map[string]any{"path": path, "status": pair.Status}, "%s: %s", path, pair.Status)
+		pairs = append(pairs, pair)
+	}
+	if resumed > 0 {
+		fmt.Fprintf(noteWriter(), "Note: %d files unchanged since they were recorded in %s were not diffed again.\n", resumed, ResumePath)
+	}
+	return printDirsResults(dirA, dirB, pairs)
+}
+
+// dirsPair reads and diffs the files at a relative path of both trees, or
+// takes their outcome from the --resume file when their checksums match.
+func dirsPair(path, dirA, dirB string, resume *dirsResume, resumed *int, opts Options) (dirPair, error) {
+	pathA, pathB := filepath.Join(dirA, filepath.FromSlash(path)), filepath.Join(dirB, filepath.FromSlash(path))
+	pair := dirPair{Path: path, Status: PairFailed}
+	contentA, contentB, err := readInputs(pathA, pathB)
+	if err != nil {
+		return pair, err
+	}
+	sumA, sumB := contentSum(contentA), contentSum(contentB)
+	if resume != nil {
+		if done, ok := resume.lookup(path, sumA, sumB); ok {
+			*resumed++
+			return done, nil
+		}
+	}
+	if pair.Status, pair.Stats, err = diffDirPair(contentA, contentB, pathB, opts); err != nil {
+		return pair, err
+	}
+	if resume != nil {
+		if err := resume.record(pair, sumA, sumB); err != nil {
+			return pair, fmt.Errorf("--resume: %v", err)
+		}
+	}
+	return pair, nil
+}
+
+// printDirsResults prints the totals of a directory diff and a row for every
+// path that is not identical, and returns the exit code.
+func printDirsResults(dirA, dirB string, pairs []dirPair) int {
+	counts := map[string]int{}
+	for _, p := range pairs {
+		counts[p.Status]++
+	}
+	fmt.Printf("Compared %s and %s: %d files, %d identical, %d changed, %d only in A, %d only in B, %d errors\n",
+		dirA, dirB, len(pairs), counts[PairIdentical], counts[PairChanged], counts[PairOnlyA], counts[PairOnlyB], counts[PairFailed])
+
+	heading := "\n# FILES\n"
+	row := "  %-9s  %10s  %9s  %5s  %13s  %7s  %5s  %7s  %s\n"
+	if OutputFormat == "markdown" {
+		heading = "\n## FILES\n\n| Status | Similarity | Unchanged | Moved | Moved-changed | Changed | New | Deleted | Path |\n|---|---:|---:|---:|---:|---:|---:|---:|---|\n"
+		row = "| %s | %s | %s | %s | %s | %s | %s | %s | %s |\n"
+	}
+	if len(pairs) == counts[PairIdentical] {
+		return ExitIdentical
+	}
+	fmt.Print(heading)
+	if OutputFormat != "markdown" {
+		fmt.Printf(row, "status", "similarity", "unchanged", "moved", "moved-changed", "changed", "new", "deleted", "path")
+	}
+	for _, p := range pairs {
+		if p.Status == PairIdentical {
+			continue
+		}
+		cells := []any{p.Status, "", "", "", "", "", "", "", p.Path}
+		if s := p.Stats; s != nil {
+			cells = []any{p.Status, fmt.Sprintf("%.1f%%", s.DocumentSimilarityPercent),
+				fmt.Sprint(s.Unchanged.Blocks), fmt.Sprint(s.Moved.Blocks), fmt.Sprint(s.MovedModified.Blocks),
+				fmt.Sprint(s.Modified.Blocks), fmt.Sprint(s.Added.Blocks), fmt.Sprint(s.Deleted.Blocks), p.Path}
+		}
+		fmt.Printf(row, cells...)
+	}
+	if counts[PairFailed] > 0 {
+		return ExitTrouble
+	}
+	return ExitDifferent
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// wordprocessingML is the namespace of the main part of a .docx file.
+const wordprocessingML = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+
+// isDOCXInput reports whether an input is a Word document, by its extension.
+func isDOCXInput(path string) bool {
+	return strings.EqualFold(filepath.Ext(inputName(path)), ".docx")
+}
+
+// inputText returns the text to diff for an input's content: the paragraph
+// text of a Word document, the visible text of an HTML page, or the content
+// itself.
+func inputText(path string, data []byte) (string, error) {
+	switch {
+	case isDOCXInput(path):
+		return extractDOCXText(data)
+	case isHTMLInput(path) && InputMode == "text":
+		text, elements := extractHTMLText(string(data))
+		htmlElementIndex[path] = elements
+		return text, nil
+	}
+	return string(data), nil
+}
+
+// extractDOCXText returns the paragraphs of a .docx file separated by blank
+// lines, so each Word paragraph is a block boundary. Line breaks within a
+// paragraph become newlines and tabs become tab characters; deleted tracked
+// changes, headers, footers and footnotes are left out.
+func extractDOCXText(data []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("not a .docx file: %w", err)
+	}
+	var part *zip.File
+	for _, f := range archive.File {
+		if f.Name == "word/document.xml" {
+			part = f
+			break
+		}
+	}
+	if part == nil {
+		return "", fmt.Errorf("not a .docx file: no word/document.xml")
+	}
+	rc, err := part.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	var paragraphs []string
+	var open []*strings.Builder // Paragraphs being read; text boxes nest paragraphs
+	inText := false
+	dec := xml.NewDecoder(rc)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("word/document.xml: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space != wordprocessingML {
+				continue
+			}
+			switch t.Name.Local {
+			case "p":
+				open = append(open, &strings.Builder{})
+			case "t":
+				inText = true
+			case "tab":
+				if len(open) > 0 {
+					open[len(open)-1].WriteByte('\t')
+				}
+			case "br", "cr":
+				if len(open) > 0 {
+					open[len(open)-1].WriteByte('\n')
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Space != wordprocessingML {
+				continue
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if len(open) == 0 {
+					continue
+				}
+				text := strings.TrimSpace(open[len(open)-1].String())
+				open = open[:len(open)-1]
+				if text != "" {
+					paragraphs = append(paragraphs, text)
+				}
+			}
+		case xml.CharData:
+			if inText && len(open) > 0 {
+				open[len(open)-1].Write(t)
+			}
+		}
+	}
+	return strings.Join(paragraphs, "\n\n") + "\n", nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const EmbeddingRequestTimeout = 30 * time.Second
+
+// EmbeddingStatus records which similarity path a run actually used.
+type EmbeddingStatus struct {
+	Backend  string // "levenshtein" or the embedding URL
+	Degraded bool   // An embedding backend was requested but could not be used
+	Reason   string
+}
+
+// postEmbeddings posts one batch of texts to url and returns one embedding per
+// text. The endpoint (--embedding-url) receives {"inputs": [...]} and answers
+// with one vector per input, like text-embeddings-inference /embed.
+func postEmbeddings(url string, texts []string) ([][]float32, error) {
+	payload, err := json.Marshal(map[string][]string{"inputs": texts})
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: EmbeddingRequestTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, &embeddingStatusError{Code: resp.StatusCode, Status: resp.Status, Body: string(bytes.TrimSpace(body)), RetryAfter: resp.Header.Get("Retry-After")}
+	}
+	var embeddings [][]float32
+	if err := json.NewDecoder(resp.Body).Decode(&embeddings); err != nil {
+		return nil, fmt.Errorf("decoding embedding response: %w", err)
+	}
+	if len(embeddings) != len(texts) {
+		return nil, fmt.Errorf("embedding backend returned %d vectors for %d inputs", len(embeddings), len(texts))
+	}
+	return embeddings, nil
+}
+
+// applyBackendEmbeddings replaces the stubbed embeddings of the gap blocks with
+// vectors from opts.EmbeddingURL. It returns false (and marks the run degraded) if
+// the backend is unavailable, in which case callers fall back to text similarity;
+// a degraded backend is not retried by the later PerformDiff calls of the run.
+func applyBackendEmbeddings(gapBlocksA, gapBlocksB []ContentBlock, opts Options) bool {
+	if opts.EmbeddingURL == "" || opts.Run.Embedding.Degraded {
+		return false
+	}
+	if len(gapBlocksA) == 0 || len(gapBlocksB) == 0 {
+		return true
+	}
+	var blocks []*ContentBlock
+	for _, gapBlocks := range [][]ContentBlock{gapBlocksA, gapBlocksB} {
+		for i := range gapBlocks {
+			blocks = append(blocks, &gapBlocks[i])
+		}
+	}
+	// Blocks embedded earlier by a --daemon or found in the --block-store are
+	// not sent to the backend again.
+	stored := currentWarmCache.embeddingsOf(opts.EmbeddingURL, blocks)
+	if BlockStorePath != "" {
+		fromStore, err := storedEmbeddings(opts.EmbeddingURL, blocks)
+		if err != nil {
+			warnBlockStore(err)
+		}
+		if stored == nil {
+			stored = fromStore
+		} else {
+			for checksum, embedding := range fromStore {
+				stored[checksum] = embedding
+			}
+		}
+	}
+	var missing []*ContentBlock
+	var texts []string
+	for _, cb := range blocks {
+		if _, ok := stored[cb.Checksum]; !ok {
+			missing = append(missing, cb)
+			texts = append(texts, cb.OriginalText)
+		}
+	}
+	if BlockStorePath != "" {
+		debugf(opts.Verbosity, VerbositySummary, "block_store", map[string]any{"store": BlockStorePath, "found": len(blocks) - len(missing), "blocks": len(blocks)}, "Block store %s: %d of %d gap blocks found", BlockStorePath, len(blocks)-len(missing), len(blocks))
+	}
+	var embeddings [][]float32
+	if len(texts) > 0 {
+		var err error
+		if embeddings, err = fetchEmbeddings(opts.EmbeddingURL, texts); err != nil {
+			opts.Run.Embedding = EmbeddingStatus{Backend: "levenshtein", Degraded: true, Reason: err.Error()}
+			debugf(opts.Verbosity, VerbosityDecisions, "backend_fallback", map[string]any{"backend": opts.EmbeddingURL, "error": err.Error()}, "Embedding backend %s unavailable, falling back to Levenshtein: %v", opts.EmbeddingURL, err)
+			return false
+		}
+	}
+	for _, cb := range blocks {
+		if embedding, ok := stored[cb.Checksum]; ok {
+			cb.Embedding = embedding
+		}
+	}
+	for k, cb := range missing {
+		cb.Embedding = embeddings[k]
+	}
+	if BlockStorePath != "" && len(missing) > 0 {
+		if err := storeEmbeddings(opts.EmbeddingURL, missing); err != nil {
+			warnBlockStore(err)
+		}
+	}
+	currentWarmCache.keepEmbeddings(opts.EmbeddingURL, blocks)
+	opts.Run.Embedding = EmbeddingStatus{Backend: opts.EmbeddingURL}
+	return true
+}
+
+var blockStoreWarned atomic.Bool
+
+// warnBlockStore reports the first block store error of a run; the store is a
+// cache, so the diff goes on without it.
+func warnBlockStore(err error) {
+	if !blockStoreWarned.Swap(true) {
+		fmt.Fprintf(os.Stderr, "Warning: --block-store %s: %v\n", BlockStorePath, err)
+	}
+}
+
+// printDegradationNotice warns at the top of the report when the requested backend
+// was not used by the run of opts.
+func printDegradationNotice(opts Options) {
+	if opts.Run == nil || !opts.Run.Embedding.Degraded {
+		return
+	}
+	fmt.Fprintf(noteWriter(), "WARNING: DEGRADED RESULT. Embedding backend %s was unavailable (%s); similarity fell back to text-only Levenshtein scoring.\n", opts.EmbeddingURL, opts.Run.Embedding.Reason)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// InputEncodings are the character encodings of File A and File B (--encoding).
+// "auto" decodes UTF-16 and UTF-8 with a byte order mark, keeps other valid
+// UTF-8, and reads anything else as Windows-1252, which covers Latin-1 text.
+var InputEncodings = [2]string{"auto", "auto"}
+
+var namedEncodings = map[string]encoding.Encoding{
+	"utf-8":        unicode.UTF8BOM, // Decodes with or without a BOM
+	"utf-16le":     unicode.UTF16(unicode.LittleEndian, unicode.UseBOM),
+	"utf-16be":     unicode.UTF16(unicode.BigEndian, unicode.UseBOM),
+	"latin1":       charmap.ISO8859_1,
+	"windows-1252": charmap.Windows1252,
+}
+
+var encodingAliases = map[string]string{"utf8": "utf-8", "iso-8859-1": "latin1", "cp1252": "windows-1252"}
+
+// parseEncodingFlag parses "name" for both files or "nameA,nameB".
+func parseEncodingFlag(spec string) ([2]string, error) {
+	names := strings.Split(strings.ToLower(spec), ",")
+	if len(names) == 1 {
+		names = append(names, names[0])
+	}
+	if len(names) != 2 {
+		return InputEncodings, fmt.Errorf("expected one encoding or two separated by a comma, got %q", spec)
+	}
+	var result [2]string
+	for k, name := range names {
+		name = strings.TrimSpace(name)
+		if alias, ok := encodingAliases[name]; ok {
+			name = alias
+		}
+		if _, ok := namedEncodings[name]; !ok && name != "auto" {
+			known := []string{"auto"}
+			for n := range namedEncodings {
+				known = append(known, n)
+			}
+			sort.Strings(known[1:])
+			return InputEncodings, fmt.Errorf("unknown encoding %q (known: %s)", name, strings.Join(known, ", "))
+		}
+		result[k] = name
+	}
+	return result, nil
+}
+
+// detectEncoding picks the encoding of an input's leading bytes for "auto":
+// by byte order mark, else UTF-8 when the bytes are valid UTF-8, else
+// Windows-1252.
+func detectEncoding(head []byte, complete bool) string {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		return "utf-16le"
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		return "utf-16be"
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		return "utf-8"
+	}
+	if !complete {
+		return "" // Only a BOM can be detected before the whole input is read
+	}
+	if utf8.Valid(head) {
+		return ""
+	}
+	return "windows-1252"
+}
+
+// decodeInput transcodes an input to UTF-8 from the named encoding, or from
+// the detected one for "auto". UTF-8 input without a BOM is returned as is.
+func decodeInput(data []byte, name string) ([]byte, error) {
+	if name == "auto" {
+		name = detectEncoding(data, true)
+	}
+	if name == "" {
+		return data, nil
+	}
+	out, _, err := transform.Bytes(namedEncodings[name].NewDecoder(), data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding as %s: %w", name, err)
+	}
+	return out, nil
+}
+
+// inputDecoder wraps a streamed input to transcode it to UTF-8. Streams are not
+// read ahead, so "auto" only recognizes a byte order mark.
+func inputDecoder(r io.Reader, name string) io.Reader {
+	br := bufio.NewReader(r)
+	if name == "auto" {
+		head, _ := br.Peek(3)
+		name = detectEncoding(head, false)
+	}
+	if name == "" {
+		return br
+	}
+	return transform.NewReader(br, namedEncodings[name].NewDecoder())
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ExplainCompetitors is how many lower-ranked File B candidates --explain lists
+// per semantic match.
+const ExplainCompetitors = 3
+
+// How a pair with a MatchExplanation was made.
+const (
+	MatchSemantic = "semantic" // Best-scoring candidate at or above the threshold
+	MatchAdjacent = "position" // Paired by --pair-adjacent, whatever its score
+)
+
+// MatchExplanation records why the engine paired an entry's blocks (--explain).
+type MatchExplanation struct {
+	Reason      string           `json:"reason"`
+	Metric      string           `json:"metric,omitempty"`
+	Threshold   float64          `json:"threshold,omitempty"`
+	Components  []ComponentScore `json:"components,omitempty"`  // Of a combined metric, in component order
+	Competitors []CandidateScore `json:"competitors,omitempty"` // Lower-ranked File B candidates, best first
+}
+
+// ComponentScore is one component's unweighted score in a combined similarity.
+type ComponentScore struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+	Score  float32 `json:"score"`
+}
+
+// CandidateScore is a File B candidate and its similarity to the File A block.
+type CandidateScore struct {
+	Block *ContentBlock `json:"block"`
+	Score float32       `json:"score"`
+}
+
+// explainSemanticMatch records a semantic match of a to best among the scored
+// candidates.
+func explainSemanticMatch(scorer Similarity, threshold float64, a, best *ContentBlock, candidates []*ContentBlock, scores []float32) *MatchExplanation {
+	ex := &MatchExplanation{Reason: MatchSemantic, Metric: similarityName(scorer), Threshold: threshold}
+	if combined, ok := scorer.(CombinedSimilarity); ok {
+		for k, score := range combined.ComponentScores(a, best) {
+			ex.Components = append(ex.Components, ComponentScore{combined.Components[k].Name, combined.Components[k].Weight, score})
+		}
+	}
+	for k, cb := range candidates {
+		if cb != best {
+			ex.Competitors = append(ex.Competitors, CandidateScore{cb, scores[k]})
+		}
+	}
+	sort.SliceStable(ex.Competitors, func(i, j int) bool { return ex.Competitors[i].Score > ex.Competitors[j].Score })
+	if len(ex.Competitors) > ExplainCompetitors {
+		ex.Competitors = ex.Competitors[:ExplainCompetitors]
+	}
+	return ex
+}
+
+// printMatchExplanations prints the MATCH EXPLANATIONS section: for each CHANGED
+// and MOVED pair, in File A order, how it was matched, the in-place pairs around
+// it and the candidates that lost.
+func printMatchExplanations(diffs []DiffEntry) {
+	heading, item, detail := "\n# MATCH EXPLANATIONS\n", "  ", "      "
+	if OutputFormat == "markdown" {
+		heading, item, detail = "\n## MATCH EXPLANATIONS\n\n", "- ", "  - "
+	}
+	fmt.Print(heading)
+
+	// In-place entries are the LIS of the pairs, so their A and B orders agree.
+	var anchors, explained []DiffEntry
+	for _, e := range diffs {
+		if e.BlockA == nil || e.BlockB == nil {
+			continue
+		}
+		if e.Type == Unchanged || e.Type == Modified {
+			anchors = append(anchors, e)
+		}
+		if e.Type != Unchanged {
+			explained = append(explained, e)
+		}
+	}
+	sort.SliceStable(anchors, func(i, j int) bool { return anchors[i].BlockA.LineStart < anchors[j].BlockA.LineStart })
+	sort.SliceStable(explained, func(i, j int) bool { return explained[i].BlockA.LineStart < explained[j].BlockA.LineStart })
+	if len(explained) == 0 {
+		fmt.Printf("%sNo CHANGED or MOVED pairs.\n", item)
+		return
+	}
+
+	for _, e := range explained {
+		fmt.Printf("%s%s A %s -> B %s: %s\n", item, e.Type, blockRange(e.BlockA), blockRange(e.BlockB), matchReason(e))
+		if ex := e.Explanation; ex != nil && len(ex.Components) > 0 {
+			parts := make([]string, len(ex.Components))
+			for k, c := range ex.Components {
+				parts[k] = fmt.Sprintf("%s %.2f (weight %.2g)", c.Name, c.Score, c.Weight)
+			}
+			fmt.Printf("%sComponents: %s\n", detail, strings.Join(parts, ", "))
+		}
+		fmt.Printf("%sAnchors: %s\n", detail, matchAnchors(e, anchors))
+		if ex := e.Explanation; ex != nil && ex.Reason == MatchSemantic {
+			if len(ex.Competitors) == 0 {
+				fmt.Printf("%sCompetitors: none, the only candidate\n", detail)
+				continue
+			}
+			parts := make([]string, len(ex.Competitors))
+			for k, c := range ex.Competitors {
+				parts[k] = fmt.Sprintf("B %s %.2f (%s)", blockRange(c.Block), c.Score, nearMissFate(diffs, c.Block))
+			}
+			fmt.Printf("%sCompetitors: %s\n", detail, strings.Join(parts, ", "))
+		}
+	}
+}
+
+// matchReason says how a pair was made.
+func matchReason(e DiffEntry) string {
+	ex := e.Explanation
+	switch {
+	case ex != nil && ex.Reason == MatchSemantic:
+		return fmt.Sprintf("best %s similarity %.2f, at least the threshold %.2f", ex.Metric, e.Similarity, ex.Threshold)
+	case ex != nil && ex.Reason == MatchAdjacent:
+		return fmt.Sprintf("paired by position between the same anchors (--pair-adjacent), similarity %.2f", e.Similarity)
+	case e.Type == Moved:
+		return "identical text, an exact megablock match"
+	default:
+		return fmt.Sprintf("similarity %.2f, matched by the hierarchical pass", e.Similarity)
+	}
+}
+
+// matchAnchors describes the in-place pairs on either side of e in File A and,
+// for a moved pair, why its File B position does not fit between them.
+func matchAnchors(e DiffEntry, anchors []DiffEntry) string {
+	var before, after *DiffEntry
+	for k := range anchors {
+		a := &anchors[k]
+		if a.BlockA == e.BlockA {
+			continue
+		}
+		if a.BlockA.LineEnd < e.BlockA.LineStart {
+			before = a
+		} else if a.BlockA.LineStart > e.BlockA.LineEnd && after == nil {
+			after = a
+		}
+	}
+	from, to := "the start of the files", "the end of the files"
+	lowB, highB := 1, -1
+	if before != nil {
+		from = fmt.Sprintf("A %s -> B %s", blockRange(before.BlockA), blockRange(before.BlockB))
+		lowB = before.BlockB.LineEnd + 1
+	}
+	if after != nil {
+		to = fmt.Sprintf("A %s -> B %s", blockRange(after.BlockA), blockRange(after.BlockB))
+		highB = after.BlockB.LineStart - 1
+	}
+	desc := fmt.Sprintf("after %s, before %s", from, to)
+	switch {
+	case e.Type != Moved && e.Type != MovedModified:
+	case highB >= 0 && highB < lowB:
+		desc += fmt.Sprintf("; they are adjacent in File B, so B %s is out of order", blockRange(e.BlockB))
+	case highB >= 0:
+		desc += fmt.Sprintf("; B %s is outside B L%d-%d between them, so it is out of order", blockRange(e.BlockB), lowB, highB)
+	default:
+		desc += fmt.Sprintf("; B %s is not after B L%d, so it is out of order", blockRange(e.BlockB), lowB-1)
+	}
+	return desc
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ShowFigures enables the FIGURES CHANGED section (--figures).
+var ShowFigures bool
+
+// figureRe matches a number with its currency, separators and unit. Longer units
+// come first in each alternation so "kb" is not read as "k".
+var figureRe = regexp.MustCompile(`(?i)(?:[$€£¥]|\b(?:usd|eur|gbp|jpy)\s?)?\d+(?:[,.]\d{3})*(?:\.\d+)?(?:\s?(?:percent|kib|mib|gib|tib|kb|mb|gb|tb|bytes|bn|billion|million|thousand|usd|eur|gbp|jpy|k|m)\b|%)?(?:\s?(?:usd|eur|gbp|jpy)\b)?`)
+
+// FigureUnit is what a unit measures and its size in that quantity's base unit.
+// Scale words have no quantity of their own and only multiply the value.
+type FigureUnit struct {
+	Quantity string
+	Factor   float64
+}
+
+// figureUnits normalizes units and currencies, keyed by lowercase spelling, so
+// "1,024 KB" and "1 MB" or "$5" and "5 USD" compare as the same figure. Byte
+// multiples are binary. Currencies are never converted into each other.
+var figureUnits = map[string]FigureUnit{
+	"%": {"percent", 1}, "percent": {"percent", 1},
+	"k": {"", 1e3}, "thousand": {"", 1e3}, "m": {"", 1e6}, "million": {"", 1e6}, "bn": {"", 1e9}, "billion": {"", 1e9},
+	"bytes": {"bytes", 1}, "kb": {"bytes", 1 << 10}, "kib": {"bytes", 1 << 10}, "mb": {"bytes", 1 << 20}, "mib": {"bytes", 1 << 20},
+	"gb": {"bytes", 1 << 30}, "gib": {"bytes", 1 << 30}, "tb": {"bytes", 1 << 40}, "tib": {"bytes", 1 << 40},
+	"$": {"USD", 1}, "usd": {"USD", 1}, "€": {"EUR", 1}, "eur": {"EUR", 1}, "£": {"GBP", 1}, "gbp": {"GBP", 1}, "¥": {"JPY", 1}, "jpy": {"JPY", 1},
+}
+
+// FigureContextWords is how many words before a figure are shown as its context.
+const FigureContextWords = 3
+
+// Figure is a number in a text with the words leading up to it.
+type Figure struct {
+	Text       string
+	Value      float64 // Parsed value, ignoring currency and unit
+	Quantity   string  // What the unit measures, e.g. "bytes" or "USD"; "" for plain numbers
+	Normalized float64 // Value in the quantity's base unit, scale words applied
+	Context    string
+}
+
+// extractFigures returns the figures of text in order.
+func extractFigures(text string) []Figure {
+	var figures []Figure
+	for _, loc := range figureRe.FindAllStringIndex(text, -1) {
+		raw := strings.TrimSpace(text[loc[0]:loc[1]])
+		start := strings.IndexFunc(raw, unicode.IsDigit)
+		prefix, number, suffix := raw[:start], raw[start:], ""
+		if end := strings.IndexFunc(number, func(r rune) bool { return !(r >= '0' && r <= '9' || r == ',' || r == '.') }); end >= 0 {
+			number, suffix = number[:end], number[end:]
+		}
+		value, err := strconv.ParseFloat(strings.ReplaceAll(number, ",", ""), 64)
+		if err != nil {
+			continue
+		}
+		fig := Figure{Text: raw, Value: value, Normalized: value}
+		for _, u := range append([]string{prefix}, strings.Fields(strings.Replace(suffix, "%", " % ", 1))...) {
+			if unit, ok := figureUnits[strings.ToLower(strings.TrimSpace(u))]; ok {
+				fig.Normalized *= unit.Factor
+				if unit.Quantity != "" {
+					fig.Quantity = unit.Quantity
+				}
+			}
+		}
+		words := strings.Fields(text[:loc[0]])
+		fig.Context = strings.Join(words[max(len(words)-FigureContextWords, 0):], " ")
+		figures = append(figures, fig)
+	}
+	return figures
+}
+
+// sameFigure reports whether two figures state the same amount, however written.
+func sameFigure(a, b Figure) bool {
+	if a.Text == b.Text {
+		return true
+	}
+	return a.Quantity == b.Quantity && math.Abs(a.Normalized-b.Normalized) <= 1e-9*math.Max(math.Abs(a.Normalized), math.Abs(b.Normalized))
+}
+
+// FigureChange is a figure whose value changed; Old or New is nil for a figure
+// that was removed or added without a counterpart.
+type FigureChange struct {
+	Old, New *Figure
+}
+
+// diffFigures aligns the figures of a and b by their longest common subsequence of
+// same figures and pairs the removed and added figures between aligned ones.
+func diffFigures(a, b []Figure) []FigureChange {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if sameFigure(a[i], b[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var changes []FigureChange
+	var removed, added []*Figure
+	flush := func() {
+		changes = append(changes, pairFigures(removed, added)...)
+		removed, added = nil, nil
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && sameFigure(a[i], b[j]):
+			flush()
+			i++
+			j++
+		case j == len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			removed = append(removed, &a[i])
+			i++
+		default:
+			added = append(added, &b[j])
+			j++
+		}
+	}
+	flush()
+	return changes
+}
+
+// pairFigures pairs each removed figure with the added one sharing most context
+// words. A lone removed and a lone added figure are paired regardless.
+func pairFigures(removed, added []*Figure) []FigureChange {
+	var changes []FigureChange
+	paired := make([]bool, len(added))
+	for _, old := range removed {
+		best, bestShared := -1, 0
+		for k, candidate := range added {
+			if shared := sharedWords(old.Context, candidate.Context); !paired[k] && shared > bestShared {
+				best, bestShared = k, shared
+			}
+		}
+		if best < 0 && len(removed) == 1 && len(added) == 1 {
+			best = 0
+		}
+		c := FigureChange{Old: old}
+		if best >= 0 {
+			c.New = added[best]
+			paired[best] = true
+		}
+		changes = append(changes, c)
+	}
+	for k, fig := range added {
+		if !paired[k] {
+			changes = append(changes, FigureChange{New: fig})
+		}
+	}
+	return changes
+}
+
+// sharedWords counts the distinct words two contexts have in common, ignoring case.
+func sharedWords(a, b string) int {
+	words := make(map[string]bool)
+	for _, w := range strings.Fields(strings.ToLower(a)) {
+		words[w] = true
+	}
+	shared := 0
+	for _, w := range strings.Fields(strings.ToLower(b)) {
+		if words[w] {
+			shared++
+			delete(words, w)
+		}
+	}
+	return shared
+}
+
+// describeFigureChange formats a change, with the relative change when both sides
+// measure the same quantity.
+func describeFigureChange(c FigureChange) string {
+	switch {
+	case c.Old == nil:
+		return fmt.Sprintf("added %s (after %q)", c.New.Text, c.New.Context)
+	case c.New == nil:
+		return fmt.Sprintf("removed %s (after %q)", c.Old.Text, c.Old.Context)
+	}
+	delta := ""
+	if c.Old.Quantity == c.New.Quantity && c.Old.Normalized != 0 {
+		delta = fmt.Sprintf(" (%+.1f%%)", 100*(c.New.Normalized-c.Old.Normalized)/c.Old.Normalized)
+	}
+	return fmt.Sprintf("%s -> %s%s (after %q)", c.Old.Text, c.New.Text, delta, c.New.Context)
+}
+
+// printFigureChanges prints the FIGURES CHANGED section for every changed block pair.
+func printFigureChanges(diffs []DiffEntry) {
+	heading, item, sub := "\n# FIGURES CHANGED\n", "  ", "    "
+	if OutputFormat == "markdown" {
+		heading, item, sub = "\n## FIGURES CHANGED\n\n", "- ", "  - "
+	}
+	fmt.Print(heading)
+	total := 0
+	for _, e := range diffs {
+		if e.BlockA == nil || e.BlockB == nil || e.BlockA.OriginalText == e.BlockB.OriginalText {
+			continue
+		}
+		changes := diffFigures(extractFigures(e.BlockA.OriginalText), extractFigures(e.BlockB.OriginalText))
+		if len(changes) == 0 {
+			continue
+		}
+		fmt.Printf("%s[%s] A L%d-%d -> B L%d-%d:\n", item, e.Type, e.BlockA.LineStart, e.BlockA.LineEnd, e.BlockB.LineStart, e.BlockB.LineEnd)
+		for _, c := range changes {
+			fmt.Printf("%s%s\n", sub, describeFigureChange(c))
+		}
+		total += len(changes)
+	}
+	if total == 0 {
+		fmt.Printf("%sNo figures changed in changed blocks.\n", item)
+	}
+}
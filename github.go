@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// githubDataEscaper and githubPropertyEscaper escape workflow command messages
+// and properties.
+var (
+	githubDataEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	githubPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+// blockAnnotation is a changed block as line-anchored review tools show it: on
+// the File B lines it concerns, or for a DELETED block (a warning) the File B
+// line where it was, with a short summary.
+type blockAnnotation struct {
+	Type          DiffType
+	Warning       bool
+	Line, EndLine int
+	Message       string
+}
+
+// blockAnnotations returns an annotation per entry that is not unchanged.
+func blockAnnotations(diffs []DiffEntry) []blockAnnotation {
+	deletedAt := githubDeletionLines(diffs)
+	var annotations []blockAnnotation
+	for _, e := range diffs {
+		if e.Type == Unchanged {
+			continue
+		}
+		a := blockAnnotation{Type: e.Type}
+		if e.BlockB != nil {
+			a.Line, a.EndLine = e.BlockB.LineStart, e.BlockB.LineEnd
+		} else {
+			a.Warning = true
+			a.Line = deletedAt[e.BlockA.ID]
+			a.EndLine = a.Line
+		}
+		switch e.Type {
+		case Added:
+			a.Message = fmt.Sprintf("New block: %s", summarizedText(e.BlockB.OriginalText, true))
+		case Deleted:
+			a.Message = fmt.Sprintf("Deleted block (A %s): %s", githubLines(e.BlockA), summarizedText(e.BlockA.OriginalText, true))
+		case Moved:
+			a.Message = fmt.Sprintf("Moved from A %s", githubLines(e.BlockA))
+		case MovedModified:
+			a.Message = fmt.Sprintf("Moved from A %s and changed [Sim: %.2f]: %s", githubLines(e.BlockA), e.Similarity, summarizedText(e.BlockB.OriginalText, true))
+		case Modified:
+			a.Message = fmt.Sprintf("Changed [Sim: %.2f]: %s -> %s", e.Similarity, summarizedText(e.BlockA.OriginalText, true), summarizedText(e.BlockB.OriginalText, true))
+		}
+		annotations = append(annotations, a)
+	}
+	return annotations
+}
+
+// printGitHubAnnotations prints the block annotations as GitHub Actions
+// workflow commands: ::warning for DELETED blocks and ::notice for the others.
+func printGitHubAnnotations(diffs []DiffEntry, fileBPath string) {
+	file := githubPropertyEscaper.Replace(filepath.ToSlash(filepath.Clean(fileBPath)))
+	for _, a := range blockAnnotations(diffs) {
+		level := "notice"
+		if a.Warning {
+			level = "warning"
+		}
+		fmt.Printf("::%s file=%s,line=%d,endLine=%d,title=%s::%s\n", level, file, a.Line, a.EndLine,
+			githubPropertyEscaper.Replace("Semantic diff: "+a.Type.String()), githubDataEscaper.Replace(a.Message))
+	}
+}
+
+// githubDeletionLines returns, by block ID, the File B line after which each
+// DELETED block was: the end of the File B block paired with the nearest File
+// A block before it, or line 1.
+func githubDeletionLines(diffs []DiffEntry) map[int]int {
+	byA := make([]DiffEntry, 0, len(diffs))
+	for _, e := range diffs {
+		if e.BlockA != nil {
+			byA = append(byA, e)
+		}
+	}
+	sort.SliceStable(byA, func(i, j int) bool { return byA[i].BlockA.LineStart < byA[j].BlockA.LineStart })
+	lines := make(map[int]int)
+	at := 1
+	for _, e := range byA {
+		if e.BlockB != nil {
+			at = e.BlockB.LineEnd
+		} else {
+			lines[e.BlockA.ID] = at
+		}
+	}
+	return lines
+}
+
+func githubLines(cb *ContentBlock) string {
+	if cb.LineStart == cb.LineEnd {
+		return fmt.Sprintf("line %d", cb.LineStart)
+	}
+	return fmt.Sprintf("lines %d-%d", cb.LineStart, cb.LineEnd)
+}
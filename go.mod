@@ -4,4 +4,14 @@ go 1.24.0
 
 require github.com/agnivade/levenshtein v1.2.1
 
-require github.com/sergi/go-diff v1.3.1 // indirect
+require (
+	github.com/fsnotify/fsnotify v1.9.0
+	github.com/klauspost/compress v1.18.0
+	github.com/rivo/uniseg v0.4.7
+	github.com/sergi/go-diff v1.3.1
+	golang.org/x/term v0.32.0
+	golang.org/x/text v0.25.0
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require golang.org/x/sys v0.33.0 // indirect
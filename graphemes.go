@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/rivo/uniseg"
+)
+
+// GraphemeSimilarity (--grapheme-similarity) makes Levenshtein count edits per
+// user-perceived character (grapheme cluster) instead of per code point, so an
+// emoji ZWJ sequence or a letter with combining marks counts as one edit.
+var GraphemeSimilarity bool
+
+// graphemeEncodingBase is the first code point used to stand in for a grapheme
+// cluster (Supplementary Private Use Area-A).
+const graphemeEncodingBase = 0xF0000
+const graphemeEncodingMax = 0xFFFFD
+
+// truncateGraphemes returns at most max grapheme clusters of text and whether it cut anything.
+func truncateGraphemes(text string, max int) (string, bool) {
+	g := uniseg.NewGraphemes(text)
+	n := 0
+	var b strings.Builder
+	for g.Next() {
+		if n == max {
+			return b.String(), true
+		}
+		b.WriteString(g.Str())
+		n++
+	}
+	return text, false
+}
+
+// encodeGraphemePair maps every distinct grapheme cluster in a and b to a single
+// private-use rune, so rune-based algorithms operate on whole clusters. ok is
+// false if the texts have more distinct clusters than the encoding range holds.
+func encodeGraphemePair(a, b string) (encA, encB string, ok bool) {
+	index := make(map[string]rune)
+	encode := func(text string) (string, bool) {
+		var out []rune
+		g := uniseg.NewGraphemes(text)
+		for g.Next() {
+			cluster := g.Str()
+			r, seen := index[cluster]
+			if !seen {
+				r = rune(graphemeEncodingBase + len(index))
+				if r > graphemeEncodingMax {
+					return "", false
+				}
+				index[cluster] = r
+			}
+			out = append(out, r)
+		}
+		return string(out), true
+	}
+	var okA, okB bool
+	encA, okA = encode(a)
+	encB, okB = encode(b)
+	return encA, encB, okA && okB
+}
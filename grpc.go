@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// The gRPC service of semanticdiff.proto, served over cleartext HTTP/2 by
+// `serve --grpc` with the wire format encoded by hand (protowire.go).
+const (
+	grpcServiceName = "semanticdiff.v1.SemanticDiff"
+	grpcDiffMethod  = "/" + grpcServiceName + "/Diff"
+	grpcChunkSize   = 1 << 20 // Entries are streamed in responses of about this many bytes
+)
+
+// gRPC status codes.
+const (
+	grpcOK                = 0
+	grpcCanceled          = 1
+	grpcInvalidArgument   = 3
+	grpcDeadlineExceeded  = 4
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+)
+
+// grpcHandler serves the Diff method: it reads one DiffRequest of at most
+// maxMessage bytes and streams DiffResponses. A grpc-timeout shorter than
+// timeout replaces it for that request.
+func grpcHandler(maxMessage int64, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+			return
+		}
+		if r.URL.Path != grpcDiffMethod {
+			writeGRPCStatus(w, grpcUnimplemented, "unknown method "+r.URL.Path)
+			return
+		}
+		message, code, err := readGRPCMessage(r.Body, maxMessage)
+		if err != nil {
+			writeGRPCStatus(w, code, err.Error())
+			return
+		}
+		req, err := decodeDiffRequest(message)
+		if err != nil {
+			writeGRPCStatus(w, grpcInvalidArgument, "invalid request: "+err.Error())
+			return
+		}
+		opts, err := req.Options.options()
+		if err != nil {
+			writeGRPCStatus(w, grpcInvalidArgument, err.Error())
+			return
+		}
+		reqTimeout := timeout
+		if d, ok := parseGRPCTimeout(r.Header.Get("Grpc-Timeout")); ok && (reqTimeout == 0 || d < reqTimeout) {
+			reqTimeout = d
+		}
+
+		diffs, note, err := runDiffRequest(r.Context(), req, opts, reqTimeout)
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			writeGRPCStatus(w, grpcDeadlineExceeded, fmt.Sprintf("diff did not finish: %v", err))
+			return
+		case errors.Is(err, context.Canceled):
+			writeGRPCStatus(w, grpcCanceled, fmt.Sprintf("diff did not finish: %v", err))
+			return
+		case err != nil:
+			writeGRPCStatus(w, grpcInternal, fmt.Sprintf("diff did not finish: %v", err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.WriteHeader(http.StatusOK)
+		rc := http.NewResponseController(w)
+		for k, chunk := range diffResponseChunks(diffs, note) {
+			if k > 0 && r.Context().Err() != nil {
+				return // The client went away
+			}
+			if err := writeGRPCMessage(w, chunk); err != nil {
+				return
+			}
+			rc.Flush()
+		}
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(grpcOK))
+	}
+}
+
+// readGRPCMessage reads the length-prefixed request message. On failure it
+// also returns the status code to reply with.
+func readGRPCMessage(body io.Reader, maxMessage int64) ([]byte, int, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		return nil, grpcInvalidArgument, fmt.Errorf("reading message: %v", err)
+	}
+	if prefix[0] != 0 {
+		return nil, grpcUnimplemented, fmt.Errorf("compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if int64(size) > maxMessage {
+		return nil, grpcResourceExhausted, fmt.Errorf("request message of %d bytes exceeds %d bytes", size, maxMessage)
+	}
+	message := make([]byte, size)
+	if _, err := io.ReadFull(body, message); err != nil {
+		return nil, grpcInvalidArgument, fmt.Errorf("reading message: %v", err)
+	}
+	return message, grpcOK, nil
+}
+
+func writeGRPCMessage(w io.Writer, message []byte) error {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(message)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(message)
+	return err
+}
+
+// writeGRPCStatus sends a response without messages, carrying the status in
+// its headers.
+func writeGRPCStatus(w http.ResponseWriter, code int, message string) {
+	h := w.Header()
+	h.Set("Content-Type", "application/grpc")
+	h.Set("Grpc-Status", strconv.Itoa(code))
+	h.Set("Grpc-Message", grpcPercentEncode(message))
+	w.WriteHeader(http.StatusOK)
+}
+
+// grpcPercentEncode escapes a status message as grpc-message requires.
+func grpcPercentEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// parseGRPCTimeout parses a grpc-timeout header such as "500m" or "30S".
+func parseGRPCTimeout(s string) (time.Duration, bool) {
+	if len(s) < 2 {
+		return 0, false
+	}
+	units := map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second, 'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond}
+	unit, ok := units[s[len(s)-1]]
+	n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if !ok || err != nil || n <= 0 || n > math.MaxInt64/int64(unit) {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// decodeDiffRequest decodes a DiffRequest message. Unknown fields are skipped.
+func decodeDiffRequest(message []byte) (DiffRequest, error) {
+	var req DiffRequest
+	fields, err := parseProto(message)
+	if err != nil {
+		return req, err
+	}
+	for _, f := range fields {
+		switch f.Number {
+		case 1, 2, 3:
+			if err := protoWireError(f, protoBytes); err != nil {
+				return req, err
+			}
+		}
+		switch f.Number {
+		case 1:
+			req.A = string(f.Data)
+		case 2:
+			req.B = string(f.Data)
+		case 3:
+			if req.Options, err = decodeDiffOptions(f.Data); err != nil {
+				return req, fmt.Errorf("options: %v", err)
+			}
+		}
+	}
+	return req, nil
+}
+
+func decodeDiffOptions(message []byte) (DiffRequestOptions, error) {
+	var o DiffRequestOptions
+	fields, err := parseProto(message)
+	if err != nil {
+		return o, err
+	}
+	for _, f := range fields {
+		want := protoVarint
+		if f.Number == 1 || f.Number == 5 {
+			want = protoFixed64
+		}
+		if f.Number >= 1 && f.Number <= 8 {
+			if err := protoWireError(f, want); err != nil {
+				return o, err
+			}
+		}
+		n := int(int32(f.Value))
+		switch f.Number {
+		case 1:
+			threshold := math.Float64frombits(f.Value)
+			o.Threshold = &threshold
+		case 2:
+			o.MinAnchorLines = &n
+		case 3:
+			o.MinParagraphLines = &n
+		case 4:
+			o.MaxBlockLines = &n
+		case 5:
+			o.RescueThreshold = math.Float64frombits(f.Value)
+		case 6:
+			o.IgnoreBlankLines = f.Value != 0
+		case 7:
+			o.PairAdjacent = f.Value != 0
+		case 8:
+			o.Hierarchical = f.Value != 0
+		}
+	}
+	return o, nil
+}
+
+// diffResponseChunks encodes the result as DiffResponse messages of about
+// grpcChunkSize bytes each; the first also carries identical and note.
+func diffResponseChunks(diffs []DiffEntry, note string) [][]byte {
+	var chunks [][]byte
+	var chunk protoMessage
+	chunk.bool(1, diffExitCode(diffs) == ExitIdentical)
+	chunk.string(2, note)
+	for _, e := range diffs {
+		entry := encodeDiffEntry(e)
+		if len(chunk) > 0 && len(chunk)+len(entry) > grpcChunkSize {
+			chunks = append(chunks, chunk)
+			chunk = nil
+		}
+		chunk.bytes(3, entry)
+	}
+	if len(chunk) > 0 || len(chunks) == 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+func encodeDiffEntry(e DiffEntry) []byte {
+	var m protoMessage
+	m.varint(1, uint64(e.Type)+1) // DIFF_TYPE_UNSPECIFIED is 0
+	if e.BlockA != nil {
+		m.bytes(2, encodeBlock(e.BlockA))
+	}
+	if e.BlockB != nil {
+		m.bytes(3, encodeBlock(e.BlockB))
+	}
+	m.float(4, e.Similarity)
+	for _, op := range e.LineDiffs {
+		var d protoMessage
+		switch op.Operation {
+		case diffmatchpatch.DiffInsert:
+			d.varint(1, 1)
+		case diffmatchpatch.DiffDelete:
+			d.varint(1, 2)
+		}
+		d.string(2, op.Text)
+		m.bytes(5, d)
+	}
+	return m
+}
+
+func encodeBlock(cb *ContentBlock) []byte {
+	var m protoMessage
+	m.int32(1, cb.ID)
+	m.int32(2, cb.LineStart)
+	m.int32(3, cb.LineEnd)
+	m.string(4, cb.OriginalText)
+	return m
+}
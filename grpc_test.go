@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// grpcDiffCall sends a Diff request for a and b through grpcHandler and
+// returns the gRPC status and the DiffResponse messages.
+func grpcDiffCall(t *testing.T, handler http.Handler, a, b string, threshold float64, grpcTimeout string) (int, [][]protoField) {
+	t.Helper()
+	var options protoMessage
+	options.tag(1, protoFixed64)
+	options = binary.LittleEndian.AppendUint64(options, math.Float64bits(threshold))
+	options.bool(6, true) // ignore_blank_lines
+	var req protoMessage
+	req.string(1, a)
+	req.string(2, b)
+	req.bytes(3, options)
+	var body bytes.Buffer
+	if err := writeGRPCMessage(&body, req); err != nil {
+		t.Fatal(err)
+	}
+	httpReq := httptest.NewRequest(http.MethodPost, grpcDiffMethod, &body)
+	httpReq.Header.Set("Content-Type", "application/grpc")
+	if grpcTimeout != "" {
+		httpReq.Header.Set("Grpc-Timeout", grpcTimeout)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httpReq)
+	resp := rec.Result()
+
+	status := resp.Header.Get("Grpc-Status")
+	if status == "" {
+		status = resp.Trailer.Get("Grpc-Status")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		t.Fatalf("grpc-status %q: %v", status, err)
+	}
+	var messages [][]protoField
+	for rec.Body.Len() > 0 {
+		message, _, err := readGRPCMessage(rec.Body, math.MaxInt32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields, err := parseProto(message)
+		if err != nil {
+			t.Fatalf("response message: %v", err)
+		}
+		messages = append(messages, fields)
+	}
+	return code, messages
+}
+
+func TestGRPCDiffRoundTrip(t *testing.T) {
+	handler := grpcHandler(1<<20, 0)
+	a := "Intro line.\n\nThe quick brown fox jumps over the lazy dog.\n\nClosing words.\n"
+	b := "Intro line.\n\nThe quick brown fox leaps over the lazy dog.\n\nClosing words.\n\nA new paragraph.\n"
+	code, messages := grpcDiffCall(t, handler, a, b, 0.5, "")
+	if code != grpcOK {
+		t.Fatalf("status %d, want %d", code, grpcOK)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("got %d response messages, want 1", len(messages))
+	}
+	want, _, err := runDiffRequest(t.Context(), DiffRequest{A: a, B: b}, withThreshold(0.5), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []int
+	for _, f := range messages[0] {
+		switch f.Number {
+		case 1:
+			t.Errorf("identical is set for different inputs")
+		case 3:
+			if err := protoWireError(f, protoBytes); err != nil {
+				t.Fatal(err)
+			}
+			entry, err := parseProto(f.Data)
+			if err != nil {
+				t.Fatalf("entry: %v", err)
+			}
+			types = append(types, int(entry[0].Value)-1)
+		}
+	}
+	if len(types) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(types), len(want))
+	}
+	for k, e := range want {
+		if types[k] != int(e.Type) {
+			t.Errorf("entry %d has type %d, want %d", k, types[k], e.Type)
+		}
+	}
+}
+
+func withThreshold(threshold float64) Options {
+	opts, err := DiffRequestOptions{Threshold: &threshold, IgnoreBlankLines: true}.options()
+	if err != nil {
+		panic(err)
+	}
+	return opts
+}
+
+func TestGRPCDiffIdentical(t *testing.T) {
+	code, messages := grpcDiffCall(t, grpcHandler(1<<20, 0), "same\n", "same\n", 0.5, "")
+	if code != grpcOK || len(messages) != 1 {
+		t.Fatalf("status %d with %d messages, want %d with 1", code, len(messages), grpcOK)
+	}
+	if len(messages[0]) != 1 || messages[0][0].Number != 1 || messages[0][0].Value != 1 {
+		t.Errorf("response %+v, want only identical = true", messages[0])
+	}
+}
+
+// A grpc-timeout applies to its own request only.
+func TestGRPCTimeoutIsPerRequest(t *testing.T) {
+	handler := grpcHandler(1<<20, 0)
+	a, b := "First paragraph.\n\nSecond paragraph.\n", "Second paragraph.\n\nFirst paragraph, edited.\n"
+	if code, _ := grpcDiffCall(t, handler, a, b, 0.5, "1n"); code != grpcDeadlineExceeded {
+		t.Fatalf("status %d with a 1ns grpc-timeout, want %d", code, grpcDeadlineExceeded)
+	}
+	if code, _ := grpcDiffCall(t, handler, a, b, 0.5, ""); code != grpcOK {
+		t.Fatalf("status %d without grpc-timeout after a timed-out request, want %d", code, grpcOK)
+	}
+}
+
+func TestReadGRPCMessageLimits(t *testing.T) {
+	var body bytes.Buffer
+	if err := writeGRPCMessage(&body, make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, code, err := readGRPCMessage(bytes.NewReader(body.Bytes()), 99); err == nil || code != grpcResourceExhausted {
+		t.Errorf("oversized message: code %d, err %v; want %d", code, err, grpcResourceExhausted)
+	}
+	compressed := append([]byte{1}, body.Bytes()[1:]...)
+	if _, code, err := readGRPCMessage(bytes.NewReader(compressed), 100); err == nil || code != grpcUnimplemented {
+		t.Errorf("compressed message: code %d, err %v; want %d", code, err, grpcUnimplemented)
+	}
+	if _, code, err := readGRPCMessage(bytes.NewReader(body.Bytes()[:50]), 100); err == nil || code != grpcInvalidArgument {
+		t.Errorf("truncated message: code %d, err %v; want %d", code, err, grpcInvalidArgument)
+	}
+}
+
+func TestDecodeDiffRequestWireTypes(t *testing.T) {
+	var req protoMessage
+	req.varint(1, 7) // a is a string
+	if _, err := decodeDiffRequest(req); err == nil {
+		t.Error("a varint for field a was accepted")
+	}
+	if _, err := decodeDiffRequest([]byte{0x0a, 0x05, 'a'}); err == nil {
+		t.Error("a truncated string was accepted")
+	}
+	var unknown protoMessage
+	unknown.string(1, "text")
+	unknown.varint(99, 1)
+	got, err := decodeDiffRequest(unknown)
+	if err != nil || got.A != "text" {
+		t.Errorf("unknown field: got %+v, %v", got, err)
+	}
+}
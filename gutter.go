@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// ShowLineNumbers prints the detailed block text of the text report line by line
+// with File A/B line numbers, and adds A and B line-number gutters to line-level
+// changes (--line-numbers).
+var ShowLineNumbers bool
+
+// firstTextLine returns the file line a block's text starts on. Paragraph text
+// is trimmed, so when it has fewer lines than its source, leading blank source
+// lines are skipped.
+func firstTextLine(cb *ContentBlock) int {
+	if strings.Count(cb.OriginalText, "\n")+1 >= len(cb.SourceLineRefs) {
+		return cb.LineStart
+	}
+	for _, li := range cb.SourceLineRefs {
+		if strings.TrimSpace(li.OriginalText) != "" {
+			return li.OriginalLineNum
+		}
+	}
+	return cb.LineStart
+}
+
+// printNumberedBlocks prints every line of the given blocks of one file, marked
+// like context lines (e.g. "    + L12 | text") so the two line up.
+func printNumberedBlocks(indent, label, marker string, blocks []*ContentBlock) {
+	if label != "" {
+		fmt.Printf("%s%s:\n", indent, label)
+	}
+	for _, cb := range blocks {
+		n := firstTextLine(cb)
+		for _, line := range strings.Split(cb.OriginalText, "\n") {
+			fmt.Println(strings.TrimRight(fmt.Sprintf("%s%s L%d | %s", indent, marker, n, bidiIsolate(line)), " "))
+			n++
+		}
+	}
+}
+
+// lineLocator finds the file lines of successive ops of a line-level diff in
+// one block, for line-number gutters. Ops that reproduce the block text exactly
+// (dmp line diffs) are numbered by counting lines; otherwise (sentence-level
+// diffs) each piece is searched for after the previous one, and 0 means it was
+// not found.
+type lineLocator struct {
+	text  string
+	pos   int
+	first int
+	exact bool
+}
+
+// newLineLocator returns a locator for the ops of cb's side: all ops except
+// those of the other side's operation, skip.
+func newLineLocator(cb *ContentBlock, ops []LineDiffOp, skip diffmatchpatch.Operation) *lineLocator {
+	if cb == nil {
+		return nil
+	}
+	var side strings.Builder
+	for _, op := range ops {
+		if op.Operation != skip {
+			side.WriteString(op.Text)
+		}
+	}
+	return &lineLocator{text: cb.OriginalText, first: firstTextLine(cb), exact: side.String() == cb.OriginalText}
+}
+
+// lines returns the file line of each line of an op's text.
+func (l *lineLocator) lines(opText string) []int {
+	pieces := strings.Split(strings.TrimSuffix(opText, "\n"), "\n")
+	nums := make([]int, len(pieces))
+	if l == nil {
+		return nums
+	}
+	if l.exact {
+		line := l.first + strings.Count(l.text[:l.pos], "\n")
+		for m := range pieces {
+			nums[m] = line + m
+		}
+		l.pos += len(opText)
+		return nums
+	}
+	for m, piece := range pieces {
+		idx := strings.Index(l.text[l.pos:], piece)
+		if piece == "" || idx < 0 {
+			continue
+		}
+		start := l.pos + idx
+		l.pos = start + len(piece)
+		nums[m] = l.first + strings.Count(l.text[:start], "\n")
+	}
+	return nums
+}
+
+// lineGutter formats the A and B line-number columns of a line-level change,
+// leaving a column blank for 0.
+func lineGutter(lineA, lineB, width int) string {
+	column := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+	return fmt.Sprintf("%*s %*s ", width, column(lineA), width, column(lineB))
+}
+
+// lineDiffGutters returns the gutter for each line printLineDiffOps prints, in
+// order, locating deleted lines in blockA, inserted lines in blockB and equal
+// lines in both.
+func lineDiffGutters(ops []LineDiffOp, blockA, blockB *ContentBlock) []string {
+	width := 1
+	for _, cb := range []*ContentBlock{blockA, blockB} {
+		if cb != nil {
+			width = max(width, len(strconv.Itoa(cb.LineEnd)))
+		}
+	}
+	locA := newLineLocator(blockA, ops, diffmatchpatch.DiffInsert)
+	locB := newLineLocator(blockB, ops, diffmatchpatch.DiffDelete)
+	var gutters []string
+	for _, op := range ops {
+		var linesA, linesB []int
+		if op.Operation != diffmatchpatch.DiffInsert {
+			linesA = locA.lines(op.Text)
+		}
+		if op.Operation != diffmatchpatch.DiffDelete {
+			linesB = locB.lines(op.Text)
+		}
+		for m, opLine := range strings.Split(strings.TrimSuffix(op.Text, "\n"), "\n") {
+			if strings.TrimSpace(opLine) == "" && op.Operation == diffmatchpatch.DiffEqual {
+				continue
+			}
+			lineA, lineB := 0, 0
+			if linesA != nil {
+				lineA = linesA[m]
+			}
+			if linesB != nil {
+				lineB = linesB[m]
+			}
+			gutters = append(gutters, lineGutter(lineA, lineB, width))
+		}
+	}
+	return gutters
+}
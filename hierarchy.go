@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// LevelThresholds are the similarity thresholds used at each level of --hierarchical mode.
+// Sentence is the similarity at which two differing sentences still count as equal.
+type LevelThresholds struct {
+	Section   float64
+	Paragraph float64
+	Sentence  float64
+}
+
+// defaultLevelThresholds uses threshold for sections and paragraphs, and
+// requires sentences to be equal.
+func defaultLevelThresholds(threshold float64) LevelThresholds {
+	return LevelThresholds{Section: threshold, Paragraph: threshold, Sentence: 1.0}
+}
+
+// parseLevelThresholds parses "section=0.4,paragraph=0.55,sentence=0.9". Levels not
+// mentioned default to defaultThreshold, except sentence which defaults to 1.0 (exact).
+func parseLevelThresholds(spec string, defaultThreshold float64) (LevelThresholds, error) {
+	lt := defaultLevelThresholds(defaultThreshold)
+	if strings.TrimSpace(spec) == "" {
+		return lt, nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return lt, fmt.Errorf("expected level=value, got %q", part)
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil || value < 0.0 || value > 1.0 {
+			return lt, fmt.Errorf("threshold for %q must be between 0.0 and 1.0, got %q", strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+		}
+		switch strings.ToLower(strings.TrimSpace(kv[0])) {
+		case "section":
+			lt.Section = value
+		case "paragraph":
+			lt.Paragraph = value
+		case "sentence":
+			lt.Sentence = value
+		default:
+			return lt, fmt.Errorf("unknown level %q (expected section, paragraph or sentence)", strings.TrimSpace(kv[0]))
+		}
+	}
+	return lt, nil
+}
+
+// Section is a heading-delimited run of lines. The preamble before the first
+// heading is a Section with an empty Title and Level 0. Parent is the index of
+// the enclosing section, the closest earlier one with a lower level (-1 for none).
+type Section struct {
+	Title     string
+	Level     int
+	Parent    int
+	LineStart int
+	LineEnd   int
+	Lines     []LineInfo
+}
+
+// Markdown ATX headings ("## Title"), AsciiDoc headings ("== Title") and
+// single-line HTML headings ("<h2>Title</h2>").
+var headingPatternHierarchy = regexp.MustCompile(`^\s{0,3}(#{1,6}|={1,6})\s+(\S.*)$`)
+var htmlHeadingPattern = regexp.MustCompile(`(?i)^\s*<h([1-6])(?:\s[^>]*)?>(.*?)</h[1-6]>\s*$`)
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// parseHeading returns the level and title of a heading line.
+func parseHeading(line string) (level int, title string, ok bool) {
+	if m := headingPatternHierarchy.FindStringSubmatch(line); m != nil {
+		return len(m[1]), strings.TrimSpace(strings.TrimRight(m[2], "#= \t")), true
+	}
+	if m := htmlHeadingPattern.FindStringSubmatch(line); m != nil {
+		return int(m[1][0] - '0'), strings.TrimSpace(htmlTagPattern.ReplaceAllString(m[2], "")), true
+	}
+	return 0, "", false
+}
+
+// splitSections cuts a file into sections at every heading line and links each
+// section to its parent in the heading tree.
+func splitSections(lines []LineInfo) []Section {
+	var sections []Section
+	current := Section{Parent: -1}
+	for _, li := range lines {
+		level, title, isHeading := parseHeading(li.OriginalText)
+		if isHeading && len(current.Lines) > 0 {
+			sections = append(sections, current)
+			current = Section{Parent: -1}
+		}
+		if len(current.Lines) == 0 {
+			current.LineStart = li.OriginalLineNum
+			if isHeading {
+				current.Title, current.Level = title, level
+				for k := len(sections) - 1; k >= 0; k-- {
+					if sections[k].Level > 0 && sections[k].Level < level {
+						current.Parent = k
+						break
+					}
+				}
+			}
+		}
+		current.Lines = append(current.Lines, li)
+		current.LineEnd = li.OriginalLineNum
+	}
+	if len(current.Lines) > 0 {
+		sections = append(sections, current)
+	}
+	return sections
+}
+
+func (sec Section) text() string {
+	parts := make([]string, len(sec.Lines))
+	for i, li := range sec.Lines {
+		parts[i] = li.OriginalText
+	}
+	return strings.Join(parts, "\n")
+}
+
+// wordSetJaccard is a cheap content similarity of normalized texts for section
+// alignment, where Levenshtein over whole sections would be too slow on
+// book-length inputs.
+func wordSetJaccard(textA, textB string) float32 {
+	setA := make(map[string]bool)
+	for _, w := range strings.Fields(textA) {
+		setA[w] = true
+	}
+	setB := make(map[string]bool)
+	for _, w := range strings.Fields(textB) {
+		setB[w] = true
+	}
+	if len(setA) == 0 && len(setB) == 0 {
+		return 1.0
+	}
+	intersection := 0
+	for w := range setA {
+		if setB[w] {
+			intersection++
+		}
+	}
+	return float32(intersection) / float32(len(setA)+len(setB)-intersection)
+}
+
+// sectionSimilarity averages title similarity and word-set overlap of the bodies.
+// Untitled sections (preambles) are compared on content alone.
+func sectionSimilarity(a, b Section, opts Options) float32 {
+	contentSim := wordSetJaccard(opts.normalize(a.text()), opts.normalize(b.text()))
+	if a.Title == "" || b.Title == "" {
+		return contentSim
+	}
+	titleSim := TextSimilarityNormalized(opts.normalize(a.Title), opts.normalize(b.Title))
+	return (titleSim + contentSim) / 2
+}
+
+// alignSections greedily pairs each A section with its most similar unpaired B
+// section, keeping pairs that reach the section threshold. Returns pairs as [aIdx, bIdx].
+func alignSections(sectionsA, sectionsB []Section, opts Options) [][2]int {
+	threshold := opts.LevelThresholds.Section
+	type candidate struct {
+		a, b int
+		sim  float32
+	}
+	var candidates []candidate
+	for i := range sectionsA {
+		for j := range sectionsB {
+			if sim := sectionSimilarity(sectionsA[i], sectionsB[j], opts); sim >= float32(threshold) {
+				candidates = append(candidates, candidate{i, j, sim})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].sim > candidates[j].sim })
+
+	usedA := make(map[int]bool)
+	usedB := make(map[int]bool)
+	var pairs [][2]int
+	for _, c := range candidates {
+		if usedA[c.a] || usedB[c.b] {
+			continue
+		}
+		usedA[c.a], usedB[c.b] = true, true
+		pairs = append(pairs, [2]int{c.a, c.b})
+		debugf(opts.Verbosity, VerbosityDecisions, "section_alignment", map[string]any{"a_line": sectionsA[c.a].LineStart, "b_line": sectionsB[c.b].LineStart, "similarity": c.sim}, "Section A L%d '%s' aligned with B L%d '%s' (sim %.2f)", sectionsA[c.a].LineStart, sectionsA[c.a].Title, sectionsB[c.b].LineStart, sectionsB[c.b].Title, c.sim)
+	}
+	return pairs
+}
+
+// relocateBlock copies a block from a per-section diff into whole-file coordinates.
+func relocateBlock(cb *ContentBlock, lineOffset, idOffset int) *ContentBlock {
+	if cb == nil {
+		return nil
+	}
+	moved := *cb
+	moved.ID += idOffset
+	moved.LineStart += lineOffset
+	moved.LineEnd += lineOffset
+	moved.SourceLineRefs = make([]LineInfo, len(cb.SourceLineRefs))
+	for i, li := range cb.SourceLineRefs {
+		li.OriginalLineNum += lineOffset
+		moved.SourceLineRefs[i] = li
+	}
+	return &moved
+}
+
+// sentenceBoundaryHierarchy matches sentence-ending punctuation followed by whitespace.
+var sentenceBoundaryHierarchy = regexp.MustCompile(`[.!?]["')\]]*\s+`)
+
+// splitSentences splits text into trimmed sentences, ignoring empty fragments.
+func splitSentences(text string) []string {
+	var sentences []string
+	last := 0
+	for _, loc := range sentenceBoundaryHierarchy.FindAllStringIndex(text, -1) {
+		if s := strings.TrimSpace(text[last:loc[1]]); s != "" {
+			sentences = append(sentences, s)
+		}
+		last = loc[1]
+	}
+	if s := strings.TrimSpace(text[last:]); s != "" {
+		sentences = append(sentences, s)
+	}
+	return sentences
+}
+
+// sentenceDiffOps diffs two texts with sentences as the unit, producing one op
+// per sentence so wrapped prose shows exactly which sentences changed. A deleted
+// sentence replaced by one at least opts.LevelThresholds.Sentence similar is
+// reported as equal.
+func sentenceDiffOps(textA, textB string, opts Options) []LineDiffOp {
+	index := make(map[string]rune)
+	var sentencesByRune []string
+	encode := func(text string) []rune {
+		var runes []rune
+		for _, s := range splitSentences(text) {
+			r, ok := index[s]
+			if !ok {
+				r = rune(len(sentencesByRune))
+				index[s] = r
+				sentencesByRune = append(sentencesByRune, s)
+			}
+			runes = append(runes, r)
+		}
+		return runes
+	}
+	runesA, runesB := encode(textA), encode(textB)
+
+	dmp := diffmatchpatch.New()
+	diffs := dmp.DiffMainRunes(runesA, runesB, false)
+	var ops []LineDiffOp
+	for i := 0; i < len(diffs); i++ {
+		d := diffs[i]
+		if d.Type == diffmatchpatch.DiffDelete && i+1 < len(diffs) && diffs[i+1].Type == diffmatchpatch.DiffInsert {
+			ops = append(ops, pairReplacedSentences([]rune(d.Text), []rune(diffs[i+1].Text), sentencesByRune, opts)...)
+			i++
+			continue
+		}
+		for _, r := range d.Text {
+			ops = append(ops, LineDiffOp{Operation: d.Type, Text: sentencesByRune[r] + "\n"})
+		}
+	}
+	return ops
+}
+
+// pairReplacedSentences walks a delete/insert hunk position by position, treating
+// sentence pairs that reach the sentence threshold as equal (shown with B's wording).
+func pairReplacedSentences(deleted, inserted []rune, sentencesByRune []string, opts Options) []LineDiffOp {
+	var ops []LineDiffOp
+	for k := 0; k < len(deleted) || k < len(inserted); k++ {
+		if k < len(deleted) && k < len(inserted) {
+			sentA, sentB := sentencesByRune[deleted[k]], sentencesByRune[inserted[k]]
+			if TextSimilarityNormalized(opts.normalize(sentA), opts.normalize(sentB)) >= float32(opts.LevelThresholds.Sentence) {
+				ops = append(ops, LineDiffOp{Operation: diffmatchpatch.DiffEqual, Text: sentB + "\n"})
+				continue
+			}
+		}
+		if k < len(deleted) {
+			ops = append(ops, LineDiffOp{Operation: diffmatchpatch.DiffDelete, Text: sentencesByRune[deleted[k]] + "\n"})
+		}
+		if k < len(inserted) {
+			ops = append(ops, LineDiffOp{Operation: diffmatchpatch.DiffInsert, Text: sentencesByRune[inserted[k]] + "\n"})
+		}
+	}
+	return ops
+}
+
+// PerformHierarchicalDiff aligns heading-delimited sections first, diffs each aligned
+// pair at paragraph level with PerformDiff, and refines changed paragraphs to
+// sentence-level diffs. Blocks never match across unaligned sections; a final LIS
+// pass over all pairs detects sections (and paragraphs) that moved. Each level uses
+// its own threshold from opts.LevelThresholds. Once ctx is cancelled, the
+// remaining sections are reported as NEW/DELETED and ctx.Err() is returned.
+func PerformHierarchicalDiff(ctx context.Context, rawContentA string, rawContentB string, opts Options) ([]DiffEntry, error) {
+	opts = opts.begin()
+	paragraphOpts := opts
+	paragraphOpts.SimilarityThreshold = opts.LevelThresholds.Paragraph
+	paragraphOpts.RescueThreshold = 0 // Run once below, across sections
+	paragraphOpts.PairAdjacent = false
+
+	allLinesA := getLinesWithInfo(rawContentA, "A", opts)
+	allLinesB := getLinesWithInfo(rawContentB, "B", opts)
+	sectionsA := splitSections(allLinesA)
+	sectionsB := splitSections(allLinesB)
+	pairs := alignSections(sectionsA, sectionsB, opts)
+	debugf(opts.Verbosity, VerbositySummary, "sections", map[string]any{"a": len(sectionsA), "b": len(sectionsB), "aligned": len(pairs)}, "Sections in A: %d, Sections in B: %d, aligned: %d", len(sectionsA), len(sectionsB), len(pairs))
+	if opts.Outline {
+		opts.Run.Outline = diffOutline(sectionsA, sectionsB, pairs)
+	}
+	parentsA, parentsB := sectionBlocks(sectionsA, "A", opts), sectionBlocks(sectionsB, "B", opts)
+
+	var pairedEntries, unpairedEntries []DiffEntry
+	defer currentRecovery.begin()()
+	currentRecovery.publish("section diffs", func() []DiffEntry { return append(append([]DiffEntry(nil), pairedEntries...), unpairedEntries...) })
+	idOffset := 0
+	pairedA := make(map[int]bool)
+	pairedB := make(map[int]bool)
+	for _, p := range pairs {
+		secA, secB := sectionsA[p[0]], sectionsB[p[1]]
+		pairedA[p[0]], pairedB[p[1]] = true, true
+		bodyA, bodyB := secA, secB
+
+		// Aligned headings pair with each other directly; they are too short for
+		// semantic matching and would otherwise show up as NEW/DELETED.
+		if secA.Title != "" && secB.Title != "" {
+			headingA := newParagraphBlock(idOffset, strings.TrimSpace(secA.Lines[0].OriginalText), "A", secA.Lines[:1], opts)
+			headingB := newParagraphBlock(idOffset+1, strings.TrimSpace(secB.Lines[0].OriginalText), "B", secB.Lines[:1], opts)
+			headingA.Parent, headingB.Parent = parentsA[p[0]], parentsB[p[1]]
+			idOffset += 2
+			entry := DiffEntry{Type: Unchanged, BlockA: &headingA, BlockB: &headingB}
+			if headingA.Checksum != headingB.Checksum {
+				entry.Type = Modified
+				entry.Similarity = TextSimilarityNormalized(headingA.NormalizedText, headingB.NormalizedText)
+				entry.LineDiffs = sentenceDiffOps(headingA.OriginalText, headingB.OriginalText, opts)
+			}
+			pairedEntries = append(pairedEntries, entry)
+			bodyA.Lines, bodyA.LineStart = secA.Lines[1:], secA.LineStart+1
+			bodyB.Lines, bodyB.LineStart = secB.Lines[1:], secB.LineStart+1
+		}
+
+		maxID := 0
+		sectionDiffs, _ := PerformDiff(ctx, bodyA.text(), bodyB.text(), paragraphOpts) // Cancellation is reported once, below
+		for _, e := range sectionDiffs {
+			for _, cb := range []*ContentBlock{e.BlockA, e.BlockB} {
+				if cb != nil && cb.ID > maxID {
+					maxID = cb.ID
+				}
+			}
+			e.BlockA = relocateBlock(e.BlockA, bodyA.LineStart-1, idOffset)
+			e.BlockB = relocateBlock(e.BlockB, bodyB.LineStart-1, idOffset)
+			e.NearMiss = relocateBlock(e.NearMiss, bodyB.LineStart-1, idOffset)
+			if e.BlockA != nil {
+				e.BlockA.Parent = parentsA[p[0]]
+			}
+			for _, cb := range []*ContentBlock{e.BlockB, e.NearMiss} {
+				if cb != nil {
+					cb.Parent = parentsB[p[1]]
+				}
+			}
+			switch e.Type {
+			case Added, Deleted:
+				unpairedEntries = append(unpairedEntries, e)
+			default:
+				// Undo the per-section move classification; LIS is rerun globally below.
+				if e.Type == Moved || e.Type == MovedModified {
+					e.Type = Unchanged
+					if e.Similarity > 0 {
+						e.Type = Modified
+					}
+				}
+				if e.Similarity > 0 {
+					e.LineDiffs = sentenceDiffOps(e.BlockA.OriginalText, e.BlockB.OriginalText, opts)
+				}
+				pairedEntries = append(pairedEntries, e)
+			}
+		}
+		idOffset += maxID + 1
+	}
+
+	// Sections without a counterpart are reported wholesale as deleted or added paragraphs.
+	for i, sec := range sectionsA {
+		if pairedA[i] {
+			continue
+		}
+		var blocks []ContentBlock
+		blocks, idOffset = SegmentGapText(sec.Lines, "A", idOffset, opts)
+		for k := range blocks {
+			blocks[k].Parent = parentsA[i]
+			unpairedEntries = append(unpairedEntries, DiffEntry{Type: Deleted, BlockA: &blocks[k]})
+		}
+	}
+	for j, sec := range sectionsB {
+		if pairedB[j] {
+			continue
+		}
+		var blocks []ContentBlock
+		blocks, idOffset = SegmentGapText(sec.Lines, "B", idOffset, opts)
+		for k := range blocks {
+			blocks[k].Parent = parentsB[j]
+			unpairedEntries = append(unpairedEntries, DiffEntry{Type: Added, BlockB: &blocks[k]})
+		}
+	}
+
+	finalDiffs := pairedEntries
+	if !opts.Pipeline.SkipClassify {
+		finalDiffs = classifyPairedMatches(pairedEntries)
+	}
+	finalDiffs = append(finalDiffs, unpairedEntries...)
+	if opts.PairAdjacent {
+		finalDiffs, _ = pairAdjacentReplacements(finalDiffs, unpairedSimilarity(finalDiffs, opts), func(textA, textB string) []LineDiffOp {
+			return sentenceDiffOps(textA, textB, opts)
+		})
+	}
+	if opts.RescueThreshold > 0 {
+		linkPossiblyRelated(ctx, finalDiffs, unpairedSimilarity(finalDiffs, opts), opts.RescueThreshold)
+	}
+	sortDiffEntries(finalDiffs)
+	return finalDiffs, ctx.Err()
+}
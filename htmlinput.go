@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ShowHTMLElements reports the DOM elements whose text changed when an input is
+// HTML (--html-elements).
+var ShowHTMLElements bool
+
+// htmlElementIndex holds the block elements of each HTML input read, by input
+// path, for --html-elements.
+var htmlElementIndex = make(map[string][]htmlElement)
+
+// htmlElement is a block element whose visible text became a paragraph of the
+// extracted text.
+type htmlElement struct {
+	Path           string // e.g. "main#content > ul > li"
+	SourceLine     int    // Line of the start tag in the HTML
+	LineStart      int    // Lines of the text in the extracted text
+	LineEnd        int
+	NormalizedText string
+}
+
+var (
+	htmlTokenPattern = regexp.MustCompile(`(?s)<!--.*?-->|<![^>]*>|<\?.*?\?>|<(/?)([A-Za-z][\w:-]*)((?:[^>"']|"[^"]*"|'[^']*')*)>`)
+	htmlAttrPattern  = regexp.MustCompile(`([\w:-]+)(?:\s*=\s*("[^"]*"|'[^']*'|[^\s>]+))?`)
+)
+
+var htmlSourceBreaks = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ")
+
+var htmlBlockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "caption": true, "dd": true, "details": true,
+	"dialog": true, "div": true, "dl": true, "dt": true, "fieldset": true, "figcaption": true, "figure": true,
+	"footer": true, "form": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hgroup": true, "hr": true, "li": true, "main": true, "nav": true, "ol": true, "p": true,
+	"pre": true, "section": true, "summary": true, "table": true, "td": true, "th": true, "tr": true, "ul": true,
+	"body": true,
+}
+
+var htmlVoidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true, "input": true,
+	"link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// htmlImpliedEnds lists, for elements whose end tag may be left out, the
+// elements that bound the search for an open one to close.
+var htmlImpliedEnds = map[string][]string{
+	"li": {"ul", "ol"},
+	"dt": {"dl"},
+	"dd": {"dl"},
+	"tr": {"table", "tbody", "thead", "tfoot"},
+	"td": {"tr", "table"},
+	"th": {"tr", "table"},
+}
+
+// isHTMLInput reports whether an input is an HTML page, by its extension.
+func isHTMLInput(path string) bool {
+	ext := strings.ToLower(filepath.Ext(inputName(path)))
+	return ext == ".html" || ext == ".htm" || ext == ".xhtml"
+}
+
+// extractHTMLText returns the visible text of an HTML page with each block
+// element's text as a paragraph, separated by blank lines, and the elements
+// the paragraphs came from. Headings become Markdown headings ("## Title").
+// Scripts, styles and the head are left out, and whitespace is collapsed
+// outside <pre>.
+func extractHTMLText(content string) (string, []htmlElement) {
+	type openElement struct {
+		tag, label string
+		line       int
+	}
+	var stack []openElement
+	var paragraphs []string
+	var elements []htmlElement
+	var text strings.Builder
+	line, lineAt := 1, 0 // Source line at offset lineAt
+	sourceLine := func(offset int) int {
+		line += strings.Count(content[lineAt:offset], "\n")
+		lineAt = offset
+		return line
+	}
+	textLine := 1 // Next line of the extracted text
+	within := func(tag string) bool {
+		for _, e := range stack {
+			if e.tag == tag {
+				return true
+			}
+		}
+		return false
+	}
+	flush := func() {
+		raw := text.String()
+		text.Reset()
+		var para string
+		if within("pre") {
+			para = strings.Trim(raw, "\n")
+		} else {
+			var lines []string
+			for _, l := range strings.Split(raw, "\n") {
+				if l = strings.Join(strings.Fields(l), " "); l != "" {
+					lines = append(lines, l)
+				}
+			}
+			para = strings.Join(lines, "\n")
+		}
+		if strings.TrimSpace(para) == "" {
+			return
+		}
+		var path []string
+		block := 0
+		for k, e := range stack {
+			if e.tag != "html" && e.tag != "body" {
+				path = append(path, e.label)
+			}
+			if htmlBlockElements[e.tag] {
+				block = k
+			}
+		}
+		startTag := line // Text after the last element was closed
+		if len(stack) > 0 {
+			startTag = stack[block].line
+			if tag := stack[block].tag; len(tag) == 2 && tag[0] == 'h' && tag[1] >= '1' && tag[1] <= '6' {
+				// Keep the heading level for --hierarchical, as a Markdown heading
+				para = strings.Repeat("#", int(tag[1]-'0')) + " " + strings.ReplaceAll(para, "\n", " ")
+			}
+		}
+		n := strings.Count(para, "\n") + 1
+		elements = append(elements, htmlElement{
+			Path:           strings.Join(path, " > "),
+			SourceLine:     startTag,
+			LineStart:      textLine,
+			LineEnd:        textLine + n - 1,
+			NormalizedText: NormalizeTextBlock(para),
+		})
+		paragraphs = append(paragraphs, para)
+		textLine += n + 1
+	}
+	closeTo := func(k int) {
+		for len(stack) > k {
+			if htmlBlockElements[stack[len(stack)-1].tag] {
+				flush()
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	openIndex := func(tag string, bounds []string) int {
+		for k := len(stack) - 1; k >= 0; k-- {
+			if stack[k].tag == tag {
+				return k
+			}
+			for _, b := range bounds {
+				if stack[k].tag == b {
+					return -1
+				}
+			}
+		}
+		return -1
+	}
+
+	pos := 0
+	for pos < len(content) {
+		loc := htmlTokenPattern.FindStringSubmatchIndex(content[pos:])
+		end := len(content)
+		if loc != nil {
+			end = pos + loc[0]
+		}
+		if !within("head") && !within("title") {
+			chunk := html.UnescapeString(content[pos:end])
+			if !within("pre") {
+				chunk = htmlSourceBreaks.Replace(chunk) // Only <br> breaks a line
+			}
+			text.WriteString(chunk)
+		}
+		if loc == nil {
+			break
+		}
+		tokenEnd := pos + loc[1]
+		if loc[4] < 0 { // Comment, doctype or processing instruction
+			pos = tokenEnd
+			continue
+		}
+		closing := loc[3] > loc[2]
+		tag := strings.ToLower(content[pos+loc[4] : pos+loc[5]])
+		attrs := content[pos+loc[6] : pos+loc[7]]
+		at := sourceLine(pos + loc[0])
+		pos = tokenEnd
+		if closing {
+			if k := openIndex(tag, nil); k >= 0 {
+				closeTo(k)
+			}
+			continue
+		}
+		if tag == "script" || tag == "style" {
+			if k := strings.Index(strings.ToLower(content[pos:]), "</"+tag); k >= 0 {
+				pos += k
+			} else {
+				pos = len(content)
+			}
+			continue
+		}
+		if tag == "br" {
+			text.WriteString("\n")
+			continue
+		}
+		if bounds, ok := htmlImpliedEnds[tag]; ok {
+			if k := openIndex(tag, bounds); k >= 0 {
+				closeTo(k)
+			}
+		}
+		if htmlBlockElements[tag] {
+			if k := openIndex("p", nil); k >= 0 {
+				closeTo(k) // A block element ends an open paragraph
+			}
+			flush()
+		}
+		if htmlVoidElements[tag] || strings.HasSuffix(strings.TrimSpace(attrs), "/") {
+			continue
+		}
+		stack = append(stack, openElement{tag: tag, label: htmlElementLabel(tag, attrs), line: at})
+	}
+	closeTo(0)
+	flush()
+	if len(paragraphs) == 0 {
+		return "", elements
+	}
+	return strings.Join(paragraphs, "\n\n") + "\n", elements
+}
+
+// htmlElementLabel renders an element as a selector: its tag with its id, or
+// else its first class, e.g. "div#main" or "p.note".
+func htmlElementLabel(tag, attrs string) string {
+	var class string
+	for _, m := range htmlAttrPattern.FindAllStringSubmatch(attrs, -1) {
+		value := strings.Trim(m[2], `"'`)
+		switch strings.ToLower(m[1]) {
+		case "id":
+			if value != "" {
+				return tag + "#" + value
+			}
+		case "class":
+			if fields := strings.Fields(value); len(fields) > 0 && class == "" {
+				class = fields[0]
+			}
+		}
+	}
+	if class != "" {
+		return tag + "." + class
+	}
+	return tag
+}
+
+// htmlElementsIn returns the elements whose text overlaps a block.
+func htmlElementsIn(elements []htmlElement, cb *ContentBlock) []htmlElement {
+	if cb == nil {
+		return nil
+	}
+	var in []htmlElement
+	for _, e := range elements {
+		if e.LineEnd >= cb.LineStart && e.LineStart <= cb.LineEnd {
+			in = append(in, e)
+		}
+	}
+	return in
+}
+
+// printHTMLElementChanges prints the HTML ELEMENTS CHANGED section: for each
+// entry that is not unchanged, the elements of its blocks whose text is not
+// found on the other side, pairing them in order, and for moved entries the
+// elements that moved.
+func printHTMLElementChanges(diffs []DiffEntry, elementsA, elementsB []htmlElement) {
+	heading, item := "\n# HTML ELEMENTS CHANGED\n", "  "
+	if OutputFormat == "markdown" {
+		heading, item = "\n## HTML ELEMENTS CHANGED\n\n", "- "
+	}
+	fmt.Print(heading)
+	total := 0
+	for _, e := range diffs {
+		if e.Type == Unchanged {
+			continue
+		}
+		inA, inB := htmlElementsIn(elementsA, e.BlockA), htmlElementsIn(elementsB, e.BlockB)
+		if e.Type != Moved {
+			seen := make(map[string]int)
+			for _, el := range inA {
+				seen[el.NormalizedText]++
+			}
+			var changedB []htmlElement
+			for _, el := range inB {
+				if seen[el.NormalizedText] > 0 {
+					seen[el.NormalizedText]--
+				} else {
+					changedB = append(changedB, el)
+				}
+			}
+			var changedA []htmlElement
+			for _, el := range inA {
+				if seen[el.NormalizedText] > 0 {
+					seen[el.NormalizedText]--
+					changedA = append(changedA, el)
+				}
+			}
+			inA, inB = changedA, changedB
+		}
+		marker := "~"
+		if e.Type == Moved {
+			marker = ">"
+		}
+		for k := 0; k < len(inA) || k < len(inB); k++ {
+			switch {
+			case k >= len(inA):
+				fmt.Printf("%s+ %s (B L%d) [%s]\n", item, inB[k].Path, inB[k].SourceLine, e.Type)
+			case k >= len(inB):
+				fmt.Printf("%s- %s (A L%d) [%s]\n", item, inA[k].Path, inA[k].SourceLine, e.Type)
+			default:
+				fmt.Printf("%s%s %s (A L%d -> B L%d) [%s]\n", item, marker, inB[k].Path, inA[k].SourceLine, inB[k].SourceLine, e.Type)
+			}
+			total++
+		}
+	}
+	if total == 0 {
+		fmt.Printf("%sNo element text changed.\n", item)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// InputMode selects how the inputs are parsed (--mode): "text" diffs them as
+// documents, "json" and "yaml" as values compared structurally.
+var InputMode = "text"
+
+// JSONChange is a structural difference between two JSON (or YAML) documents.
+// PathA is empty for a NEW value and PathB for a DELETED one; array elements
+// that moved have different indices in the two paths. LineA and LineB are the
+// source lines of the paths when known (YAML), else 0.
+type JSONChange struct {
+	Type         DiffType
+	PathA, PathB string
+	A, B         any
+	Similarity   float32
+	LineA, LineB int
+}
+
+var jsonIdentifierPattern = regexp.MustCompile(`^[A-Za-z_$][\w$]*$`)
+
+// parseJSONDocument decodes a whole input as one JSON value, keeping numbers
+// as written.
+func parseJSONDocument(content string) (any, error) {
+	dec := json.NewDecoder(strings.NewReader(content))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after the top-level value")
+	}
+	return v, nil
+}
+
+// canonicalJSON renders a value compactly with object keys sorted, so equal
+// values render identically.
+func canonicalJSON(v any) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v) // Decoded values always encode
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// jsonEqual reports whether two values are equal; numbers compare by value,
+// so 1 equals 1.0.
+func jsonEqual(a, b any) bool {
+	if na, ok := a.(json.Number); ok {
+		if nb, ok := b.(json.Number); ok {
+			fa, errA := na.Float64()
+			fb, errB := nb.Float64()
+			if errA == nil && errB == nil {
+				return fa == fb
+			}
+		}
+	}
+	return canonicalJSON(a) == canonicalJSON(b)
+}
+
+// jsonKind is "object", "array" or "scalar".
+func jsonKind(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	}
+	return "scalar"
+}
+
+// jsonSimilarity scores two values by the normalized text of their canonical
+// renderings, so --mask and --ignore-numbers apply.
+func jsonSimilarity(a, b any, opts Options) float32 {
+	return TextSimilarityNormalized(opts.normalize(canonicalJSON(a)), opts.normalize(canonicalJSON(b)))
+}
+
+// sortedJSONKeys returns the keys of an object in sorted order.
+func sortedJSONKeys(obj map[string]any) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// jsonKeyPath appends an object key to a path, e.g. $.name or $["first name"].
+func jsonKeyPath(path, key string) string {
+	if jsonIdentifierPattern.MatchString(key) {
+		return path + "." + key
+	}
+	return path + "[" + strconv.Quote(key) + "]"
+}
+
+// jsonIndexPath appends an array index to a path, e.g. $.items[2].
+func jsonIndexPath(path string, index int) string {
+	return fmt.Sprintf("%s[%d]", path, index)
+}
+
+// diffJSON compares two decoded JSON documents. Objects are compared key by
+// key whatever their key order; array elements are paired by the similarity
+// engine, and paired elements out of order are reported as moved.
+func diffJSON(a, b any, opts Options) []JSONChange {
+	var changes []JSONChange
+	diffJSONValues("$", "$", a, b, opts, &changes)
+	return changes
+}
+
+func diffJSONValues(pathA, pathB string, a, b any, opts Options, changes *[]JSONChange) {
+	objA, okA := a.(map[string]any)
+	objB, okB := b.(map[string]any)
+	if okA && okB {
+		keys := sortedJSONKeys(objA)
+		for _, k := range sortedJSONKeys(objB) {
+			if _, ok := objA[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			va, inA := objA[k]
+			vb, inB := objB[k]
+			switch {
+			case !inB:
+				*changes = append(*changes, JSONChange{Type: Deleted, PathA: jsonKeyPath(pathA, k), A: va})
+			case !inA:
+				*changes = append(*changes, JSONChange{Type: Added, PathB: jsonKeyPath(pathB, k), B: vb})
+			default:
+				diffJSONValues(jsonKeyPath(pathA, k), jsonKeyPath(pathB, k), va, vb, opts, changes)
+			}
+		}
+		return
+	}
+	arrA, okA := a.([]any)
+	arrB, okB := b.([]any)
+	if okA && okB {
+		diffJSONArrays(pathA, pathB, arrA, arrB, opts, changes)
+		return
+	}
+	if !jsonEqual(a, b) {
+		*changes = append(*changes, JSONChange{Type: Modified, PathA: pathA, PathB: pathB, A: a, B: b, Similarity: jsonSimilarity(a, b, opts)})
+	}
+}
+
+// diffJSONArrays pairs equal elements first, then the most similar remaining
+// elements of the same kind scoring at least the threshold. Paired elements outside
+// the longest run in the same order are MOVED, or MOVED_AND_CHANGED with their
+// inner changes reported underneath.
+func diffJSONArrays(pathA, pathB string, arrA, arrB []any, opts Options, changes *[]JSONChange) {
+	partnerOfA := make(map[int]int)
+	pairedB := make(map[int]bool)
+	byValue := make(map[string][]int)
+	for j, v := range arrB {
+		byValue[canonicalJSON(v)] = append(byValue[canonicalJSON(v)], j)
+	}
+	for i, v := range arrA {
+		key := canonicalJSON(v)
+		if queue := byValue[key]; len(queue) > 0 {
+			partnerOfA[i], pairedB[queue[0]] = queue[0], true
+			byValue[key] = queue[1:]
+		}
+	}
+
+	type candidate struct {
+		i, j  int
+		score float32
+	}
+	var candidates []candidate
+	for i, va := range arrA {
+		if _, ok := partnerOfA[i]; ok {
+			continue
+		}
+		for j, vb := range arrB {
+			if pairedB[j] || jsonKind(va) != jsonKind(vb) {
+				continue
+			}
+			if score := jsonSimilarity(va, vb, opts); float64(score) >= opts.SimilarityThreshold {
+				candidates = append(candidates, candidate{i, j, score})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(x, y int) bool { return candidates[x].score > candidates[y].score })
+	for _, c := range candidates {
+		if _, ok := partnerOfA[c.i]; !ok && !pairedB[c.j] {
+			partnerOfA[c.i], pairedB[c.j] = c.j, true
+		}
+	}
+
+	var order [][2]int
+	for i := range arrA {
+		if j, ok := partnerOfA[i]; ok {
+			order = append(order, [2]int{i, j})
+		}
+	}
+	inOrder := longestIncreasingB(order)
+	for i, va := range arrA {
+		elemA := jsonIndexPath(pathA, i)
+		j, ok := partnerOfA[i]
+		if !ok {
+			*changes = append(*changes, JSONChange{Type: Deleted, PathA: elemA, A: va})
+			continue
+		}
+		elemB, vb := jsonIndexPath(pathB, j), arrB[j]
+		equal := jsonEqual(va, vb)
+		switch {
+		case inOrder[i] && equal:
+		case inOrder[i]:
+			diffJSONValues(elemA, elemB, va, vb, opts, changes)
+		case equal:
+			*changes = append(*changes, JSONChange{Type: Moved, PathA: elemA, PathB: elemB, A: va, B: vb, Similarity: 1})
+		default:
+			*changes = append(*changes, JSONChange{Type: MovedModified, PathA: elemA, PathB: elemB, A: va, B: vb, Similarity: jsonSimilarity(va, vb, opts)})
+			if jsonKind(va) != "scalar" {
+				diffJSONValues(elemA, elemB, va, vb, opts, changes)
+			}
+		}
+	}
+	for j, vb := range arrB {
+		if !pairedB[j] {
+			*changes = append(*changes, JSONChange{Type: Added, PathB: jsonIndexPath(pathB, j), B: vb})
+		}
+	}
+}
+
+// reportJSON diffs two JSON inputs structurally and prints the changes by
+// path, returning the process exit code.
+func reportJSON(fileAPath, fileBPath string, opts Options) int {
+	rawContentA, rawContentB, err := readInputs(fileAPath, fileBPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return ExitTrouble
+	}
+	a, err := parseJSONDocument(rawContentA)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --mode json: %s: %v\n", fileAPath, err)
+		return ExitTrouble
+	}
+	b, err := parseJSONDocument(rawContentB)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --mode json: %s: %v\n", fileBPath, err)
+		return ExitTrouble
+	}
+	changes := diffJSON(a, b, opts)
+	if len(changes) == 0 {
+		fmt.Println("Files are semantically identical (the JSON values are equal).")
+		return ExitIdentical
+	}
+	printJSONChanges(changes)
+	return ExitDifferent
+}
+
+// printJSONChanges prints the changes grouped by type, like the block report.
+func printJSONChanges(changes []JSONChange) {
+	heading, item := "\n# %s VALUES\n", "  "
+	if OutputFormat == "markdown" {
+		heading, item = "\n## %s VALUES\n\n", "- "
+	}
+	path := func(p, side string, line int) string {
+		if OutputFormat == "markdown" {
+			p = "`" + p + "`"
+		}
+		if line > 0 {
+			p += fmt.Sprintf(" (%s L%d)", side, line)
+		}
+		return p
+	}
+	pair := func(c JSONChange) string {
+		if c.PathA != c.PathB {
+			return path(c.PathA, "A", c.LineA) + " -> " + path(c.PathB, "B", c.LineB)
+		}
+		if c.LineA > 0 || c.LineB > 0 {
+			return path(c.PathA, "", 0) + fmt.Sprintf(" (A L%d -> B L%d)", c.LineA, c.LineB)
+		}
+		return path(c.PathA, "", 0)
+	}
+	value := func(v any) string {
+		if FullContent {
+			return canonicalJSON(v)
+		}
+		return summarizedText(canonicalJSON(v), true)
+	}
+	grouped := make(map[DiffType][]JSONChange)
+	for _, c := range changes {
+		grouped[c.Type] = append(grouped[c.Type], c)
+	}
+	for _, t := range []DiffType{Added, Deleted, Moved, MovedModified, Modified} {
+		if len(grouped[t]) == 0 {
+			continue
+		}
+		fmt.Printf(heading, t)
+		for _, c := range grouped[t] {
+			switch t {
+			case Added:
+				fmt.Printf("%s+ %s: %s\n", item, path(c.PathB, "B", c.LineB), value(c.B))
+			case Deleted:
+				fmt.Printf("%s- %s: %s\n", item, path(c.PathA, "A", c.LineA), value(c.A))
+			case Moved:
+				fmt.Printf("%s> %s\n", item, pair(c))
+			case MovedModified:
+				fmt.Printf("%s~ %s [Sim: %.2f]\n", item, pair(c), c.Similarity)
+			case Modified:
+				fmt.Printf("%s~ %s: %s -> %s\n", item, pair(c), value(c.A), value(c.B))
+			}
+		}
+	}
+}
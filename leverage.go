@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ShowLeverage enables the LEVERAGE section (--leverage).
+var ShowLeverage bool
+
+// LeverageBand is a translation-memory fuzzy-match band: File B blocks whose
+// best match in File A scores at least MinPercent.
+type LeverageBand struct {
+	Name       string
+	MinPercent int
+}
+
+// LeverageBands are the usual TM bands, best first. Blocks below 50% are priced
+// as new translation.
+var LeverageBands = []LeverageBand{{"100%", 100}, {"95-99%", 95}, {"85-94%", 85}, {"75-84%", 75}, {"50-74%", 50}, {"No match", 0}}
+
+// leveragePercent is the match percentage of an entry's File B block against the
+// previous version: 100 for an unchanged block, moved or not, the similarity of a
+// changed pair, the --rescue-threshold similarity of a linked NEW block, else 0.
+func leveragePercent(e DiffEntry) int {
+	switch {
+	case e.BlockA == nil:
+		return int(e.RelatedSimilarity * 100)
+	case e.Similarity > 0:
+		return int(e.Similarity * 100)
+	default:
+		return 100
+	}
+}
+
+// leverageBand returns the index in LeverageBands of a match percentage.
+func leverageBand(percent int) int {
+	for k, band := range LeverageBands {
+		if percent >= band.MinPercent {
+			return k
+		}
+	}
+	return len(LeverageBands) - 1
+}
+
+// printLeverage prints the LEVERAGE section: segments and words of File B per
+// band, then every File B block below 100% with its band.
+func printLeverage(diffs []DiffEntry) {
+	segments := make([]int, len(LeverageBands))
+	words := make([]int, len(LeverageBands))
+	var fuzzy []DiffEntry
+	for _, e := range diffs {
+		if e.BlockB == nil {
+			continue
+		}
+		k := leverageBand(leveragePercent(e))
+		segments[k]++
+		words[k] += len(strings.Fields(e.BlockB.OriginalText))
+		if k > 0 {
+			fuzzy = append(fuzzy, e)
+		}
+	}
+	sort.SliceStable(fuzzy, func(x, y int) bool { return fuzzy[x].BlockB.LineStart < fuzzy[y].BlockB.LineStart })
+	describe := func(e DiffEntry) string {
+		if e.BlockA == nil {
+			if e.Related != nil {
+				return fmt.Sprintf("NEW, possibly related to A %s", blockRange(e.Related))
+			}
+			return "NEW"
+		}
+		return fmt.Sprintf("%s from A %s", strings.ToUpper(e.Type.String()), blockRange(e.BlockA))
+	}
+	if OutputFormat == "markdown" {
+		fmt.Print("\n## LEVERAGE\n\n")
+		fmt.Println("| Band | Segments | Words |")
+		fmt.Println("| --- | ---: | ---: |")
+		for k, band := range LeverageBands {
+			fmt.Printf("| %s | %d | %d |\n", band.Name, segments[k], words[k])
+		}
+		fmt.Println()
+		for _, e := range fuzzy {
+			percent := leveragePercent(e)
+			fmt.Printf("- B %s: %d%% (%s), %s\n", blockRange(e.BlockB), percent, LeverageBands[leverageBand(percent)].Name, describe(e))
+		}
+		return
+	}
+	fmt.Print("\n# LEVERAGE\n")
+	fmt.Printf("  %-10s %9s %9s\n", "Band", "Segments", "Words")
+	for k, band := range LeverageBands {
+		fmt.Printf("  %-10s %9d %9d\n", band.Name, segments[k], words[k])
+	}
+	for _, e := range fuzzy {
+		percent := leveragePercent(e)
+		fmt.Printf("  B %s: %d%% (%s), %s\n", blockRange(e.BlockB), percent, LeverageBands[leverageBand(percent)].Name, describe(e))
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// LineMapPath receives the line mapping table of the diff (--line-map).
+var LineMapPath string
+
+// Line mapping statuses. A line of a CHANGED block that is identical to its
+// mapped line is unchanged (moved in a MOVED_AND_CHANGED block).
+const (
+	LineUnchanged = "unchanged"
+	LineMoved     = "moved"
+	LineChanged   = "changed"
+	LineDeleted   = "deleted" // File A only
+	LineNew       = "new"     // File B only
+	LineBlank     = "blank"   // A blank line between blocks, in no block
+)
+
+// LineMapping maps a line of one file to its line in the other, 0 if none.
+type LineMapping struct {
+	Line   int    `json:"line"`
+	Mapped int    `json:"mapped_line,omitempty"`
+	Status string `json:"status"`
+}
+
+// LineMap maps every line of File A to File B and every line of File B to
+// File A, so annotations can be carried between the versions.
+type LineMap struct {
+	SchemaVersion int           `json:"schema_version"`
+	A             []LineMapping `json:"a"`
+	B             []LineMapping `json:"b"`
+}
+
+// fileLines splits content into lines, without the empty line after a final newline.
+func fileLines(content string) []string {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	if len(lines) > 1 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// buildLineMap derives the line mapping from the block pairs of diffs. The
+// lines of UNCHANGED and MOVED blocks map in order; those of CHANGED blocks
+// map to the line they share the most unchanged characters with in their
+// line diff, and lines sharing none are deleted or new.
+func buildLineMap(contentA, contentB string, diffs []DiffEntry) LineMap {
+	linesA, linesB := fileLines(contentA), fileLines(contentB)
+	m := LineMap{SchemaVersion: SchemaVersion, A: make([]LineMapping, len(linesA)), B: make([]LineMapping, len(linesB))}
+	for k := range m.A {
+		m.A[k] = LineMapping{Line: k + 1, Status: LineBlank}
+	}
+	for k := range m.B {
+		m.B[k] = LineMapping{Line: k + 1, Status: LineBlank}
+	}
+	set := func(side []LineMapping, line, mapped int, status string) {
+		if line >= 1 && line <= len(side) {
+			side[line-1].Mapped, side[line-1].Status = mapped, status
+		}
+	}
+	for _, e := range diffs {
+		switch {
+		case e.BlockB == nil:
+			for _, ref := range e.BlockA.SourceLineRefs {
+				set(m.A, ref.OriginalLineNum, 0, LineDeleted)
+			}
+		case e.BlockA == nil:
+			for _, ref := range e.BlockB.SourceLineRefs {
+				set(m.B, ref.OriginalLineNum, 0, LineNew)
+			}
+		case e.Type == Unchanged || e.Type == Moved:
+			status := LineUnchanged
+			if e.Type == Moved {
+				status = LineMoved
+			}
+			refsA, refsB := e.BlockA.SourceLineRefs, e.BlockB.SourceLineRefs
+			if len(refsA) != len(refsB) { // --ignore-blank-lines megablocks differ in blank lines only
+				refsA, refsB = nonBlankRefs(refsA), nonBlankRefs(refsB)
+			}
+			for k := 0; k < len(refsA) && k < len(refsB); k++ {
+				a, b := refsA[k].OriginalLineNum, refsB[k].OriginalLineNum
+				set(m.A, a, b, status)
+				set(m.B, b, a, status)
+			}
+		default:
+			mapChangedBlock(m, e, set)
+		}
+	}
+	return m
+}
+
+// mapChangedBlock maps the lines of a CHANGED or MOVED_AND_CHANGED pair.
+func mapChangedBlock(m LineMap, e DiffEntry, set func([]LineMapping, int, int, string)) {
+	refsA, refsB := e.BlockA.SourceLineRefs, e.BlockB.SourceLineRefs
+	ops := e.LineDiffs
+	dmp := diffmatchpatch.New()
+	var diffs []diffmatchpatch.Diff
+	for _, op := range ops {
+		diffs = append(diffs, diffmatchpatch.Diff{Type: op.Operation, Text: op.Text})
+	}
+	if dmp.DiffText1(diffs) != e.BlockA.OriginalText || dmp.DiffText2(diffs) != e.BlockB.OriginalText {
+		ops = blockLineDiffs(e.BlockA.OriginalText, e.BlockB.OriginalText) // --hierarchical sentence diffs
+	}
+
+	// shared[k][j] counts the unchanged non-space characters of block line k of
+	// A that are on block line j of B
+	shared := make([]map[int]int, len(refsA))
+	lineA, lineB := 0, 0
+	for _, op := range ops {
+		for i := 0; i < len(op.Text); i++ {
+			c := op.Text[i]
+			if op.Operation == diffmatchpatch.DiffEqual && c != ' ' && c != '\t' && c != '\n' && lineA < len(refsA) {
+				if shared[lineA] == nil {
+					shared[lineA] = make(map[int]int)
+				}
+				shared[lineA][lineB]++
+			}
+			if c == '\n' {
+				if op.Operation != diffmatchpatch.DiffInsert {
+					lineA++
+				}
+				if op.Operation != diffmatchpatch.DiffDelete {
+					lineB++
+				}
+			}
+		}
+	}
+
+	moved := e.Type == MovedModified
+	status := func(a, b LineInfo) string {
+		switch {
+		case a.OriginalText != b.OriginalText:
+			return LineChanged
+		case moved:
+			return LineMoved
+		}
+		return LineUnchanged
+	}
+	best := make([]int, len(refsB)) // Most characters any A line shares with each B line
+	mappedB := make([]int, len(refsB))
+	for k, counts := range shared {
+		bestJ, bestCount := -1, 0
+		for j, count := range counts {
+			if j < len(refsB) && (count > bestCount || count == bestCount && j < bestJ) {
+				bestJ, bestCount = j, count
+			}
+			if j < len(refsB) && count > best[j] {
+				best[j], mappedB[j] = count, k
+			}
+		}
+		if bestJ >= 0 {
+			set(m.A, refsA[k].OriginalLineNum, refsB[bestJ].OriginalLineNum, status(refsA[k], refsB[bestJ]))
+		}
+	}
+	for k, ref := range refsA {
+		if shared[k] == nil {
+			set(m.A, ref.OriginalLineNum, 0, LineDeleted)
+		}
+	}
+	for j, ref := range refsB {
+		if best[j] == 0 {
+			set(m.B, ref.OriginalLineNum, 0, LineNew)
+		} else {
+			a := refsA[mappedB[j]]
+			set(m.B, ref.OriginalLineNum, a.OriginalLineNum, status(a, ref))
+		}
+	}
+}
+
+// WriteFile writes the line map as JSON to a .json file, otherwise as CSV with
+// a row per line: file (A or B), line, mapped_line (empty if none) and status.
+func (m LineMap) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	}
+
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"file", "line", "mapped_line", "status"}); err != nil {
+		return err
+	}
+	for side, mappings := range [][]LineMapping{m.A, m.B} {
+		for _, lm := range mappings {
+			mapped := ""
+			if lm.Mapped > 0 {
+				mapped = strconv.Itoa(lm.Mapped)
+			}
+			if err := w.Write([]string{[]string{"A", "B"}[side], strconv.Itoa(lm.Line), mapped, lm.Status}); err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
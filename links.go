@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CheckLinks enables the link integrity report (--check-links); HeadCheckLinks
+// also verifies that added and retargeted links resolve (--check-links-head).
+var CheckLinks bool
+var HeadCheckLinks bool
+
+const LinkCheckTimeout = 10 * time.Second
+const LinkCheckConcurrency = 8
+
+var (
+	bareURLRe  = regexp.MustCompile(`https?://[^\s<>"'()\[\]]+[^\s<>"'()\[\].,;:!?]`)
+	htmlHrefRe = regexp.MustCompile(`(?i)<a\s[^>]*href\s*=\s*["']([^"']+)["']`)
+)
+
+// extractHyperlinks returns every link of content: Markdown links, badge targets and
+// reference definitions (labelled, so they can be paired as retargeted), plus HTML
+// hrefs and bare URLs, which are labelled by their own URL.
+func extractHyperlinks(content string) []MarkdownAsset {
+	var links []MarkdownAsset
+	seenOnLine := make(map[int]map[string]bool) // URLs already found in Markdown syntax
+	for _, a := range extractMarkdownAssets(content) {
+		if seenOnLine[a.Line] == nil {
+			seenOnLine[a.Line] = make(map[string]bool)
+		}
+		seenOnLine[a.Line][a.URL] = true
+		switch a.Kind {
+		case "link", "reference":
+			links = append(links, a)
+		case "badge":
+			seenOnLine[a.Line][a.Target] = true
+			links = append(links, MarkdownAsset{Kind: "badge link", Label: a.Label, URL: a.Target, Line: a.Line})
+		}
+	}
+	for i, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		for _, m := range htmlHrefRe.FindAllStringSubmatch(line, -1) {
+			links = append(links, MarkdownAsset{Kind: "href", Label: m[1], URL: m[1], Line: i + 1})
+			if seenOnLine[i+1] == nil {
+				seenOnLine[i+1] = make(map[string]bool)
+			}
+			seenOnLine[i+1][m[1]] = true
+		}
+		for _, u := range bareURLRe.FindAllString(line, -1) {
+			if !seenOnLine[i+1][u] {
+				links = append(links, MarkdownAsset{Kind: "url", Label: u, URL: u, Line: i + 1})
+			}
+		}
+	}
+	return links
+}
+
+// LinkStatus is the outcome of checking one link.
+type LinkStatus struct {
+	OK     bool
+	Detail string // HTTP status, "file exists" or the error
+}
+
+// checkLink resolves an http(s) URL with HEAD (falling back to GET for servers that
+// reject HEAD) and a relative link against the directory of File B, if baseDir is set.
+func checkLink(client *http.Client, link, baseDir string) LinkStatus {
+	u, err := url.Parse(link)
+	if err != nil {
+		return LinkStatus{Detail: err.Error()}
+	}
+	switch u.Scheme {
+	case "http", "https":
+		resp, err := client.Head(link)
+		if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+			resp.Body.Close()
+			resp, err = client.Get(link)
+		}
+		if err != nil {
+			return LinkStatus{Detail: err.Error()}
+		}
+		resp.Body.Close()
+		return LinkStatus{OK: resp.StatusCode < 400, Detail: resp.Status}
+	case "":
+		if u.Path == "" {
+			return LinkStatus{OK: true, Detail: "in-page anchor"}
+		}
+		if baseDir == "" {
+			return LinkStatus{OK: true, Detail: "not checked (File B is an object-store URI)"}
+		}
+		if _, err := os.Stat(filepath.Join(baseDir, filepath.FromSlash(u.Path))); err != nil {
+			return LinkStatus{Detail: "file not found"}
+		}
+		return LinkStatus{OK: true, Detail: "file exists"}
+	default:
+		return LinkStatus{OK: true, Detail: "not checked (" + u.Scheme + ")"}
+	}
+}
+
+// checkNewLinks checks the new side of every added or retargeted link, each distinct URL once.
+func checkNewLinks(changes []AssetChange, baseDir string) map[string]LinkStatus {
+	client := &http.Client{Timeout: LinkCheckTimeout}
+	results := make(map[string]LinkStatus)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, LinkCheckConcurrency)
+	for _, c := range changes {
+		if c.New == nil {
+			continue
+		}
+		link := c.New.URL
+		mu.Lock()
+		_, queued := results[link]
+		results[link] = LinkStatus{}
+		mu.Unlock()
+		if queued {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			status := checkLink(client, link, baseDir)
+			<-sem
+			mu.Lock()
+			results[link] = status
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// printLinkChanges prints the LINK CHANGES section, with check results when statuses is non-nil.
+func printLinkChanges(changes []AssetChange, statuses map[string]LinkStatus) {
+	heading, item := "\n# LINK CHANGES\n", "  "
+	if OutputFormat == "markdown" {
+		heading, item = "\n## LINK CHANGES\n\n", "- "
+	}
+	fmt.Print(heading)
+	added, removed, retargeted, broken := 0, 0, 0, 0
+	for _, c := range changes {
+		check := ""
+		if c.New != nil {
+			if status, ok := statuses[c.New.URL]; ok {
+				check = " [" + status.Detail + "]"
+				if !status.OK {
+					check = " [BROKEN: " + status.Detail + "]"
+					broken++
+				}
+			}
+		}
+		switch {
+		case c.Old != nil && c.New != nil:
+			retargeted++
+			fmt.Printf("%s~ %s %q (A L%d -> B L%d): %s -> %s%s\n", item, c.New.Kind, c.New.Label, c.Old.Line, c.New.Line, c.Old.URL, c.New.URL, check)
+		case c.Old != nil:
+			removed++
+			fmt.Printf("%s- %s (A L%d): %s\n", item, c.Old.Kind, c.Old.Line, c.Old.URL)
+		default:
+			added++
+			fmt.Printf("%s+ %s (B L%d): %s%s\n", item, c.New.Kind, c.New.Line, c.New.URL, check)
+		}
+	}
+	summary := fmt.Sprintf("%sTotal: %d added, %d removed, %d retargeted", item, added, removed, retargeted)
+	if statuses != nil {
+		summary += fmt.Sprintf(", %d broken", broken)
+	}
+	fmt.Println(summary + ".")
+}
@@ -1,21 +1,54 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
-var DebugMode bool
-var SimilarityThreshold float64
-var DetailsSections map[DiffType]bool
 var FocusRangeStr string
+var FocusPatternStr string
+var NoEscalate bool
+var DumpMatrixPath string
+var ShowStats bool
+var StatsJSONPath string
+var HierarchicalMode bool
+var QuietMode bool
+var TUIMode bool
+var WatchMode bool
+var WatchInterval time.Duration
+var DiffTimeout time.Duration
+var ShowConfidence bool
+var SampleSize int
+var SampleSeed int64
+
+// FullContent prints whole blocks in detailed sections (--full-content);
+// otherwise text is cut at SummaryWidth characters, or 80 (60 in compact
+// listings) when it is 0 (--summary-width).
+var FullContent bool
+var SummaryWidth int
+
+// CoalesceGap is how many lines may separate neighbouring blocks that are merged
+// into one detailed entry (--coalesce-gap); -1 prints every block on its own
+// (--no-coalesce).
+var CoalesceGap = 1
+
+// Exit codes follow GNU diff: 0 identical, 1 differences found, 2 trouble.
+const (
+	ExitIdentical = 0
+	ExitDifferent = 1
+	ExitTrouble   = 2
+)
 
 const MaxMovedSummariesCompact = 5
 const MaxModifiedSummariesCompact = 3
@@ -25,36 +58,62 @@ type FocusRange struct {
 	IsSet              bool
 }
 
-var CurrentFocusRange FocusRange
+// detailsSectionNames maps the --details section names and their aliases to
+// entry types; "_" is read as "-", so the report names (e.g.
+// MOVED_AND_CHANGED) work too.
+var detailsSectionNames = map[string][]DiffType{
+	"all":                {Added, Deleted, Modified, Moved, MovedModified, Unchanged},
+	"none":               nil,
+	"new":                {Added},
+	"added":              {Added},
+	"deleted":            {Deleted},
+	"removed":            {Deleted},
+	"changed":            {Modified},
+	"modified":           {Modified},
+	"moved":              {Moved},
+	"moved-changed":      {MovedModified},
+	"moved-modified":     {MovedModified},
+	"moved-and-changed":  {MovedModified},
+	"unchanged":          {Unchanged},
+	"unchanged-in-place": {Unchanged},
+}
 
-// parseDetailsFlag is stable
-func parseDetailsFlag(detailsStr string) map[DiffType]bool {
+// parseDetailsFlag reads a --details list. Sections are applied left to right:
+// a name adds its sections and "-name" removes them, so "all,-unchanged" lists
+// everything but unchanged blocks. A list that starts with an exclusion starts
+// from all sections; "none" clears the list so far.
+func parseDetailsFlag(detailsStr string) (map[DiffType]bool, error) {
 	sections := make(map[DiffType]bool)
-	if detailsStr == "all" {
-		sections[Added] = true
-		sections[Deleted] = true
-		sections[Modified] = true
-		sections[Moved] = true
-		sections[Unchanged] = true
-		return sections
-	}
-	parts := strings.Split(detailsStr, ",")
-	for _, part := range parts {
-		trimmedPart := strings.ToLower(strings.TrimSpace(part))
-		switch trimmedPart {
-		case "new", "added":
-			sections[Added] = true
-		case "deleted":
-			sections[Deleted] = true
-		case "changed", "modified":
-			sections[Modified] = true
-		case "moved":
-			sections[Moved] = true
-		case "unchanged":
-			sections[Unchanged] = true
-		}
-	}
-	return sections
+	first := true
+	for _, part := range strings.Split(detailsStr, ",") {
+		name := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(part)), "_", "-")
+		if name == "" {
+			continue
+		}
+		exclude := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		types, ok := detailsSectionNames[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown section %q (expected new, deleted, changed, moved, moved-changed, unchanged, all or none, each optionally prefixed with - to exclude it)", strings.TrimSpace(part))
+		}
+		if exclude && first {
+			for _, t := range detailsSectionNames["all"] {
+				sections[t] = true
+			}
+		}
+		first = false
+		if name == "none" && !exclude {
+			clear(sections)
+		}
+		for _, t := range types {
+			if exclude {
+				delete(sections, t)
+			} else {
+				sections[t] = true
+			}
+		}
+	}
+	return sections, nil
 }
 
 // parseFocusRange is stable
@@ -76,60 +135,1015 @@ func parseFocusRange(focusStr string) FocusRange {
 	return FocusRange{StartLine: start, EndLine: end, IsSet: true}
 }
 
+// wasmMain replaces the command line in the WebAssembly build (wasm.go).
+var wasmMain func()
+
 func main() {
+	if wasmMain != nil {
+		wasmMain()
+		return
+	}
+	if code, ok := dispatchSubcommand(); ok {
+		os.Exit(code)
+	}
+	opts := DefaultOptions()
 	var detailsFlagStr string
-	flag.BoolVar(&DebugMode, "debug", false, "Enable debug printing")
-	flag.StringVar(&detailsFlagStr, "details", "new,deleted", "Comma-separated list of sections to show in detail (new,deleted,changed,moved,unchanged,all)")
-	flag.Float64Var(&SimilarityThreshold, "threshold", 0.55, "Semantic similarity threshold (0.0 to 1.0)")
+	var levelThresholdsStr string
+	var maxMemoryStr, blockStoreMaxSizeStr, pipelineStr string
+	var styleRulesStr string
+	var noCoalesce bool
+	var presetName, savePresetName string
+	var encodingStr string
+	var similarityWeightsStr string
+	var verbose, veryVerbose, debugVerbose, debug bool
+	flag.BoolVar(&verbose, "v", false, "Print settings, block counts and stage timings on stderr")
+	flag.BoolVar(&veryVerbose, "vv", false, "Like -v, plus escalations, budget shortcuts, backend fallbacks and section alignment")
+	flag.BoolVar(&debugVerbose, "vvv", false, "Like -vv, plus every semantic match decision")
+	flag.BoolVar(&debug, "debug", false, "Same as -vvv")
+	flag.StringVar(&CPUProfilePath, "cpuprofile", "", "Write a CPU profile of the run to this file, for 'go tool pprof'")
+	flag.StringVar(&MemProfilePath, "memprofile", "", "Write a heap profile to this file when the run ends, for 'go tool pprof'")
+	flag.BoolVar(&ShowTimings, "timings", false, "Print how long each diff stage took on stderr")
+	flag.StringVar(&LogFilePath, "log-file", "", "Append every debug event to this file as JSON lines, whatever the verbosity")
+	flag.BoolVar(&TUIMode, "tui", false, "Browse the diff interactively in the terminal")
+	flag.BoolVar(&WatchMode, "watch", false, "Re-run the diff whenever either input file changes")
+	flag.DurationVar(&WatchInterval, "watch-interval", 500*time.Millisecond, "How long --watch waits for a change to settle before re-diffing, and how often it polls where file events are unavailable")
+	flag.BoolVar(&ForceProgress, "progress", false, "Always show stage progress on stderr (default: only for large inputs on a terminal)")
+	flag.BoolVar(&NoProgress, "no-progress", false, "Never show stage progress on stderr")
+	flag.BoolVar(&QuietMode, "quiet", false, "Suppress all output; only the exit status reports whether the files differ")
+	flag.StringVar(&OutputFormat, "format", "text", "Report format: text, markdown (every entry gets a stable permalink anchor), side-by-side (two columns sized to the terminal), github (GitHub Actions annotations on File B) or rdjson (Reviewdog diagnostics on File B)")
+	flag.StringVar(&InputMode, "mode", InputMode, "Input mode: text (documents), json or yaml (parse both inputs and diff them structurally, reporting paths; yaml also matches renamed and moved entries and reports line numbers), or csv (rows as blocks, with per-cell changes)")
+	flag.StringVar(&CSVKeyColumns, "csv-key", "", "Comma-separated columns identifying a row in --mode csv (default: pair rows by content)")
+	flag.StringVar(&CSVDelimiter, "csv-delimiter", "", "Field separator for --mode csv: one character or \\t (default: tab for .tsv and .tab files, else comma)")
+	flag.StringVar(&detailsFlagStr, "details", "new,deleted", "Comma-separated list of sections to show in detail (new,deleted,changed,moved,moved-changed,unchanged,all,none); prefix a section with - to exclude it, e.g. all,-unchanged")
+	flag.IntVar(&CoalesceGap, "coalesce-gap", CoalesceGap, "Merge detailed entries whose blocks are at most this many lines apart (0 merges only adjacent blocks)")
+	flag.BoolVar(&noCoalesce, "no-coalesce", false, "Print every block of the detailed sections individually, with its own similarity")
+	flag.BoolVar(&FullContent, "full-content", false, "Print the complete text of every block in detailed sections instead of a truncated summary")
+	flag.IntVar(&ContextLines, "context", 0, "Show this many lines around each detailed NEW, DELETED and CHANGED entry of the text report")
+	flag.IntVar(&ContextLines, "C", 0, "Shorthand for --context")
+	flag.IntVar(&SummaryWidth, "summary-width", 0, "Truncate summarized block text to this many characters (0 = 80 in detailed sections, 60 elsewhere)")
+	flag.Float64Var(&opts.SimilarityThreshold, "threshold", opts.SimilarityThreshold, "Semantic similarity threshold (0.0 to 1.0)")
+	flag.StringVar(&SimilarityCommand, "similarity-cmd", "", "External scorer used instead of --similarity: a program reading JSON lines of block pairs on stdin and answering a line of scores per request")
+	flag.StringVar(&opts.SimilarityMetric, "similarity", "", "Similarity metric: levenshtein, cosine, jaccard, shingle, tfidf or combined (default: cosine with a reachable --embedding-url, else levenshtein)")
+	flag.IntVar(&opts.ShingleSize, "shingle-size", opts.ShingleSize, "Words per shingle for --similarity shingle")
+	flag.StringVar(&similarityWeightsStr, "similarity-weights", "", "Component weights for --similarity combined, e.g. levenshtein=0.5,jaccard=0.3,tfidf=0.2,cosine=0.2 (implies combined)")
 	flag.StringVar(&FocusRangeStr, "focus", "", "Report on lines n,m from File A (e.g., --focus 10,20)")
+	flag.StringVar(&FocusPatternStr, "focus-pattern", "", "Report the fate of every File A block whose content matches this regexp")
+	flag.IntVar(&opts.MaxBlockLines, "max-block-lines", opts.MaxBlockLines, "Split gap paragraphs longer than this many lines into sentence-aware windows (0 disables)")
+	flag.IntVar(&opts.MinAnchorLines, "min-anchor-lines", opts.MinAnchorLines, "Minimum number of identical consecutive lines that anchor the diff as an unchanged megablock")
+	flag.BoolVar(&opts.IgnoreNumbers, "ignore-numbers", false, "Mask numbers when comparing text, so blocks that differ only in figures, version numbers or counters match as unchanged")
+	flag.Var(&opts.Masks, "mask", "Replace matches of a regexp with a placeholder before comparing text, as regexp=placeholder (e.g. '\\d{4}-\\d{2}-\\d{2}=<date>'); repeatable, applied in order")
+	flag.StringVar(&encodingStr, "encoding", "auto", "Character encoding of the inputs: auto, utf-8, utf-16le, utf-16be, latin1 or windows-1252; one for both files or two as A,B (auto detects a BOM, else reads invalid UTF-8 as Windows-1252)")
+	flag.BoolVar(&ShowHTMLElements, "html-elements", false, "For .html inputs, report the DOM elements whose visible text changed, with their source lines")
+	flag.BoolVar(&opts.IgnoreBlankLines, "ignore-blank-lines", false, "Ignore added and removed blank lines: identical text separated by different blank lines still anchors as one unchanged block")
+	flag.IntVar(&opts.MinParagraphLines, "min-paragraph-lines", opts.MinParagraphLines, "Minimum lines for a gap paragraph to be semantically matched; shorter ones are reported as NEW/DELETED (1 matches every paragraph)")
+	flag.StringVar(&pipelineStr, "pipeline", strings.Join(PipelineStages, ","), "Engine stages to run, in order; leave out exact-match, semantic-match or classify to skip them, and add exec:cmd stages before render to post-process the entries (preprocess, segment and render always run)")
+	flag.BoolVar(&opts.PairAdjacent, "pair-adjacent", false, "Pair DELETED and NEW blocks at corresponding positions between the same unchanged or changed blocks as CHANGED, whatever their similarity")
+	flag.Float64Var(&opts.RescueThreshold, "rescue-threshold", 0, "Link leftover DELETED and NEW blocks scoring at least this (below --threshold) as possibly related (0 disables)")
+	flag.BoolVar(&opts.Explain, "explain", false, "For each CHANGED and MOVED pair, report why it was matched: the similarity components, the anchoring unchanged or changed blocks and the lower-ranked candidates")
+	flag.BoolVar(&ShowNearMisses, "show-near-misses", false, "List DELETED blocks whose best candidate scored just below --threshold, with the score")
+	flag.Float64Var(&NearMissMargin, "near-miss-margin", NearMissMargin, "How far below --threshold a --show-near-misses candidate may score")
+	flag.DurationVar(&DiffTimeout, "timeout", 0, "Cancel the diff after this long (e.g. 30s) and report partial results with exit status 2 (0 = no limit)")
+	flag.DurationVar(&opts.TimeBudget, "budget", 0, "Total time budget (e.g. 5s); stages degrade to meet it and a best-effort report is always printed (0 = unlimited)")
+	flag.StringVar(&maxMemoryStr, "max-memory", "", "Memory budget (e.g. 512MB); larger inputs are streamed and diffed in overlapping windows")
+	flag.BoolVar(&opts.NoLSH, "no-lsh", false, "Score every gap block pair instead of pruning candidates with MinHash/LSH on large inputs")
+	flag.BoolVar(&NoEscalate, "no-escalate", false, "Do not retry at finer granularity / lower threshold when nothing matches")
+	flag.StringVar(&opts.EmbeddingURL, "embedding-url", "", "Embedding endpoint (TEI-style /embed) used for semantic similarity; falls back to Levenshtein if unreachable")
+	flag.IntVar(&EmbeddingBatchSize, "embedding-batch-size", EmbeddingBatchSize, "Texts per --embedding-url request; keep within the server's limit (text-embeddings-inference --max-client-batch-size)")
+	flag.IntVar(&EmbeddingConcurrency, "embedding-concurrency", EmbeddingConcurrency, "Most --embedding-url requests in flight at once")
+	flag.IntVar(&EmbeddingRetries, "embedding-retries", EmbeddingRetries, "Retries of an --embedding-url request that failed with a network error, 429 or 5xx, with exponential backoff")
+	flag.StringVar(&BlockStorePath, "block-store", "", "Shared store of --embedding-url embeddings by block checksum, reused across runs: a directory or an s3:// or gs:// prefix")
+	flag.StringVar(&blockStoreMaxSizeStr, "block-store-max-size", "", "Delete the least recently used entries of a local --block-store beyond this size (e.g. 2GB) after each run")
+	flag.BoolVar(&HierarchicalMode, "hierarchical", false, "Align heading-delimited sections first, then diff paragraphs and sentences within each aligned section")
+	flag.BoolVar(&ShowOutline, "outline", false, "Report heading changes (added, removed, renamed, re-leveled, moved sections) from the heading trees; implies --hierarchical")
+	flag.BoolVar(&ShowRollup, "rollup", false, "Summarize paragraph changes per section (\"Section 3 modified: 2 paragraphs changed, 1 moved\"), drilling down into sentence changes for --details types; implies --hierarchical")
+	flag.StringVar(&levelThresholdsStr, "level-thresholds", "", "Per-level thresholds for --hierarchical, e.g. section=0.4,paragraph=0.55,sentence=0.9")
+	flag.BoolVar(&ShowReadability, "readability", false, "Report readability (Flesch-Kincaid grade, reading ease, sentence length) of both documents and every changed block")
+	flag.StringVar(&styleRulesStr, "style-rules", "", "Report style rule violations gained or lost by each change; comma-separated rule files (\"Name: regexp\" lines, or Vale existence .yml rules) or builtin")
+	flag.BoolVar(&ShowToneShifts, "tone", false, "Flag changed blocks whose tone shifted (e.g. neutral -> promotional), by lexicon or via --embedding-url")
+	flag.BoolVar(&RedactionMode, "redacted", false, "One file is a redacted copy of the other: match redaction markers as wildcards and report what they hide")
+	flag.StringVar(&RedactionPattern, "redaction-pattern", RedactionPattern, "Regexp matching one redaction marker for --redacted")
+	flag.BoolVar(&ShowFigures, "figures", false, "List numbers (prices, limits, percentages) that changed within changed blocks, old -> new")
+	flag.BoolVar(&ShowWordCount, "word-count", false, "Count words added, deleted and reworded (within changed blocks) separately")
+	flag.BoolVar(&ShowLeverage, "leverage", false, "Report File B segments and words per translation-memory fuzzy-match band (100%, 95-99%, 85-94%, ...)")
+	flag.BoolVar(&ShowDefinedTerms, "defined-terms", false, "Report defined terms (e.g. \"Effective Date\") that were added, removed or whose definition changed")
+	flag.BoolVar(&ShowClauseMap, "clause-map", false, "Print a table mapping old clause numbers to new ones (7.2 -> 8.1), with what changed")
+	flag.BoolVar(&CheckCrossRefs, "check-xrefs", false, "Check that clause references in File B (\"Section 7.2\") point to the renumbered targets and flag stale ones")
+	flag.StringVar(&DefinedTermPattern, "defined-term-pattern", DefinedTermPattern, "Regexp matching a term definition for --defined-terms; its first group is the term")
+	flag.BoolVar(&DetectPII, "detect-pii", false, "Flag new and changed blocks that introduce emails, phone numbers, card numbers or other IDs absent from File A")
+	flag.BoolVar(&ShowConfidence, "confidence", false, "Print diff confidence indicators (exact coverage, semantic match quality, ambiguous pairings)")
+	flag.BoolVar(&GraphemeSimilarity, "grapheme-similarity", false, "Score Levenshtein similarity over grapheme clusters (emoji, combining marks) instead of code points")
+	flag.BoolVar(&RTLHint, "rtl", false, "Treat content as right-to-left when rendering (RTL text is otherwise auto-detected and bidi-isolated)")
+	flag.StringVar(&SortMovedBy, "sort-moved", SortMovedBy, "Order of the moved sections: position (File A order) or distance (largest moves first)")
+	flag.StringVar(&CollateLocale, "collate", "", "Sort entries within each section by content using this locale's collation (e.g. de, sv, fr-CA)")
+	flag.BoolVar(&ShowAssetChanges, "asset-changes", false, "Report changed Markdown images, links and badges even when the inputs are not .md files")
+	flag.StringVar(&AnnotateCommand, "annotate-cmd", "", "External checker (e.g. \"aspell list\") run on new and changed text; findings new in File B are attached to the entries")
+	flag.BoolVar(&CheckLinks, "check-links", false, "Report hyperlinks added, removed or retargeted between the files")
+	flag.BoolVar(&HeadCheckLinks, "check-links-head", false, "With --check-links, also check that added and retargeted links resolve (HTTP HEAD, or file existence for relative links)")
+	flag.IntVar(&SampleSize, "sample", 0, "Print N randomly selected entries in full detail, regardless of --details")
+	flag.Int64Var(&SampleSeed, "sample-seed", 0, "Random seed for --sample (0 picks a new seed each run)")
+	flag.IntVar(&PageLimit, "page-limit", 0, "Print only this many entries in full detail, starting after --page-after (0 prints the normal report)")
+	flag.StringVar(&PageAfter, "page-after", "", "Entry ID cursor for --page-limit, as printed by the previous page")
+	flag.BoolVar(&ShowStats, "stats", false, "Print a statistics summary (blocks/lines per category, similarity)")
+	flag.StringVar(&StatsJSONPath, "stats-json", "", "Write the statistics summary as JSON to this file ('-' for stdout)")
+	flag.StringVar(&DumpMatrixPath, "dump-matrix", "", "Write the gap-block similarity matrix to this file (.json for JSON, otherwise CSV)")
+	flag.StringVar(&ExportSegmentsPath, "export-segments", "", "Export changed and new File B blocks for retranslation to this file (.xlf/.xliff for XLIFF 1.2, otherwise CSV)")
+	flag.StringVar(&SegmentsSourceLang, "segments-lang", SegmentsSourceLang, "Source language of the segments in an --export-segments XLIFF file")
+	flag.StringVar(&presetName, "preset", "", "Load the flags saved in this preset; flags given on the command line take precedence")
+	flag.StringVar(&savePresetName, "save-preset", "", "Save the effective value of every flag as this preset, under the user config directory")
+	flag.BoolVar(&RecordUsage, "usage-stats", false, "Append this run's input sizes and stage timings (no content) to a local usage file; see 'go-semantic-diff stats report'")
+	flag.StringVar(&RecoveryFilePath, "recovery-file", "", "If the diff panics or is cancelled, save the entries finished so far to this file")
+	flag.BoolVar(&GitDifftool, "git-difftool", false, "Take the arguments git passes to a difftool or GIT_EXTERNAL_DIFF, and exit 0 when the files differ")
+	flag.StringVar(&DaemonSocket, "daemon", "", "Serve diff requests on this Unix socket, keeping caches warm between them, instead of diffing")
+	flag.BoolVar(&ProvenanceMode, "provenance", false, "Print File B line by line with the origin of each line: copied from A:<n>, moved from A:<n>, changed from block A#<id>, or new")
+	flag.StringVar(&LineMapPath, "line-map", "", "Write the File B line of every File A line and vice versa to this file (.json for JSON, otherwise CSV)")
+	flag.BoolVar(&ReverseDiff, "reverse", false, "Swap File A and File B, reporting how to get from the second file to the first")
+	flag.BoolVar(&SymmetricCheck, "symmetric-check", false, "Also diff File B against File A and report lines the two directions map differently, which points at matcher asymmetries")
+	flag.BoolVar(&VerifyResult, "verify", false, "After diffing, rebuild File B from File A and the block operations and fail if any line is lost or differs")
+	flag.StringVar(&SaveSessionPath, "save-session", "", "Save the full diff result to this file, for views printed by the query subcommand without diffing again")
+	flag.StringVar(&RecoverPath, "recover", "", "Render the partial result saved in a --recovery-file instead of diffing")
+	flag.StringVar(&ResumePath, "resume", "", "When diffing two directories, record each diffed pair in this file, and skip pairs recorded there whose inputs and options are unchanged")
+	flag.BoolVar(&ShowLineNumbers, "line-numbers", false, "Print detailed block text line by line with its line numbers, and add File A/B line-number gutters to line-level changes")
 	flag.Parse()
-	DetailsSections = parseDetailsFlag(detailsFlagStr)
-	CurrentFocusRange = parseFocusRange(FocusRangeStr)
-	if CurrentFocusRange.IsSet && CurrentFocusRange.StartLine == -1 {
-		os.Exit(1)
+	if presetName != "" {
+		if err := applyPreset(flag.CommandLine, presetName); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --preset: %v\n", err)
+			os.Exit(ExitTrouble)
+		}
+	}
+	var difftoolA, difftoolB, difftoolName string
+	GitDifftool = GitDifftool || gitDifftoolCommand()
+	if GitDifftool {
+		var err error
+		if difftoolA, difftoolB, difftoolName, err = gitDifftoolInputs(flag.Args()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --git-difftool: %v\n", err)
+			os.Exit(ExitTrouble)
+		}
+		if preset := gitDifftoolPreset(difftoolName); preset != "" {
+			if err := applyPreset(flag.CommandLine, preset); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: --git-difftool: preset %s: %v\n", preset, err)
+				os.Exit(ExitTrouble)
+			}
+		}
+	}
+	if savePresetName != "" {
+		path, err := savePreset(flag.CommandLine, savePresetName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --save-preset: %v\n", err)
+			os.Exit(ExitTrouble)
+		}
+		fmt.Fprintf(os.Stderr, "Saved preset %q to %s\n", savePresetName, path)
+		if flag.NArg() == 0 {
+			os.Exit(ExitIdentical) // Saving a preset needs no inputs
+		}
+	}
+	var errDetails error
+	if opts.DetailsSections, errDetails = parseDetailsFlag(detailsFlagStr); errDetails != nil {
+		fmt.Fprintf(os.Stderr, "Error: --details: %v\n", errDetails)
+		os.Exit(ExitTrouble)
+	}
+	opts.FocusRange = parseFocusRange(FocusRangeStr)
+	if opts.FocusRange.IsSet && opts.FocusRange.StartLine == -1 {
+		os.Exit(ExitTrouble)
+	}
+	var focusPattern *regexp.Regexp
+	if FocusPatternStr != "" {
+		var errPattern error
+		focusPattern, errPattern = regexp.Compile(FocusPatternStr)
+		if errPattern != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --focus-pattern: %v\n", errPattern)
+			os.Exit(ExitTrouble)
+		}
 	}
 
-	if flag.NArg() != 2 {
-		fmt.Fprintln(os.Stderr, "Usage: go-semantic-diff [--debug] [--details <sections>] [--threshold <value>] [--focus n,m] <fileA> <fileB>")
-		os.Exit(1)
+	if QuietMode {
+		devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err == nil {
+			os.Stdout = devNull
+		}
+	}
+
+	if RecoverPath != "" {
+		os.Exit(renderRecoveryFile(RecoverPath, opts.DetailsSections))
+	}
+
+	if flag.NArg() != 2 && DaemonSocket == "" && !GitDifftool && !(MatchMode && flag.NArg() > 2) {
+		fmt.Fprintln(os.Stderr, "Usage: go-semantic-diff [--preset name] [--save-preset name] [--usage-stats] [--recovery-file file] [-v | -vv | -vvv | --debug] [--log-file file] [--timings] [--cpuprofile file] [--memprofile file] [--quiet] [--progress | --no-progress] [--tui | --watch] [--mode text|json|yaml|csv [--csv-key columns] [--csv-delimiter c]] [--format text|markdown|side-by-side|github|rdjson] [--details <sections>] [--coalesce-gap N | --no-coalesce] [--full-content | --summary-width N] [--line-numbers] [-C N] [--threshold <value>] [--similarity metric [--similarity-weights spec] [--shingle-size N] | --similarity-cmd program] [--focus n,m | --focus-pattern re | --provenance] [--max-block-lines N] [--min-anchor-lines N] [--min-paragraph-lines N] [--encoding name[,name]] [--html-elements] [--ignore-blank-lines] [--ignore-numbers] [--mask regexp=placeholder ...] [--pipeline stages] [--pair-adjacent] [--rescue-threshold value] [--show-near-misses [--near-miss-margin value]] [--explain] [--no-lsh] [--max-memory size] [--budget duration] [--timeout duration] [--embedding-url url [--embedding-batch-size N] [--embedding-concurrency N] [--embedding-retries N] [--block-store dir|uri [--block-store-max-size size]]] [--hierarchical [--level-thresholds spec] [--outline] [--rollup]] [--dump-matrix file] [--export-segments file [--segments-lang lang]] [--line-map file] [--stats] [--stats-json file] [--save-session file] [--verify] [--reverse] [--symmetric-check] [--annotate-cmd cmd] [--asset-changes] [--check-links [--check-links-head]] [--sample N] [--page-limit N [--page-after id]] [--readability] [--style-rules files] [--figures] [--word-count] [--leverage] [--defined-terms [--defined-term-pattern re]] [--clause-map] [--check-xrefs] [--tone] [--detect-pii] [--redacted [--redaction-pattern re]] [--confidence] [--collate locale] [--sort-moved position|distance] [--rtl] [--grapheme-similarity] <fileA> <fileB> (files, .docx documents, .html pages, .gz/.bz2/.zst compressed files, or s3://, gs:// object URIs)")
+		fmt.Fprintln(os.Stderr, "       go-semantic-diff --git-difftool [options] [<local> <remote> | <GIT_EXTERNAL_DIFF arguments>]")
+		fmt.Fprintln(os.Stderr, "       go-semantic-diff --daemon socket [options]")
+		fmt.Fprintln(os.Stderr, "       go-semantic-diff --recover file [--format text|markdown|side-by-side|github|rdjson] [--details <sections>]")
+		fmt.Fprintln(os.Stderr, "       go-semantic-diff diff [options] <fileA> <fileB>")
+		fmt.Fprintln(os.Stderr, "       go-semantic-diff focus <n,m> [options] <fileA> <fileB>")
+		fmt.Fprintln(os.Stderr, "       go-semantic-diff stats [options] <fileA> <fileB>")
+		fmt.Fprintln(os.Stderr, "       go-semantic-diff stats report [file]")
+		fmt.Fprintln(os.Stderr, "       go-semantic-diff dirs [--resume file] [options] <dirA> <dirB>")
+		fmt.Fprintln(os.Stderr, "       go-semantic-diff query [--focus n,m | --focus-pattern re] [--format text|markdown|side-by-side|github|rdjson] [--details <sections>] [--full-content] [--stats] [--stats-json file] <session-file>")
+		fmt.Fprintln(os.Stderr, "       go-semantic-diff apply [--output file] <session-file> <file>")
+		fmt.Fprintln(os.Stderr, "       go-semantic-diff match [options] <file> <candidate>... (files or quoted glob patterns)")
+		fmt.Fprintln(os.Stderr, "       go-semantic-diff serve [--grpc] [--listen addr] [--max-body-size size] [--timeout duration]")
+		fmt.Fprintln(os.Stderr, "       go-semantic-diff help")
+		os.Exit(ExitTrouble)
 	}
 	fileAPath := flag.Arg(0)
 	fileBPath := flag.Arg(1)
-	if SimilarityThreshold < 0.0 || SimilarityThreshold > 1.0 {
+	if GitDifftool {
+		fileAPath, fileBPath = difftoolA, difftoolB
+	}
+	if ReverseDiff {
+		fileAPath, fileBPath = fileBPath, fileAPath
+	}
+	DirsMode = DirsMode || isDirectory(fileAPath) && isDirectory(fileBPath)
+	if ResumePath != "" && !DirsMode {
+		fmt.Fprintln(os.Stderr, "Error: --resume only applies when both inputs are directories")
+		os.Exit(ExitTrouble)
+	}
+	if DirsMode && (InputMode != "text" || TUIMode || WatchMode || DaemonSocket != "" || GitDifftool) {
+		fmt.Fprintln(os.Stderr, "Error: directory inputs cannot be combined with --mode, --tui, --watch, --daemon or --git-difftool")
+		os.Exit(ExitTrouble)
+	}
+	if opts.SimilarityThreshold < 0.0 || opts.SimilarityThreshold > 1.0 {
 		fmt.Fprintln(os.Stderr, "Error: threshold value must be between 0.0 and 1.0")
-		os.Exit(1)
+		os.Exit(ExitTrouble)
+	}
+	if err := validateSimilarityMetric(opts.SimilarityMetric); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --similarity: %v\n", err)
+		os.Exit(ExitTrouble)
+	}
+	if opts.ShingleSize < 1 {
+		fmt.Fprintln(os.Stderr, "Error: --shingle-size must be at least 1")
+		os.Exit(ExitTrouble)
+	}
+	if flagGiven("annotate-cmd") && strings.TrimSpace(AnnotateCommand) == "" {
+		fmt.Fprintln(os.Stderr, "Error: --annotate-cmd needs a command to run")
+		os.Exit(ExitTrouble)
+	}
+	if flagGiven("similarity-cmd") && strings.TrimSpace(SimilarityCommand) == "" {
+		fmt.Fprintln(os.Stderr, "Error: --similarity-cmd needs a command to run")
+		os.Exit(ExitTrouble)
+	}
+	if SimilarityCommand != "" && (opts.SimilarityMetric != "" || similarityWeightsStr != "") {
+		fmt.Fprintln(os.Stderr, "Error: --similarity-cmd replaces --similarity and --similarity-weights")
+		os.Exit(ExitTrouble)
+	}
+	if similarityWeightsStr != "" {
+		if opts.SimilarityMetric == "" {
+			opts.SimilarityMetric = "combined"
+		}
+		if opts.SimilarityMetric != "combined" {
+			fmt.Fprintln(os.Stderr, "Error: --similarity-weights requires --similarity combined")
+			os.Exit(ExitTrouble)
+		}
+		var errWeights error
+		if opts.SimilarityWeights, errWeights = parseSimilarityWeights(similarityWeightsStr); errWeights != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --similarity-weights: %v\n", errWeights)
+			os.Exit(ExitTrouble)
+		}
+	}
+	if ShowOutline || ShowRollup {
+		HierarchicalMode = true
+	}
+	opts.Outline = ShowOutline
+	opts.SimilarityMatrix = DumpMatrixPath != ""
+	var errLevels error
+	opts.LevelThresholds, errLevels = parseLevelThresholds(levelThresholdsStr, opts.SimilarityThreshold)
+	if errLevels != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --level-thresholds: %v\n", errLevels)
+		os.Exit(ExitTrouble)
+	}
+	if WatchMode && WatchInterval <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: --watch-interval must be positive")
+		os.Exit(ExitTrouble)
+	}
+	if WatchMode && (isObjectURI(fileAPath) || isObjectURI(fileBPath)) {
+		fmt.Fprintln(os.Stderr, "Error: --watch needs local files, not object-store URIs")
+		os.Exit(ExitTrouble)
+	}
+	for _, path := range []string{fileAPath, fileBPath} {
+		if isObjectURI(path) {
+			if _, err := parseObjectURI(path); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(ExitTrouble)
+			}
+		}
+	}
+	if CollateLocale != "" {
+		if _, err := newCollator(CollateLocale); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --collate locale %q: %v\n", CollateLocale, err)
+			os.Exit(ExitTrouble)
+		}
+	}
+	if SortMovedBy != "position" && SortMovedBy != "distance" {
+		fmt.Fprintf(os.Stderr, "Error: --sort-moved must be position or distance, got %q\n", SortMovedBy)
+		os.Exit(ExitTrouble)
+	}
+	if SampleSize < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --sample must be a non-negative number of entries")
+		os.Exit(ExitTrouble)
+	}
+	if ForceProgress && NoProgress {
+		fmt.Fprintln(os.Stderr, "Error: --progress and --no-progress are mutually exclusive")
+		os.Exit(ExitTrouble)
+	}
+	switch {
+	case debugVerbose || debug:
+		opts.Verbosity = VerbosityMatches
+	case veryVerbose:
+		opts.Verbosity = VerbosityDecisions
+	case verbose:
+		opts.Verbosity = VerbositySummary
+	}
+	if opts.Verbosity > 0 && !ForceProgress {
+		NoProgress = true // The progress line would overwrite debug messages
+	}
+	if LogFilePath != "" {
+		var err error
+		if currentDebugLog, err = openDebugLog(LogFilePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --log-file: %v\n", err)
+			os.Exit(ExitTrouble)
+		}
+	}
+	if OutputFormat != "text" && OutputFormat != "markdown" && OutputFormat != "side-by-side" && OutputFormat != "github" && OutputFormat != "rdjson" {
+		fmt.Fprintf(os.Stderr, "Error: unknown --format %q (expected text, markdown, side-by-side, github or rdjson)\n", OutputFormat)
+		os.Exit(ExitTrouble)
+	}
+	if encodings, err := parseEncodingFlag(encodingStr); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --encoding: %v\n", err)
+		os.Exit(ExitTrouble)
+	} else {
+		InputEncodings = encodings
+	}
+	if InputMode != "text" && InputMode != "json" && InputMode != "yaml" && InputMode != "csv" {
+		fmt.Fprintf(os.Stderr, "Error: unknown --mode %q (expected text, json, yaml or csv)\n", InputMode)
+		os.Exit(ExitTrouble)
+	}
+	if InputMode != "text" && (TUIMode || WatchMode) {
+		fmt.Fprintf(os.Stderr, "Error: --mode %s cannot be combined with --tui or --watch\n", InputMode)
+		os.Exit(ExitTrouble)
+	}
+	if MatchMode && (InputMode != "text" || TUIMode || WatchMode || DaemonSocket != "" || GitDifftool || ReverseDiff) {
+		fmt.Fprintln(os.Stderr, "Error: match cannot be combined with --mode, --tui, --watch, --daemon, --git-difftool or --reverse")
+		os.Exit(ExitTrouble)
+	}
+	if DaemonSocket != "" && (InputMode != "text" || TUIMode || WatchMode) {
+		fmt.Fprintln(os.Stderr, "Error: --daemon cannot be combined with --mode, --tui or --watch")
+		os.Exit(ExitTrouble)
+	}
+	if styleRulesStr != "" {
+		var errRules error
+		if StyleRules, errRules = loadStyleRules(styleRulesStr); errRules != nil {
+			fmt.Fprintf(os.Stderr, "Error: --style-rules: %v\n", errRules)
+			os.Exit(ExitTrouble)
+		}
+	}
+	if _, err := regexp.Compile(RedactionPattern); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --redaction-pattern: %v\n", err)
+		os.Exit(ExitTrouble)
+	}
+	if err := validateDefinedTermPattern(DefinedTermPattern); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid --defined-term-pattern: %v\n", err)
+		os.Exit(ExitTrouble)
+	}
+	if pipeline, err := parsePipeline(pipelineStr); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --pipeline: %v\n", err)
+		os.Exit(ExitTrouble)
+	} else {
+		opts.Pipeline = pipeline
+	}
+	if maxMemoryStr != "" {
+		var errSize error
+		if MaxMemory, errSize = parseByteSize(maxMemoryStr); errSize != nil {
+			fmt.Fprintf(os.Stderr, "Error: --max-memory: %v\n", errSize)
+			os.Exit(ExitTrouble)
+		}
+	}
+	if blockStoreMaxSizeStr != "" {
+		var errSize error
+		if BlockStoreMaxSize, errSize = parseByteSize(blockStoreMaxSizeStr); errSize != nil {
+			fmt.Fprintf(os.Stderr, "Error: --block-store-max-size: %v\n", errSize)
+			os.Exit(ExitTrouble)
+		}
+		if BlockStorePath == "" || isObjectURI(BlockStorePath) {
+			fmt.Fprintln(os.Stderr, "Error: --block-store-max-size needs a local --block-store directory; expire object-store entries with bucket lifecycle rules")
+			os.Exit(ExitTrouble)
+		}
+	}
+	if EmbeddingBatchSize < 1 || EmbeddingConcurrency < 1 {
+		fmt.Fprintln(os.Stderr, "Error: --embedding-batch-size and --embedding-concurrency must be at least 1")
+		os.Exit(ExitTrouble)
+	}
+	if EmbeddingRetries < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --embedding-retries must be 0 or more")
+		os.Exit(ExitTrouble)
+	}
+	if BlockStorePath != "" && opts.EmbeddingURL == "" {
+		fmt.Fprintln(os.Stderr, "Warning: --block-store only stores --embedding-url embeddings and is unused without it")
+	}
+	if DiffTimeout < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --timeout must be 0 (no limit) or a positive duration")
+		os.Exit(ExitTrouble)
+	}
+	if opts.TimeBudget < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --budget must be 0 (unlimited) or a positive duration")
+		os.Exit(ExitTrouble)
+	}
+	if PageLimit < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --page-limit must be a non-negative number of entries")
+		os.Exit(ExitTrouble)
+	}
+	if opts.RescueThreshold < 0.0 || opts.RescueThreshold > 1.0 {
+		fmt.Fprintln(os.Stderr, "Error: --rescue-threshold must be between 0.0 and 1.0")
+		os.Exit(ExitTrouble)
+	}
+	if NearMissMargin <= 0.0 || NearMissMargin > 1.0 {
+		fmt.Fprintln(os.Stderr, "Error: --near-miss-margin must be greater than 0.0 and at most 1.0")
+		os.Exit(ExitTrouble)
+	}
+	if ShowNearMisses {
+		opts.NearMissMargin = NearMissMargin
+	}
+	if CoalesceGap < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --coalesce-gap must be 0 or more lines")
+		os.Exit(ExitTrouble)
+	}
+	if ContextLines < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --context must be 0 or more lines")
+		os.Exit(ExitTrouble)
+	}
+	if SummaryWidth != 0 && SummaryWidth < 10 {
+		fmt.Fprintln(os.Stderr, "Error: --summary-width must be 0 (default widths) or at least 10")
+		os.Exit(ExitTrouble)
+	}
+	if noCoalesce {
+		CoalesceGap = -1
+	}
+	if opts.MinAnchorLines < 1 {
+		fmt.Fprintln(os.Stderr, "Error: --min-anchor-lines must be at least 1")
+		os.Exit(ExitTrouble)
+	}
+	if opts.MinParagraphLines < 1 {
+		fmt.Fprintln(os.Stderr, "Error: --min-paragraph-lines must be at least 1")
+		os.Exit(ExitTrouble)
+	}
+	if opts.MaxBlockLines < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --max-block-lines must be 0 (disabled) or a positive number of lines")
+		os.Exit(ExitTrouble)
 	}
 
-	contentABytes, errA := ioutil.ReadFile(fileAPath)
-	if errA != nil {
-		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", fileAPath, errA)
-		os.Exit(1)
+	settings := map[string]any{"threshold": opts.SimilarityThreshold, "details": detailsFlagStr, "max_block_lines": opts.MaxBlockLines, "min_anchor_lines": opts.MinAnchorLines, "min_paragraph_lines": opts.MinParagraphLines}
+	debugf(opts.Verbosity, VerbositySummary, "settings", settings, "Using Similarity Threshold: %.2f\nDetails sections: %s\nMax block lines before windowing: %d\nMin anchor lines: %d, min paragraph lines for semantic matching: %d",
+		opts.SimilarityThreshold, detailsFlagStr, opts.MaxBlockLines, opts.MinAnchorLines, opts.MinParagraphLines)
+	if HierarchicalMode {
+		debugf(opts.Verbosity, VerbositySummary, "level_thresholds", map[string]any{"section": opts.LevelThresholds.Section, "paragraph": opts.LevelThresholds.Paragraph, "sentence": opts.LevelThresholds.Sentence}, "Level thresholds: section %.2f, paragraph %.2f, sentence %.2f", opts.LevelThresholds.Section, opts.LevelThresholds.Paragraph, opts.LevelThresholds.Sentence)
 	}
-	contentBBytes, errB := ioutil.ReadFile(fileBPath)
-	if errB != nil {
-		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", fileBPath, errB)
-		os.Exit(1)
+	if opts.FocusRange.IsSet {
+		debugf(opts.Verbosity, VerbositySummary, "focus", map[string]any{"start": opts.FocusRange.StartLine, "end": opts.FocusRange.EndLine}, "Focus range for File A: Lines %d-%d", opts.FocusRange.StartLine, opts.FocusRange.EndLine)
 	}
-	rawContentA := string(contentABytes)
-	rawContentB := string(contentBBytes)
 
-	// Debug prints and initial setup are stable
-	if DebugMode {
-		fmt.Printf("File A ('%s') has %d lines.\n", fileAPath, strings.Count(rawContentA, "\n")+1)
-		fmt.Printf("File B ('%s') has %d lines.\n", fileBPath, strings.Count(rawContentB, "\n")+1)
-		fmt.Printf("Using Similarity Threshold: %.2f\n", SimilarityThreshold)
-		fmt.Printf("Details sections: %s\n", detailsFlagStr)
-		if CurrentFocusRange.IsSet {
-			fmt.Printf("Focus range for File A: Lines %d-%d\n", CurrentFocusRange.StartLine, CurrentFocusRange.EndLine)
+	if (CPUProfilePath != "" || MemProfilePath != "" || ShowTimings) && WatchMode {
+		fmt.Fprintln(os.Stderr, "Error: --cpuprofile, --memprofile and --timings cover a run that ends, not --watch")
+		os.Exit(ExitTrouble)
+	}
+	if err := startProfiling(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --cpuprofile: %v\n", err)
+		os.Exit(ExitTrouble)
+	}
+
+	if DaemonSocket != "" {
+		exitProfiled(runDaemon(DaemonSocket, opts))
+	}
+	if MatchMode {
+		exitProfiled(runMatch(flag.Arg(0), flag.Args()[1:], opts))
+	}
+	if DirsMode {
+		exitProfiled(runDirs(fileAPath, fileBPath, opts))
+	}
+	if GitDifftool && !TUIMode {
+		printGitDifftoolHeader(difftoolName)
+	}
+	switch InputMode {
+	case "json":
+		exitProfiled(gitDifftoolExitCode(reportJSON(fileAPath, fileBPath, opts)))
+	case "yaml":
+		exitProfiled(gitDifftoolExitCode(reportYAML(fileAPath, fileBPath, opts)))
+	case "csv":
+		exitProfiled(gitDifftoolExitCode(reportCSV(fileAPath, fileBPath, opts)))
+	}
+	if TUIMode {
+		rawContentA, rawContentB, err := readInputs(fileAPath, fileBPath)
+		if err == nil {
+			err = runTUI(rawContentA, rawContentB, opts)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exitProfiled(ExitTrouble)
 		}
-		fmt.Println("--- Performing Diff (Debug Mode) ---")
+		exitProfiled(ExitIdentical)
 	}
+	if WatchMode {
+		watchAndReport(fileAPath, fileBPath, focusPattern, opts)
+	}
+	if RecordUsage {
+		currentUsage = newUsageRecorder(fileAPath, fileBPath)
+	}
+	if RecoveryFilePath != "" {
+		currentRecovery = &recoveryCheckpoint{fileA: fileAPath, fileB: fileBPath}
+	}
+	exitCode := reportOnce(fileAPath, fileBPath, focusPattern, opts)
+	if BlockStoreMaxSize > 0 {
+		if _, err := collectBlockStore(BlockStorePath, BlockStoreMaxSize); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not trim --block-store %s: %v\n", BlockStorePath, err)
+		}
+	}
+	if currentUsage != nil {
+		if err := currentUsage.save(exitCode); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not record usage statistics: %v\n", err)
+		}
+	}
+	exitProfiled(gitDifftoolExitCode(exitCode))
+}
 
-	diffResults := PerformDiff(rawContentA, rawContentB)
-	if CurrentFocusRange.IsSet {
-		printFocusResults(rawContentA, diffResults, CurrentFocusRange)
-		return
+// readInputs reads both input files, fetching object-store URIs, decompressing
+// and transcoding them to UTF-8 and extracting the text of Word documents and HTML pages.
+func readInputs(fileAPath, fileBPath string) (string, string, error) {
+	contentA, err := readInputFile(fileAPath, 0)
+	if err != nil {
+		return "", "", err
 	}
+	contentB, err := readInputFile(fileBPath, 1)
+	if err != nil {
+		return "", "", err
+	}
+	return contentA, contentB, nil
+}
+
+// readInputFile reads one input as readInputs does; side is 0 for File A and 1
+// for File B, selecting its --encoding.
+func readInputFile(path string, side int) (string, error) {
+	data, err := readInput(path)
+	if err == nil {
+		data, err = decompressInput(data)
+	}
+	if err == nil && !isDOCXInput(path) {
+		data, err = decodeInput(data, InputEncodings[side])
+	}
+	var content string
+	if err == nil {
+		content, err = inputText(path, data)
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", path, err)
+	}
+	return content, nil
+}
+
+// reportOnce diffs the two files and prints every requested report section,
+// returning the process exit code.
+func reportOnce(fileAPath, fileBPath string, focusPattern *regexp.Regexp, opts Options) int {
+	if MaxMemory > 0 && !isDOCXInput(fileAPath) && !isDOCXInput(fileBPath) && !isHTMLInput(fileAPath) && !isHTMLInput(fileBPath) { // Extracted text is not streamed
+		shapeA, errA := scanInputShape(fileAPath)
+		shapeB, errB := scanInputShape(fileBPath)
+		if errA == nil && errB == nil && estimateDiffMemory(shapeA, shapeB) > MaxMemory {
+			return reportWindowed(fileAPath, fileBPath, windowLinesForBudget(shapeA, shapeB, MaxMemory), opts)
+		}
+	}
+	rawContentA, rawContentB, err := readInputs(fileAPath, fileBPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return ExitTrouble
+	}
+	if debugEnabled(opts.Verbosity, VerbositySummary) {
+		linesA, linesB := strings.Count(rawContentA, "\n")+1, strings.Count(rawContentB, "\n")+1
+		debugf(opts.Verbosity, VerbositySummary, "inputs", map[string]any{"file_a": fileAPath, "lines_a": linesA, "file_b": fileBPath, "lines_b": linesB}, "File A ('%s') has %d lines.\nFile B ('%s') has %d lines.", fileAPath, linesA, fileBPath, linesB)
+	}
+
+	// Redacted lines are diffed as their source lines; the report keeps the raw text.
+	diffContentA, diffContentB := rawContentA, rawContentB
+	var redactions []Redaction
+	if RedactionMode {
+		diffContentA, diffContentB, redactions, _ = unredactInputs(rawContentA, rawContentB) // Pattern validated in main
+	}
+
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if DiffTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, DiffTimeout)
+	}
+	defer cancel()
+	opts.Run = &DiffRun{}
+	var diffResults []DiffEntry
+	var escalationNote string
+	var diffErr error
+	if identicalInputs(rawContentA, rawContentB) {
+		fmt.Fprintln(noteWriter(), "Files are semantically identical (whole-file checksums match).")
+		diffResults = identicalDiff(diffContentA, diffContentB, opts)
+	} else {
+		diffResults, escalationNote, diffErr = runDiff(ctx, diffContentA, diffContentB, opts)
+	}
+	if diffErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: diff did not finish within --timeout %s (%v); reporting partial results\n", DiffTimeout, diffErr)
+		escalationNote = strings.TrimSpace(escalationNote + " PARTIAL RESULT: the diff was cancelled at --timeout; content not yet matched is reported as NEW/DELETED.")
+		currentRecovery.save(diffResults, fmt.Sprintf("cancelled: %v", diffErr))
+	}
+	if err := similarityPluginErr(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error running --similarity-cmd: %v\n", err)
+		return ExitTrouble
+	}
+	verifyFailed := VerifyResult && !printVerifyReport(verifyDiff(diffContentA, diffContentB, diffResults, opts))
+	if len(opts.Pipeline.Custom) > 0 {
+		if diffResults, err = runCustomStages(diffResults, opts.Pipeline.Custom); err != nil {
+			fmt.Fprintf(os.Stderr, "Error running --pipeline stage: %v\n", err)
+			return ExitTrouble
+		}
+	}
+	if SaveSessionPath != "" {
+		if err := saveSession(fileAPath, fileBPath, rawContentA, rawContentB, diffResults, escalationNote, diffErr != nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing session to %s: %v\n", SaveSessionPath, err)
+			return ExitTrouble
+		}
+	}
+	printDegradationNotice(opts)
+	if escalationNote != "" {
+		fmt.Fprintf(noteWriter(), "Note: %s\n", escalationNote)
+	}
+	if DumpMatrixPath != "" && opts.Run.Matrix != nil {
+		if err := opts.Run.Matrix.WriteFile(DumpMatrixPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing similarity matrix to %s: %v\n", DumpMatrixPath, err)
+			return ExitTrouble
+		}
+	}
+	if ExportSegmentsPath != "" {
+		if err := writeSegmentsFile(diffResults, fileBPath, ExportSegmentsPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing segments to %s: %v\n", ExportSegmentsPath, err)
+			return ExitTrouble
+		}
+	}
+	if LineMapPath != "" {
+		if err := buildLineMap(diffContentA, diffContentB, diffResults).WriteFile(LineMapPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing line map to %s: %v\n", LineMapPath, err)
+			return ExitTrouble
+		}
+	}
+	exitCode := diffExitCode(diffResults)
+	if diffErr != nil || verifyFailed {
+		exitCode = ExitTrouble
+	}
+	if opts.FocusRange.IsSet {
+		printFocusResults(rawContentA, diffResults, opts.FocusRange)
+		return exitCode
+	}
+	if ProvenanceMode {
+		printProvenance(diffContentA, diffContentB, rawContentB, diffResults)
+		return exitCode
+	}
+	if focusPattern != nil {
+		printFocusPatternResults(diffResults, focusPattern)
+		return exitCode
+	}
+	if PageLimit > 0 {
+		page, err := pageDiffEntries(diffResults, PageAfter, PageLimit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --page-after: %v\n", err)
+			return ExitTrouble
+		}
+		printDiffPage(page)
+		return exitCode
+	}
+	if AnnotateCommand != "" {
+		if err := annotateEntries(diffResults); err != nil {
+			fmt.Fprintf(os.Stderr, "Error running --annotate-cmd: %v\n", err)
+			return ExitTrouble
+		}
+	}
+	switch {
+	case StatsOnly:
+	case OutputFormat == "markdown":
+		printMarkdownReport(diffResults, fileAPath, fileBPath, opts.DetailsSections)
+	case OutputFormat == "github":
+		printGitHubAnnotations(diffResults, fileBPath)
+	case OutputFormat == "rdjson":
+		printRDJSON(diffResults, fileBPath)
+	case OutputFormat == "side-by-side":
+		printSideBySideReport(diffResults, opts.DetailsSections)
+		if AnnotateCommand != "" {
+			printAnnotations(diffResults)
+		}
+	default:
+		printDiffReport(diffResults, opts.DetailsSections, rawContentA, rawContentB)
+		if AnnotateCommand != "" {
+			printAnnotations(diffResults)
+		}
+	}
+	if ShowOutline {
+		printOutlineChanges(opts.Run.Outline)
+	}
+	if ShowRollup {
+		printSectionRollup(rollUpSections(diffResults), opts)
+	}
+	if ShowHTMLElements {
+		printHTMLElementChanges(diffResults, htmlElementIndex[fileAPath], htmlElementIndex[fileBPath])
+	}
+	if opts.RescueThreshold > 0 {
+		printPossiblyRelated(diffResults, opts.RescueThreshold)
+	}
+	if ShowNearMisses {
+		printNearMisses(diffResults, opts.NearMissMargin)
+	}
+	if opts.Explain {
+		printMatchExplanations(diffResults)
+	}
+	if RedactionMode {
+		printRedactions(redactions, diffResults)
+	}
+	if ShowFigures {
+		printFigureChanges(diffResults)
+	}
+	if ShowWordCount {
+		printWordCounts(countWords(diffResults))
+	}
+	if ShowLeverage {
+		printLeverage(diffResults)
+	}
+	if ShowDefinedTerms {
+		printDefinedTerms(diffResults, rawContentA, rawContentB)
+	}
+	if ShowClauseMap || CheckCrossRefs {
+		mappings := mapClauses(diffResults, rawContentA, rawContentB, opts)
+		if ShowClauseMap {
+			printClauseMap(mappings)
+		}
+		if CheckCrossRefs {
+			printCrossRefProblems(checkCrossRefs(diffResults, mappings, rawContentA, rawContentB))
+		}
+	}
+	if ShowAssetChanges || !StatsOnly && (isMarkdownPath(inputName(fileAPath)) || isMarkdownPath(inputName(fileBPath))) {
+		printAssetChanges(diffMarkdownAssets(extractMarkdownAssets(rawContentA), extractMarkdownAssets(rawContentB)))
+	}
+	if CheckLinks || HeadCheckLinks {
+		linkChanges := diffMarkdownAssets(extractHyperlinks(rawContentA), extractHyperlinks(rawContentB))
+		var statuses map[string]LinkStatus
+		if HeadCheckLinks {
+			baseDir := filepath.Dir(fileBPath)
+			if isObjectURI(fileBPath) {
+				baseDir = "" // Relative links of an object are not checked
+			}
+			statuses = checkNewLinks(linkChanges, baseDir)
+		}
+		printLinkChanges(linkChanges, statuses)
+	}
+	if SampleSize > 0 {
+		printRandomSample(diffResults, SampleSize, SampleSeed)
+	}
+	if ShowReadability {
+		printReadabilityDelta(diffResults, rawContentA, rawContentB)
+	}
+	if len(StyleRules) > 0 {
+		printStyleDelta(diffResults, StyleRules, rawContentA, rawContentB)
+	}
+	if ShowToneShifts {
+		printToneShifts(diffResults, opts)
+	}
+	if DetectPII {
+		printPIIFindings(detectIntroducedPII(diffResults, rawContentA))
+	}
+	if SymmetricCheck {
+		reverseOpts := opts
+		reverseOpts.Run = nil // The report describes the forward run
+		reverseResults, _, err := runDiff(ctx, diffContentB, diffContentA, reverseOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --symmetric-check: %v\n", err)
+			return ExitTrouble
+		}
+		printSymmetryCheck(checkSymmetry(buildLineMap(diffContentA, diffContentB, diffResults), buildLineMap(diffContentB, diffContentA, reverseResults)))
+	}
+	if ShowConfidence {
+		printDiffConfidence(computeDiffConfidence(diffResults, rawContentA, rawContentB, opts.SimilarityThreshold))
+	}
+	if ShowStats || StatsJSONPath != "" {
+		stats := computeDiffStats(diffResults, opts.Run)
+		if ShowStats {
+			printDiffStats(stats)
+		}
+		if StatsJSONPath != "" {
+			if err := writeDiffStatsJSON(stats, StatsJSONPath); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing stats to %s: %v\n", StatsJSONPath, err)
+				return ExitTrouble
+			}
+		}
+	}
+	return exitCode
+}
+
+// reportWindowed is reportOnce for inputs too large for --max-memory. Only the
+// reports that work from diff entries alone are available; sections that need
+// both whole files in memory are skipped with a note.
+func reportWindowed(fileAPath, fileBPath string, windowLines int, opts Options) int {
+	currentUsage.setMode("windowed")
+	fmt.Fprintf(noteWriter(), "Note: inputs exceed --max-memory; diffed in windows of %d lines. Moves further than a window are reported as DELETED and NEW.\n", windowLines)
+	if opts.FocusRange.IsSet || FocusRangeStr != "" || FocusPatternStr != "" || ShowConfidence || ShowReadability || len(StyleRules) > 0 || DetectPII || RedactionMode || ShowDefinedTerms || ShowClauseMap || CheckCrossRefs || ContextLines > 0 || CheckLinks || HeadCheckLinks || ShowAssetChanges || HierarchicalMode || DumpMatrixPath != "" || SaveSessionPath != "" || VerifyResult || LineMapPath != "" || ProvenanceMode || SymmetricCheck {
+		fmt.Fprintln(os.Stderr, "Warning: --focus, --focus-pattern, --confidence, --readability, --style-rules, --detect-pii, --redacted, --defined-terms, --clause-map, --check-xrefs, --context, --check-links, --asset-changes, --hierarchical, --dump-matrix, --save-session, --verify, --line-map, --provenance and --symmetric-check are not available in windowed mode and were ignored")
+	}
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if DiffTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, DiffTimeout)
+	}
+	defer cancel()
+	opts.Run = &DiffRun{}
+	diffResults, err := func() ([]DiffEntry, error) {
+		defer currentRecovery.recoverPanic()
+		return PerformWindowedDiff(ctx, fileAPath, fileBPath, windowLines, opts)
+	}()
+	exitCode := diffExitCode(diffResults)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v; reporting partial results\n", err)
+		if diffResults == nil {
+			return ExitTrouble
+		}
+		currentRecovery.save(diffResults, fmt.Sprintf("cancelled: %v", err))
+		exitCode = ExitTrouble
+	}
+	if err := similarityPluginErr(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error running --similarity-cmd: %v\n", err)
+		return ExitTrouble
+	}
+	if len(opts.Pipeline.Custom) > 0 {
+		partial := exitCode == ExitTrouble
+		if diffResults, err = runCustomStages(diffResults, opts.Pipeline.Custom); err != nil {
+			fmt.Fprintf(os.Stderr, "Error running --pipeline stage: %v\n", err)
+			return ExitTrouble
+		}
+		if exitCode = diffExitCode(diffResults); partial {
+			exitCode = ExitTrouble
+		}
+	}
+	printDegradationNotice(opts)
+	if budgetNote := opts.Run.budget.note(); budgetNote != "" {
+		fmt.Fprintf(noteWriter(), "Note: %s\n", budgetNote)
+	}
+	if ExportSegmentsPath != "" {
+		if err := writeSegmentsFile(diffResults, fileBPath, ExportSegmentsPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing segments to %s: %v\n", ExportSegmentsPath, err)
+			return ExitTrouble
+		}
+	}
+	if AnnotateCommand != "" {
+		if err := annotateEntries(diffResults); err != nil {
+			fmt.Fprintf(os.Stderr, "Error running --annotate-cmd: %v\n", err)
+			return ExitTrouble
+		}
+	}
+	switch {
+	case PageLimit > 0:
+		page, err := pageDiffEntries(diffResults, PageAfter, PageLimit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --page-after: %v\n", err)
+			return ExitTrouble
+		}
+		printDiffPage(page)
+		return exitCode
+	case StatsOnly:
+	case OutputFormat == "markdown":
+		printMarkdownReport(diffResults, fileAPath, fileBPath, opts.DetailsSections)
+	case OutputFormat == "github":
+		printGitHubAnnotations(diffResults, fileBPath)
+	case OutputFormat == "rdjson":
+		printRDJSON(diffResults, fileBPath)
+	case OutputFormat == "side-by-side":
+		printSideBySideReport(diffResults, opts.DetailsSections)
+		if AnnotateCommand != "" {
+			printAnnotations(diffResults)
+		}
+	default:
+		printDiffReport(diffResults, opts.DetailsSections, "", "") // Context lines need the whole files
+		if AnnotateCommand != "" {
+			printAnnotations(diffResults)
+		}
+	}
+	if opts.RescueThreshold > 0 {
+		printPossiblyRelated(diffResults, opts.RescueThreshold)
+	}
+	if ShowNearMisses {
+		printNearMisses(diffResults, opts.NearMissMargin)
+	}
+	if opts.Explain {
+		printMatchExplanations(diffResults)
+	}
+	if ShowFigures {
+		printFigureChanges(diffResults)
+	}
+	if ShowWordCount {
+		printWordCounts(countWords(diffResults))
+	}
+	if ShowLeverage {
+		printLeverage(diffResults)
+	}
+	if SampleSize > 0 {
+		printRandomSample(diffResults, SampleSize, SampleSeed)
+	}
+	if ShowToneShifts {
+		printToneShifts(diffResults, opts)
+	}
+	if ShowStats || StatsJSONPath != "" {
+		stats := computeDiffStats(diffResults, opts.Run)
+		if ShowStats {
+			printDiffStats(stats)
+		}
+		if StatsJSONPath != "" {
+			if err := writeDiffStatsJSON(stats, StatsJSONPath); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing stats to %s: %v\n", StatsJSONPath, err)
+				return ExitTrouble
+			}
+		}
+	}
+	return exitCode
+}
+
+// runDiff runs the engine selected by the mode flags within --budget. The note
+// describes any automatic escalation and any shortcuts taken to meet the budget.
+// If ctx is cancelled, the partial result is returned with ctx.Err(); on a panic
+// the entries finished so far are saved to --recovery-file first.
+func runDiff(ctx context.Context, rawContentA, rawContentB string, opts Options) ([]DiffEntry, string, error) {
+	defer currentRecovery.recoverPanic()
+	opts = opts.begin()
+	if progressEnabled(rawContentA, rawContentB) {
+		currentProgress = &progressReporter{}
+	}
+	defer func() {
+		currentProgress.finish()
+		currentProgress = nil
+	}()
+
+	var diffs []DiffEntry
+	var note string
+	var err error
+	switch {
+	case HierarchicalMode:
+		diffs, err = PerformHierarchicalDiff(ctx, rawContentA, rawContentB, opts)
+	case NoEscalate:
+		diffs, err = PerformDiff(ctx, rawContentA, rawContentB, opts)
+	default:
+		diffs, note, err = PerformDiffWithEscalation(ctx, rawContentA, rawContentB, opts)
+	}
+	if budgetNote := opts.Run.budget.note(); budgetNote != "" {
+		note = strings.TrimSpace(note + " " + budgetNote)
+	}
+	return diffs, note, err
+}
+
+// flagGiven reports whether the named flag was set on the command line or by a preset.
+func flagGiven(name string) bool {
+	given := false
+	flag.Visit(func(f *flag.Flag) {
+		given = given || f.Name == name
+	})
+	return given
+}
+
+// identicalInputs compares whole-file checksums of both inputs, ignoring CRLF vs LF,
+// so identical files skip block analysis entirely.
+func identicalInputs(rawContentA, rawContentB string) bool {
+	sumA := sha256.Sum256([]byte(strings.ReplaceAll(rawContentA, "\r\n", "\n")))
+	sumB := sha256.Sum256([]byte(strings.ReplaceAll(rawContentB, "\r\n", "\n")))
+	return sumA == sumB
+}
+
+// identicalDiff is the result of inputs that identicalInputs found equal: one
+// UNCHANGED entry spanning both files, so they are reported like any other diff.
+func identicalDiff(contentA, contentB string, opts Options) []DiffEntry {
+	block := func(id int, content, origin string) *ContentBlock {
+		lines := getLinesWithInfo(content, origin, opts)
+		texts := make([]string, len(lines))
+		for k, li := range lines {
+			texts[k] = li.OriginalText
+		}
+		text := strings.Join(texts, "\n")
+		normalized := opts.normalize(text)
+		return &ContentBlock{
+			ID:             id,
+			OriginalText:   text,
+			NormalizedText: normalized,
+			Checksum:       CalculateBlockChecksum(normalized),
+			LineStart:      1,
+			LineEnd:        len(lines),
+			FileOrigin:     origin,
+			SourceLineRefs: lines,
+		}
+	}
+	return []DiffEntry{{Type: Unchanged, BlockA: block(0, contentA, "A"), BlockB: block(1, contentB, "B")}}
+}
+
+// diffExitCode returns ExitIdentical when every entry is unchanged in place, else ExitDifferent.
+func diffExitCode(diffs []DiffEntry) int {
+	for _, d := range diffs {
+		if d.Type != Unchanged {
+			return ExitDifferent
+		}
+	}
+	return ExitIdentical
+}
+
+// printDiffReport prints the grouped NEW/DELETED/MOVED/MOVED_AND_CHANGED/CHANGED/UNCHANGED sections.
+// With --context, detailed NEW, DELETED and CHANGED entries show the lines around
+// them from the raw contents.
+func printDiffReport(diffResults []DiffEntry, details map[DiffType]bool, rawContentA, rawContentB string) {
+	linesA, linesB := contextFileLines(rawContentA), contextFileLines(rawContentB)
 	if len(diffResults) == 0 {
 		fmt.Println("Files are semantically identical at the block level.")
 		return
@@ -139,7 +1153,18 @@ func main() {
 	for _, entry := range diffResults {
 		groupedDiffs[entry.Type] = append(groupedDiffs[entry.Type], entry)
 	}
-	outputOrder := []DiffType{Added, Deleted, Moved, Modified, Unchanged}
+	if CollateLocale != "" {
+		collator, _ := newCollator(CollateLocale) // Validated in main
+		for _, entries := range groupedDiffs {
+			sortEntriesByCollation(entries, collator)
+		}
+	}
+	docLinesA, docLinesB := documentLengths(diffResults)
+	if SortMovedBy == "distance" {
+		sortMovedByDistance(groupedDiffs[Moved], docLinesA, docLinesB)
+		sortMovedByDistance(groupedDiffs[MovedModified], docLinesA, docLinesB)
+	}
+	outputOrder := []DiffType{Added, Deleted, Moved, MovedModified, Modified, Unchanged}
 
 	// This loop processes and prints each diff type section.
 	// The main change is within the `showDetailsForThisSection` block.
@@ -149,13 +1174,13 @@ func main() {
 			continue
 		}
 		sectionTitle := strings.ToUpper(entries[0].Type.String())
-		if entries[0].Type == Unchanged && !DetailsSections[Unchanged] {
+		if entries[0].Type == Unchanged && !details[Unchanged] {
 			sectionTitle = "UNCHANGED (IN PLACE)"
-		} else if entries[0].Type == Unchanged && DetailsSections[Unchanged] {
+		} else if entries[0].Type == Unchanged && details[Unchanged] {
 			sectionTitle = "UNCHANGED_IN_PLACE"
 		}
 		fmt.Printf("\n# %s BLOCKS\n", sectionTitle)
-		showDetailsForThisSection := DetailsSections[diffType]
+		showDetailsForThisSection := details[diffType]
 
 		if !showDetailsForThisSection { // Compact Output Logic (Stable)
 			sectionKeyName := "unknown"
@@ -168,6 +1193,8 @@ func main() {
 				sectionKeyName = "changed"
 			case Moved:
 				sectionKeyName = "moved"
+			case MovedModified:
+				sectionKeyName = "moved-changed"
 			case Unchanged:
 				sectionKeyName = "unchanged"
 			}
@@ -205,15 +1232,24 @@ func main() {
 				}
 				for i := 0; i < limit; i++ {
 					e := entries[i]
-					summary := fmt.Sprintf("A_ID:%d (L%d-%d) -> B_ID:%d (L%d-%d)", e.BlockA.ID, e.BlockA.LineStart, e.BlockA.LineEnd, e.BlockB.ID, e.BlockB.LineStart, e.BlockB.LineEnd)
-					if e.Similarity > 0 && e.Similarity < 0.9999 {
-						summary += fmt.Sprintf(" [Sim: %.2f]", e.Similarity)
-					}
-					fmt.Printf("    - %s\n", summary)
+					fmt.Printf("    - A_ID:%d (L%d-%d) -> B_ID:%d (L%d-%d) [%s]\n", e.BlockA.ID, e.BlockA.LineStart, e.BlockA.LineEnd, e.BlockB.ID, e.BlockB.LineStart, e.BlockB.LineEnd, entryMoveDistance(e, docLinesA, docLinesB))
 				}
 				if numMovedEntries > MaxMovedSummariesCompact {
 					fmt.Printf("    ... and %d more moved blocks.\n", numMovedEntries-MaxMovedSummariesCompact)
 				}
+			case MovedModified:
+				fmt.Printf("  Total: %d blocks moved and changed.\n", len(entries))
+				limit := MaxMovedSummariesCompact
+				if len(entries) < limit {
+					limit = len(entries)
+				}
+				for i := 0; i < limit; i++ {
+					e := entries[i]
+					fmt.Printf("    ~ A_ID:%d (L%d-%d) -> B_ID:%d (L%d-%d) (Sim: %.2f) [%s]\n", e.BlockA.ID, e.BlockA.LineStart, e.BlockA.LineEnd, e.BlockB.ID, e.BlockB.LineStart, e.BlockB.LineEnd, e.Similarity, entryMoveDistance(e, docLinesA, docLinesB))
+				}
+				if len(entries) > limit {
+					fmt.Printf("    ... and %d more moved and changed blocks.\n", len(entries)-limit)
+				}
 			case Modified:
 				fmt.Printf("  Total: %d blocks changed.\n", len(entries))
 				limit := MaxModifiedSummariesCompact
@@ -228,7 +1264,7 @@ func main() {
 					fmt.Printf("    ... and %d more changed blocks.\n", len(entries)-limit)
 				}
 			}
-			if diffType == Modified && !showDetailsForThisSection {
+			if (diffType == Modified || diffType == MovedModified) && !showDetailsForThisSection {
 				fmt.Printf("  (Use --details including '%s' to see content.)\n", sectionKeyName)
 			} else if !showDetailsForThisSection {
 				fmt.Printf("  (Use --details including '%s' to list them.)\n", sectionKeyName)
@@ -266,21 +1302,27 @@ func main() {
 			for j < len(entries) {
 				nextEntry := entries[j]
 				canCoalesce := false
-				const maxGapForCoalesce = 1
+				maxGapForCoalesce := CoalesceGap
 
-				switch diffType {
-				case Added:
+				switch {
+				case maxGapForCoalesce < 0: // --no-coalesce
+				// Only blocks that follow the group in the file coalesce; with --collate,
+				// neighbours in the list may come from earlier in the file.
+				case diffType == Added:
 					if startEntry.BlockB != nil && nextEntry.BlockB != nil &&
+						nextEntry.BlockB.LineStart > currentCoalescedEndB &&
 						nextEntry.BlockB.LineStart <= currentCoalescedEndB+1+maxGapForCoalesce {
 						canCoalesce = true
 					}
-				case Deleted:
+				case diffType == Deleted:
 					if startEntry.BlockA != nil && nextEntry.BlockA != nil &&
+						nextEntry.BlockA.LineStart > currentCoalescedEndA &&
 						nextEntry.BlockA.LineStart <= currentCoalescedEndA+1+maxGapForCoalesce {
 						canCoalesce = true
 					}
-				case Modified, Moved, Unchanged:
+				case diffType == Modified, diffType == Moved, diffType == MovedModified, diffType == Unchanged:
 					if startEntry.BlockA != nil && nextEntry.BlockA != nil &&
+						nextEntry.BlockA.LineStart > currentCoalescedEndA &&
 						(nextEntry.BlockA.LineStart <= currentCoalescedEndA+1+maxGapForCoalesce) {
 						if startEntry.BlockB != nil && nextEntry.BlockB != nil &&
 							(nextEntry.BlockB.LineStart <= currentCoalescedEndB+1+maxGapForCoalesce) {
@@ -322,72 +1364,139 @@ func main() {
 				}
 			}
 
+			// With --line-numbers, block text is printed line by line from the grouped blocks.
+			printText := func(label, marker string, fromB bool, combined string) {
+				if !ShowLineNumbers {
+					printDetailText("    ", label, combined)
+					return
+				}
+				var blocks []*ContentBlock
+				for _, e := range entries[i:j] {
+					cb := e.BlockA
+					if fromB {
+						cb = e.BlockB
+					}
+					if cb != nil {
+						blocks = append(blocks, cb)
+					}
+				}
+				printNumberedBlocks("    ", label, marker, blocks)
+			}
+
 			switch diffType {
 			case Added:
 				fmt.Printf("  + File B Lines ~%d-%d:\n", currentCoalescedStartB, currentCoalescedEndB)
-				fmt.Printf("    \"%s\"\n", summarizedText(combinedTextB.String(), true))
+				printContextLines(linesB, currentCoalescedStartB-ContextLines, currentCoalescedStartB-1)
+				printText("", "+", true, combinedTextB.String())
+				printContextLines(linesB, currentCoalescedEndB+1, currentCoalescedEndB+ContextLines)
 			case Deleted:
 				fmt.Printf("  - File A Lines ~%d-%d:\n", currentCoalescedStartA, currentCoalescedEndA)
-				fmt.Printf("    \"%s\"\n", summarizedText(combinedTextA.String(), true))
+				printContextLines(linesA, currentCoalescedStartA-ContextLines, currentCoalescedStartA-1)
+				printText("", "-", false, combinedTextA.String())
+				printContextLines(linesA, currentCoalescedEndA+1, currentCoalescedEndA+ContextLines)
 			case Modified:
 				fmt.Printf("  ~ File A Lines ~%d-%d vs File B Lines ~%d-%d\n", currentCoalescedStartA, currentCoalescedEndA, currentCoalescedStartB, currentCoalescedEndB)
 				fmt.Printf("    (Overall Block Similarity: %.2f)\n", firstBlockInCoalescedGroup.Similarity)
+				printContextLines(linesB, currentCoalescedStartB-ContextLines, currentCoalescedStartB-1)
 				if len(firstBlockInCoalescedGroup.LineDiffs) > 0 && (j-i == 1) {
 					fmt.Println("    Line-level changes (for first block in sequence):")
-					for _, op := range firstBlockInCoalescedGroup.LineDiffs {
-						opTextLines := strings.Split(strings.TrimSuffix(op.Text, "\n"), "\n")
-						for _, opLine := range opTextLines {
-							if strings.TrimSpace(opLine) == "" && op.Operation == diffmatchpatch.DiffEqual {
-								continue
-							}
-							prefix := "      "
-							switch op.Operation {
-							case diffmatchpatch.DiffInsert:
-								prefix += "+ "
-							case diffmatchpatch.DiffDelete:
-								prefix += "- "
-							case diffmatchpatch.DiffEqual:
-								prefix += "  "
-							}
-							fmt.Printf("%s%s\n", prefix, opLine)
-						}
-					}
+					printLineDiffOps(firstBlockInCoalescedGroup.LineDiffs, "      ", firstBlockInCoalescedGroup.BlockA, firstBlockInCoalescedGroup.BlockB)
 				} else {
-					fmt.Printf("    Block A Content: \"%s\"\n", summarizedText(combinedTextA.String(), true))
-					fmt.Printf("    Block B Content: \"%s\"\n", summarizedText(combinedTextB.String(), true))
+					printText("Block A Content", "-", false, combinedTextA.String())
+					printText("Block B Content", "+", true, combinedTextB.String())
 				}
+				printContextLines(linesB, currentCoalescedEndB+1, currentCoalescedEndB+ContextLines)
 			case Moved:
 				fmt.Printf("  M File A Lines ~%d-%d moved to\n", currentCoalescedStartA, currentCoalescedEndA)
-				fmt.Printf("    Content (from A): \"%s\"\n", summarizedText(combinedTextA.String(), true))
+				printText("Content (from A)", "M", false, combinedTextA.String())
 				fmt.Printf("  M File B Lines ~%d-%d\n", currentCoalescedStartB, currentCoalescedEndB)
+				fmt.Printf("    (Displacement: %s)\n", entryMoveDistance(firstBlockInCoalescedGroup, docLinesA, docLinesB))
 				if combinedTextA.String() != combinedTextB.String() && combinedTextB.Len() > 0 {
-					fmt.Printf("    Content (from B, if different): \"%s\"\n", summarizedText(combinedTextB.String(), true))
+					printText("Content (from B, if different)", "M", true, combinedTextB.String())
 				}
-				if firstBlockInCoalescedGroup.Similarity > 0 && firstBlockInCoalescedGroup.Similarity < 0.9999 {
-					fmt.Printf("    (Note: Initial pair in sequence may also be modified, Similarity to B: %.2f)\n", firstBlockInCoalescedGroup.Similarity)
+			case MovedModified:
+				fmt.Printf("  M~ File A Lines ~%d-%d moved and changed to File B Lines ~%d-%d\n", currentCoalescedStartA, currentCoalescedEndA, currentCoalescedStartB, currentCoalescedEndB)
+				fmt.Printf("    (Displacement: %s)\n", entryMoveDistance(firstBlockInCoalescedGroup, docLinesA, docLinesB))
+				fmt.Printf("    (Overall Block Similarity: %.2f)\n", firstBlockInCoalescedGroup.Similarity)
+				if len(firstBlockInCoalescedGroup.LineDiffs) > 0 && (j-i == 1) {
+					fmt.Println("    Line-level changes (for first block in sequence):")
+					printLineDiffOps(firstBlockInCoalescedGroup.LineDiffs, "      ", firstBlockInCoalescedGroup.BlockA, firstBlockInCoalescedGroup.BlockB)
+				} else {
+					printText("Block A Content", "-", false, combinedTextA.String())
+					printText("Block B Content", "+", true, combinedTextB.String())
 				}
 			case Unchanged:
 				fmt.Printf("  = File A Lines ~%d-%d matches\n", currentCoalescedStartA, currentCoalescedEndA)
 				fmt.Printf("  = File B Lines ~%d-%d\n", currentCoalescedStartB, currentCoalescedEndB)
-				fmt.Printf("    \"%s\"\n", summarizedText(combinedTextA.String(), true))
+				printText("", "=", false, combinedTextA.String())
 			}
 			i = j
 		}
 	}
 }
 
+// printLineDiffOps prints line-level diff ops with +/- markers, skipping blank equal lines.
+// With --line-numbers each line is prefixed with its line numbers in blockA and blockB.
+func printLineDiffOps(ops []LineDiffOp, indent string, blockA, blockB *ContentBlock) {
+	var gutters []string
+	if ShowLineNumbers {
+		gutters = lineDiffGutters(ops, blockA, blockB)
+	}
+	for _, op := range ops {
+		opTextLines := strings.Split(strings.TrimSuffix(op.Text, "\n"), "\n")
+		for _, opLine := range opTextLines {
+			if strings.TrimSpace(opLine) == "" && op.Operation == diffmatchpatch.DiffEqual {
+				continue
+			}
+			prefix := indent
+			if len(gutters) > 0 {
+				prefix, gutters = prefix+gutters[0], gutters[1:]
+			}
+			switch op.Operation {
+			case diffmatchpatch.DiffInsert:
+				prefix += "+ "
+			case diffmatchpatch.DiffDelete:
+				prefix += "- "
+			case diffmatchpatch.DiffEqual:
+				prefix += "  "
+			}
+			fmt.Printf("%s%s\n", prefix, bidiIsolate(opLine))
+		}
+	}
+}
+
 // summarizedText is stable
 func summarizedText(text string, detailed bool) string {
 	text = strings.ReplaceAll(text, "\n", "↵ ")
 	maxLength := 60
-	if detailed {
+	switch {
+	case SummaryWidth > 0:
+		maxLength = SummaryWidth
+	case detailed:
 		maxLength = 80
 	}
-	runes := []rune(text)
-	if len(runes) > maxLength {
-		return string(runes[:maxLength-3]) + "..."
+	if _, cut := truncateGraphemes(text, maxLength); cut {
+		head, _ := truncateGraphemes(text, maxLength-3)
+		return bidiIsolateLines(head) + "..."
 	}
-	return text
+	return bidiIsolateLines(text)
+}
+
+// printDetailText prints block text in a detailed section: summarized on one
+// line, optionally after a label, or with --full-content every line of it.
+func printDetailText(indent, label, text string) {
+	if FullContent {
+		if label != "" {
+			fmt.Printf("%s%s:\n", indent, label)
+		}
+		printIndentedText(indent+"| ", text)
+		return
+	}
+	if label != "" {
+		fmt.Printf("%s%s: \"%s\"\n", indent, label, summarizedText(text, true))
+		return
+	}
+	fmt.Printf("%s\"%s\"\n", indent, summarizedText(text, true))
 }
 
 // printFocusResults is stable
@@ -437,52 +1546,84 @@ func printFocusResults(rawFileAContent string, diffs []DiffEntry, focus FocusRan
 
 				switch intersectingDiffEntry.Type {
 				case Deleted:
-					fmt.Printf("    Content (from A): \"%s\"\n", summarizedText(blockA.OriginalText, true))
+					printDetailText("    ", "Content (from A)", blockA.OriginalText)
 				case Unchanged:
 					fmt.Printf("    Matched with File B Lines: ~%d-%d\n", intersectingDiffEntry.BlockB.LineStart, intersectingDiffEntry.BlockB.LineEnd)
-					fmt.Printf("    Content: \"%s\"\n", summarizedText(blockA.OriginalText, true))
+					printDetailText("    ", "Content", blockA.OriginalText)
 				case Moved:
 					fmt.Printf("    Moved to File B Lines: ~%d-%d\n", intersectingDiffEntry.BlockB.LineStart, intersectingDiffEntry.BlockB.LineEnd)
-					fmt.Printf("    Content (from A): \"%s\"\n", summarizedText(blockA.OriginalText, true))
-					if intersectingDiffEntry.Similarity > 0 && intersectingDiffEntry.Similarity < 0.9999 {
-						fmt.Printf("    (Note: Content also modified, Block Similarity: %.2f)\n", intersectingDiffEntry.Similarity)
+					printDetailText("    ", "Content (from A)", blockA.OriginalText)
+				case MovedModified:
+					fmt.Printf("    Moved and changed to File B Lines: ~%d-%d\n", intersectingDiffEntry.BlockB.LineStart, intersectingDiffEntry.BlockB.LineEnd)
+					fmt.Printf("    (Overall Block Similarity: %.2f)\n", intersectingDiffEntry.Similarity)
+					if len(intersectingDiffEntry.LineDiffs) > 0 {
+						fmt.Println("    Line-level changes within this block:")
+						printLineDiffOps(intersectingDiffEntry.LineDiffs, "      ", intersectingDiffEntry.BlockA, intersectingDiffEntry.BlockB)
 					}
 				case Modified:
 					fmt.Printf("    Changed from/to File B Lines: ~%d-%d\n", intersectingDiffEntry.BlockB.LineStart, intersectingDiffEntry.BlockB.LineEnd)
 					fmt.Printf("    (Overall Block Similarity: %.2f)\n", intersectingDiffEntry.Similarity)
 					if len(intersectingDiffEntry.LineDiffs) > 0 {
 						fmt.Println("    Line-level changes within this block:")
-						for _, op := range intersectingDiffEntry.LineDiffs {
-							opTextLines := strings.Split(strings.TrimSuffix(op.Text, "\n"), "\n")
-							for _, opLine := range opTextLines {
-								if strings.TrimSpace(opLine) == "" && op.Operation == diffmatchpatch.DiffEqual {
-									continue
-								}
-								prefix := "      "
-								switch op.Operation {
-								case diffmatchpatch.DiffInsert:
-									prefix += "+ "
-								case diffmatchpatch.DiffDelete:
-									prefix += "- "
-								case diffmatchpatch.DiffEqual:
-									prefix += "  "
-								}
-								fmt.Printf("%s%s\n", prefix, opLine)
-							}
-						}
+						printLineDiffOps(intersectingDiffEntry.LineDiffs, "      ", intersectingDiffEntry.BlockA, intersectingDiffEntry.BlockB)
 					}
 				}
 				lastReportedBlockKey = entryKey
 			}
 			currentFocusLineNum = min(focus.EndLine, blockA.LineEnd) + 1
 		} else {
-			fmt.Printf("\nLine A:%d: \"%s\"\n", currentFocusLineNum, fileALines[currentFocusLineNum-1])
+			fmt.Printf("\nLine A:%d: \"%s\"\n", currentFocusLineNum, bidiIsolate(fileALines[currentFocusLineNum-1]))
 			fmt.Printf("  Status: Line not part of any reported diff block.\n")
 			currentFocusLineNum++
 		}
 	}
 }
 
+// printFocusPatternResults reports the fate of every File A block matching pattern,
+// plus any NEW File B blocks that match it.
+func printFocusPatternResults(diffs []DiffEntry, pattern *regexp.Regexp) {
+	fmt.Printf("\n--- Focus on File A blocks matching /%s/ ---\n", pattern.String())
+	var matchedA, matchedNewB []DiffEntry
+	for _, d := range diffs {
+		if d.BlockA != nil && pattern.MatchString(d.BlockA.OriginalText) {
+			matchedA = append(matchedA, d)
+		} else if d.Type == Added && d.BlockB != nil && pattern.MatchString(d.BlockB.OriginalText) {
+			matchedNewB = append(matchedNewB, d)
+		}
+	}
+	sort.Slice(matchedA, func(i, j int) bool { return matchedA[i].BlockA.LineStart < matchedA[j].BlockA.LineStart })
+
+	if len(matchedA) == 0 {
+		fmt.Println("\nNo File A blocks match the pattern.")
+	}
+	for _, d := range matchedA {
+		fmt.Printf("\nA Lines %d-%d: %s\n", d.BlockA.LineStart, d.BlockA.LineEnd, d.Type)
+		printDetailText("    ", "Content (from A)", d.BlockA.OriginalText)
+		switch d.Type {
+		case Unchanged:
+			fmt.Printf("    Matched with File B Lines: ~%d-%d\n", d.BlockB.LineStart, d.BlockB.LineEnd)
+		case Moved:
+			fmt.Printf("    Moved to File B Lines: ~%d-%d\n", d.BlockB.LineStart, d.BlockB.LineEnd)
+		case MovedModified:
+			fmt.Printf("    Moved and changed to File B Lines: ~%d-%d (Similarity: %.2f)\n", d.BlockB.LineStart, d.BlockB.LineEnd, d.Similarity)
+			if !pattern.MatchString(d.BlockB.OriginalText) {
+				fmt.Println("    (The pattern no longer matches the File B version.)")
+			}
+		case Modified:
+			fmt.Printf("    Changed from/to File B Lines: ~%d-%d (Similarity: %.2f)\n", d.BlockB.LineStart, d.BlockB.LineEnd, d.Similarity)
+			if !pattern.MatchString(d.BlockB.OriginalText) {
+				fmt.Println("    (The pattern no longer matches the File B version.)")
+			}
+		}
+	}
+	if len(matchedNewB) > 0 {
+		fmt.Printf("\nThe pattern also matches %d NEW block(s) in File B:\n", len(matchedNewB))
+		for _, d := range matchedNewB {
+			fmt.Printf("  + File B Lines ~%d-%d: \"%s\"\n", d.BlockB.LineStart, d.BlockB.LineEnd, summarizedText(d.BlockB.OriginalText, true))
+		}
+	}
+}
+
 // min is stable
 func min(a, b int) int {
 	if a < b {
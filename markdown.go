@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// OutputFormat selects the report renderer (--format): "text", "markdown",
+// "side-by-side", "github" or "rdjson".
+var OutputFormat string
+
+const AnchorChecksumLength = 10
+
+// markdownEscaper keeps summaries from being rendered as Markdown or HTML.
+var markdownEscaper = strings.NewReplacer("\\", "\\\\", "*", "\\*", "_", "\\_", "`", "\\`", "[", "\\[", "]", "\\]", "<", "&lt;")
+
+// entryAnchors returns a permalink anchor for every entry, derived from the content
+// checksums of its blocks. Anchors survive re-runs, threshold changes and edits
+// elsewhere in the files; repeated identical entries get a -2, -3, ... suffix.
+func entryAnchors(diffs []DiffEntry) map[string]string {
+	side := func(cb *ContentBlock) string {
+		if cb == nil {
+			return "none"
+		}
+		return cb.Checksum[:AnchorChecksumLength]
+	}
+	anchors := make(map[string]string, len(diffs))
+	seen := make(map[string]int)
+	for _, e := range diffs {
+		anchor := "e-" + side(e.BlockA) + "-" + side(e.BlockB)
+		seen[anchor]++
+		if n := seen[anchor]; n > 1 {
+			anchor = fmt.Sprintf("%s-%d", anchor, n)
+		}
+		anchors[entryID(e)] = anchor
+	}
+	return anchors
+}
+
+func markdownRange(label string, cb *ContentBlock) string {
+	if cb.LineStart == cb.LineEnd {
+		return fmt.Sprintf("%s L%d", label, cb.LineStart)
+	}
+	return fmt.Sprintf("%s L%d-%d", label, cb.LineStart, cb.LineEnd)
+}
+
+// markdownFence returns a code fence longer than any backtick run in text.
+func markdownFence(text string) string {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	return fence
+}
+
+// printMarkdownReport prints the diff as a Markdown document with one anchored
+// item per entry, so reviewers can link straight to a change. Sections listed in
+// --details include the entry content; entries are never coalesced.
+func printMarkdownReport(diffs []DiffEntry, fileAPath, fileBPath string, details map[DiffType]bool) {
+	fmt.Printf("# Semantic diff of `%s` and `%s`\n", fileAPath, fileBPath)
+	if len(diffs) == 0 {
+		fmt.Println("\nFiles are semantically identical at the block level.")
+		return
+	}
+	anchors := entryAnchors(diffs)
+	grouped := make(map[DiffType][]DiffEntry)
+	for _, e := range diffs {
+		grouped[e.Type] = append(grouped[e.Type], e)
+	}
+	if CollateLocale != "" {
+		collator, _ := newCollator(CollateLocale) // Validated in main
+		for _, entries := range grouped {
+			sortEntriesByCollation(entries, collator)
+		}
+	}
+	docLinesA, docLinesB := documentLengths(diffs)
+	if SortMovedBy == "distance" {
+		sortMovedByDistance(grouped[Moved], docLinesA, docLinesB)
+		sortMovedByDistance(grouped[MovedModified], docLinesA, docLinesB)
+	}
+
+	for _, diffType := range []DiffType{Added, Deleted, Moved, MovedModified, Modified, Unchanged} {
+		entries := grouped[diffType]
+		if len(entries) == 0 {
+			continue
+		}
+		fmt.Printf("\n## %s (%d)\n\n", diffType, len(entries))
+		for _, e := range entries {
+			anchor := anchors[entryID(e)]
+			var where []string
+			if e.BlockA != nil {
+				where = append(where, markdownRange("A", e.BlockA))
+			}
+			if e.BlockB != nil {
+				where = append(where, markdownRange("B", e.BlockB))
+			}
+			item := fmt.Sprintf("- <a id=\"%s\"></a>[%s](#%s)", anchor, strings.Join(where, " → "), anchor)
+			if e.Similarity > 0 {
+				item += fmt.Sprintf(" (similarity %.2f)", e.Similarity)
+			}
+			if diffType == Moved || diffType == MovedModified {
+				item += fmt.Sprintf(" (%s)", entryMoveDistance(e, docLinesA, docLinesB))
+			}
+			text := ""
+			if e.BlockA != nil {
+				text = e.BlockA.OriginalText
+			} else {
+				text = e.BlockB.OriginalText
+			}
+			fmt.Printf("%s: %s\n", item, markdownEscaper.Replace(summarizedText(text, true)))
+			for _, f := range e.Annotations {
+				fmt.Printf("  - ⚠ %s\n", markdownEscaper.Replace(f))
+			}
+			if details[diffType] {
+				printMarkdownEntryBody(e)
+			}
+		}
+	}
+}
+
+// printMarkdownEntryBody prints an entry's content as an indented code block,
+// as a unified-style diff when it has line-level changes.
+func printMarkdownEntryBody(e DiffEntry) {
+	var body strings.Builder
+	lang := ""
+	if len(e.LineDiffs) > 0 {
+		lang = "diff"
+		for _, op := range e.LineDiffs {
+			marker := " "
+			switch op.Operation {
+			case diffmatchpatch.DiffInsert:
+				marker = "+"
+			case diffmatchpatch.DiffDelete:
+				marker = "-"
+			}
+			for _, line := range strings.Split(strings.TrimSuffix(op.Text, "\n"), "\n") {
+				body.WriteString(marker + line + "\n")
+			}
+		}
+	} else if e.BlockA != nil {
+		body.WriteString(e.BlockA.OriginalText + "\n")
+	} else {
+		body.WriteString(e.BlockB.OriginalText + "\n")
+	}
+	fence := markdownFence(body.String())
+	fmt.Printf("\n  %s%s\n", fence, lang)
+	for _, line := range strings.Split(strings.TrimSuffix(body.String(), "\n"), "\n") {
+		fmt.Printf("  %s\n", line)
+	}
+	fmt.Printf("  %s\n\n", fence)
+}
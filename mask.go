@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// textMask replaces every match of a pattern with a placeholder.
+type textMask struct {
+	Pattern     *regexp.Regexp
+	Placeholder string
+}
+
+// maskList is the repeatable --mask flag. The masks are applied, in order, to
+// text before it is normalized, so volatile tokens such as UUIDs, dates or
+// e-mail addresses do not stop lines and blocks from matching. Reports still
+// show the original text. Its string form holds one "regexp=placeholder" per
+// line, so presets round-trip every mask.
+type maskList []textMask
+
+func (m *maskList) String() string {
+	specs := make([]string, len(*m))
+	for k, mask := range *m {
+		specs[k] = mask.Pattern.String() + "=" + mask.Placeholder
+	}
+	return strings.Join(specs, "\n")
+}
+
+// Set adds the masks of a "regexp=placeholder" value. The pattern ends at the
+// last '=', so it may contain '=' itself but the placeholder may not.
+func (m *maskList) Set(value string) error {
+	for _, spec := range strings.Split(value, "\n") {
+		if spec == "" {
+			continue
+		}
+		eq := strings.LastIndex(spec, "=")
+		if eq <= 0 {
+			return fmt.Errorf("invalid mask %q (want regexp=placeholder)", spec)
+		}
+		re, err := regexp.Compile(spec[:eq])
+		if err != nil {
+			return fmt.Errorf("invalid mask %q: %v", spec, err)
+		}
+		*m = append(*m, textMask{Pattern: re, Placeholder: spec[eq+1:]})
+	}
+	return nil
+}
+
+// apply masks text with each mask in turn. Placeholders are literal; "$1" is
+// not expanded.
+func (m maskList) apply(text string) string {
+	for _, mask := range m {
+		text = mask.Pattern.ReplaceAllLiteralString(text, mask.Placeholder)
+	}
+	return text
+}
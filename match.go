@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MatchMode diffs one file against every candidate file and ranks the
+// candidates by document similarity (the match subcommand).
+var MatchMode bool
+
+// MatchAmbiguousMargin is how many similarity points the best candidate must
+// lead the next by to be named without a warning.
+const MatchAmbiguousMargin = 5.0
+
+// matchCandidate is the outcome of diffing the file against one candidate.
+type matchCandidate struct {
+	path      string
+	identical bool
+	stats     DiffStats
+}
+
+// expandCandidates expands the glob patterns among the candidate arguments,
+// leaving out the file itself and duplicates.
+func expandCandidates(filePath string, args []string) ([]string, error) {
+	var paths []string
+	seen := map[string]bool{filepath.Clean(filePath): true}
+	for _, arg := range args {
+		matches := []string{arg}
+		if !isObjectURI(arg) && strings.ContainsAny(arg, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(arg); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %v", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no file matches %q", arg)
+			}
+		}
+		for _, path := range matches {
+			if !isObjectURI(path) {
+				path = filepath.Clean(path)
+			}
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths, nil
+}
+
+// runMatch diffs filePath against each candidate and reports them from the
+// most to the least similar. It exits 0 if a candidate is identical to the
+// file, 1 otherwise, and 2 if no candidate could be diffed.
+func runMatch(filePath string, args []string, opts Options) int {
+	candidates, err := expandCandidates(filePath, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: match: %v\n", err)
+		return ExitTrouble
+	}
+	if len(candidates) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: match: no candidates other than the file itself")
+		return ExitTrouble
+	}
+	content, err := readInputFile(filePath, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitTrouble
+	}
+
+	var results []matchCandidate
+	for _, path := range candidates {
+		candidate, err := readInputFile(path, 1)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping candidate: %v\n", err)
+			continue
+		}
+		if identicalInputs(content, candidate) {
+			results = append(results, matchCandidate{path: path, identical: true, stats: computeDiffStats(nil, nil)})
+			continue
+		}
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if DiffTimeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, DiffTimeout)
+		}
+		opts.Run = &DiffRun{}
+		diffs, _, err := runDiff(ctx, content, candidate, opts)
+		cancel()
+		if err == nil {
+			err = similarityPluginErr()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping candidate %s: %v\n", path, err)
+			continue
+		}
+		stats := computeDiffStats(diffs, opts.Run)
+		debugf(opts.Verbosity, VerbositySummary, "match_candidate", map[string]any{"candidate": path, "similarity": stats.DocumentSimilarityPercent}, "Candidate %s: %.1f%% similar", path, stats.DocumentSimilarityPercent)
+		results = append(results, matchCandidate{path: path, stats: stats})
+	}
+	if len(results) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: match: no candidate could be diffed")
+		return ExitTrouble
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].stats.DocumentSimilarityPercent > results[j].stats.DocumentSimilarityPercent
+	})
+	printMatchResults(filePath, results)
+	if results[0].identical {
+		return ExitIdentical
+	}
+	return ExitDifferent
+}
+
+// printMatchResults names the best candidate and lists every candidate with
+// its document similarity and the blocks of its diff by type.
+func printMatchResults(filePath string, results []matchCandidate) {
+	best := results[0]
+	fmt.Printf("Best match for %s among %d candidates: %s (%.1f%% similar", filePath, len(results), best.path, best.stats.DocumentSimilarityPercent)
+	if best.identical {
+		fmt.Print(", identical")
+	}
+	fmt.Println(")")
+	if len(results) > 1 && best.stats.DocumentSimilarityPercent-results[1].stats.DocumentSimilarityPercent < MatchAmbiguousMargin {
+		fmt.Fprintf(noteWriter(), "Note: %s is within %.0f points (%.1f%% similar); the best match is not clear-cut.\n", results[1].path, MatchAmbiguousMargin, results[1].stats.DocumentSimilarityPercent)
+	}
+
+	heading := "\n# CANDIDATES\n"
+	row := "  %4s  %10s  %9s  %5s  %13s  %7s  %5s  %7s  %s\n"
+	if OutputFormat == "markdown" {
+		heading = "\n## CANDIDATES\n\n| Rank | Similarity | Unchanged | Moved | Moved-changed | Changed | New | Deleted | Candidate |\n|---:|---:|---:|---:|---:|---:|---:|---:|---|\n"
+		row = "| %s | %s | %s | %s | %s | %s | %s | %s | %s |\n"
+	}
+	fmt.Print(heading)
+	if OutputFormat != "markdown" {
+		fmt.Printf(row, "rank", "similarity", "unchanged", "moved", "moved-changed", "changed", "new", "deleted", "candidate")
+	}
+	for k, r := range results {
+		s := r.stats
+		fmt.Printf(row, fmt.Sprint(k+1), fmt.Sprintf("%.1f%%", s.DocumentSimilarityPercent),
+			fmt.Sprint(s.Unchanged.Blocks), fmt.Sprint(s.Moved.Blocks), fmt.Sprint(s.MovedModified.Blocks),
+			fmt.Sprint(s.Modified.Blocks), fmt.Sprint(s.Added.Blocks), fmt.Sprint(s.Deleted.Blocks), r.path)
+	}
+	if OutputFormat != "markdown" {
+		fmt.Println("  (Blocks of the diff from the file to each candidate; identical candidates have none.)")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MatrixBlockRef identifies a gap block in a similarity matrix dump.
+type MatrixBlockRef struct {
+	ID        int `json:"id"`
+	LineStart int `json:"line_start"`
+	LineEnd   int `json:"line_end"`
+	Lines     int `json:"lines"`
+}
+
+// SimilarityMatrix holds the score of every gap block in A against every gap block in B.
+type SimilarityMatrix struct {
+	SchemaVersion int              `json:"schema_version"`
+	Threshold     float64          `json:"threshold"`
+	BlocksA       []MatrixBlockRef `json:"blocks_a"`
+	BlocksB       []MatrixBlockRef `json:"blocks_b"`
+	Scores        [][]float32      `json:"scores"` // Scores[i][j] is BlocksA[i] vs BlocksB[j]
+
+	// Component scores of --similarity combined, by metric name
+	Components map[string][][]float32 `json:"components,omitempty"`
+}
+
+func newMatrixBlockRef(cb *ContentBlock) MatrixBlockRef {
+	return MatrixBlockRef{
+		ID:        cb.ID,
+		LineStart: cb.LineStart,
+		LineEnd:   cb.LineEnd,
+		Lines:     strings.Count(cb.OriginalText, "\n") + 1,
+	}
+}
+
+// computeSimilarityMatrix scores all A×B gap block pairs, including the short
+// blocks that Stage 4 skips, so thresholds can be tuned against the full picture.
+func computeSimilarityMatrix(gapBlocksA, gapBlocksB []ContentBlock, sim Similarity, threshold float64) *SimilarityMatrix {
+	m := &SimilarityMatrix{
+		SchemaVersion: SchemaVersion,
+		Threshold:     threshold,
+		BlocksA:       make([]MatrixBlockRef, len(gapBlocksA)),
+		BlocksB:       make([]MatrixBlockRef, len(gapBlocksB)),
+		Scores:        make([][]float32, len(gapBlocksA)),
+	}
+	for j := range gapBlocksB {
+		m.BlocksB[j] = newMatrixBlockRef(&gapBlocksB[j])
+	}
+	for i := range gapBlocksA {
+		m.BlocksA[i] = newMatrixBlockRef(&gapBlocksA[i])
+		m.Scores[i] = make([]float32, len(gapBlocksB))
+		for j := range gapBlocksB {
+			m.Scores[i][j] = sim.Score(&gapBlocksA[i], &gapBlocksB[j])
+		}
+		if combined, ok := sim.(CombinedSimilarity); ok {
+			if m.Components == nil {
+				m.Components = make(map[string][][]float32)
+			}
+			for _, comp := range combined.Components {
+				m.Components[comp.Name] = append(m.Components[comp.Name], make([]float32, len(gapBlocksB)))
+			}
+			for j := range gapBlocksB {
+				for k, score := range combined.ComponentScores(&gapBlocksA[i], &gapBlocksB[j]) {
+					m.Components[combined.Components[k].Name][i][j] = score
+				}
+			}
+		}
+	}
+	return m
+}
+
+// WriteFile writes the matrix as JSON when path ends in .json, otherwise as a CSV
+// grid with one row per A block and one column per B block.
+func (m *SimilarityMatrix) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	}
+
+	w := csv.NewWriter(f)
+	header := []string{"A\\B"}
+	for _, b := range m.BlocksB {
+		header = append(header, fmt.Sprintf("B%d L%d-%d", b.ID, b.LineStart, b.LineEnd))
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	for i, a := range m.BlocksA {
+		row := []string{fmt.Sprintf("A%d L%d-%d", a.ID, a.LineStart, a.LineEnd)}
+		for _, score := range m.Scores[i] {
+			row = append(row, fmt.Sprintf("%.4f", score))
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+	"strings"
+)
+
+const MinHashSize = 64      // Hash functions per signature
+const LSHBands = 32         // Bands of MinHashSize/LSHBands rows; pairs sharing any band are candidates
+const LSHShingleSize = 2    // Words per shingle
+const LSHMinPairs = 10000   // Gap block pairs from which pruning kicks in
+const LSHSeed = 0x5eed1e55a // Fixed, so candidate sets (and results) are reproducible
+
+type minHashSignature [MinHashSize]uint64
+
+// splitmix64 derives well-mixed 64-bit hashes from one shingle hash.
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// computeMinHash returns the MinHash signature of the word shingles of normalized
+// text. With 32 bands of 2 rows, a pair whose shingle sets have a Jaccard
+// similarity of 0.2 shares a band with probability 0.73, and one of 0.3 with 0.95.
+func computeMinHash(normalized string) minHashSignature {
+	var sig minHashSignature
+	for i := range sig {
+		sig[i] = ^uint64(0)
+	}
+	words := strings.Fields(normalized)
+	n := max(len(words)-LSHShingleSize+1, 1)
+	for start := 0; start < n; start++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[start:min(start+LSHShingleSize, len(words))], " ")))
+		base := h.Sum64()
+		for i := range sig {
+			if v := splitmix64(base ^ splitmix64(LSHSeed+uint64(i))); v < sig[i] {
+				sig[i] = v
+			}
+		}
+	}
+	return sig
+}
+
+func (sig *minHashSignature) bandKey(band int) uint64 {
+	rows := MinHashSize / LSHBands
+	buf := make([]byte, 8*(rows+1))
+	binary.LittleEndian.PutUint64(buf, uint64(band))
+	for r := 0; r < rows; r++ {
+		binary.LittleEndian.PutUint64(buf[8*(r+1):], sig[band*rows+r])
+	}
+	h := fnv.New64a()
+	h.Write(buf)
+	return h.Sum64()
+}
+
+// lshIndex finds the B gap blocks likely to be similar to an A block without
+// scoring every pair.
+type lshIndex struct {
+	buckets map[uint64][]int // Band key -> indices into the B gap blocks
+}
+
+// newLSHIndex indexes gapBlocksB, or returns nil (no pruning) when noLSH is set
+// (--no-lsh) or there are too few pairs for pruning to pay off.
+func newLSHIndex(gapBlocksA, gapBlocksB []ContentBlock, noLSH bool) *lshIndex {
+	if noLSH || len(gapBlocksA)*len(gapBlocksB) < LSHMinPairs {
+		return nil
+	}
+	idx := &lshIndex{buckets: make(map[uint64][]int)}
+	for j := range gapBlocksB {
+		sig := computeMinHash(gapBlocksB[j].NormalizedText)
+		for band := 0; band < LSHBands; band++ {
+			key := sig.bandKey(band)
+			idx.buckets[key] = append(idx.buckets[key], j)
+		}
+	}
+	return idx
+}
+
+// candidates returns, in ascending order, the indices in [from, to) of B blocks
+// sharing at least one band with a. A nil index returns the whole range.
+func (idx *lshIndex) candidates(a *ContentBlock, from, to int) []int {
+	var result []int
+	if idx == nil {
+		for j := from; j < to; j++ {
+			result = append(result, j)
+		}
+		return result
+	}
+	sig := computeMinHash(a.NormalizedText)
+	seen := make(map[int]bool)
+	for band := 0; band < LSHBands; band++ {
+		for _, j := range idx.buckets[sig.bandKey(band)] {
+			if j >= from && j < to && !seen[j] {
+				seen[j] = true
+				result = append(result, j)
+			}
+		}
+	}
+	sort.Ints(result)
+	return result
+}
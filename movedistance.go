@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// SortMovedBy orders the MOVED and MOVED_AND_CHANGED sections (--sort-moved):
+// "position" (File A order, the default) or "distance" (largest moves first).
+var SortMovedBy = "position"
+
+// moveDistance is how far a moved block travelled.
+type moveDistance struct {
+	Lines            int     // B start line minus A start line; negative moves towards the top
+	FromPct, ToPct   float64 // Start position as a percentage of File A and of File B
+	RelativeDistance float64 // |ToPct - FromPct|
+}
+
+// documentLengths returns the last line of any block on each side, which is
+// the length of each file as far as the diff is concerned.
+func documentLengths(diffs []DiffEntry) (linesA, linesB int) {
+	for _, e := range diffs {
+		if e.BlockA != nil {
+			linesA = max(linesA, e.BlockA.LineEnd)
+		}
+		if e.BlockB != nil {
+			linesB = max(linesB, e.BlockB.LineEnd)
+		}
+	}
+	return linesA, linesB
+}
+
+// entryMoveDistance measures the displacement of a paired entry in files of
+// linesA and linesB lines.
+func entryMoveDistance(e DiffEntry, linesA, linesB int) moveDistance {
+	position := func(line, total int) float64 {
+		if total <= 1 {
+			return 0
+		}
+		return 100 * float64(line-1) / float64(total-1)
+	}
+	d := moveDistance{
+		Lines:   e.BlockB.LineStart - e.BlockA.LineStart,
+		FromPct: position(e.BlockA.LineStart, linesA),
+		ToPct:   position(e.BlockB.LineStart, linesB),
+	}
+	d.RelativeDistance = math.Abs(d.ToPct - d.FromPct)
+	return d
+}
+
+// String describes the move, e.g. "412 lines down, from 12% to 78% of the document".
+func (d moveDistance) String() string {
+	direction := "down"
+	lines := d.Lines
+	if lines < 0 {
+		direction, lines = "up", -lines
+	}
+	return fmt.Sprintf("%d lines %s, from %.0f%% to %.0f%% of the document", lines, direction, d.FromPct, d.ToPct)
+}
+
+// sortMovedByDistance stably sorts moved entries by relative distance, largest
+// first, then by line distance.
+func sortMovedByDistance(entries []DiffEntry, linesA, linesB int) {
+	distances := make(map[*ContentBlock]moveDistance, len(entries))
+	for _, e := range entries {
+		distances[e.BlockA] = entryMoveDistance(e, linesA, linesB)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		di, dj := distances[entries[i].BlockA], distances[entries[j].BlockA]
+		if di.RelativeDistance != dj.RelativeDistance {
+			return di.RelativeDistance > dj.RelativeDistance
+		}
+		return math.Abs(float64(di.Lines)) > math.Abs(float64(dj.Lines))
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import "fmt"
+
+// ShowNearMisses enables the NEAR MISSES section (--show-near-misses);
+// NearMissMargin is how far below the threshold a near miss may score
+// (--near-miss-margin).
+var ShowNearMisses bool
+var NearMissMargin = 0.1
+
+// nearMissFate describes what became of a near miss's File B block.
+func nearMissFate(diffs []DiffEntry, cb *ContentBlock) string {
+	for _, e := range diffs {
+		if e.BlockB == nil || e.BlockB.LineStart != cb.LineStart || e.BlockB.LineEnd != cb.LineEnd {
+			continue
+		}
+		if e.BlockA == nil {
+			return "reported NEW"
+		}
+		return fmt.Sprintf("matched A %s instead", blockRange(e.BlockA))
+	}
+	return "not reported"
+}
+
+// printNearMisses prints the NEAR MISSES section: DELETED blocks whose best File
+// B candidate scored just below the threshold, in File A order.
+func printNearMisses(diffs []DiffEntry, margin float64) {
+	heading, item := "\n# NEAR MISSES\n", "  "
+	if OutputFormat == "markdown" {
+		heading, item = "\n## NEAR MISSES\n\n", "- "
+	}
+	fmt.Print(heading)
+	found := false
+	for _, e := range diffs {
+		if e.Type != Deleted || e.NearMiss == nil {
+			continue
+		}
+		found = true
+		fmt.Printf("%sDELETED A %s: best candidate B %s scored %.2f (%s)\n", item, blockRange(e.BlockA), blockRange(e.NearMiss), e.NearMissSimilarity, nearMissFate(diffs, e.NearMiss))
+	}
+	if !found {
+		fmt.Printf("%sNo DELETED block scored within %.2f of the threshold.\n", item, margin)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const ObjectFetchTimeout = 5 * time.Minute
+
+// objectRef is a parsed object-store input: s3://bucket/key?versionId=V, or
+// gs://bucket/object?generation=G (also gs://bucket/object#G, as gsutil prints it).
+// An empty Version reads the current version.
+type objectRef struct {
+	Scheme  string
+	Bucket  string
+	Key     string
+	Version string
+}
+
+// isObjectURI reports whether an input names an S3 or GCS object rather than a local file.
+func isObjectURI(path string) bool {
+	return strings.HasPrefix(path, "s3://") || strings.HasPrefix(path, "gs://")
+}
+
+// inputName returns the file name part of an input, without the version of an
+// object URI or a compression extension, for extension checks.
+func inputName(path string) string {
+	name := path
+	if ref, err := parseObjectURI(path); err == nil {
+		name = ref.Key
+	}
+	for _, ext := range compressionExtensions {
+		if len(name) > len(ext) && strings.EqualFold(name[len(name)-len(ext):], ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
+
+func parseObjectURI(uri string) (objectRef, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return objectRef{}, err
+	}
+	ref := objectRef{Scheme: u.Scheme, Bucket: u.Host, Key: strings.TrimPrefix(u.Path, "/")}
+	if (ref.Scheme != "s3" && ref.Scheme != "gs") || ref.Bucket == "" || ref.Key == "" {
+		return objectRef{}, fmt.Errorf("invalid object URI %q (expected s3://bucket/key or gs://bucket/object)", uri)
+	}
+	query := u.Query()
+	switch ref.Scheme {
+	case "s3":
+		ref.Version = query.Get("versionId")
+	case "gs":
+		ref.Version = query.Get("generation")
+		if u.Fragment != "" {
+			ref.Version = u.Fragment
+		}
+	}
+	return ref, nil
+}
+
+// errObjectNotFound is returned by getObject for a missing object or version.
+var errObjectNotFound = errors.New("object not found")
+
+// readInput reads a local file, or fetches the given version of an object.
+func readInput(path string) ([]byte, error) {
+	if !isObjectURI(path) {
+		return os.ReadFile(path)
+	}
+	ref, err := parseObjectURI(path)
+	if err != nil {
+		return nil, err
+	}
+	return getObject(ref)
+}
+
+// getObject fetches an object version.
+func getObject(ref objectRef) ([]byte, error) {
+	resp, err := doObjectRequest(http.MethodGet, ref, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// putObject stores data as the object ref names (its Version is ignored).
+func putObject(ref objectRef, data []byte) error {
+	resp, err := doObjectRequest(http.MethodPut, ref, data)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// doObjectRequest sends a GET or PUT for ref, returning the response on success.
+func doObjectRequest(method string, ref objectRef, body []byte) (*http.Response, error) {
+	var req *http.Request
+	var err error
+	if ref.Scheme == "s3" {
+		req, err = newS3Request(method, ref, body, time.Now())
+	} else {
+		req, err = newGCSRequest(method, ref, body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: ObjectFetchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound && method == http.MethodGet {
+		resp.Body.Close()
+		return nil, errObjectNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("object store returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp, nil
+}
+
+// newS3Request builds a GET of an S3 object version, or a PUT of an object. It
+// is signed with AWS Signature Version 4 when AWS_ACCESS_KEY_ID and
+// AWS_SECRET_ACCESS_KEY are set (plus AWS_SESSION_TOKEN for temporary
+// credentials), and sent unsigned for public buckets otherwise. AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL selects an
+// S3-compatible service, addressed path-style.
+func newS3Request(method string, ref objectRef, body []byte, now time.Time) (*http.Request, error) {
+	region := firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	path := "/" + awsURIEncode(ref.Key, false)
+	endpoint := strings.TrimSuffix(firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"), "/")
+	if endpoint != "" {
+		path = "/" + awsURIEncode(ref.Bucket, true) + path
+	} else {
+		endpoint = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", ref.Bucket, region)
+	}
+	rawURL := endpoint + path
+	if ref.Version != "" && method == http.MethodGet {
+		rawURL += "?versionId=" + awsURIEncode(ref.Version, true)
+	}
+	req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return req, nil
+	}
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	signS3Request(req, body, accessKey, secretKey, region, now)
+	return req, nil
+}
+
+// signS3Request adds an AWS Signature Version 4 Authorization header for the
+// "s3" service to a request with the given body, signing the host and every
+// header already set.
+func signS3Request(req *http.Request, body []byte, accessKey, secretKey, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	// The query is only ever a single, already encoded versionId parameter.
+	canonicalRequest := strings.Join([]string{req.Method, req.URL.EscapedPath(), req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, headers["x-amz-content-sha256"]}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	hmacSHA256 := func(key []byte, data string) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(data))
+		return mac.Sum(nil)
+	}
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+// awsURIEncode percent-encodes everything but unreserved characters, and '/'
+// unless encodeSlash is set, as Signature Version 4 requires.
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// newGCSRequest builds a media download of a GCS object generation, or for PUT a
+// media upload of an object, through the JSON API, authorized with the OAuth token in GOOGLE_OAUTH_ACCESS_TOKEN (e.g.
+// from "gcloud auth print-access-token") when set. STORAGE_EMULATOR_HOST selects
+// an emulator.
+func newGCSRequest(method string, ref objectRef, body []byte) (*http.Request, error) {
+	endpoint := "https://storage.googleapis.com"
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		endpoint = strings.TrimSuffix(host, "/")
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+	}
+	var rawURL string
+	if method == http.MethodPut {
+		query := url.Values{"uploadType": {"media"}, "name": {ref.Key}}
+		method, rawURL = http.MethodPost, fmt.Sprintf("%s/upload/storage/v1/b/%s/o?%s", endpoint, url.PathEscape(ref.Bucket), query.Encode())
+	} else {
+		query := url.Values{"alt": {"media"}}
+		if ref.Version != "" {
+			query.Set("generation", ref.Version)
+		}
+		rawURL = fmt.Sprintf("%s/storage/v1/b/%s/o/%s?%s", endpoint, url.PathEscape(ref.Bucket), url.PathEscape(ref.Key), query.Encode())
+	}
+	req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// firstEnv returns the value of the first of the environment variables that is set.
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"time"
+)
+
+// Options configures one diff. The engine entry points take Options by value and
+// never change them, and keep what a diff finds besides its entries in Run, so
+// diffs with different options may run at the same time. The --similarity-cmd
+// process and the --daemon warm cache are still shared by the whole process.
+type Options struct {
+	Verbosity           int               // Debug messages printed on stderr, 0 to VerbosityMatches (-v, -vv, -vvv)
+	SimilarityThreshold float64           // Minimum similarity for a semantic match (--threshold)
+	MaxBlockLines       int               // Window gap paragraphs longer than this; 0 disables (--max-block-lines)
+	MinAnchorLines      int               // Minimum length of an exact megablock match (--min-anchor-lines)
+	MinParagraphLines   int               // Shorter gap paragraphs are never semantically matched (--min-paragraph-lines)
+	IgnoreBlankLines    bool              // Megablocks match across added or removed blank lines (--ignore-blank-lines)
+	IgnoreNumbers       bool              // Mask numeric literals before comparing text (--ignore-numbers)
+	Masks               maskList          // Replace regexp matches before comparing text (--mask)
+	SimilarityMetric    string            // Block similarity metric; empty picks cosine or Levenshtein (--similarity)
+	ShingleSize         int               // Words per shingle of the shingle metric (--shingle-size)
+	SimilarityWeights   SimilarityWeights // Component weights of the combined metric (--similarity-weights)
+	EmbeddingURL        string            // Embedding endpoint for cosine similarity; "" uses stubbed embeddings (--embedding-url)
+	NoLSH               bool              // Score every gap block pair instead of pruning with MinHash/LSH (--no-lsh)
+	TimeBudget          time.Duration     // Total time for one diff, retries included; 0 means unlimited (--budget)
+	RescueThreshold     float64           // Link leftover DELETED and NEW blocks scoring this as possibly related; 0 disables (--rescue-threshold)
+	NearMissMargin      float64           // Record a DELETED block's best candidate scoring this close below the threshold; 0 disables (--show-near-misses)
+	PairAdjacent        bool              // Pair DELETED and NEW blocks between the same anchors as MODIFIED (--pair-adjacent)
+	Explain             bool              // Record why each semantic match was made (--explain)
+	SimilarityMatrix    bool              // Record the gap-block similarity matrix in Run (--dump-matrix)
+	Outline             bool              // Record the heading changes of a hierarchical diff in Run (--outline)
+	Pipeline            Pipeline          // Engine stages to skip and custom stages to run (--pipeline)
+	DetailsSections     map[DiffType]bool // Report sections listed in full (--details)
+	FocusRange          FocusRange        // File A lines to report on (--focus)
+	LevelThresholds     LevelThresholds   // Thresholds of each level of --hierarchical (--level-thresholds)
+	Run                 *DiffRun          // Receives the per-run results; the entry points start one when nil
+}
+
+// DiffRun is what one diff finds besides its entries. Set Options.Run to a new
+// DiffRun to read it once the diff returns; every PerformDiff call of the diff,
+// retries and sections included, shares it.
+type DiffRun struct {
+	Embedding EmbeddingStatus   // The similarity backend used, and why it was degraded
+	Matrix    *SimilarityMatrix // With Options.SimilarityMatrix
+	Outline   []OutlineChange   // With Options.Outline
+	budget    *diffBudget       // Options.TimeBudget, started by the first entry point
+}
+
+// DefaultOptions returns the settings used when no flags are given.
+func DefaultOptions() Options {
+	return Options{
+		SimilarityThreshold: 0.55,
+		MaxBlockLines:       40,
+		MinAnchorLines:      MinMegaBlockLength,
+		MinParagraphLines:   MinParagraphLinesForSemanticMatch,
+		ShingleSize:         3,
+		SimilarityWeights:   SimilarityWeights{Levenshtein: 1, Jaccard: 1, TFIDF: 1, Cosine: 1},
+		DetailsSections:     map[DiffType]bool{Added: true, Deleted: true},
+		LevelThresholds:     defaultLevelThresholds(0.55),
+	}
+}
+
+// begin returns opts with a DiffRun, starting one if the caller did not, and
+// starts the time budget of the run.
+func (o Options) begin() Options {
+	if o.Run == nil {
+		o.Run = &DiffRun{}
+	}
+	if o.Run.Embedding.Backend == "" {
+		o.Run.Embedding.Backend = "levenshtein"
+	}
+	if o.Run.budget == nil {
+		o.Run.budget = startBudget(o.TimeBudget, o.Verbosity)
+	}
+	return o
+}
+
+// normalize prepares text for comparison: the --mask and --ignore-numbers
+// replacements, then NormalizeTextBlock.
+func (o Options) normalize(text string) string {
+	text = o.Masks.apply(text)
+	if o.IgnoreNumbers {
+		text = numberPatternContentBlock.ReplaceAllString(text, "#")
+	}
+	return NormalizeTextBlock(text)
+}
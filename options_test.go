@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// Diffs with different options may run at the same time, each with its own
+// settings and run state.
+func TestConcurrentDiffsKeepTheirOptions(t *testing.T) {
+	a := "Order 1234 shipped on Monday to the customer.\nIt was packed twice.\nThe invoice followed.\n\nClosing words here.\nSigned by all.\nThe end.\n"
+	b := "Order 9876 shipped on Monday to the customer.\nIt was packed twice.\nThe invoice followed.\n\nClosing words here.\nSigned by all.\nThe end.\n"
+	plain := DefaultOptions()
+	numbers := DefaultOptions()
+	numbers.IgnoreNumbers = true
+	matrix := DefaultOptions()
+	matrix.SimilarityMatrix = true
+
+	want := make(map[string]DiffStats)
+	for name, opts := range map[string]Options{"plain": plain, "numbers": numbers, "matrix": matrix} {
+		opts.Run = &DiffRun{}
+		diffs, err := PerformDiff(context.Background(), a, b, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[name] = computeDiffStats(diffs, opts.Run)
+	}
+	if want["numbers"].Unchanged.LinesA == want["plain"].Unchanged.LinesA {
+		t.Fatalf("--ignore-numbers made no difference: %+v", want["numbers"])
+	}
+
+	var wg sync.WaitGroup
+	for k := 0; k < 8; k++ {
+		for name, opts := range map[string]Options{"plain": plain, "numbers": numbers, "matrix": matrix} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				opts.Run = &DiffRun{}
+				diffs, err := PerformDiff(context.Background(), a, b, opts)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if got := computeDiffStats(diffs, opts.Run); got != want[name] {
+					t.Errorf("%s: concurrent diff gave %+v, want %+v", name, got, want[name])
+				}
+				if (opts.Run.Matrix != nil) != opts.SimilarityMatrix {
+					t.Errorf("%s: matrix recorded %t, want %t", name, opts.Run.Matrix != nil, opts.SimilarityMatrix)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ShowOutline prints an outline-level diff of the heading tree (--outline,
+// which implies --hierarchical).
+var ShowOutline bool
+
+// OutlineChange is a heading that was added, removed, or aligned with a heading
+// whose title, level or position differs. A is nil for an added section and B
+// for a removed one.
+type OutlineChange struct {
+	A, B         *Section
+	Renamed      bool
+	LevelChanged bool
+	Moved        bool     // Out of order relative to the other aligned sections
+	Reparented   bool     // Now under a different parent heading
+	NewParent    *Section // B's parent when Reparented (nil for the top level)
+}
+
+// diffOutline compares the heading trees of two files, given the aligned section
+// pairs. Untitled preambles are not part of the outline.
+func diffOutline(sectionsA, sectionsB []Section, pairs [][2]int) []OutlineChange {
+	partnerOfA := make(map[int]int)
+	partnerOfB := make(map[int]int)
+	for _, p := range pairs {
+		partnerOfA[p[0]], partnerOfB[p[1]] = p[1], p[0]
+	}
+
+	// Aligned sections outside the longest run in the same order have moved.
+	var order [][2]int
+	for i := range sectionsA {
+		if j, ok := partnerOfA[i]; ok {
+			order = append(order, [2]int{i, j})
+		}
+	}
+	inOrder := longestIncreasingB(order)
+
+	var changes []OutlineChange
+	for i := range sectionsA {
+		a := &sectionsA[i]
+		if a.Title == "" {
+			continue
+		}
+		j, ok := partnerOfA[i]
+		if !ok {
+			changes = append(changes, OutlineChange{A: a})
+			continue
+		}
+		b := &sectionsB[j]
+		c := OutlineChange{
+			A:            a,
+			B:            b,
+			Renamed:      a.Title != b.Title,
+			LevelChanged: a.Level != b.Level,
+			Moved:        !inOrder[i],
+		}
+		parentPartner := -1
+		if a.Parent >= 0 {
+			if pj, ok := partnerOfA[a.Parent]; ok {
+				parentPartner = pj
+			} else {
+				parentPartner = -2 // The old parent is gone; any new one is a change
+			}
+		}
+		if parentPartner != b.Parent && !(parentPartner == -2 && b.Parent < 0) {
+			c.Reparented = true
+			if b.Parent >= 0 {
+				c.NewParent = &sectionsB[b.Parent]
+			}
+		}
+		if c.Renamed || c.LevelChanged || c.Moved || c.Reparented {
+			changes = append(changes, c)
+		}
+	}
+	for j := range sectionsB {
+		if _, ok := partnerOfB[j]; !ok && sectionsB[j].Title != "" {
+			changes = append(changes, OutlineChange{B: &sectionsB[j]})
+		}
+	}
+	return changes
+}
+
+// longestIncreasingB returns the A indices of a longest subsequence of pairs,
+// given in A order, whose B indices increase.
+func longestIncreasingB(pairs [][2]int) map[int]bool {
+	length := make([]int, len(pairs))
+	prev := make([]int, len(pairs))
+	best := -1
+	for k := range pairs {
+		length[k], prev[k] = 1, -1
+		for m := 0; m < k; m++ {
+			if pairs[m][1] < pairs[k][1] && length[m]+1 > length[k] {
+				length[k], prev[k] = length[m]+1, m
+			}
+		}
+		if best < 0 || length[k] > length[best] {
+			best = k
+		}
+	}
+	members := make(map[int]bool)
+	for k := best; k >= 0; k = prev[k] {
+		members[pairs[k][0]] = true
+	}
+	return members
+}
+
+// outlineHeading renders a section heading as "## Title" whatever its source syntax.
+func outlineHeading(sec *Section) string {
+	return strings.Repeat("#", sec.Level) + " " + sec.Title
+}
+
+// printOutlineChanges prints the OUTLINE CHANGES section.
+func printOutlineChanges(changes []OutlineChange) {
+	heading, item := "\n# OUTLINE CHANGES\n", "  "
+	if OutputFormat == "markdown" {
+		heading, item = "\n## OUTLINE CHANGES\n\n", "- "
+	}
+	fmt.Print(heading)
+	if len(changes) == 0 {
+		fmt.Printf("%sNo heading changes.\n", item)
+		return
+	}
+	for _, c := range changes {
+		switch {
+		case c.A == nil:
+			fmt.Printf("%s+ %s (B L%d)\n", item, outlineHeading(c.B), c.B.LineStart)
+		case c.B == nil:
+			fmt.Printf("%s- %s (A L%d)\n", item, outlineHeading(c.A), c.A.LineStart)
+		default:
+			var what []string
+			if c.Renamed {
+				what = append(what, fmt.Sprintf("renamed to %q", c.B.Title))
+			}
+			if c.LevelChanged {
+				what = append(what, fmt.Sprintf("level %d -> %d", c.A.Level, c.B.Level))
+			}
+			if c.Moved {
+				what = append(what, "moved")
+			}
+			if c.Reparented {
+				if c.NewParent != nil {
+					what = append(what, fmt.Sprintf("now under %q", c.NewParent.Title))
+				} else {
+					what = append(what, "now at the top level")
+				}
+			}
+			fmt.Printf("%s~ %s (A L%d -> B L%d): %s\n", item, outlineHeading(c.A), c.A.LineStart, c.B.LineStart, strings.Join(what, ", "))
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+)
+
+// PageAfter and PageLimit select one page of entries (--page-after, --page-limit).
+var PageAfter string
+var PageLimit int
+
+// entryID identifies an entry by its block IDs as "A/B", with -1 for a missing side.
+// Block IDs are assigned deterministically, so an ID stays valid across runs as
+// long as both inputs and the diff settings are unchanged.
+func entryID(e DiffEntry) string {
+	idA, idB := -1, -1
+	if e.BlockA != nil {
+		idA = e.BlockA.ID
+	}
+	if e.BlockB != nil {
+		idB = e.BlockB.ID
+	}
+	return fmt.Sprintf("%d/%d", idA, idB)
+}
+
+// DiffPage is one cursor-delimited slice of a diff result.
+type DiffPage struct {
+	Entries []DiffEntry
+	Offset  int    // Index of the first entry of the page in the full result
+	Total   int    // Number of entries in the full result
+	Next    string // Cursor for the following page, "" on the last page
+}
+
+// pageDiffEntries returns up to limit entries following the entry whose ID is
+// after ("" starts at the beginning), in report order.
+func pageDiffEntries(diffs []DiffEntry, after string, limit int) (DiffPage, error) {
+	start := 0
+	if after != "" {
+		start = -1
+		for i, e := range diffs {
+			if entryID(e) == after {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return DiffPage{}, fmt.Errorf("no entry with ID %q (IDs change when the inputs or settings change)", after)
+		}
+	}
+	end := min(start+limit, len(diffs))
+	page := DiffPage{Entries: diffs[start:end], Offset: start, Total: len(diffs)}
+	if end < len(diffs) && end > start {
+		page.Next = entryID(diffs[end-1])
+	}
+	return page, nil
+}
+
+func printDiffPage(page DiffPage) {
+	if len(page.Entries) == 0 {
+		fmt.Printf("# ENTRIES (none after this cursor, %d total)\n", page.Total)
+		return
+	}
+	fmt.Printf("# ENTRIES %d-%d of %d\n", page.Offset+1, page.Offset+len(page.Entries), page.Total)
+	for _, e := range page.Entries {
+		fmt.Printf("  id %s\n", entryID(e))
+		printEntryDetail(e)
+	}
+	if page.Next != "" {
+		fmt.Printf("\nNext page: --page-after %s\n", page.Next)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import "sort"
+
+// pairAdjacentReplacements pairs DELETED and NEW blocks that sit in the same gap
+// between two in-place anchors (UNCHANGED or MODIFIED entries, or the file ends)
+// as MODIFIED, whatever their similarity: the i-th DELETED block of a gap, in
+// File A order, pairs with the i-th NEW block, in File B order. This is how a
+// replaced paragraph reads. diffOps computes the line-level changes of each
+// pair. It returns the entries without the paired NEW entries, and the number
+// of pairs.
+func pairAdjacentReplacements(diffs []DiffEntry, scorer Similarity, diffOps func(textA, textB string) []LineDiffOp) ([]DiffEntry, int) {
+	// In-place entries are the LIS of the pairs, so their A and B orders agree.
+	var anchors []DiffEntry
+	for _, e := range diffs {
+		if (e.Type == Unchanged || e.Type == Modified) && e.BlockA != nil && e.BlockB != nil {
+			anchors = append(anchors, e)
+		}
+	}
+	sort.Slice(anchors, func(i, j int) bool { return anchors[i].BlockA.LineStart < anchors[j].BlockA.LineStart })
+	gapOf := func(line int, fromB bool) int {
+		return sort.Search(len(anchors), func(k int) bool {
+			if fromB {
+				return anchors[k].BlockB.LineStart > line
+			}
+			return anchors[k].BlockA.LineStart > line
+		})
+	}
+
+	deletedByGap := make(map[int][]int)
+	addedByGap := make(map[int][]int)
+	for i, e := range diffs {
+		switch e.Type {
+		case Deleted:
+			gap := gapOf(e.BlockA.LineStart, false)
+			deletedByGap[gap] = append(deletedByGap[gap], i)
+		case Added:
+			gap := gapOf(e.BlockB.LineStart, true)
+			addedByGap[gap] = append(addedByGap[gap], i)
+		}
+	}
+
+	pairedAdded := make(map[int]bool)
+	pairs := 0
+	for gap, deleted := range deletedByGap {
+		added := addedByGap[gap]
+		sort.Slice(deleted, func(x, y int) bool { return diffs[deleted[x]].BlockA.LineStart < diffs[deleted[y]].BlockA.LineStart })
+		sort.Slice(added, func(x, y int) bool { return diffs[added[x]].BlockB.LineStart < diffs[added[y]].BlockB.LineStart })
+		for k := 0; k < len(deleted) && k < len(added); k++ {
+			blockA, blockB := diffs[deleted[k]].BlockA, diffs[added[k]].BlockB
+			diffs[deleted[k]] = DiffEntry{
+				Type:        Modified,
+				BlockA:      blockA,
+				BlockB:      blockB,
+				Similarity:  scorer.Score(blockA, blockB),
+				LineDiffs:   diffOps(blockA.OriginalText, blockB.OriginalText),
+				Explanation: &MatchExplanation{Reason: MatchAdjacent},
+			}
+			pairedAdded[added[k]] = true
+			pairs++
+		}
+	}
+	if pairs == 0 {
+		return diffs, 0
+	}
+	kept := diffs[:0]
+	for i, e := range diffs {
+		if !pairedAdded[i] {
+			kept = append(kept, e)
+		}
+	}
+	return kept, pairs
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+// ParallelMinCandidates is the candidate count below which scoring stays serial,
+// since spreading a handful of comparisons over goroutines costs more than it saves.
+const ParallelMinCandidates = 16
+
+// scoreCandidates returns the similarity of a to each candidate, in candidate
+// order. Large candidate sets are split into contiguous chunks scored by up to
+// GOMAXPROCS workers. A metric that scores a whole candidate set at once gets
+// it in one call.
+func scoreCandidates(a *ContentBlock, candidates []*ContentBlock, sim Similarity) []float32 {
+	if batch, ok := sim.(interface {
+		ScoreCandidates(a *ContentBlock, candidates []*ContentBlock) []float32
+	}); ok {
+		return batch.ScoreCandidates(a, candidates)
+	}
+	scores := make([]float32, len(candidates))
+	workers := min(runtime.GOMAXPROCS(0), len(candidates)/ParallelMinCandidates*2)
+	if workers <= 1 {
+		for k, b := range candidates {
+			scores[k] = sim.Score(a, b)
+		}
+		return scores
+	}
+	chunk := (len(candidates) + workers - 1) / workers
+	var wg sync.WaitGroup
+	for from := 0; from < len(candidates); from += chunk {
+		to := min(from+chunk, len(candidates))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := from; k < to; k++ {
+				scores[k] = sim.Score(a, candidates[k])
+			}
+		}()
+	}
+	wg.Wait()
+	return scores
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DetectPII enables flagging of entries that introduce personal data (--detect-pii).
+var DetectPII bool
+
+// piiPatterns find personal data candidates; matches are confirmed by validPII.
+var piiPatterns = []struct {
+	Kind    string
+	Pattern *regexp.Regexp
+}{
+	{"email", regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	{"credit card", regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)},
+	{"SSN", regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)},
+	{"IBAN", regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,4})?\b`)},
+	{"IP address", regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`)},
+	{"phone", regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{2,4}\)[ .-]?)?\d{2,4}[ .-]\d{3,4}[ .-]?\d{0,4}\b`)},
+}
+
+// PIIMatch is one piece of personal data found in a text.
+type PIIMatch struct {
+	Kind  string
+	Value string
+}
+
+func digitsOnly(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// luhnValid reports whether a digit string passes the Luhn checksum used by card numbers.
+func luhnValid(digits string) bool {
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if (len(digits)-i)%2 == 0 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// validPII weeds out matches that are most likely not personal data.
+func validPII(kind, value string) bool {
+	switch kind {
+	case "credit card":
+		return luhnValid(digitsOnly(value))
+	case "phone":
+		n := len(digitsOnly(value))
+		return n >= 7 && n <= 15
+	}
+	return true
+}
+
+// piiKey identifies a match independently of its formatting.
+func piiKey(m PIIMatch) string {
+	switch m.Kind {
+	case "email":
+		return m.Kind + ":" + strings.ToLower(m.Value)
+	case "IBAN":
+		return m.Kind + ":" + strings.ReplaceAll(m.Value, " ", "")
+	case "IP address":
+		return m.Kind + ":" + m.Value
+	default:
+		return m.Kind + ":" + digitsOnly(m.Value)
+	}
+}
+
+// findPII returns the personal data in text. Each span is claimed by the first
+// pattern matching it, so a card number or IP address is not also reported as a
+// phone number.
+func findPII(text string) []PIIMatch {
+	var matches []PIIMatch
+	var claimed [][2]int
+	for _, p := range piiPatterns {
+	next:
+		for _, loc := range p.Pattern.FindAllStringIndex(text, -1) {
+			for _, c := range claimed {
+				if loc[0] < c[1] && c[0] < loc[1] {
+					continue next
+				}
+			}
+			value := text[loc[0]:loc[1]]
+			if !validPII(p.Kind, value) {
+				continue
+			}
+			claimed = append(claimed, [2]int{loc[0], loc[1]})
+			matches = append(matches, PIIMatch{Kind: p.Kind, Value: value})
+		}
+	}
+	return matches
+}
+
+// maskPII hides all but the edges of a value, so the report does not spread the data.
+func maskPII(m PIIMatch) string {
+	if m.Kind == "email" {
+		local, domain, _ := strings.Cut(m.Value, "@")
+		return local[:1] + "***@" + domain
+	}
+	if len(m.Value) <= 4 {
+		return "****"
+	}
+	return strings.Repeat("*", len(m.Value)-4) + m.Value[len(m.Value)-4:]
+}
+
+// PIIFinding is an entry whose new text contains personal data absent from File A.
+type PIIFinding struct {
+	Entry   DiffEntry
+	Matches []PIIMatch
+}
+
+// detectIntroducedPII scans the new text of NEW and changed entries for personal
+// data that appears nowhere in File A.
+func detectIntroducedPII(diffs []DiffEntry, rawContentA string) []PIIFinding {
+	known := make(map[string]bool)
+	for _, m := range findPII(rawContentA) {
+		known[piiKey(m)] = true
+	}
+	var findings []PIIFinding
+	for _, e := range diffs {
+		if e.BlockB == nil || (e.Type != Added && e.Similarity == 0) {
+			continue
+		}
+		var introduced []PIIMatch
+		for _, m := range findPII(e.BlockB.OriginalText) {
+			if !known[piiKey(m)] {
+				introduced = append(introduced, m)
+			}
+		}
+		if len(introduced) > 0 {
+			findings = append(findings, PIIFinding{Entry: e, Matches: introduced})
+		}
+	}
+	return findings
+}
+
+// printPIIFindings prints the PERSONAL DATA INTRODUCED section with masked values.
+func printPIIFindings(findings []PIIFinding) {
+	heading, item := "\n# PERSONAL DATA INTRODUCED\n", "  "
+	if OutputFormat == "markdown" {
+		heading, item = "\n## PERSONAL DATA INTRODUCED\n\n", "- "
+	}
+	fmt.Print(heading)
+	if len(findings) == 0 {
+		fmt.Printf("%sNo new or changed block introduces personal data.\n", item)
+		return
+	}
+	for _, f := range findings {
+		var parts []string
+		for _, m := range f.Matches {
+			parts = append(parts, fmt.Sprintf("%s %s", m.Kind, maskPII(m)))
+		}
+		fmt.Printf("%s[%s] File B L%d-%d: %s\n", item, f.Entry.Type, f.Entry.BlockB.LineStart, f.Entry.BlockB.LineEnd, strings.Join(parts, ", "))
+	}
+}
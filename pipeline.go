@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// PipelineStages are the built-in engine stages in the order they run (--pipeline).
+// preprocess, segment and render run even when left out; custom stages
+// ("exec:cmd") go between classify and render.
+var PipelineStages = []string{"preprocess", "exact-match", "segment", "semantic-match", "classify", "render"}
+
+// Pipeline is a configured engine stage chain. The zero value runs every
+// built-in stage and no custom ones.
+type Pipeline struct {
+	SkipExactMatch    bool     // No megablocks; all content is segmented into paragraphs
+	SkipSemanticMatch bool     // Unmatched paragraphs stay DELETED and NEW
+	SkipClassify      bool     // No move detection; pairs stay UNCHANGED or CHANGED in place
+	Custom            []string // Commands run in order on the classified entries
+}
+
+// parsePipeline parses a comma-separated stage list such as
+// "preprocess,segment,semantic-match,classify,exec:./filter.sh,render". The
+// required stages are added where left out, so "exact-match,render" is valid.
+func parsePipeline(spec string) (Pipeline, error) {
+	var p Pipeline
+	present := make(map[string]bool)
+	next := 0 // Index in PipelineStages of the earliest built-in stage still allowed
+	for _, stage := range strings.Split(spec, ",") {
+		stage = strings.TrimSpace(stage)
+		if command, ok := strings.CutPrefix(stage, "exec:"); ok {
+			if strings.TrimSpace(command) == "" {
+				return p, fmt.Errorf("custom stage %q has no command", stage)
+			}
+			if present["render"] {
+				return p, fmt.Errorf("custom stage %q must come before render", stage)
+			}
+			p.Custom = append(p.Custom, command)
+			continue
+		}
+		k := stageIndex(stage)
+		if k < 0 {
+			return p, fmt.Errorf("unknown stage %q (stages: %s, exec:cmd)", stage, strings.Join(PipelineStages, ", "))
+		}
+		if len(p.Custom) > 0 && k <= stageIndex("classify") {
+			return p, fmt.Errorf("stage %q must come before the custom stages, which see classified entries", stage)
+		}
+		if present[stage] || k < next {
+			return p, fmt.Errorf("stage %q is out of order (order: %s)", stage, strings.Join(PipelineStages, ", "))
+		}
+		present[stage] = true
+		next = k + 1
+	}
+	p.SkipExactMatch = !present["exact-match"]
+	p.SkipSemanticMatch = !present["semantic-match"]
+	p.SkipClassify = !present["classify"]
+	return p, nil
+}
+
+// stageIndex returns the position of a built-in stage, or -1.
+func stageIndex(stage string) int {
+	for k, name := range PipelineStages {
+		if name == stage {
+			return k
+		}
+	}
+	return -1
+}
+
+// runCustomStages passes the entries through each custom stage command. A
+// command receives the entries as a JSON array on stdin, in the recovery file
+// entry format, and prints the entries to keep in the same format. Blocks are
+// identified by their id; their text in the output is ignored.
+func runCustomStages(diffs []DiffEntry, commands []string) ([]DiffEntry, error) {
+	blocksA := make(map[int]*ContentBlock)
+	blocksB := make(map[int]*ContentBlock)
+	for _, e := range diffs {
+		if e.BlockA != nil {
+			blocksA[e.BlockA.ID] = e.BlockA
+		}
+		if e.BlockB != nil {
+			blocksB[e.BlockB.ID] = e.BlockB
+		}
+	}
+	for _, command := range commands {
+		input, err := json.Marshal(recoveryEntries(diffs))
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(command)
+		cmd := exec.Command(fields[0], fields[1:]...)
+		cmd.Stdin = bytes.NewReader(input)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v: %s", command, err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		var entries []RecoveryEntry
+		if err := json.Unmarshal(out, &entries); err != nil {
+			return nil, fmt.Errorf("%s: invalid output: %v", command, err)
+		}
+		diffs = diffs[:0:0]
+		for _, re := range entries {
+			e, err := customStageEntry(re, blocksA, blocksB)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", command, err)
+			}
+			diffs = append(diffs, e)
+		}
+	}
+	sortDiffEntries(diffs)
+	return diffs, nil
+}
+
+// customStageEntry rebuilds a diff entry printed by a custom stage. A pair
+// reported as changed without line_diffs gets them computed.
+func customStageEntry(re RecoveryEntry, blocksA, blocksB map[int]*ContentBlock) (DiffEntry, error) {
+	t, ok := diffTypeByName(re.Type)
+	if !ok {
+		return DiffEntry{}, fmt.Errorf("unknown entry type %q", re.Type)
+	}
+	e := DiffEntry{Type: t, Similarity: re.Similarity, LineDiffs: re.LineDiffs}
+	if re.A != nil {
+		if e.BlockA = blocksA[re.A.ID]; e.BlockA == nil {
+			return e, fmt.Errorf("unknown File A block id %d", re.A.ID)
+		}
+	}
+	if re.B != nil {
+		if e.BlockB = blocksB[re.B.ID]; e.BlockB == nil {
+			return e, fmt.Errorf("unknown File B block id %d", re.B.ID)
+		}
+	}
+	switch {
+	case e.BlockA == nil && e.BlockB == nil:
+		return e, fmt.Errorf("%s entry has no blocks", re.Type)
+	case (t == Added) != (e.BlockA == nil), (t == Deleted) != (e.BlockB == nil):
+		return e, fmt.Errorf("%s entry has the wrong blocks", re.Type)
+	}
+	if (t == Modified || t == MovedModified) && e.LineDiffs == nil {
+		e.LineDiffs = blockLineDiffs(e.BlockA.OriginalText, e.BlockB.OriginalText)
+	}
+	return e, nil
+}
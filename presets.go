@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// presetRunFlags describe a single run rather than a setup and are never saved
+// in or loaded from a preset.
+var presetRunFlags = map[string]bool{"preset": true, "save-preset": true, "focus": true, "focus-pattern": true, "page-after": true, "git-difftool": true}
+
+var presetNameRe = regexp.MustCompile(`^[\w-][\w.-]*$`)
+
+// Preset is a saved configuration: the value of every flag, by flag name.
+type Preset struct {
+	Name  string            `json:"name"`
+	Flags map[string]string `json:"flags"`
+}
+
+// presetPath returns where the named preset is stored, under the user's config
+// directory (e.g. ~/.config/go-semantic-diff/presets/legal-review.json).
+func presetPath(name string) (string, error) {
+	if !presetNameRe.MatchString(name) {
+		return "", fmt.Errorf("invalid preset name %q (use letters, digits, '_', '-' and '.')", name)
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "go-semantic-diff", "presets", name+".json"), nil
+}
+
+// applyPreset sets every flag stored in the named preset that was not given on
+// the command line, so explicit flags override the preset.
+func applyPreset(fs *flag.FlagSet, name string) error {
+	path, err := presetPath(name)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no preset named %q (looked for %s)", name, path)
+	}
+	if err != nil {
+		return err
+	}
+	var preset Preset
+	if err := json.Unmarshal(data, &preset); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	names := make([]string, 0, len(preset.Flags))
+	for flagName := range preset.Flags {
+		names = append(names, flagName)
+	}
+	sort.Strings(names)
+	for _, flagName := range names {
+		if explicit[flagName] || presetRunFlags[flagName] {
+			continue
+		}
+		if err := fs.Set(flagName, preset.Flags[flagName]); err != nil {
+			return fmt.Errorf("%s: --%s: %w", path, flagName, err)
+		}
+	}
+	return nil
+}
+
+// savePreset stores the effective value of every flag, defaults included, as the
+// named preset and returns the file it was written to.
+func savePreset(fs *flag.FlagSet, name string) (string, error) {
+	path, err := presetPath(name)
+	if err != nil {
+		return "", err
+	}
+	preset := Preset{Name: name, Flags: make(map[string]string)}
+	fs.VisitAll(func(f *flag.Flag) {
+		if !presetRunFlags[f.Name] {
+			preset.Flags[f.Name] = f.Value.String()
+		}
+	})
+	data, err := json.MarshalIndent(preset, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, append(data, '\n'), 0o644)
+}
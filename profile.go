@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"time"
+)
+
+// CPUProfilePath and MemProfilePath receive pprof profiles of the run
+// (--cpuprofile, --memprofile), for "go tool pprof".
+var CPUProfilePath, MemProfilePath string
+
+// ShowTimings prints how long each PerformDiff stage took on stderr (--timings).
+var ShowTimings bool
+
+// runTimings adds up the stage durations of every PerformDiff call of a run;
+// its methods do nothing on a nil value.
+type runTimings struct {
+	mu     sync.Mutex
+	start  time.Time
+	stages map[string]time.Duration
+}
+
+// cpuProfile is the open --cpuprofile file.
+var cpuProfile *os.File
+
+// currentTimings is set by startProfiling when --timings is given, nil otherwise.
+var currentTimings *runTimings
+
+func (t *runTimings) add(stage string, elapsed time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stages[stage] += elapsed
+}
+
+// print writes the timings summary to stderr, the stages in pipeline order.
+func (t *runTimings) print() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	total := time.Since(t.start)
+	staged := time.Duration(0)
+	fmt.Fprintln(os.Stderr, "\nTimings:")
+	for _, stage := range UsageStages {
+		elapsed := t.stages[stage]
+		staged += elapsed
+		fmt.Fprintf(os.Stderr, "  %-20s %12v  %5.1f%%\n", stage, elapsed.Round(time.Microsecond), 100*elapsed.Seconds()/total.Seconds())
+	}
+	// Windows and sections diffed in parallel can add up to more than the total
+	if other := total - staged; other > 0 {
+		fmt.Fprintf(os.Stderr, "  %-20s %12v  %5.1f%%\n", "other", other.Round(time.Microsecond), 100*other.Seconds()/total.Seconds())
+	}
+	fmt.Fprintf(os.Stderr, "  %-20s %12v\n", "total", total.Round(time.Microsecond))
+}
+
+// startProfiling starts the --cpuprofile and the --timings clock.
+func startProfiling() error {
+	if ShowTimings {
+		currentTimings = &runTimings{start: time.Now(), stages: make(map[string]time.Duration)}
+	}
+	if CPUProfilePath == "" {
+		return nil
+	}
+	f, err := os.Create(CPUProfilePath)
+	if err != nil {
+		return err
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	cpuProfile = f
+	return nil
+}
+
+// exitProfiled ends the run: it stops the --cpuprofile, writes the
+// --memprofile, prints the --timings and exits with code.
+func exitProfiled(code int) {
+	if cpuProfile != nil {
+		pprof.StopCPUProfile()
+		if err := cpuProfile.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not write --cpuprofile %s: %v\n", CPUProfilePath, err)
+		}
+	}
+	if MemProfilePath != "" {
+		if err := writeMemProfile(MemProfilePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not write --memprofile %s: %v\n", MemProfilePath, err)
+		}
+	}
+	currentTimings.print()
+	os.Exit(code)
+}
+
+// writeMemProfile writes a heap profile of the allocations made so far.
+func writeMemProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	runtime.GC() // Up-to-date statistics
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
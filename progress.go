@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// ForceProgress and NoProgress override the automatic choice (--progress, --no-progress).
+var ForceProgress bool
+var NoProgress bool
+
+// ProgressAutoMinLines is the combined input size from which progress is shown
+// automatically when stderr is a terminal.
+const ProgressAutoMinLines = 5000
+const ProgressInterval = 100 * time.Millisecond
+
+// Overall percentage at which each PerformDiff stage starts; semantic matching runs to 100.
+const (
+	ProgressStartMegablocks   = 0
+	ProgressStartSegmentation = 40
+	ProgressStartSemantic     = 45
+)
+
+// progressReporter writes a single, periodically rewritten progress line to stderr.
+type progressReporter struct {
+	last  time.Time
+	shown bool
+}
+
+// currentProgress is set by runDiff when progress is enabled, nil otherwise.
+var currentProgress *progressReporter
+
+func progressEnabled(rawContentA, rawContentB string) bool {
+	switch {
+	case NoProgress:
+		return false
+	case ForceProgress:
+		return true
+	case QuietMode || TUIMode || !term.IsTerminal(int(os.Stderr.Fd())):
+		return false
+	}
+	return strings.Count(rawContentA, "\n")+strings.Count(rawContentB, "\n")+2 >= ProgressAutoMinLines
+}
+
+// update reports done of total units of the stage spanning the overall
+// percentages [from, to). Updates are throttled to ProgressInterval.
+func (p *progressReporter) update(stage string, from, to, done, total int) {
+	if p == nil || time.Since(p.last) < ProgressInterval {
+		return
+	}
+	percent := from
+	if total > 0 {
+		percent += (to - from) * min(done, total) / total
+	}
+	fmt.Fprintf(os.Stderr, "\r\x1b[KProgress: %3d%% (%s)", percent, stage)
+	p.last = time.Now()
+	p.shown = true
+}
+
+// finish erases the progress line so it does not mix with the report.
+func (p *progressReporter) finish() {
+	if p != nil && p.shown {
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Protocol Buffers wire format, just enough for the messages of
+// semanticdiff.proto.
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// protoMessage builds an encoded message. Zero scalars are left out, as proto3
+// does for fields without presence.
+type protoMessage []byte
+
+func (m *protoMessage) tag(field, wireType int) {
+	*m = binary.AppendUvarint(*m, uint64(field)<<3|uint64(wireType))
+}
+
+func (m *protoMessage) varint(field int, v uint64) {
+	if v != 0 {
+		m.tag(field, protoVarint)
+		*m = binary.AppendUvarint(*m, v)
+	}
+}
+
+func (m *protoMessage) int32(field int, v int) {
+	m.varint(field, uint64(int64(v))) // Negative values take ten bytes, as in proto
+}
+
+func (m *protoMessage) bool(field int, v bool) {
+	if v {
+		m.varint(field, 1)
+	}
+}
+
+func (m *protoMessage) float(field int, v float32) {
+	if v != 0 {
+		m.tag(field, protoFixed32)
+		*m = binary.LittleEndian.AppendUint32(*m, math.Float32bits(v))
+	}
+}
+
+func (m *protoMessage) bytes(field int, b []byte) {
+	m.tag(field, protoBytes)
+	*m = binary.AppendUvarint(*m, uint64(len(b)))
+	*m = append(*m, b...)
+}
+
+func (m *protoMessage) string(field int, s string) {
+	if s != "" {
+		m.bytes(field, []byte(s))
+	}
+}
+
+// protoField is a decoded field: its number and wire type, and its value,
+// Value for varint and fixed fields and Data for length-delimited ones.
+type protoField struct {
+	Number, WireType int
+	Value            uint64
+	Data             []byte
+}
+
+// parseProto splits an encoded message into its fields.
+func parseProto(data []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("malformed field key")
+		}
+		data = data[n:]
+		f := protoField{Number: int(key >> 3), WireType: int(key & 7)}
+		switch f.WireType {
+		case protoVarint:
+			if f.Value, n = binary.Uvarint(data); n <= 0 {
+				return nil, fmt.Errorf("field %d: malformed varint", f.Number)
+			}
+			data = data[n:]
+		case protoFixed64:
+			if len(data) < 8 {
+				return nil, fmt.Errorf("field %d: truncated", f.Number)
+			}
+			f.Value, data = binary.LittleEndian.Uint64(data), data[8:]
+		case protoFixed32:
+			if len(data) < 4 {
+				return nil, fmt.Errorf("field %d: truncated", f.Number)
+			}
+			f.Value, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		case protoBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return nil, fmt.Errorf("field %d: truncated", f.Number)
+			}
+			f.Data, data = data[n:n+int(size)], data[n+int(size):]
+		default:
+			return nil, fmt.Errorf("field %d: unsupported wire type %d", f.Number, f.WireType)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// protoWireError reports a field whose wire type does not match its declaration.
+func protoWireError(f protoField, want int) error {
+	if f.WireType != want {
+		return fmt.Errorf("field %d: wire type %d, want %d", f.Number, f.WireType, want)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProvenanceMode prints File B line by line with where each line came from
+// (--provenance), the File B view of --focus.
+var ProvenanceMode bool
+
+// lineOrigins describes the origin of every File B line: "A:<n>" for a line
+// copied unchanged, "moved from A:<n>", "changed from A#<id> (A:<lines>)" for
+// a line of a changed block, "new", or "" for a blank line between blocks.
+func lineOrigins(contentA, contentB string, diffs []DiffEntry) []string {
+	lineMap := buildLineMap(contentA, contentB, diffs)
+	origins := make([]string, len(lineMap.B))
+	for _, e := range diffs {
+		if e.BlockB == nil {
+			continue
+		}
+		for _, ref := range e.BlockB.SourceLineRefs {
+			n := ref.OriginalLineNum
+			if n < 1 || n > len(origins) {
+				continue
+			}
+			mapped := lineMap.B[n-1].Mapped
+			switch {
+			case e.BlockA == nil:
+				origins[n-1] = "new"
+			case e.Type == Modified || e.Type == MovedModified:
+				origins[n-1] = fmt.Sprintf("changed from A#%d (A:%d-%d)", e.BlockA.ID, e.BlockA.LineStart, e.BlockA.LineEnd)
+			case mapped == 0: // A blank line of an --ignore-blank-lines megablock
+				origins[n-1] = ""
+			case e.Type == Moved:
+				origins[n-1] = fmt.Sprintf("moved from A:%d", mapped)
+			default:
+				origins[n-1] = fmt.Sprintf("A:%d", mapped)
+			}
+		}
+	}
+	return origins
+}
+
+// printProvenance prints every line of File B after its line number and origin.
+// The origins come from the diffed contents, the text from rawContentB.
+func printProvenance(contentA, contentB, rawContentB string, diffs []DiffEntry) {
+	fmt.Println("\n--- Provenance of File B Lines ---")
+	origins := lineOrigins(contentA, contentB, diffs)
+	width := 0
+	for _, origin := range origins {
+		width = max(width, len(origin))
+	}
+	numberWidth := len(fmt.Sprint(len(origins)))
+	for k, line := range fileLines(rawContentB) {
+		origin := ""
+		if k < len(origins) {
+			origin = origins[k]
+		}
+		fmt.Println(strings.TrimRight(fmt.Sprintf("%*d  %-*s | %s", numberWidth, k+1, width, origin, line), " "))
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Reviewdog Diagnostic Format (--format rdjson), one DiagnosticResult object.
+type rdjsonResult struct {
+	Source      rdjsonSource       `json:"source"`
+	Severity    string             `json:"severity"`
+	Diagnostics []rdjsonDiagnostic `json:"diagnostics"`
+}
+
+type rdjsonSource struct {
+	Name string `json:"name"`
+}
+
+type rdjsonDiagnostic struct {
+	Message  string         `json:"message"`
+	Location rdjsonLocation `json:"location"`
+	Severity string         `json:"severity"`
+	Code     rdjsonCode     `json:"code"`
+}
+
+type rdjsonLocation struct {
+	Path  string      `json:"path"`
+	Range rdjsonRange `json:"range"`
+}
+
+type rdjsonRange struct {
+	Start rdjsonPosition `json:"start"`
+	End   rdjsonPosition `json:"end"`
+}
+
+type rdjsonPosition struct {
+	Line int `json:"line"`
+}
+
+type rdjsonCode struct {
+	Value string `json:"value"`
+}
+
+// noteWriter is where notes around the report go: stderr when the report is
+// JSON for another tool, else stdout.
+func noteWriter() io.Writer {
+	if OutputFormat == "rdjson" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// printRDJSON prints the block annotations as a Reviewdog diagnostic result on
+// File B, DELETED blocks as warnings and the other changes as info, with the
+// entry type as the diagnostic code.
+func printRDJSON(diffs []DiffEntry, fileBPath string) {
+	result := rdjsonResult{Source: rdjsonSource{Name: "go-semantic-diff"}, Severity: "INFO", Diagnostics: []rdjsonDiagnostic{}}
+	path := filepath.ToSlash(filepath.Clean(fileBPath))
+	for _, a := range blockAnnotations(diffs) {
+		severity := "INFO"
+		if a.Warning {
+			severity = "WARNING"
+		}
+		result.Diagnostics = append(result.Diagnostics, rdjsonDiagnostic{
+			Message:  a.Message,
+			Location: rdjsonLocation{Path: path, Range: rdjsonRange{Start: rdjsonPosition{a.Line}, End: rdjsonPosition{a.EndLine}}},
+			Severity: severity,
+			Code:     rdjsonCode{Value: a.Type.String()},
+		})
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding rdjson: %v\n", err)
+		return
+	}
+	fmt.Println(string(data))
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ShowReadability enables the readability delta section (--readability).
+var ShowReadability bool
+
+// ReadabilityGradeTolerance is the Flesch-Kincaid grade change below which a
+// revision counts as neither harder nor easier to read.
+const ReadabilityGradeTolerance = 0.5
+
+var (
+	readabilityWordRe   = regexp.MustCompile(`[\p{L}']+`)
+	readabilityVowelsRe = regexp.MustCompile(`[aeiouy]+`)
+)
+
+// ReadabilityScores are English readability measures of a text.
+type ReadabilityScores struct {
+	Sentences          int
+	Words              int
+	Syllables          int
+	AvgSentenceLength  float64 // Words per sentence
+	FleschReadingEase  float64 // Higher is easier (60-70 is plain English)
+	FleschKincaidGrade float64 // US school grade level
+}
+
+// countSyllables estimates syllables as vowel groups, minus a silent final "e".
+func countSyllables(word string) int {
+	word = strings.ToLower(strings.Trim(word, "'"))
+	n := len(readabilityVowelsRe.FindAllString(word, -1))
+	if n > 1 && strings.HasSuffix(word, "e") && !strings.HasSuffix(word, "le") {
+		n--
+	}
+	return max(n, 1)
+}
+
+func computeReadability(text string) ReadabilityScores {
+	var r ReadabilityScores
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		for _, sentence := range splitSentences(paragraph) {
+			words := readabilityWordRe.FindAllString(sentence, -1)
+			if len(words) == 0 {
+				continue
+			}
+			r.Sentences++
+			r.Words += len(words)
+			for _, w := range words {
+				r.Syllables += countSyllables(w)
+			}
+		}
+	}
+	if r.Sentences == 0 || r.Words == 0 {
+		return r
+	}
+	wordsPerSentence := float64(r.Words) / float64(r.Sentences)
+	syllablesPerWord := float64(r.Syllables) / float64(r.Words)
+	r.AvgSentenceLength = wordsPerSentence
+	r.FleschReadingEase = 206.835 - 1.015*wordsPerSentence - 84.6*syllablesPerWord
+	r.FleschKincaidGrade = 0.39*wordsPerSentence + 11.8*syllablesPerWord - 15.59
+	return r
+}
+
+// readabilityVerdict describes the change in grade level from a to b.
+func readabilityVerdict(a, b ReadabilityScores) string {
+	switch delta := b.FleschKincaidGrade - a.FleschKincaidGrade; {
+	case delta >= ReadabilityGradeTolerance:
+		return "harder to read"
+	case delta <= -ReadabilityGradeTolerance:
+		return "easier to read"
+	default:
+		return "about as readable"
+	}
+}
+
+func printReadabilityLine(prefix string, a, b ReadabilityScores) {
+	fmt.Printf("%sgrade %.1f -> %.1f (%+.1f), reading ease %.0f -> %.0f, %.1f -> %.1f words/sentence: %s\n",
+		prefix, a.FleschKincaidGrade, b.FleschKincaidGrade, b.FleschKincaidGrade-a.FleschKincaidGrade,
+		a.FleschReadingEase, b.FleschReadingEase, a.AvgSentenceLength, b.AvgSentenceLength, readabilityVerdict(a, b))
+}
+
+// printReadabilityDelta reports Flesch-Kincaid grade, Flesch reading ease and
+// sentence length for both documents and for every changed block pair.
+func printReadabilityDelta(diffs []DiffEntry, rawContentA, rawContentB string) {
+	fmt.Printf("\n# READABILITY\n")
+	docA, docB := computeReadability(rawContentA), computeReadability(rawContentB)
+	printReadabilityLine("  Document: ", docA, docB)
+	for _, e := range diffs {
+		if e.BlockA == nil || e.BlockB == nil || e.Similarity == 0 {
+			continue
+		}
+		a, b := computeReadability(e.BlockA.OriginalText), computeReadability(e.BlockB.OriginalText)
+		if a.Words == 0 || b.Words == 0 {
+			continue
+		}
+		printReadabilityLine(fmt.Sprintf("  [%s] A L%d-%d -> B L%d-%d: ", e.Type, e.BlockA.LineStart, e.BlockA.LineEnd, e.BlockB.LineStart, e.BlockB.LineEnd), a, b)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// RecoveryFilePath is where a diff that panics or is cancelled saves the entries
+// finished so far (--recovery-file); RecoverPath renders such a file (--recover).
+var RecoveryFilePath string
+var RecoverPath string
+
+// RecoveryBlock is a block of a recovery file.
+type RecoveryBlock struct {
+	ID        int    `json:"id"`
+	LineStart int    `json:"line_start"`
+	LineEnd   int    `json:"line_end"`
+	Text      string `json:"text"`
+}
+
+// RecoveryEntry is a diff entry of a recovery file.
+type RecoveryEntry struct {
+	Type       string         `json:"type"`
+	A          *RecoveryBlock `json:"a,omitempty"`
+	B          *RecoveryBlock `json:"b,omitempty"`
+	Similarity float32        `json:"similarity,omitempty"`
+	LineDiffs  []LineDiffOp   `json:"line_diffs,omitempty"`
+}
+
+// RecoveryFile is the partial result of a diff that did not finish.
+type RecoveryFile struct {
+	SchemaVersion int             `json:"schema_version"`
+	FileA         string          `json:"file_a"`
+	FileB         string          `json:"file_b"`
+	Time          time.Time       `json:"time"`
+	Stage         string          `json:"stage"`  // Engine stage running when the diff stopped
+	Reason        string          `json:"reason"` // Panic value or cancellation error
+	Entries       []RecoveryEntry `json:"entries"`
+}
+
+// recoveryCheckpoint tracks what the running engine has finished. Engines
+// publish a snapshot function at each stage; only the outermost engine call
+// publishes, so the per-section and per-window PerformDiff calls of hierarchical
+// and windowed diffs do not replace the whole-file state. Its methods do nothing
+// on a nil checkpoint.
+type recoveryCheckpoint struct {
+	mu           sync.Mutex
+	fileA, fileB string
+	depth        int
+	stage        string
+	snapshot     func() []DiffEntry
+}
+
+// currentRecovery is set by reportOnce and reportWindowed when --recovery-file is given.
+var currentRecovery *recoveryCheckpoint
+
+// begin marks an engine call; the returned function ends it.
+func (c *recoveryCheckpoint) begin() func() {
+	if c == nil {
+		return func() {}
+	}
+	c.mu.Lock()
+	c.depth++
+	c.mu.Unlock()
+	return func() {
+		c.mu.Lock()
+		c.depth--
+		c.mu.Unlock()
+	}
+}
+
+// publish records the running stage and how to list the entries finished so far.
+func (c *recoveryCheckpoint) publish(stage string, snapshot func() []DiffEntry) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.depth == 1 {
+		c.stage, c.snapshot = stage, snapshot
+	}
+}
+
+// save writes entries, or the published snapshot when entries is nil, to
+// RecoveryFilePath and tells the user how to render it.
+func (c *recoveryCheckpoint) save(entries []DiffEntry, reason string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	stage, snapshot := c.stage, c.snapshot
+	c.mu.Unlock()
+	if entries == nil && snapshot != nil {
+		entries = snapshot()
+	}
+	file := RecoveryFile{SchemaVersion: SchemaVersion, FileA: c.fileA, FileB: c.fileB, Time: time.Now(), Stage: stage, Reason: reason, Entries: recoveryEntries(entries)}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err == nil {
+		err = os.WriteFile(RecoveryFilePath, append(data, '\n'), 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing recovery file %s: %v\n", RecoveryFilePath, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Saved %d finished entries to %s; render them with --recover %s\n", len(file.Entries), RecoveryFilePath, RecoveryFilePath)
+}
+
+// recoveryEntries converts diff entries to their recovery file form.
+func recoveryEntries(entries []DiffEntry) []RecoveryEntry {
+	toBlock := func(cb *ContentBlock) *RecoveryBlock {
+		if cb == nil {
+			return nil
+		}
+		return &RecoveryBlock{ID: cb.ID, LineStart: cb.LineStart, LineEnd: cb.LineEnd, Text: cb.OriginalText}
+	}
+	var converted []RecoveryEntry
+	for _, e := range entries {
+		converted = append(converted, RecoveryEntry{Type: e.Type.String(), A: toBlock(e.BlockA), B: toBlock(e.BlockB), Similarity: e.Similarity, LineDiffs: e.LineDiffs})
+	}
+	return converted
+}
+
+// diffTypeByName maps DiffType.String() back to the type.
+func diffTypeByName(name string) (DiffType, bool) {
+	for _, t := range []DiffType{Added, Deleted, Modified, Moved, Unchanged, MovedModified} {
+		if t.String() == name {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+// recoverPanic is deferred by the engine drivers: on a panic it saves the
+// published snapshot, then panics again so the crash is still reported.
+func (c *recoveryCheckpoint) recoverPanic() {
+	if c == nil {
+		return
+	}
+	if r := recover(); r != nil {
+		c.save(nil, fmt.Sprintf("panic: %v", r))
+		panic(r)
+	}
+}
+
+// renderRecoveryFile prints the partial result saved in a recovery file in the
+// selected format. It returns ExitTrouble, as for any partial result.
+func renderRecoveryFile(path string, details map[DiffType]bool) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --recover: %v\n", err)
+		return ExitTrouble
+	}
+	var file RecoveryFile
+	if err = json.Unmarshal(data, &file); err == nil {
+		err = checkSchemaVersion(file.SchemaVersion)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --recover: %s: %v\n", path, err)
+		return ExitTrouble
+	}
+	toBlock := func(rb *RecoveryBlock, origin string) *ContentBlock {
+		if rb == nil {
+			return nil
+		}
+		return &ContentBlock{
+			ID:             rb.ID,
+			OriginalText:   rb.Text,
+			NormalizedText: NormalizeTextBlock(rb.Text),
+			Checksum:       CalculateBlockChecksum(NormalizeTextBlock(rb.Text)),
+			LineStart:      rb.LineStart,
+			LineEnd:        rb.LineEnd,
+			FileOrigin:     origin,
+		}
+	}
+	var diffs []DiffEntry
+	for _, re := range file.Entries {
+		t, ok := diffTypeByName(re.Type)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: --recover: %s: unknown entry type %q\n", path, re.Type)
+			return ExitTrouble
+		}
+		diffs = append(diffs, DiffEntry{Type: t, BlockA: toBlock(re.A, "A"), BlockB: toBlock(re.B, "B"), Similarity: re.Similarity, LineDiffs: re.LineDiffs})
+	}
+	sortDiffEntries(diffs)
+	fmt.Fprintf(noteWriter(), "Note: PARTIAL RESULT recovered from %s. The diff of %s and %s stopped during %s at %s (%s); content it had not finished is not reported.\n",
+		path, file.FileA, file.FileB, file.Stage, file.Time.Format(time.RFC3339), file.Reason)
+	switch OutputFormat {
+	case "markdown":
+		printMarkdownReport(diffs, file.FileA, file.FileB, details)
+	case "github":
+		printGitHubAnnotations(diffs, file.FileB)
+	case "rdjson":
+		printRDJSON(diffs, file.FileB)
+	case "side-by-side":
+		printSideBySideReport(diffs, details)
+	default:
+		printDiffReport(diffs, details, "", "")
+	}
+	return ExitTrouble
+}
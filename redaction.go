@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// RedactionMode compares a redacted document against its source (--redacted).
+// RedactionPattern matches one redaction marker (--redaction-pattern).
+var RedactionMode bool
+var RedactionPattern = `█+|(?i:\[REDACTED\])`
+
+// Redaction is a redacted line matched to its source line. Side is the file holding the markers.
+type Redaction struct {
+	Side        string
+	Line        int // Line with the markers
+	SourceLine  int // Line in the other file it was matched to
+	Markers     int
+	HiddenChars int
+	HiddenWords int
+}
+
+// redactionLineRegexp turns a line with markers into a pattern matching any line
+// that equals it outside the markers, capturing what each marker hides.
+func redactionLineRegexp(line string, marker *regexp.Regexp) (*regexp.Regexp, int) {
+	locs := marker.FindAllStringIndex(line, -1)
+	var expr strings.Builder
+	expr.WriteString(`^`)
+	prev := 0
+	for _, loc := range locs {
+		expr.WriteString(regexp.QuoteMeta(line[prev:loc[0]]))
+		expr.WriteString(`(.+?)`)
+		prev = loc[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(line[prev:]))
+	expr.WriteString(`$`)
+	return regexp.MustCompile(expr.String()), len(locs)
+}
+
+// unredactLines replaces every line of redacted that contains markers with the
+// source line it matches, treating each marker as a wildcard, so the diff sees
+// the lines as unchanged. Source lines are searched in order from just after the
+// previous match, and each is used once. Lines matching no source line are kept.
+func unredactLines(redacted, source []string, side string, marker *regexp.Regexp) ([]string, []Redaction) {
+	result := append([]string(nil), redacted...)
+	used := make([]bool, len(source))
+	var redactions []Redaction
+	next := 0
+	for i, line := range redacted {
+		line = strings.TrimRight(line, "\r")
+		if !marker.MatchString(line) || isMarkerOnly(line, marker) {
+			continue // Marker-only lines hide whole lines; see redactedBlocks
+		}
+		re, markers := redactionLineRegexp(line, marker)
+		for k := 0; k < len(source); k++ {
+			j := (next + k) % len(source)
+			if used[j] {
+				continue
+			}
+			m := re.FindStringSubmatch(strings.TrimRight(source[j], "\r"))
+			if m == nil {
+				continue
+			}
+			r := Redaction{Side: side, Line: i + 1, SourceLine: j + 1, Markers: markers}
+			for _, hidden := range m[1:] {
+				r.HiddenChars += utf8.RuneCountInString(hidden)
+				r.HiddenWords += len(strings.Fields(hidden))
+			}
+			redactions = append(redactions, r)
+			result[i] = source[j]
+			used[j] = true
+			next = j + 1
+			break
+		}
+	}
+	return result, redactions
+}
+
+// unredactInputs applies unredactLines in both directions, so either file may be
+// the redacted one, and returns the contents to diff.
+func unredactInputs(rawContentA, rawContentB string) (string, string, []Redaction, error) {
+	marker, err := regexp.Compile(RedactionPattern)
+	if err != nil {
+		return "", "", nil, err
+	}
+	linesA, linesB := strings.Split(rawContentA, "\n"), strings.Split(rawContentB, "\n")
+	linesB, redactionsB := unredactLines(linesB, linesA, "B", marker)
+	linesA, redactionsA := unredactLines(linesA, linesB, "A", marker)
+	return strings.Join(linesA, "\n"), strings.Join(linesB, "\n"), append(redactionsA, redactionsB...), nil
+}
+
+// isMarkerOnly reports whether text consists of redaction markers and whitespace.
+func isMarkerOnly(text string, marker *regexp.Regexp) bool {
+	return marker.MatchString(text) && strings.TrimSpace(marker.ReplaceAllString(text, "")) == ""
+}
+
+// redactedBlocks pairs NEW blocks made only of markers with the DELETED blocks
+// they replace (and vice versa when File A is the redacted one), in document order.
+func redactedBlocks(diffs []DiffEntry, marker *regexp.Regexp) [][2]*ContentBlock {
+	var added, deleted []*ContentBlock
+	for i := range diffs {
+		switch diffs[i].Type {
+		case Added:
+			added = append(added, diffs[i].BlockB)
+		case Deleted:
+			deleted = append(deleted, diffs[i].BlockA)
+		}
+	}
+	var pairs [][2]*ContentBlock // [marker block, hidden block]
+	pair := func(markerBlocks, hiddenBlocks []*ContentBlock) {
+		k := 0
+		for _, mb := range markerBlocks {
+			if !isMarkerOnly(mb.OriginalText, marker) {
+				continue
+			}
+			for k < len(hiddenBlocks) && isMarkerOnly(hiddenBlocks[k].OriginalText, marker) {
+				k++
+			}
+			if k == len(hiddenBlocks) {
+				return
+			}
+			pairs = append(pairs, [2]*ContentBlock{mb, hiddenBlocks[k]})
+			k++
+		}
+	}
+	pair(added, deleted)
+	pair(deleted, added)
+	return pairs
+}
+
+// printRedactions prints the REDACTIONS section: each redacted line with the
+// source line it hides part of, and each block that replaced whole lines.
+func printRedactions(redactions []Redaction, diffs []DiffEntry) {
+	heading, item := "\n# REDACTIONS\n", "  "
+	if OutputFormat == "markdown" {
+		heading, item = "\n## REDACTIONS\n\n", "- "
+	}
+	fmt.Print(heading)
+	marker := regexp.MustCompile(RedactionPattern) // Validated by unredactInputs
+	totalLines, totalChars := 0, 0
+	for _, r := range redactions {
+		other := "A"
+		if r.Side == "A" {
+			other = "B"
+		}
+		fmt.Printf("%s%s L%d (%s L%d): %d marker(s) hiding %d characters (%d words)\n", item, r.Side, r.Line, other, r.SourceLine, r.Markers, r.HiddenChars, r.HiddenWords)
+		totalLines++
+		totalChars += r.HiddenChars
+	}
+	for _, p := range redactedBlocks(diffs, marker) {
+		mb, hidden := p[0], p[1]
+		lines := hidden.LineEnd - hidden.LineStart + 1
+		chars := utf8.RuneCountInString(strings.TrimSpace(hidden.OriginalText))
+		fmt.Printf("%s%s L%d-%d (%s L%d-%d): redacted block hiding %d lines, %d characters (%d words)\n", item,
+			mb.FileOrigin, mb.LineStart, mb.LineEnd, hidden.FileOrigin, hidden.LineStart, hidden.LineEnd, lines, chars, len(strings.Fields(hidden.OriginalText)))
+		totalLines += lines
+		totalChars += chars
+	}
+	if totalLines == 0 {
+		fmt.Printf("%sNo redactions matched.\n", item)
+		return
+	}
+	fmt.Printf("%sTotal: %d lines redacted, %d characters hidden.\n", item, totalLines, totalChars)
+}
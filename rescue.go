@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// linkPossiblyRelated pairs DELETED and NEW entries whose blocks score at least
+// threshold, best pairs first and each entry at most once, so a heavy rewrite is
+// not reported as an unrelated delete and add. Linked entries keep their type;
+// Related points each one to the other's block. It returns the number of pairs.
+func linkPossiblyRelated(ctx context.Context, diffs []DiffEntry, scorer Similarity, threshold float64) int {
+	var deleted, added []int
+	for i, e := range diffs {
+		switch e.Type {
+		case Deleted:
+			deleted = append(deleted, i)
+		case Added:
+			added = append(added, i)
+		}
+	}
+	type candidate struct {
+		d, a  int
+		score float32
+	}
+	var candidates []candidate
+	for _, d := range deleted {
+		if ctx.Err() != nil {
+			break
+		}
+		for _, a := range added {
+			if score := scorer.Score(diffs[d].BlockA, diffs[a].BlockB); score >= float32(threshold) {
+				candidates = append(candidates, candidate{d, a, score})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(x, y int) bool { return candidates[x].score > candidates[y].score })
+	linked := 0
+	for _, c := range candidates {
+		if diffs[c.d].Related != nil || diffs[c.a].Related != nil {
+			continue
+		}
+		diffs[c.d].Related, diffs[c.d].RelatedSimilarity = diffs[c.a].BlockB, c.score
+		diffs[c.a].Related, diffs[c.a].RelatedSimilarity = diffs[c.d].BlockA, c.score
+		linked++
+	}
+	return linked
+}
+
+// unpairedSimilarity returns the metric for a rescue pass over merged section or
+// window results, with TF-IDF vectors built over the unpaired blocks. Backend
+// embeddings are not used, since blocks of unaligned sections and of windows
+// have none.
+func unpairedSimilarity(diffs []DiffEntry, opts Options) Similarity {
+	var blocksA, blocksB []ContentBlock
+	for _, e := range diffs {
+		switch e.Type {
+		case Deleted:
+			blocksA = append(blocksA, *e.BlockA)
+		case Added:
+			blocksB = append(blocksB, *e.BlockB)
+		}
+	}
+	return selectSimilarity(false, blocksA, blocksB, opts)
+}
+
+// printPossiblyRelated prints the POSSIBLY RELATED section: the DELETED and NEW
+// blocks linked by the --rescue-threshold pass, in File A order.
+func printPossiblyRelated(diffs []DiffEntry, threshold float64) {
+	heading, item := "\n# POSSIBLY RELATED\n", "  "
+	if OutputFormat == "markdown" {
+		heading, item = "\n## POSSIBLY RELATED\n\n", "- "
+	}
+	fmt.Print(heading)
+	found := false
+	for _, e := range diffs {
+		if e.Type != Deleted || e.Related == nil {
+			continue
+		}
+		found = true
+		fmt.Printf("%sDELETED A %s ~ NEW B %s (similarity %.2f)\n", item, blockRange(e.BlockA), blockRange(e.Related), e.RelatedSimilarity)
+	}
+	if !found {
+		fmt.Printf("%sNo DELETED and NEW blocks reach the rescue threshold %.2f.\n", item, threshold)
+	}
+}
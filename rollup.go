@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ShowRollup prints a per-section summary of the paragraph entries, with each
+// changed paragraph's sentence changes underneath when its type is in --details
+// (--rollup, which implies --hierarchical).
+var ShowRollup bool
+
+// sectionBlocks returns a section-level block for each section of a file, linked
+// to the block of its parent section. A section block's ID is its index.
+func sectionBlocks(sections []Section, origin string, opts Options) []*ContentBlock {
+	blocks := make([]*ContentBlock, len(sections))
+	for k, sec := range sections {
+		cb := newParagraphBlock(k, sec.text(), origin, sec.Lines, opts)
+		cb.Level, cb.Title = SectionLevel, sec.Title
+		if sec.Parent >= 0 {
+			cb.Parent = blocks[sec.Parent]
+		}
+		blocks[k] = &cb
+	}
+	return blocks
+}
+
+// sentenceBlocks splits a block into sentence-level children.
+func sentenceBlocks(cb *ContentBlock, opts Options) []*ContentBlock {
+	var sentences []*ContentBlock
+	first, pos := firstTextLine(cb), 0
+	for k, sentence := range splitSentences(cb.OriginalText) {
+		idx := strings.Index(cb.OriginalText[pos:], sentence)
+		if idx < 0 {
+			idx = 0 // Sentences are trimmed substrings, so this does not happen
+		}
+		start := pos + idx
+		pos = start + len(sentence)
+		normalized := opts.normalize(sentence)
+		sentences = append(sentences, &ContentBlock{
+			ID:             k,
+			OriginalText:   sentence,
+			NormalizedText: normalized,
+			Checksum:       CalculateBlockChecksum(normalized),
+			LineStart:      first + strings.Count(cb.OriginalText[:start], "\n"),
+			LineEnd:        first + strings.Count(cb.OriginalText[:pos], "\n"),
+			FileOrigin:     cb.FileOrigin,
+			Level:          SentenceLevel,
+			Parent:         cb,
+		})
+	}
+	return sentences
+}
+
+// SectionRollup summarizes the paragraph entries of a section. A is nil for a
+// section only in File B, B for one only in File A.
+type SectionRollup struct {
+	A, B           *ContentBlock
+	HeadingChanged bool
+	Counts         map[DiffType]int
+	Entries        []DiffEntry
+}
+
+// rollUpSections groups entries by section. A File A section rolls up with the
+// File B section most of its paired paragraphs went to; NEW paragraphs join the
+// rollup of their File B section.
+func rollUpSections(diffs []DiffEntry) []*SectionRollup {
+	votes := make(map[*ContentBlock]map[*ContentBlock]int)
+	for _, e := range diffs {
+		if e.BlockA != nil && e.BlockB != nil && e.BlockA.Parent != nil && e.BlockB.Parent != nil {
+			if votes[e.BlockA.Parent] == nil {
+				votes[e.BlockA.Parent] = make(map[*ContentBlock]int)
+			}
+			votes[e.BlockA.Parent][e.BlockB.Parent]++
+		}
+	}
+	rollups := make(map[*ContentBlock]*SectionRollup) // By File A section, or File B section for new ones
+	partnerOfB := make(map[*ContentBlock]*ContentBlock)
+	for secA, counts := range votes {
+		var best *ContentBlock
+		for secB, n := range counts {
+			if best == nil || n > counts[best] || n == counts[best] && secB.LineStart < best.LineStart {
+				best = secB
+			}
+		}
+		if other, taken := partnerOfB[best]; !taken || counts[best] > votes[other][best] || counts[best] == votes[other][best] && secA.LineStart < other.LineStart {
+			partnerOfB[best] = secA
+		}
+	}
+	rollupOf := func(secA, secB *ContentBlock) *SectionRollup {
+		key := secA
+		if key == nil {
+			if key = partnerOfB[secB]; key == nil {
+				key = secB
+			}
+		}
+		r := rollups[key]
+		if r == nil {
+			r = &SectionRollup{Counts: make(map[DiffType]int)}
+			if key.FileOrigin == "A" {
+				r.A = key
+			} else {
+				r.B = key
+			}
+			rollups[key] = r
+		}
+		return r
+	}
+	for secB, secA := range partnerOfB {
+		rollupOf(secA, nil).B = secB
+	}
+	for _, e := range diffs {
+		var secA, secB *ContentBlock
+		if e.BlockA != nil {
+			secA = e.BlockA.Parent
+		}
+		if e.BlockB != nil {
+			secB = e.BlockB.Parent
+		}
+		if secA == nil && secB == nil {
+			continue
+		}
+		r := rollupOf(secA, secB)
+		if r.A != nil && r.B != nil && r.A.Title != "" && e.BlockA != nil && e.BlockB != nil && e.BlockA.LineStart == r.A.LineStart && e.BlockB.LineStart == r.B.LineStart {
+			r.HeadingChanged = e.Similarity > 0 // The heading line itself
+			continue
+		}
+		r.Counts[e.Type]++
+		r.Entries = append(r.Entries, e)
+	}
+
+	var sorted []*SectionRollup
+	for _, r := range rollups {
+		sorted = append(sorted, r)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		ri, rj := sorted[i], sorted[j]
+		if (ri.A != nil) != (rj.A != nil) {
+			return ri.A != nil // Sections only in File B last
+		}
+		if ri.A != nil {
+			return ri.A.LineStart < rj.A.LineStart
+		}
+		return ri.B.LineStart < rj.B.LineStart
+	})
+	return sorted
+}
+
+// rollupSummary describes a section's paragraph changes, e.g. "2 paragraphs changed, 1 moved".
+func rollupSummary(r *SectionRollup) string {
+	var parts []string
+	counted := false
+	if r.HeadingChanged {
+		parts = append(parts, "heading changed")
+	}
+	for _, kind := range []struct {
+		t    DiffType
+		verb string
+	}{{Modified, "changed"}, {Moved, "moved"}, {MovedModified, "moved and changed"}, {Added, "new"}, {Deleted, "deleted"}} {
+		n := r.Counts[kind.t]
+		if n == 0 {
+			continue
+		}
+		noun := "" // Only the first count names the unit
+		if !counted {
+			noun, counted = " paragraphs", true
+			if n == 1 {
+				noun = " paragraph"
+			}
+		}
+		parts = append(parts, fmt.Sprintf("%d%s %s", n, noun, kind.verb))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sentenceChanges counts the sentences only in File A and only in File B of a pair.
+func sentenceChanges(e DiffEntry, opts Options) (removed, added int) {
+	inA := make(map[string]int)
+	for _, s := range sentenceBlocks(e.BlockA, opts) {
+		inA[s.NormalizedText]++
+	}
+	for _, s := range sentenceBlocks(e.BlockB, opts) {
+		if inA[s.NormalizedText] > 0 {
+			inA[s.NormalizedText]--
+		} else {
+			added++
+		}
+	}
+	for _, n := range inA {
+		removed += n
+	}
+	return removed, added
+}
+
+// printSectionRollup prints the SECTION ROLLUP section. Sections are drilled down
+// into their entries of the types listed in opts.DetailsSections, and changed
+// pairs into sentence counts.
+func printSectionRollup(rollups []*SectionRollup, opts Options) {
+	heading, item, sub := "\n# SECTION ROLLUP\n", "  ", "      "
+	if OutputFormat == "markdown" {
+		heading, item, sub = "\n## SECTION ROLLUP\n\n", "- ", "  - "
+	}
+	fmt.Print(heading)
+	if len(rollups) == 0 {
+		fmt.Printf("%sNo sections found.\n", item)
+		return
+	}
+	name := func(r *SectionRollup) string {
+		sec := r.A
+		if sec == nil {
+			sec = r.B
+		}
+		if sec.Title == "" {
+			return "(preamble)"
+		}
+		return fmt.Sprintf("%q", sec.Title)
+	}
+	for _, r := range rollups {
+		switch {
+		case r.A == nil:
+			fmt.Printf("%sSection %s (B %s) new: %s\n", item, name(r), blockRange(r.B), rollupSummary(r))
+		case r.B == nil:
+			fmt.Printf("%sSection %s (A %s) deleted: %s\n", item, name(r), blockRange(r.A), rollupSummary(r))
+		default:
+			summary := rollupSummary(r)
+			if summary == "" {
+				fmt.Printf("%sSection %s (A %s -> B %s) unchanged\n", item, name(r), blockRange(r.A), blockRange(r.B))
+				continue
+			}
+			fmt.Printf("%sSection %s (A %s -> B %s) modified: %s\n", item, name(r), blockRange(r.A), blockRange(r.B), summary)
+		}
+		for _, e := range r.Entries {
+			if e.Type == Unchanged || !opts.DetailsSections[e.Type] {
+				continue
+			}
+			line := fmt.Sprintf("%s[%s] A %s -> B %s", sub, e.Type, blockRange(e.BlockA), blockRange(e.BlockB))
+			if e.BlockA != nil && e.BlockB != nil && e.Similarity > 0 {
+				removed, added := sentenceChanges(e, opts)
+				line += fmt.Sprintf(": sentences %d removed, %d added", removed, added)
+			}
+			fmt.Println(line)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// printRandomSample prints up to n randomly chosen entries in full detail so
+// reviewers can spot-check classification quality on very large diffs.
+func printRandomSample(diffs []DiffEntry, n int, seed int64) {
+	if len(diffs) == 0 {
+		return
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	if n > len(diffs) {
+		n = len(diffs)
+	}
+	rng := rand.New(rand.NewSource(seed))
+	picked := rng.Perm(len(diffs))[:n]
+	sort.Ints(picked) // Keep the report order stable within the sample
+
+	fmt.Printf("\n# RANDOM SAMPLE (%d of %d entries, seed %d)\n", n, len(diffs), seed)
+	for _, idx := range picked {
+		printEntryDetail(diffs[idx])
+	}
+}
+
+// printEntryDetail prints a single entry with its full, untruncated content.
+func printEntryDetail(e DiffEntry) {
+	header := fmt.Sprintf("  [%s]", e.Type)
+	if e.BlockA != nil {
+		header += fmt.Sprintf(" A_ID:%d (L%d-%d)", e.BlockA.ID, e.BlockA.LineStart, e.BlockA.LineEnd)
+	}
+	if e.BlockA != nil && e.BlockB != nil {
+		header += " ->"
+	}
+	if e.BlockB != nil {
+		header += fmt.Sprintf(" B_ID:%d (L%d-%d)", e.BlockB.ID, e.BlockB.LineStart, e.BlockB.LineEnd)
+	}
+	if e.Similarity > 0 {
+		header += fmt.Sprintf(" [Sim: %.2f]", e.Similarity)
+	}
+	fmt.Println(header)
+
+	if len(e.LineDiffs) > 0 {
+		fmt.Println("    Line-level changes:")
+		printLineDiffOps(e.LineDiffs, "      ", e.BlockA, e.BlockB)
+		return
+	}
+	if e.BlockA != nil {
+		printIndentedText("    A | ", e.BlockA.OriginalText)
+	}
+	if e.BlockB != nil && (e.BlockA == nil || e.BlockA.OriginalText != e.BlockB.OriginalText) {
+		printIndentedText("    B | ", e.BlockB.OriginalText)
+	}
+}
+
+func printIndentedText(prefix, text string) {
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Printf("%s%s\n", prefix, bidiIsolate(line))
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import "fmt"
+
+// SchemaVersion is the version of the JSON written for other programs: the
+// --stats-json summary, --dump-matrix and --line-map JSON, recovery and session
+// files, POST /diff, --daemon and WebAssembly responses, and MarshalResult. Each carries it
+// as "schema_version".
+//
+// Within a version, fields are only ever added; consumers must ignore fields
+// they do not know. Renaming or removing a field, or changing its type or
+// meaning, increments SchemaVersion, and the readers of this program keep
+// accepting files of every earlier version (see checkSchemaVersion and
+// LineDiffOp.UnmarshalJSON).
+//
+// Version 1 is the output before schema_version existed: a document without
+// the field is version 1. Its line diffs were {"Operation": -1|0|1, "Text"}.
+// Version 2 names line-diff operations {"op": "delete"|"equal"|"insert",
+// "text"}.
+const SchemaVersion = 2
+
+// checkSchemaVersion checks that a document of the given schema version can be
+// read; 0 means the document has no schema_version and is version 1.
+func checkSchemaVersion(version int) error {
+	if version > SchemaVersion {
+		return fmt.Errorf("schema version %d is newer than this release supports (%d); upgrade go-semantic-diff", version, SchemaVersion)
+	}
+	if version < 0 {
+		return fmt.Errorf("invalid schema version %d", version)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ExportSegmentsPath is the file the changed segments are exported to
+// (--export-segments); SegmentsSourceLang is their language (--segments-lang).
+var ExportSegmentsPath string
+var SegmentsSourceLang = "en"
+
+// Segment is a File B block that needs (re)translation: a changed block with the
+// File A text it replaces, or a new block.
+type Segment struct {
+	ID             string // Stable permalink anchor of the entry, as in --format markdown
+	Type           string // "changed" or "new"
+	LinesA, LinesB string
+	Similarity     float32
+	PreviousSource string // File A text of a changed block
+	Source         string // File B text
+}
+
+// changedSegments returns the changed and new File B blocks in File B order.
+// Moved blocks are included when their text changed.
+func changedSegments(diffs []DiffEntry) []Segment {
+	anchors := entryAnchors(diffs)
+	var entries []DiffEntry
+	for _, e := range diffs {
+		if e.Type == Added || e.BlockA != nil && e.BlockB != nil && e.Similarity > 0 {
+			entries = append(entries, e)
+		}
+	}
+	sort.SliceStable(entries, func(x, y int) bool { return entries[x].BlockB.LineStart < entries[y].BlockB.LineStart })
+	segments := make([]Segment, len(entries))
+	for k, e := range entries {
+		segments[k] = Segment{ID: anchors[entryID(e)], Type: "new", LinesB: blockRange(e.BlockB), Source: e.BlockB.OriginalText}
+		if e.BlockA != nil {
+			segments[k].Type, segments[k].LinesA = "changed", blockRange(e.BlockA)
+			segments[k].Similarity, segments[k].PreviousSource = e.Similarity, e.BlockA.OriginalText
+		}
+	}
+	return segments
+}
+
+// XLIFF 1.2 document with one trans-unit per segment.
+type xliffDocument struct {
+	XMLName xml.Name  `xml:"urn:oasis:names:tc:xliff:document:1.2 xliff"`
+	Version string    `xml:"version,attr"`
+	File    xliffFile `xml:"file"`
+}
+
+type xliffFile struct {
+	Original       string      `xml:"original,attr"`
+	SourceLanguage string      `xml:"source-language,attr"`
+	Datatype       string      `xml:"datatype,attr"`
+	Units          []xliffUnit `xml:"body>trans-unit"`
+}
+
+type xliffUnit struct {
+	ID      string   `xml:"id,attr"`
+	Resname string   `xml:"resname,attr"`
+	Source  string   `xml:"source"`
+	Notes   []string `xml:"note"`
+}
+
+// writeSegmentsFile writes the changed segments of File B as XLIFF 1.2 when path
+// ends in .xlf or .xliff, otherwise as a CSV with an empty target column for
+// translation-memory tools.
+func writeSegmentsFile(diffs []DiffEntry, fileBPath, path string) error {
+	segments := changedSegments(diffs)
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".xlf", ".xliff":
+		doc := xliffDocument{Version: "1.2", File: xliffFile{Original: fileBPath, SourceLanguage: SegmentsSourceLang, Datatype: "plaintext"}}
+		for _, s := range segments {
+			unit := xliffUnit{ID: s.ID, Resname: "B " + s.LinesB, Source: s.Source}
+			if s.Type == "new" {
+				unit.Notes = []string{"New in this revision."}
+			} else {
+				unit.Notes = []string{fmt.Sprintf("Changed from A %s (similarity %.2f). Previous source: %s", s.LinesA, s.Similarity, s.PreviousSource)}
+			}
+			doc.File.Units = append(doc.File.Units, unit)
+		}
+		if _, err := f.WriteString(xml.Header); err != nil {
+			return err
+		}
+		enc := xml.NewEncoder(f)
+		enc.Indent("", "  ")
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+		_, err = f.WriteString("\n")
+		return err
+	}
+
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"id", "type", "lines_a", "lines_b", "similarity", "previous_source", "source", "target"}); err != nil {
+		return err
+	}
+	for _, s := range segments {
+		similarity := ""
+		if s.Type == "changed" {
+			similarity = fmt.Sprintf("%.4f", s.Similarity)
+		}
+		if err := w.Write([]string{s.ID, s.Type, s.LinesA, s.LinesB, similarity, s.PreviousSource, s.Source, ""}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
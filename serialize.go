@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Result is a diff result as MarshalResult writes it. DiffEntry, ContentBlock
+// and LineDiffOp also encode with encoding/gob as they are.
+type Result struct {
+	SchemaVersion int         `json:"schema_version"`
+	Entries       []DiffEntry `json:"entries"`
+}
+
+// MarshalResult encodes diff entries as JSON.
+func MarshalResult(diffs []DiffEntry) ([]byte, error) {
+	if diffs == nil {
+		diffs = []DiffEntry{}
+	}
+	return json.Marshal(Result{SchemaVersion: SchemaVersion, Entries: diffs})
+}
+
+// UnmarshalResult decodes diff entries encoded by MarshalResult.
+func UnmarshalResult(data []byte) ([]DiffEntry, error) {
+	var result Result
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	if err := checkSchemaVersion(result.SchemaVersion); err != nil {
+		return nil, err
+	}
+	return result.Entries, nil
+}
+
+// MarshalText encodes a DiffType by its report name (NEW, DELETED, ...).
+func (dt DiffType) MarshalText() ([]byte, error) {
+	if _, ok := diffTypeByName(dt.String()); !ok {
+		return nil, fmt.Errorf("invalid diff type %d", int(dt))
+	}
+	return []byte(dt.String()), nil
+}
+
+func (dt *DiffType) UnmarshalText(text []byte) error {
+	t, ok := diffTypeByName(string(text))
+	if !ok {
+		return fmt.Errorf("unknown diff type %q", text)
+	}
+	*dt = t
+	return nil
+}
+
+var blockLevelNames = []string{ParagraphLevel: "paragraph", SectionLevel: "section", SentenceLevel: "sentence"}
+
+// MarshalText encodes a BlockLevel as paragraph, section or sentence.
+func (l BlockLevel) MarshalText() ([]byte, error) {
+	if l < 0 || int(l) >= len(blockLevelNames) {
+		return nil, fmt.Errorf("invalid block level %d", int(l))
+	}
+	return []byte(blockLevelNames[l]), nil
+}
+
+func (l *BlockLevel) UnmarshalText(text []byte) error {
+	for level, name := range blockLevelNames {
+		if name == string(text) {
+			*l = BlockLevel(level)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown block level %q", text)
+}
+
+var lineDiffOperationNames = map[diffmatchpatch.Operation]string{
+	diffmatchpatch.DiffEqual:  "equal",
+	diffmatchpatch.DiffInsert: "insert",
+	diffmatchpatch.DiffDelete: "delete",
+}
+
+func (op LineDiffOp) MarshalJSON() ([]byte, error) {
+	name, ok := lineDiffOperationNames[op.Operation]
+	if !ok {
+		return nil, fmt.Errorf("invalid line diff operation %d", op.Operation)
+	}
+	return json.Marshal(struct {
+		Op   string `json:"op"`
+		Text string `json:"text"`
+	}{name, op.Text})
+}
+
+// UnmarshalJSON also reads the numeric "Operation" of files written before
+// the operation was named.
+func (op *LineDiffOp) UnmarshalJSON(data []byte) error {
+	var fields struct {
+		Op        string                    `json:"op"`
+		Operation *diffmatchpatch.Operation `json:"Operation"`
+		Text      string                    `json:"text"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	op.Text = fields.Text
+	if fields.Operation != nil && fields.Op == "" {
+		op.Operation = *fields.Operation
+		return nil
+	}
+	for operation, name := range lineDiffOperationNames {
+		if name == fields.Op {
+			op.Operation = operation
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown line diff operation %q", fields.Op)
+}
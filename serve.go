@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// DiffRequest is the body of a POST /diff request: the two documents and the
+// options to diff them with. Options left out keep their command-line defaults.
+type DiffRequest struct {
+	A       string             `json:"a"`
+	B       string             `json:"b"`
+	Options DiffRequestOptions `json:"options"`
+}
+
+// DiffRequestOptions are the per-request engine options of POST /diff.
+type DiffRequestOptions struct {
+	Threshold         *float64 `json:"threshold,omitempty"`
+	MinAnchorLines    *int     `json:"min_anchor_lines,omitempty"`
+	MinParagraphLines *int     `json:"min_paragraph_lines,omitempty"`
+	MaxBlockLines     *int     `json:"max_block_lines,omitempty"`
+	IgnoreBlankLines  bool     `json:"ignore_blank_lines,omitempty"`
+	PairAdjacent      bool     `json:"pair_adjacent,omitempty"`
+	RescueThreshold   float64  `json:"rescue_threshold,omitempty"`
+	Hierarchical      bool     `json:"hierarchical,omitempty"`
+}
+
+// DiffResponse is the result of POST /diff. Entries use the recovery file
+// entry format. Page is set when the request asked for a page of entries.
+type DiffResponse struct {
+	SchemaVersion int               `json:"schema_version"`
+	Identical     bool              `json:"identical"`
+	Note          string            `json:"note,omitempty"`
+	Entries       []RecoveryEntry   `json:"entries"`
+	Page          *DiffResponsePage `json:"page,omitempty"`
+}
+
+// DiffResponsePage places a page of entries in the full result; Next is the
+// after cursor of the following page, empty on the last page.
+type DiffResponsePage struct {
+	Offset int    `json:"offset"`
+	Total  int    `json:"total"`
+	Next   string `json:"next,omitempty"`
+}
+
+// options validates the request options and applies them to the defaults.
+func (o DiffRequestOptions) options() (Options, error) {
+	return o.applyTo(DefaultOptions())
+}
+
+// applyTo validates the request options and applies them to opts; the boolean
+// options can only turn settings on.
+func (o DiffRequestOptions) applyTo(opts Options) (Options, error) {
+	if o.Threshold != nil {
+		if *o.Threshold < 0 || *o.Threshold > 1 {
+			return opts, fmt.Errorf("threshold must be between 0.0 and 1.0")
+		}
+		opts.SimilarityThreshold = *o.Threshold
+		opts.LevelThresholds.Section, opts.LevelThresholds.Paragraph = *o.Threshold, *o.Threshold
+	}
+	if o.MinAnchorLines != nil {
+		if *o.MinAnchorLines < 1 {
+			return opts, fmt.Errorf("min_anchor_lines must be at least 1")
+		}
+		opts.MinAnchorLines = *o.MinAnchorLines
+	}
+	if o.MinParagraphLines != nil {
+		if *o.MinParagraphLines < 1 {
+			return opts, fmt.Errorf("min_paragraph_lines must be at least 1")
+		}
+		opts.MinParagraphLines = *o.MinParagraphLines
+	}
+	if o.MaxBlockLines != nil {
+		if *o.MaxBlockLines < 0 {
+			return opts, fmt.Errorf("max_block_lines must be 0 (disabled) or a positive number of lines")
+		}
+		opts.MaxBlockLines = *o.MaxBlockLines
+	}
+	if o.RescueThreshold < 0 || o.RescueThreshold > 1 {
+		return opts, fmt.Errorf("rescue_threshold must be between 0.0 and 1.0")
+	}
+	if o.RescueThreshold > 0 {
+		opts.RescueThreshold = o.RescueThreshold
+	}
+	opts.IgnoreBlankLines = opts.IgnoreBlankLines || o.IgnoreBlankLines
+	opts.PairAdjacent = opts.PairAdjacent || o.PairAdjacent
+	return opts, nil
+}
+
+// runServe runs the serve subcommand: an HTTP server whose POST /diff endpoint
+// diffs two documents and returns the entries as JSON, or with --grpc a gRPC
+// server of semanticdiff.proto.
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	listen := fs.String("listen", "localhost:8080", "Address to listen on")
+	maxBodyStr := fs.String("max-body-size", "10MB", "Largest accepted request body (e.g. 512KB, 10MB)")
+	useGRPC := fs.Bool("grpc", false, "Serve the gRPC SemanticDiff service (cleartext HTTP/2) instead of the REST API")
+	timeout := fs.Duration("timeout", time.Minute, "Cancel a diff that runs longer than this (0 = no limit)")
+	if err := fs.Parse(args); err != nil {
+		return ExitTrouble
+	}
+	maxBody, err := parseByteSize(*maxBodyStr)
+	if err != nil || maxBody <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: --max-body-size: invalid size %q\n", *maxBodyStr)
+		return ExitTrouble
+	}
+	if *timeout < 0 {
+		fmt.Fprintln(os.Stderr, "Error: --timeout must be 0 (no limit) or a positive duration")
+		return ExitTrouble
+	}
+	server := &http.Server{Addr: *listen, ReadHeaderTimeout: 10 * time.Second}
+	if *useGRPC {
+		server.Handler = grpcHandler(maxBody, *timeout)
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetUnencryptedHTTP2(true)
+		fmt.Fprintf(os.Stderr, "Serving gRPC %s on %s\n", grpcServiceName, *listen)
+	} else {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/diff", diffHandler(maxBody, *timeout))
+		server.Handler = mux
+		fmt.Fprintf(os.Stderr, "Serving POST /diff on http://%s\n", *listen)
+	}
+	if err := server.ListenAndServe(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return ExitTrouble
+	}
+	return ExitIdentical
+}
+
+// diffHandler serves POST /diff. With ?limit=N it returns N entries,
+// following the entry whose ID is ?after=id if given. Errors are returned as
+// {"error": "..."}.
+func diffHandler(maxBody int64, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSONError(w, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+		var req DiffRequest
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", maxBody))
+				return
+			}
+			writeJSONError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+			return
+		}
+		opts, err := req.Options.options()
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		after, limit := r.URL.Query().Get("after"), 0
+		if s := r.URL.Query().Get("limit"); s != "" {
+			if limit, err = strconv.Atoi(s); err != nil || limit < 1 {
+				writeJSONError(w, http.StatusBadRequest, "limit must be a positive number of entries")
+				return
+			}
+		}
+		if after != "" && limit == 0 {
+			writeJSONError(w, http.StatusBadRequest, "after needs a limit")
+			return
+		}
+
+		diffs, note, err := runDiffRequest(r.Context(), req, opts, timeout)
+		if err != nil {
+			writeJSONError(w, http.StatusServiceUnavailable, fmt.Sprintf("diff did not finish: %v", err))
+			return
+		}
+		if limit == 0 {
+			writeJSON(w, http.StatusOK, newDiffResponse(diffs, note))
+			return
+		}
+		resp, err := newDiffResponsePage(diffs, note, after, limit)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid after: "+err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// runDiffRequest diffs the documents of a request, cancelling the diff after
+// timeout when it is positive. Identical documents give no entries.
+func runDiffRequest(ctx context.Context, req DiffRequest, opts Options, timeout time.Duration) ([]DiffEntry, string, error) {
+	if identicalInputs(req.A, req.B) {
+		return nil, "", nil
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var diffs []DiffEntry
+	var note string
+	var err error
+	if req.Options.Hierarchical {
+		diffs, err = PerformHierarchicalDiff(ctx, req.A, req.B, opts)
+	} else {
+		diffs, note, err = PerformDiffWithEscalation(ctx, req.A, req.B, opts)
+	}
+	if pluginErr := similarityPluginErr(); pluginErr != nil {
+		return nil, "", fmt.Errorf("--similarity-cmd: %v", pluginErr)
+	}
+	return diffs, note, err
+}
+
+// newDiffResponse builds the serializable result of a diff.
+func newDiffResponse(diffs []DiffEntry, note string) DiffResponse {
+	resp := DiffResponse{SchemaVersion: SchemaVersion, Identical: diffExitCode(diffs) == ExitIdentical, Note: note, Entries: []RecoveryEntry{}}
+	if entries := recoveryEntries(diffs); entries != nil {
+		resp.Entries = entries
+	}
+	return resp
+}
+
+// newDiffResponsePage builds the response of one page of a diff result;
+// Identical still describes the whole result.
+func newDiffResponsePage(diffs []DiffEntry, note, after string, limit int) (DiffResponse, error) {
+	page, err := pageDiffEntries(diffs, after, limit)
+	if err != nil {
+		return DiffResponse{}, err
+	}
+	resp := newDiffResponse(page.Entries, note)
+	resp.Identical = diffExitCode(diffs) == ExitIdentical
+	resp.Page = &DiffResponsePage{Offset: page.Offset, Total: page.Total, Next: page.Next}
+	return resp, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v) // The client may be gone; nothing to do then
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
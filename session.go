@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SaveSessionPath is where the full result of a diff is saved for the query
+// subcommand (--save-session).
+var SaveSessionPath string
+
+// SessionFile is a finished diff: both inputs and every entry, so views of the
+// result can be printed without diffing again.
+type SessionFile struct {
+	SchemaVersion int            `json:"schema_version"`
+	FileA         string         `json:"file_a"`
+	FileB         string         `json:"file_b"`
+	Time          time.Time      `json:"time"`
+	Note          string         `json:"note,omitempty"`    // Escalation or partial result note
+	Partial       bool           `json:"partial,omitempty"` // The diff was cancelled at --timeout
+	ContentA      string         `json:"content_a"`
+	ContentB      string         `json:"content_b"`
+	Entries       []SessionEntry `json:"entries"`
+}
+
+// SessionBlock is a block of a session file; Lines maps its lines to their
+// line numbers in the input.
+type SessionBlock struct {
+	RecoveryBlock
+	Lines []int `json:"lines"`
+}
+
+// SessionEntry is a diff entry of a session file.
+type SessionEntry struct {
+	Type               string        `json:"type"`
+	A                  *SessionBlock `json:"a,omitempty"`
+	B                  *SessionBlock `json:"b,omitempty"`
+	Similarity         float32       `json:"similarity,omitempty"`
+	RunnerUpSimilarity float32       `json:"runner_up_similarity,omitempty"`
+	LineDiffs          []LineDiffOp  `json:"line_diffs,omitempty"`
+}
+
+// saveSession writes the result of a diff to SaveSessionPath.
+func saveSession(fileA, fileB, contentA, contentB string, diffs []DiffEntry, note string, partial bool) error {
+	toBlock := func(cb *ContentBlock) *SessionBlock {
+		if cb == nil {
+			return nil
+		}
+		sb := &SessionBlock{RecoveryBlock: RecoveryBlock{ID: cb.ID, LineStart: cb.LineStart, LineEnd: cb.LineEnd, Text: cb.OriginalText}}
+		for _, line := range cb.SourceLineRefs {
+			sb.Lines = append(sb.Lines, line.OriginalLineNum)
+		}
+		return sb
+	}
+	session := SessionFile{SchemaVersion: SchemaVersion, FileA: fileA, FileB: fileB, Time: time.Now(), Note: note, Partial: partial, ContentA: contentA, ContentB: contentB, Entries: []SessionEntry{}}
+	for _, e := range diffs {
+		session.Entries = append(session.Entries, SessionEntry{
+			Type:               e.Type.String(),
+			A:                  toBlock(e.BlockA),
+			B:                  toBlock(e.BlockB),
+			Similarity:         e.Similarity,
+			RunnerUpSimilarity: e.RunnerUpSimilarity,
+			LineDiffs:          e.LineDiffs,
+		})
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(SaveSessionPath, append(data, '\n'), 0o644)
+}
+
+// loadSession reads a session file and rebuilds its entries.
+func loadSession(path string) (SessionFile, []DiffEntry, error) {
+	var session SessionFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return session, nil, err
+	}
+	if err := json.Unmarshal(data, &session); err != nil {
+		return session, nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := checkSchemaVersion(session.SchemaVersion); err != nil {
+		return session, nil, fmt.Errorf("%s: %v", path, err)
+	}
+	inputLines := [2][]string{
+		strings.Split(strings.ReplaceAll(session.ContentA, "\r\n", "\n"), "\n"),
+		strings.Split(strings.ReplaceAll(session.ContentB, "\r\n", "\n"), "\n"),
+	}
+	toBlock := func(sb *SessionBlock, side int) *ContentBlock {
+		if sb == nil {
+			return nil
+		}
+		origin := []string{"A", "B"}[side]
+		cb := &ContentBlock{
+			ID:             sb.ID,
+			OriginalText:   sb.Text,
+			NormalizedText: NormalizeTextBlock(sb.Text),
+			Checksum:       CalculateBlockChecksum(NormalizeTextBlock(sb.Text)),
+			LineStart:      sb.LineStart,
+			LineEnd:        sb.LineEnd,
+			FileOrigin:     origin,
+		}
+		for _, n := range sb.Lines {
+			if n >= 1 && n <= len(inputLines[side]) {
+				text := inputLines[side][n-1]
+				cb.SourceLineRefs = append(cb.SourceLineRefs, LineInfo{OriginalText: text, TrimmedText: strings.TrimSpace(text), OriginalLineNum: n, FileOrigin: origin})
+			}
+		}
+		return cb
+	}
+	var diffs []DiffEntry
+	for _, se := range session.Entries {
+		t, ok := diffTypeByName(se.Type)
+		if !ok {
+			return session, nil, fmt.Errorf("%s: unknown entry type %q", path, se.Type)
+		}
+		diffs = append(diffs, DiffEntry{Type: t, BlockA: toBlock(se.A, 0), BlockB: toBlock(se.B, 1), Similarity: se.Similarity, RunnerUpSimilarity: se.RunnerUpSimilarity, LineDiffs: se.LineDiffs})
+	}
+	sortDiffEntries(diffs)
+	return session, diffs, nil
+}
+
+// runQuery implements "go-semantic-diff query": it prints a view of a result
+// saved with --save-session, returning the exit code of the saved diff.
+func runQuery(args []string) int {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	focusStr := fs.String("focus", "", "Report only on File A lines n,m")
+	focusPatternStr := fs.String("focus-pattern", "", "Report the fate of every File A block whose content matches this regexp")
+	detailsStr := fs.String("details", "new,deleted", "Sections listed in full: new, deleted, changed, moved, moved-changed, unchanged, all or none; prefix a section with - to exclude it")
+	fs.StringVar(&OutputFormat, "format", "text", "Report format: text, markdown, side-by-side, github or rdjson")
+	fs.BoolVar(&ShowStats, "stats", false, "Print the statistics summary after the report")
+	fs.StringVar(&StatsJSONPath, "stats-json", "", "Write the statistics summary as JSON to this file ('-' for stdout)")
+	fs.BoolVar(&FullContent, "full-content", false, "Print whole blocks in detailed sections")
+	if err := fs.Parse(args); err != nil {
+		return ExitTrouble
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: go-semantic-diff query [--focus n,m | --focus-pattern re] [--format text|markdown|side-by-side|github|rdjson] [--details <sections>] [--full-content] [--stats] [--stats-json file] <session-file>")
+		return ExitTrouble
+	}
+	if OutputFormat != "text" && OutputFormat != "markdown" && OutputFormat != "side-by-side" && OutputFormat != "github" && OutputFormat != "rdjson" {
+		fmt.Fprintf(os.Stderr, "Error: unknown --format %q (expected text, markdown, side-by-side, github or rdjson)\n", OutputFormat)
+		return ExitTrouble
+	}
+	focus := parseFocusRange(*focusStr)
+	if focus.StartLine == -1 {
+		return ExitTrouble
+	}
+	var focusPattern *regexp.Regexp
+	if *focusPatternStr != "" {
+		var err error
+		if focusPattern, err = regexp.Compile(*focusPatternStr); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --focus-pattern: %v\n", err)
+			return ExitTrouble
+		}
+	}
+	details, err := parseDetailsFlag(*detailsStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --details: %v\n", err)
+		return ExitTrouble
+	}
+	session, diffs, err := loadSession(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: query: %v\n", err)
+		return ExitTrouble
+	}
+
+	exitCode := diffExitCode(diffs)
+	if session.Partial {
+		exitCode = ExitTrouble
+	}
+	if session.Note != "" {
+		fmt.Fprintf(noteWriter(), "Note: %s\n", session.Note)
+	}
+	switch {
+	case focus.IsSet:
+		printFocusResults(session.ContentA, diffs, focus)
+	case focusPattern != nil:
+		printFocusPatternResults(diffs, focusPattern)
+	case identicalInputs(session.ContentA, session.ContentB):
+		fmt.Fprintln(noteWriter(), "Files are semantically identical (whole-file checksums match).")
+		if OutputFormat == "rdjson" {
+			printRDJSON(nil, session.FileB)
+		}
+	case OutputFormat == "markdown":
+		printMarkdownReport(diffs, session.FileA, session.FileB, details)
+	case OutputFormat == "github":
+		printGitHubAnnotations(diffs, session.FileB)
+	case OutputFormat == "rdjson":
+		printRDJSON(diffs, session.FileB)
+	case OutputFormat == "side-by-side":
+		printSideBySideReport(diffs, details)
+	default:
+		printDiffReport(diffs, details, session.ContentA, session.ContentB)
+	}
+	if ShowStats || StatsJSONPath != "" {
+		stats := computeDiffStats(diffs, nil)
+		if ShowStats {
+			printDiffStats(stats)
+		}
+		if StatsJSONPath != "" {
+			if err := writeDiffStatsJSON(stats, StatsJSONPath); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing stats to %s: %v\n", StatsJSONPath, err)
+				return ExitTrouble
+			}
+		}
+	}
+	return exitCode
+}
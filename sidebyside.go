@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/term"
+)
+
+const SideBySideDefaultWidth = 130 // Used when stdout is not a terminal and $COLUMNS is unset, as in sdiff
+const SideBySideMinWidth = 40
+const sideBySideLineNumberWidth = 5
+
+// sideBySideRow is one output row; a line number of 0 leaves that side empty.
+type sideBySideRow struct {
+	lineA, lineB int
+	textA, textB string
+	marker       byte
+}
+
+// terminalWidth returns the width of the terminal on stdout, else $COLUMNS, else
+// SideBySideDefaultWidth.
+func terminalWidth() int {
+	if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
+		return width
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return SideBySideDefaultWidth
+}
+
+// sideBySideOrder orders entries by File A position. Entries only in File B are
+// placed just before the in-place pair that follows them in File B, so each NEW
+// block lines up where it was inserted, after any DELETED block it replaces.
+func sideBySideOrder(diffs []DiffEntry) []DiffEntry {
+	ordered := append([]DiffEntry(nil), diffs...)
+	byB := make([]int, 0, len(ordered))
+	for i, e := range ordered {
+		if e.BlockB != nil {
+			byB = append(byB, i)
+		}
+	}
+	sort.SliceStable(byB, func(x, y int) bool { return ordered[byB[x]].BlockB.LineStart < ordered[byB[y]].BlockB.LineStart })
+	keys := make([]float64, len(ordered))
+	nextA := math.Inf(1)
+	for k := len(byB) - 1; k >= 0; k-- {
+		e := ordered[byB[k]]
+		switch {
+		case e.BlockA == nil:
+			keys[byB[k]] = nextA - 0.5
+		case e.Type != Moved && e.Type != MovedModified:
+			nextA = float64(e.BlockA.LineStart)
+		}
+	}
+	for i, e := range ordered {
+		if e.BlockA != nil {
+			keys[i] = float64(e.BlockA.LineStart)
+		}
+	}
+	idx := make([]int, len(ordered))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(x, y int) bool { return keys[idx[x]] < keys[idx[y]] })
+	result := make([]DiffEntry, len(ordered))
+	for k, i := range idx {
+		result[k] = ordered[i]
+	}
+	return result
+}
+
+// blockSourceLines returns the line numbers and text of the lines a block spans,
+// without blank lines at either end. Blocks without source lines (from windowed
+// diffs) are split from their text.
+func blockSourceLines(cb *ContentBlock) ([]int, []string) {
+	var nums []int
+	var lines []string
+	refs := cb.SourceLineRefs
+	for len(refs) > 1 && strings.TrimSpace(refs[0].OriginalText) == "" {
+		refs = refs[1:]
+	}
+	for len(refs) > 1 && strings.TrimSpace(refs[len(refs)-1].OriginalText) == "" {
+		refs = refs[:len(refs)-1]
+	}
+	if len(refs) > 0 {
+		for _, li := range refs {
+			nums = append(nums, li.OriginalLineNum)
+			lines = append(lines, strings.TrimSuffix(li.OriginalText, "\r"))
+		}
+		return nums, lines
+	}
+	lines = strings.Split(strings.TrimSuffix(strings.ReplaceAll(cb.OriginalText, "\r\n", "\n"), "\n"), "\n")
+	for k := range lines {
+		nums = append(nums, cb.LineStart+k)
+	}
+	return nums, lines
+}
+
+// sideBySideRows aligns the lines of an entry. Changed pairs are aligned on their
+// common lines, pairing removed lines with the added lines that replace them.
+func sideBySideRows(e DiffEntry) []sideBySideRow {
+	var rows []sideBySideRow
+	switch {
+	case e.BlockB == nil:
+		nums, lines := blockSourceLines(e.BlockA)
+		for k, line := range lines {
+			rows = append(rows, sideBySideRow{lineA: nums[k], textA: line, marker: '<'})
+		}
+		return rows
+	case e.BlockA == nil:
+		nums, lines := blockSourceLines(e.BlockB)
+		for k, line := range lines {
+			rows = append(rows, sideBySideRow{lineB: nums[k], textB: line, marker: '>'})
+		}
+		return rows
+	}
+	same := byte(' ')
+	if e.Type == Moved || e.Type == MovedModified {
+		same = '~'
+	}
+	numsA, linesA := blockSourceLines(e.BlockA)
+	numsB, linesB := blockSourceLines(e.BlockB)
+	if e.Similarity == 0 && len(linesA) == len(linesB) {
+		for k := range linesA {
+			rows = append(rows, sideBySideRow{numsA[k], numsB[k], linesA[k], linesB[k], same})
+		}
+		return rows
+	}
+	// Longest common subsequence of lines; unmatched runs between common lines
+	// are paired row by row.
+	lcs := make([][]int, len(linesA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(linesB)+1)
+	}
+	for i := len(linesA) - 1; i >= 0; i-- {
+		for j := len(linesB) - 1; j >= 0; j-- {
+			if linesA[i] == linesB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var removed, added []int
+	flush := func() {
+		for k := 0; k < max(len(removed), len(added)); k++ {
+			row := sideBySideRow{marker: '|'}
+			if k < len(removed) {
+				row.lineA, row.textA = numsA[removed[k]], linesA[removed[k]]
+			} else {
+				row.marker = '>'
+			}
+			if k < len(added) {
+				row.lineB, row.textB = numsB[added[k]], linesB[added[k]]
+			} else {
+				row.marker = '<'
+			}
+			rows = append(rows, row)
+		}
+		removed, added = nil, nil
+	}
+	i, j := 0, 0
+	for i < len(linesA) || j < len(linesB) {
+		switch {
+		case i < len(linesA) && j < len(linesB) && linesA[i] == linesB[j]:
+			flush()
+			rows = append(rows, sideBySideRow{numsA[i], numsB[j], linesA[i], linesB[j], same})
+			i++
+			j++
+		case j == len(linesB) || i < len(linesA) && lcs[i+1][j] >= lcs[i][j+1]:
+			removed = append(removed, i)
+			i++
+		default:
+			added = append(added, j)
+			j++
+		}
+	}
+	flush()
+	return rows
+}
+
+// sideBySideCell fits text into a column of the given display width, expanding
+// tabs and padding so the next column lines up.
+func sideBySideCell(text string, width int) string {
+	text = bidiIsolate(strings.ReplaceAll(text, "\t", "    "))
+	var b strings.Builder
+	used := 0
+	g := uniseg.NewGraphemes(text)
+	for g.Next() {
+		w := g.Width()
+		if used+w > width {
+			break
+		}
+		b.WriteString(g.Str())
+		used += w
+	}
+	return b.String() + strings.Repeat(" ", width-used)
+}
+
+// printSideBySideReport prints both files in two columns, block by block, like
+// sdiff: ' ' unchanged, '~' moved, '|' changed, '<' only in File A, '>' only in
+// File B. Unchanged blocks are collapsed to one row unless --details lists them.
+func printSideBySideReport(diffs []DiffEntry, details map[DiffType]bool) {
+	width := max(terminalWidth(), SideBySideMinWidth)
+	column := (width - 2*(sideBySideLineNumberWidth+1) - 3) / 2
+	number := func(n int) string {
+		if n == 0 {
+			return strings.Repeat(" ", sideBySideLineNumberWidth)
+		}
+		return fmt.Sprintf("%*d", sideBySideLineNumberWidth, n)
+	}
+	rule := strings.Repeat("─", width)
+	for _, e := range sideBySideOrder(diffs) {
+		header := fmt.Sprintf("%s A %s | B %s", strings.ToUpper(e.Type.String()), blockRange(e.BlockA), blockRange(e.BlockB))
+		if e.Similarity > 0 {
+			header += fmt.Sprintf(" (similarity %.2f)", e.Similarity)
+		}
+		line, _ := truncateGraphemes("── "+header+" "+rule, width)
+		fmt.Println(line)
+		if e.Type == Unchanged && e.Similarity == 0 && !details[Unchanged] {
+			fmt.Printf("%s ... %d unchanged lines\n", number(0), e.BlockA.LineEnd-e.BlockA.LineStart+1)
+			continue
+		}
+		for _, r := range sideBySideRows(e) {
+			row := fmt.Sprintf("%s %s %c %s %s", number(r.lineA), sideBySideCell(r.textA, column), r.marker, number(r.lineB), sideBySideCell(r.textB, column))
+			fmt.Println(strings.TrimRight(row, " "))
+		}
+	}
+}
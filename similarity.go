@@ -1,13 +1,15 @@
 package main
 
 import (
+	"fmt"
 	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/agnivade/levenshtein"
 )
 
-// const SemanticSimilarityThreshold = 0.55 // No longer needed here, it's a global var in main.go
-
 // StubbedCosineSimilarity - STUBBED.
 func StubbedCosineSimilarity(vecA, vecB []float32) float32 {
 	if len(vecA) != len(vecB) || len(vecA) == 0 {
@@ -31,7 +33,8 @@ func StubbedCosineSimilarity(vecA, vecB []float32) float32 {
 	return dotProduct / denominator
 }
 
-// TextSimilarityNormalized uses Levenshtein distance.
+// TextSimilarityNormalized uses Levenshtein distance, normalized by the longer
+// text's length in runes (or grapheme clusters with --grapheme-similarity).
 func TextSimilarityNormalized(textA, textB string) float32 {
 	if len(textA) == 0 && len(textB) == 0 {
 		return 1.0
@@ -39,11 +42,16 @@ func TextSimilarityNormalized(textA, textB string) float32 {
 	if len(textA) == 0 || len(textB) == 0 {
 		return 0.0
 	}
+	if GraphemeSimilarity {
+		if encA, encB, ok := encodeGraphemePair(textA, textB); ok {
+			textA, textB = encA, encB
+		}
+	}
 
 	dist := levenshtein.ComputeDistance(textA, textB)
-	maxLen := len(textA)
-	if len(textB) > maxLen {
-		maxLen = len(textB)
+	maxLen := utf8.RuneCountInString(textA)
+	if lenB := utf8.RuneCountInString(textB); lenB > maxLen {
+		maxLen = lenB
 	}
 	if maxLen == 0 {
 		return 1.0
@@ -51,3 +59,242 @@ func TextSimilarityNormalized(textA, textB string) float32 {
 	similarity := 1.0 - (float32(dist) / float32(maxLen))
 	return similarity
 }
+
+// SimilarityMetrics are the block similarity metrics of --similarity. The
+// default, "", selects cosine when backend embeddings are available and
+// Levenshtein otherwise.
+var SimilarityMetrics = []string{"levenshtein", "cosine", "jaccard", "shingle", "tfidf", "combined"}
+
+// Similarity scores two blocks from 0 (unrelated) to 1 (identical).
+type Similarity interface {
+	Score(a, b *ContentBlock) float32
+}
+
+// LevenshteinSimilarity compares normalized text by edit distance; best for
+// revisions that reword a little.
+type LevenshteinSimilarity struct{}
+
+func (LevenshteinSimilarity) Score(a, b *ContentBlock) float32 {
+	return TextSimilarityNormalized(a.NormalizedText, b.NormalizedText)
+}
+
+// CosineSimilarity compares block embeddings, from --embedding-url or the built-in stub.
+type CosineSimilarity struct{}
+
+func (CosineSimilarity) Score(a, b *ContentBlock) float32 {
+	return StubbedCosineSimilarity(a.Embedding, b.Embedding)
+}
+
+// JaccardSimilarity compares the sets of words, ignoring order; best for content
+// such as lists and tables whose items are reordered.
+type JaccardSimilarity struct{}
+
+func (JaccardSimilarity) Score(a, b *ContentBlock) float32 {
+	return wordSetJaccard(a.NormalizedText, b.NormalizedText)
+}
+
+// ShingleSimilarity is the Jaccard similarity of the sets of word n-grams. It is
+// linear in text length, unlike Levenshtein, and ignores the order of sentences
+// within a block while still rewarding shared phrasing.
+type ShingleSimilarity struct {
+	Size int
+}
+
+func (s ShingleSimilarity) Score(a, b *ContentBlock) float32 {
+	setA, setB := wordShingles(a.NormalizedText, s.Size), wordShingles(b.NormalizedText, s.Size)
+	if len(setA) == 0 && len(setB) == 0 {
+		return 1.0
+	}
+	if len(setB) < len(setA) {
+		setA, setB = setB, setA
+	}
+	intersection := 0
+	for sh := range setA {
+		if setB[sh] {
+			intersection++
+		}
+	}
+	return float32(intersection) / float32(len(setA)+len(setB)-intersection)
+}
+
+// wordShingles returns the set of size-word shingles of text; texts shorter than
+// size form a single shingle.
+func wordShingles(text string, size int) map[string]bool {
+	words := strings.Fields(text)
+	shingles := make(map[string]bool)
+	if len(words) == 0 {
+		return shingles
+	}
+	for start := 0; start+size <= len(words) || start == 0; start++ {
+		shingles[strings.Join(words[start:min(start+size, len(words))], " ")] = true
+	}
+	return shingles
+}
+
+// SimilarityWeights are the weights of the combined metric's components
+// (--similarity-weights). Cosine only counts when backend embeddings are available.
+type SimilarityWeights struct {
+	Levenshtein, Jaccard, TFIDF, Cosine float64
+}
+
+// parseSimilarityWeights parses "levenshtein=0.5,jaccard=0.3,tfidf=0.2,cosine=0.2".
+// Components not mentioned keep weight 1; weights need not sum to 1.
+func parseSimilarityWeights(spec string) (SimilarityWeights, error) {
+	w := SimilarityWeights{Levenshtein: 1, Jaccard: 1, TFIDF: 1, Cosine: 1}
+	if strings.TrimSpace(spec) == "" {
+		return w, nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return w, fmt.Errorf("expected metric=weight, got %q", part)
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil || value < 0 {
+			return w, fmt.Errorf("weight for %q must be a non-negative number, got %q", strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+		}
+		switch strings.ToLower(strings.TrimSpace(kv[0])) {
+		case "levenshtein":
+			w.Levenshtein = value
+		case "jaccard":
+			w.Jaccard = value
+		case "tfidf":
+			w.TFIDF = value
+		case "cosine":
+			w.Cosine = value
+		default:
+			return w, fmt.Errorf("unknown metric %q (expected levenshtein, jaccard, tfidf or cosine)", strings.TrimSpace(kv[0]))
+		}
+	}
+	if w.Levenshtein+w.Jaccard+w.TFIDF == 0 {
+		return w, fmt.Errorf("levenshtein, jaccard and tfidf weights cannot all be 0 (use --similarity cosine for cosine alone)")
+	}
+	return w, nil
+}
+
+// WeightedSimilarity is one component of a combined metric.
+type WeightedSimilarity struct {
+	Name   string
+	Metric Similarity
+	Weight float64
+}
+
+// CombinedSimilarity blends several metrics by weighted mean, so matches hold up
+// to rewording (Levenshtein, cosine), to reordered words (Jaccard) and to heavy
+// rewriting that keeps the distinctive terms (TF-IDF).
+type CombinedSimilarity struct {
+	Components []WeightedSimilarity
+}
+
+func (c CombinedSimilarity) Score(a, b *ContentBlock) float32 {
+	var sum, total float64
+	for _, comp := range c.Components {
+		sum += comp.Weight * float64(comp.Metric.Score(a, b))
+		total += comp.Weight
+	}
+	return float32(sum / total)
+}
+
+// ComponentScores returns each component's unweighted score, in component order.
+func (c CombinedSimilarity) ComponentScores(a, b *ContentBlock) []float32 {
+	scores := make([]float32, len(c.Components))
+	for k, comp := range c.Components {
+		scores[k] = comp.Metric.Score(a, b)
+	}
+	return scores
+}
+
+// describe formats component scores, e.g. "levenshtein 0.62, jaccard 0.80".
+func (c CombinedSimilarity) describe(scores []float32) string {
+	parts := make([]string, len(scores))
+	for k, score := range scores {
+		parts[k] = fmt.Sprintf("%s %.2f", c.Components[k].Name, score)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// validateSimilarityMetric checks a --similarity value.
+func validateSimilarityMetric(name string) error {
+	if name == "" {
+		return nil
+	}
+	for _, m := range SimilarityMetrics {
+		if name == m {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown metric %q (expected %s)", name, strings.Join(SimilarityMetrics, ", "))
+}
+
+// similarityUsesEmbeddings reports whether the metric of opts can use backend embeddings.
+func similarityUsesEmbeddings(opts Options) bool {
+	return SimilarityCommand == "" && (opts.SimilarityMetric == "" || opts.SimilarityMetric == "cosine" || opts.SimilarityMetric == "combined")
+}
+
+// selectSimilarity returns the metric of opts. When --embedding-url
+// was given but is unavailable, cosine falls back to Levenshtein, since the stubbed
+// embeddings are no substitute for real ones, and combined drops cosine. TF-IDF
+// vectors are built over the gap blocks of both files.
+func selectSimilarity(backendEmbeddings bool, gapBlocksA, gapBlocksB []ContentBlock, opts Options) Similarity {
+	if SimilarityCommand != "" {
+		return CommandSimilarity{}
+	}
+	switch opts.SimilarityMetric {
+	case "levenshtein":
+		return LevenshteinSimilarity{}
+	case "jaccard":
+		return JaccardSimilarity{}
+	case "shingle":
+		return ShingleSimilarity{Size: opts.ShingleSize}
+	case "tfidf":
+		return newTFIDFSimilarity(gapBlocksA, gapBlocksB)
+	case "combined":
+		w := opts.SimilarityWeights
+		components := []WeightedSimilarity{{"levenshtein", LevenshteinSimilarity{}, w.Levenshtein}, {"jaccard", JaccardSimilarity{}, w.Jaccard}}
+		if w.TFIDF > 0 {
+			components = append(components, WeightedSimilarity{"tfidf", newTFIDFSimilarity(gapBlocksA, gapBlocksB), w.TFIDF})
+		}
+		if backendEmbeddings {
+			components = append(components, WeightedSimilarity{"cosine", CosineSimilarity{}, w.Cosine})
+		}
+		var weighted []WeightedSimilarity
+		for _, comp := range components {
+			if comp.Weight > 0 {
+				weighted = append(weighted, comp)
+			}
+		}
+		return CombinedSimilarity{Components: weighted}
+	case "cosine":
+		if opts.EmbeddingURL == "" || backendEmbeddings {
+			return CosineSimilarity{}
+		}
+		return LevenshteinSimilarity{}
+	default:
+		if backendEmbeddings {
+			return CosineSimilarity{}
+		}
+		return LevenshteinSimilarity{}
+	}
+}
+
+// similarityName names a metric for reports.
+func similarityName(s Similarity) string {
+	switch s := s.(type) {
+	case warmSimilarity:
+		return similarityName(s.inner)
+	case CosineSimilarity:
+		return "cosine"
+	case JaccardSimilarity:
+		return "jaccard"
+	case ShingleSimilarity:
+		return "shingle"
+	case TFIDFSimilarity:
+		return "tfidf"
+	case CombinedSimilarity:
+		return "combined"
+	case CommandSimilarity:
+		return "similarity-cmd"
+	default:
+		return "levenshtein"
+	}
+}
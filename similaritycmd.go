@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// SimilarityCommand is an external scorer (--similarity-cmd), e.g.
+// "python3 cross_encoder.py". It is started once and kept running: for each
+// request line {"pairs": [{"a": ..., "b": ...}, ...]} of normalized block texts
+// it must answer one line {"scores": [...]} with a score from 0 to 1 per pair.
+var SimilarityCommand string
+
+// similarityPair is a pair of blocks sent to the --similarity-cmd.
+type similarityPair struct {
+	A string `json:"a"`
+	B string `json:"b"`
+}
+
+type similarityCommandRequest struct {
+	Pairs []similarityPair `json:"pairs"`
+}
+
+type similarityCommandResponse struct {
+	Scores []float64 `json:"scores"`
+}
+
+// similarityPlugin is the running --similarity-cmd process. Requests are sent
+// one at a time. When the process fails, its error is kept for
+// similarityPluginErr, later pairs score 0, and the next diff starts it again.
+type similarityPlugin struct {
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	err    error
+}
+
+var currentSimilarityPlugin similarityPlugin
+
+// CommandSimilarity scores pairs with the --similarity-cmd.
+type CommandSimilarity struct{}
+
+func (CommandSimilarity) Score(a, b *ContentBlock) float32 {
+	return currentSimilarityPlugin.scores([]similarityPair{{a.NormalizedText, b.NormalizedText}})[0]
+}
+
+// ScoreCandidates scores a against all candidates in one request.
+func (CommandSimilarity) ScoreCandidates(a *ContentBlock, candidates []*ContentBlock) []float32 {
+	pairs := make([]similarityPair, len(candidates))
+	for k, b := range candidates {
+		pairs[k] = similarityPair{a.NormalizedText, b.NormalizedText}
+	}
+	return currentSimilarityPlugin.scores(pairs)
+}
+
+// scores returns the command's score for each pair, or zeros once it failed.
+func (p *similarityPlugin) scores(pairs []similarityPair) []float32 {
+	scores := make([]float32, len(pairs))
+	if len(pairs) == 0 {
+		return scores
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return scores
+	}
+	resp, err := p.exchange(pairs)
+	if err != nil {
+		p.err = err
+		p.stop()
+		return scores
+	}
+	for k, score := range resp.Scores {
+		scores[k] = float32(score)
+	}
+	return scores
+}
+
+// exchange sends one request and reads its response, starting the command if
+// it is not running.
+func (p *similarityPlugin) exchange(pairs []similarityPair) (similarityCommandResponse, error) {
+	var resp similarityCommandResponse
+	if p.cmd == nil {
+		if err := p.start(); err != nil {
+			return resp, err
+		}
+	}
+	line, err := json.Marshal(similarityCommandRequest{Pairs: pairs})
+	if err != nil {
+		return resp, err
+	}
+	if _, err := p.stdin.Write(append(line, '\n')); err != nil {
+		return resp, fmt.Errorf("%s: writing request: %v", SimilarityCommand, err)
+	}
+	answer, err := p.stdout.ReadBytes('\n')
+	if err != nil {
+		return resp, fmt.Errorf("%s: reading response: %v", SimilarityCommand, err)
+	}
+	if err := json.Unmarshal(answer, &resp); err != nil {
+		return resp, fmt.Errorf("%s: invalid response %q: %v", SimilarityCommand, strings.TrimSpace(string(answer)), err)
+	}
+	if len(resp.Scores) != len(pairs) {
+		return resp, fmt.Errorf("%s: got %d scores for %d pairs", SimilarityCommand, len(resp.Scores), len(pairs))
+	}
+	for _, score := range resp.Scores {
+		if math.IsNaN(score) || score < 0 || score > 1 {
+			return resp, fmt.Errorf("%s: score %v is not between 0 and 1", SimilarityCommand, score)
+		}
+	}
+	return resp, nil
+}
+
+func (p *similarityPlugin) start() error {
+	fields := strings.Fields(SimilarityCommand)
+	cmd := exec.Command(fields[0], fields[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%s: %v", SimilarityCommand, err)
+	}
+	p.cmd, p.stdin, p.stdout = cmd, stdin, bufio.NewReader(stdout)
+	return nil
+}
+
+// stop ends the command: it sees end of input, and is killed if it does not
+// exit by itself on a failed exchange.
+func (p *similarityPlugin) stop() {
+	if p.cmd == nil {
+		return
+	}
+	p.stdin.Close()
+	if p.err != nil {
+		p.cmd.Process.Kill()
+	}
+	p.cmd.Wait()
+	p.cmd = nil
+}
+
+// similarityPluginErr returns the error the --similarity-cmd failed with since
+// the last call, if any, and lets the next diff start it again.
+func similarityPluginErr() error {
+	p := &currentSimilarityPlugin
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	err := p.err
+	p.err = nil
+	return err
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// CategoryStats totals the blocks and lines of one DiffType.
+type CategoryStats struct {
+	Blocks int `json:"blocks"`
+	LinesA int `json:"lines_a"`
+	LinesB int `json:"lines_b"`
+}
+
+// DiffStats is the --stats summary of a diff result.
+type DiffStats struct {
+	SchemaVersion             int           `json:"schema_version"`
+	Added                     CategoryStats `json:"added"`
+	Deleted                   CategoryStats `json:"deleted"`
+	Modified                  CategoryStats `json:"modified"`
+	Moved                     CategoryStats `json:"moved"`
+	MovedModified             CategoryStats `json:"moved_changed"`
+	Unchanged                 CategoryStats `json:"unchanged"`
+	AverageModifiedSimilarity float32       `json:"average_modified_similarity"`
+	DocumentSimilarityPercent float64       `json:"document_similarity_percent"`
+	SimilarityBackend         string        `json:"similarity_backend"`
+	Degraded                  bool          `json:"degraded"`
+	DegradedReason            string        `json:"degraded_reason,omitempty"`
+}
+
+// blockLineCount returns the number of source lines a block spans (0 for nil).
+func blockLineCount(cb *ContentBlock) int {
+	if cb == nil {
+		return 0
+	}
+	return cb.LineEnd - cb.LineStart + 1
+}
+
+// entrySimilarity is the similarity of a paired entry; exact (megablock) pairs score 1.
+func entrySimilarity(e DiffEntry) float32 {
+	switch e.Type {
+	case Added, Deleted:
+		return 0
+	}
+	if e.Similarity > 0 {
+		return e.Similarity
+	}
+	return 1
+}
+
+func (s *DiffStats) category(dt DiffType) *CategoryStats {
+	switch dt {
+	case Added:
+		return &s.Added
+	case Deleted:
+		return &s.Deleted
+	case Modified:
+		return &s.Modified
+	case Moved:
+		return &s.Moved
+	case MovedModified:
+		return &s.MovedModified
+	default:
+		return &s.Unchanged
+	}
+}
+
+// computeDiffStats totals a diff result. The document similarity is the
+// line-weighted similarity of all blocks on both sides, so NEW and DELETED
+// lines count as 0% and exact matches as 100%. The similarity backend is the one
+// run used; a nil run, for a result that was not diffed now, reports Levenshtein.
+func computeDiffStats(diffs []DiffEntry, run *DiffRun) DiffStats {
+	embedding := EmbeddingStatus{Backend: "levenshtein"}
+	if run != nil && run.Embedding.Backend != "" {
+		embedding = run.Embedding
+	}
+	stats := DiffStats{
+		SchemaVersion:     SchemaVersion,
+		SimilarityBackend: embedding.Backend,
+		Degraded:          embedding.Degraded,
+		DegradedReason:    embedding.Reason,
+	}
+	var modifiedSimSum float32
+	var weightedSim, totalLines float64
+	for _, e := range diffs {
+		c := stats.category(e.Type)
+		linesA, linesB := blockLineCount(e.BlockA), blockLineCount(e.BlockB)
+		c.Blocks++
+		c.LinesA += linesA
+		c.LinesB += linesB
+		if e.Type == Modified {
+			modifiedSimSum += e.Similarity
+		}
+		totalLines += float64(linesA + linesB)
+		weightedSim += float64(linesA+linesB) * float64(entrySimilarity(e))
+	}
+	if stats.Modified.Blocks > 0 {
+		stats.AverageModifiedSimilarity = modifiedSimSum / float32(stats.Modified.Blocks)
+	}
+	if totalLines > 0 {
+		stats.DocumentSimilarityPercent = 100 * weightedSim / totalLines
+	} else {
+		stats.DocumentSimilarityPercent = 100
+	}
+	return stats
+}
+
+func printDiffStats(stats DiffStats) {
+	fmt.Printf("\n# STATISTICS\n")
+	rows := []struct {
+		name string
+		c    CategoryStats
+	}{
+		{"new", stats.Added},
+		{"deleted", stats.Deleted},
+		{"moved", stats.Moved},
+		{"moved-changed", stats.MovedModified},
+		{"changed", stats.Modified},
+		{"unchanged", stats.Unchanged},
+	}
+	for _, r := range rows {
+		fmt.Printf("  %-14s %5d blocks  %6d lines in A  %6d lines in B\n", r.name+":", r.c.Blocks, r.c.LinesA, r.c.LinesB)
+	}
+	if stats.Modified.Blocks > 0 {
+		fmt.Printf("  Average similarity of changed blocks: %.2f\n", stats.AverageModifiedSimilarity)
+	}
+	fmt.Printf("  Overall document similarity: %.1f%%\n", stats.DocumentSimilarityPercent)
+	if stats.Degraded {
+		fmt.Printf("  Similarity backend: %s (DEGRADED: %s)\n", stats.SimilarityBackend, stats.DegradedReason)
+	}
+}
+
+// writeDiffStatsJSON writes stats as indented JSON to path, or to stdout for "-".
+func writeDiffStatsJSON(stats DiffStats, path string) error {
+	out := os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(stats)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// StyleRules are the rules loaded from --style-rules, a comma-separated list of
+// rule files where "builtin" selects the built-in rules.
+var StyleRules []StyleRule
+
+// StyleRule flags every match of Pattern in a block's text.
+type StyleRule struct {
+	Name    string
+	Message string // Optional description
+	Pattern *regexp.Regexp
+}
+
+// builtinStyleRules are the rules selected by --style-rules builtin.
+var builtinStyleRules = []StyleRule{
+	{"PassiveVoice", "passive voice", regexp.MustCompile(`(?i)\b(?:am|is|are|was|were|be|been|being)\s+(?:\w+ly\s+)?\w+(?:ed|en)\b`)},
+	{"Weasel", "weasel word", regexp.MustCompile(`(?i)\b(?:very|really|quite|fairly|extremely|basically|clearly|obviously|simply)\b`)},
+	{"LongSentence", "sentence over 30 words", regexp.MustCompile(`(?:[^\s.!?]+\s+){30,}[^\s.!?]+[.!?]`)},
+}
+
+// loadStyleRules loads the rules of every source in spec.
+func loadStyleRules(spec string) ([]StyleRule, error) {
+	var rules []StyleRule
+	for _, source := range strings.Split(spec, ",") {
+		switch source = strings.TrimSpace(source); {
+		case source == "":
+		case source == "builtin":
+			rules = append(rules, builtinStyleRules...)
+		case strings.HasSuffix(source, ".yml") || strings.HasSuffix(source, ".yaml"):
+			rule, err := loadValeRule(source)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, rule)
+		default:
+			fileRules, err := loadRegexRules(source)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, fileRules...)
+		}
+	}
+	return rules, nil
+}
+
+// loadRegexRules reads a rule file with one "Name: regexp" rule per line; blank
+// lines and lines starting with # are ignored.
+func loadRegexRules(path string) ([]StyleRule, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []StyleRule
+	for i, line := range strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, expr, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("%s:%d: expected \"Name: regexp\"", path, i+1)
+		}
+		re, err := regexp.Compile(strings.TrimSpace(expr))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, i+1, err)
+		}
+		rules = append(rules, StyleRule{Name: strings.TrimSpace(name), Pattern: re})
+	}
+	return rules, nil
+}
+
+// loadValeRule reads a Vale "existence" rule: the message, ignorecase, nonword and
+// the tokens or raw lists. The rule is named after its file, as in Vale.
+func loadValeRule(path string) (StyleRule, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return StyleRule{}, err
+	}
+	rule := StyleRule{Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))}
+	var tokens, raw []string
+	var list *[]string
+	ignoreCase, nonWord := false, false
+	for _, line := range strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if item, ok := strings.CutPrefix(trimmed, "- "); ok && list != nil {
+			*list = append(*list, valeScalar(item))
+			continue
+		}
+		key, value, _ := strings.Cut(trimmed, ":")
+		value = valeScalar(value)
+		list = nil
+		switch key {
+		case "extends":
+			if value != "existence" {
+				return StyleRule{}, fmt.Errorf("%s: only Vale existence rules are supported (extends: %s)", path, value)
+			}
+		case "message":
+			rule.Message = strings.ReplaceAll(value, "%s", "...")
+		case "ignorecase":
+			ignoreCase = value == "true"
+		case "nonword":
+			nonWord = value == "true"
+		case "tokens":
+			list = &tokens
+		case "raw":
+			list = &raw
+		}
+	}
+	expr := strings.Join(raw, "")
+	if len(tokens) > 0 {
+		expr = `(?:` + strings.Join(tokens, "|") + `)`
+		if !nonWord {
+			expr = `\b` + expr + `\b`
+		}
+	}
+	if expr == "" {
+		return StyleRule{}, fmt.Errorf("%s: rule has no tokens or raw pattern", path)
+	}
+	if ignoreCase {
+		expr = `(?i)` + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return StyleRule{}, fmt.Errorf("%s: %v", path, err)
+	}
+	rule.Pattern = re
+	return rule, nil
+}
+
+// valeScalar strips the quotes from a YAML scalar.
+func valeScalar(s string) string {
+	s = strings.TrimSpace(s)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		return unquoted
+	}
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	return s
+}
+
+// countStyleViolations returns the number of matches of every rule in text.
+func countStyleViolations(rules []StyleRule, text string) []int {
+	counts := make([]int, len(rules))
+	for i, r := range rules {
+		counts[i] = len(r.Pattern.FindAllStringIndex(text, -1))
+	}
+	return counts
+}
+
+// styleDelta formats the rules whose violation count differs, e.g. "PassiveVoice +2, Weasel -1".
+func styleDelta(rules []StyleRule, before, after []int) string {
+	var parts []string
+	for i, r := range rules {
+		if d := after[i] - before[i]; d != 0 {
+			parts = append(parts, fmt.Sprintf("%s %+d", r.Name, d))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// printStyleDelta prints the STYLE section: rule violation counts for both documents
+// and the change in violations for every NEW, DELETED and changed entry.
+func printStyleDelta(diffs []DiffEntry, rules []StyleRule, rawContentA, rawContentB string) {
+	heading, item := "\n# STYLE\n", "  "
+	if OutputFormat == "markdown" {
+		heading, item = "\n## STYLE\n\n", "- "
+	}
+	fmt.Print(heading)
+	docA, docB := countStyleViolations(rules, rawContentA), countStyleViolations(rules, rawContentB)
+	for i, r := range rules {
+		name := r.Name
+		if r.Message != "" {
+			name += " (" + r.Message + ")"
+		}
+		fmt.Printf("%s%s: %d -> %d (%+d)\n", item, name, docA[i], docB[i], docB[i]-docA[i])
+	}
+	none := make([]int, len(rules))
+	for _, e := range diffs {
+		before, after := none, none
+		if e.BlockA != nil {
+			before = countStyleViolations(rules, e.BlockA.OriginalText)
+		}
+		if e.BlockB != nil {
+			after = countStyleViolations(rules, e.BlockB.OriginalText)
+		}
+		delta := styleDelta(rules, before, after)
+		if delta == "" {
+			continue
+		}
+		var location string
+		switch {
+		case e.BlockA == nil:
+			location = fmt.Sprintf("B L%d-%d", e.BlockB.LineStart, e.BlockB.LineEnd)
+		case e.BlockB == nil:
+			location = fmt.Sprintf("A L%d-%d", e.BlockA.LineStart, e.BlockA.LineEnd)
+		default:
+			location = fmt.Sprintf("A L%d-%d -> B L%d-%d", e.BlockA.LineStart, e.BlockA.LineEnd, e.BlockB.LineStart, e.BlockB.LineEnd)
+		}
+		fmt.Printf("%s[%s] %s: %s\n", item, e.Type, location, delta)
+	}
+}
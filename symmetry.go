@@ -0,0 +1,99 @@
+package main
+
+import "fmt"
+
+// ReverseDiff swaps the roles of File A and File B (--reverse).
+var ReverseDiff bool
+
+// SymmetricCheck also diffs File B against File A and reports the lines the
+// two directions map differently (--symmetric-check).
+var SymmetricCheck bool
+
+// symmetryMismatch is a run of lines of one file that the forward diff and
+// the reverse diff map differently, in the same way.
+type symmetryMismatch struct {
+	side             string // File of the lines, A or B
+	start, end       int
+	forward, reverse symmetryMapping
+}
+
+// symmetryMapping is how one direction maps a run of lines: the status, folded
+// by symmetryStatus, and the range of lines mapped to.
+type symmetryMapping struct {
+	status   string
+	from, to int
+}
+
+func (m *symmetryMapping) add(lm LineMapping) {
+	if lm.Mapped == 0 {
+		return
+	}
+	if m.from == 0 || lm.Mapped < m.from {
+		m.from = lm.Mapped
+	}
+	m.to = max(m.to, lm.Mapped)
+}
+
+func (m symmetryMapping) describe(other string) string {
+	if m.from == 0 {
+		return m.status
+	}
+	return fmt.Sprintf("%s to %s %d-%d", m.status, other, m.from, m.to)
+}
+
+// symmetryStatus folds the statuses that differ between directions by
+// design: deleted and new, and moved and unchanged, since of two swapped
+// blocks each direction can move either.
+func symmetryStatus(status string) string {
+	switch status {
+	case LineDeleted, LineNew:
+		return "unmatched"
+	case LineMoved, LineUnchanged:
+		return "copied"
+	}
+	return status
+}
+
+// checkSymmetry compares the line map of the forward diff with that of the
+// reverse diff, whose File A is the forward File B.
+func checkSymmetry(forward, reverse LineMap) []symmetryMismatch {
+	var mismatches []symmetryMismatch
+	compare := func(side string, forwardLines, reverseLines []LineMapping) {
+		var run *symmetryMismatch
+		for k := 0; k < len(forwardLines) && k < len(reverseLines); k++ {
+			f, r := forwardLines[k], reverseLines[k]
+			fStatus, rStatus := symmetryStatus(f.Status), symmetryStatus(r.Status)
+			if f.Mapped == r.Mapped && fStatus == rStatus {
+				run = nil
+				continue
+			}
+			if run == nil || run.end != k || run.forward.status != fStatus || run.reverse.status != rStatus {
+				mismatches = append(mismatches, symmetryMismatch{side: side, start: k + 1, forward: symmetryMapping{status: fStatus}, reverse: symmetryMapping{status: rStatus}})
+				run = &mismatches[len(mismatches)-1]
+			}
+			run.end = k + 1
+			run.forward.add(f)
+			run.reverse.add(r)
+		}
+	}
+	compare("A", forward.A, reverse.B)
+	compare("B", forward.B, reverse.A)
+	return mismatches
+}
+
+// printSymmetryCheck prints the SYMMETRY CHECK section.
+func printSymmetryCheck(mismatches []symmetryMismatch) {
+	heading, item := "\n# SYMMETRY CHECK\n", "  "
+	if OutputFormat == "markdown" {
+		heading, item = "\n## SYMMETRY CHECK\n\n", "- "
+	}
+	fmt.Print(heading)
+	if len(mismatches) == 0 {
+		fmt.Printf("%sDiffing File B against File A maps every line as diffing File A against File B does.\n", item)
+		return
+	}
+	for _, m := range mismatches {
+		other := map[string]string{"A": "B", "B": "A"}[m.side]
+		fmt.Printf("%s%s lines %d-%d: %s forward, %s in reverse\n", item, m.side, m.start, m.end, m.forward.describe(other), m.reverse.describe(other))
+	}
+}
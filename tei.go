@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Requests to --embedding-url are split into batches of EmbeddingBatchSize
+// texts (--embedding-batch-size; text-embeddings-inference accepts 32 by
+// default), at most EmbeddingConcurrency of them in flight
+// (--embedding-concurrency). A batch that fails with a network error, 429 or a
+// 5xx status is retried up to EmbeddingRetries times (--embedding-retries),
+// waiting EmbeddingRetryBackoff and twice as long after each further failure,
+// or as long as the server's Retry-After asks.
+var (
+	EmbeddingBatchSize   = 32
+	EmbeddingConcurrency = 4
+	EmbeddingRetries     = 3
+)
+
+const (
+	EmbeddingRetryBackoff    = 500 * time.Millisecond
+	EmbeddingMaxRetryBackoff = 30 * time.Second
+)
+
+// embeddingStatusError is a response of the embedding backend other than 200 OK.
+type embeddingStatusError struct {
+	Code       int
+	Status     string
+	Body       string
+	RetryAfter string // The Retry-After header, if any
+}
+
+func (e *embeddingStatusError) Error() string {
+	return fmt.Sprintf("embedding backend returned %s: %s", e.Status, e.Body)
+}
+
+// fetchEmbeddings returns one embedding per text from url, in batches.
+func fetchEmbeddings(url string, texts []string) ([][]float32, error) {
+	size := max(EmbeddingBatchSize, 1)
+	embeddings := make([][]float32, len(texts))
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	slots := make(chan struct{}, max(EmbeddingConcurrency, 1))
+	for from := 0; from < len(texts); from += size {
+		to := min(from+size, len(texts))
+		slots <- struct{}{}
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			<-slots
+			break // The run falls back to text similarity anyway
+		}
+		wg.Add(1)
+		go func() {
+			defer func() { <-slots; wg.Done() }()
+			batch, err := postEmbeddingsRetrying(url, texts[from:to])
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			copy(embeddings[from:to], batch)
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return embeddings, nil
+}
+
+// postEmbeddingsRetrying posts a batch, retrying failures that may pass.
+func postEmbeddingsRetrying(url string, texts []string) ([][]float32, error) {
+	backoff := EmbeddingRetryBackoff
+	for attempt := 0; ; attempt++ {
+		embeddings, err := postEmbeddings(url, texts)
+		if err == nil || attempt >= EmbeddingRetries || !retryableEmbeddingError(err) {
+			if err != nil && attempt > 0 {
+				err = fmt.Errorf("%w (after %d attempts)", err, attempt+1)
+			}
+			return embeddings, err
+		}
+		wait := backoff
+		var statusErr *embeddingStatusError
+		if errors.As(err, &statusErr) {
+			if seconds, convErr := strconv.Atoi(statusErr.RetryAfter); convErr == nil && seconds >= 0 {
+				wait = time.Duration(seconds) * time.Second
+			}
+		}
+		if wait > EmbeddingMaxRetryBackoff {
+			wait = EmbeddingMaxRetryBackoff
+		}
+		time.Sleep(wait)
+		if backoff *= 2; backoff > EmbeddingMaxRetryBackoff {
+			backoff = EmbeddingMaxRetryBackoff
+		}
+	}
+}
+
+// retryableEmbeddingError reports whether a failed request may succeed when
+// sent again: the server was unreachable, overloaded or failed internally.
+// Other errors (a malformed response, a batch over the server's limit) would
+// fail the same way.
+func retryableEmbeddingError(err error) bool {
+	var statusErr *embeddingStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code == http.StatusTooManyRequests || statusErr.Code >= 500
+	}
+	var requestErr *url.Error
+	return errors.As(err, &requestErr)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ShowDefinedTerms enables the DEFINED TERMS section (--defined-terms).
+// DefinedTermPattern matches where a term is defined, with the term as its first
+// group (--defined-term-pattern). The default finds quoted capitalized phrases
+// such as ("Effective Date") or “Confidential Information” means.
+var ShowDefinedTerms bool
+var DefinedTermPattern = `["“]([A-Z][\w-]*(?:\s+(?:of|and|the|[A-Z][\w-]*))*)["”]`
+
+// DefinedTermChange is a defined term that was added, removed, or whose
+// definition changed. A or B is nil for a term defined on one side only.
+type DefinedTermChange struct {
+	Term string
+	A, B *TermDefinition
+}
+
+// TermDefinition spans a term's definition, from the line defining the term to
+// the end of its paragraph.
+type TermDefinition struct {
+	LineStart, LineEnd int
+}
+
+// validateDefinedTermPattern checks a --defined-term-pattern value.
+func validateDefinedTermPattern(pattern string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	if re.NumSubexp() < 1 {
+		return fmt.Errorf("pattern needs a group capturing the term")
+	}
+	return nil
+}
+
+// findDefinedTerms returns the first definition of each term in content.
+func findDefinedTerms(content string, re *regexp.Regexp) map[string]*TermDefinition {
+	lines := strings.Split(content, "\n")
+	defs := make(map[string]*TermDefinition)
+	for _, m := range re.FindAllStringSubmatchIndex(content, -1) {
+		term := content[m[2]:m[3]]
+		if _, seen := defs[term]; seen {
+			continue
+		}
+		def := &TermDefinition{LineStart: strings.Count(content[:m[0]], "\n") + 1}
+		def.LineEnd = def.LineStart
+		for def.LineEnd < len(lines) && strings.TrimSpace(lines[def.LineEnd]) != "" {
+			def.LineEnd++
+		}
+		defs[term] = def
+	}
+	return defs
+}
+
+// definitionChanged reports whether any entry overlapping def on the given side
+// is unpaired or a changed pair, i.e. whether block matching saw it change.
+func definitionChanged(diffs []DiffEntry, side string, def *TermDefinition) bool {
+	for _, e := range diffs {
+		block := e.BlockA
+		if side == "B" {
+			block = e.BlockB
+		}
+		if block == nil || block.LineEnd < def.LineStart || block.LineStart > def.LineEnd {
+			continue
+		}
+		if e.BlockA == nil || e.BlockB == nil || e.Similarity > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// diffDefinedTerms returns the terms defined on one side only and those whose
+// definition changed on either side, sorted by term.
+func diffDefinedTerms(diffs []DiffEntry, rawContentA, rawContentB string, re *regexp.Regexp) []DefinedTermChange {
+	defsA, defsB := findDefinedTerms(rawContentA, re), findDefinedTerms(rawContentB, re)
+	var changes []DefinedTermChange
+	for term, defA := range defsA {
+		defB, inB := defsB[term]
+		if !inB || definitionChanged(diffs, "A", defA) || definitionChanged(diffs, "B", defB) {
+			changes = append(changes, DefinedTermChange{Term: term, A: defA, B: defB})
+		}
+	}
+	for term, defB := range defsB {
+		if _, inA := defsA[term]; !inA {
+			changes = append(changes, DefinedTermChange{Term: term, B: defB})
+		}
+	}
+	sort.Slice(changes, func(x, y int) bool { return changes[x].Term < changes[y].Term })
+	return changes
+}
+
+// printDefinedTerms prints the DEFINED TERMS section.
+func printDefinedTerms(diffs []DiffEntry, rawContentA, rawContentB string) {
+	heading, item := "\n# DEFINED TERMS\n", "  "
+	if OutputFormat == "markdown" {
+		heading, item = "\n## DEFINED TERMS\n\n", "- "
+	}
+	fmt.Print(heading)
+	changes := diffDefinedTerms(diffs, rawContentA, rawContentB, regexp.MustCompile(DefinedTermPattern)) // Validated in main
+	if len(changes) == 0 {
+		fmt.Printf("%sNo defined term was added, removed or redefined.\n", item)
+		return
+	}
+	for _, c := range changes {
+		switch {
+		case c.B == nil:
+			fmt.Printf("%sremoved %q (defined in A L%d-%d)\n", item, c.Term, c.A.LineStart, c.A.LineEnd)
+		case c.A == nil:
+			fmt.Printf("%sadded %q (defined in B L%d-%d)\n", item, c.Term, c.B.LineStart, c.B.LineEnd)
+		default:
+			fmt.Printf("%sdefinition of %q modified (A L%d-%d -> B L%d-%d)\n", item, c.Term, c.A.LineStart, c.A.LineEnd, c.B.LineStart, c.B.LineEnd)
+		}
+	}
+}
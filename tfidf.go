@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math"
+	"strings"
+)
+
+// TFIDFSimilarity is the cosine similarity of TF-IDF vectors built over all gap
+// blocks of both files. Terms that are rare across the pair weigh most, so blocks
+// sharing distinctive terms match even after heavy rewriting.
+type TFIDFSimilarity struct {
+	vectors map[int]map[string]float64 // Block ID -> L2-normalized sparse vector
+}
+
+// newTFIDFSimilarity vectorizes the given blocks, each a document of the corpus.
+// IDF is smoothed (ln((1+N)/(1+df)) + 1), so terms in every block still count a little.
+func newTFIDFSimilarity(blockSets ...[]ContentBlock) TFIDFSimilarity {
+	termCounts := make(map[int]map[string]int)
+	docFreq := make(map[string]int)
+	docs := 0
+	for _, blocks := range blockSets {
+		for i := range blocks {
+			counts := make(map[string]int)
+			for _, term := range strings.Fields(blocks[i].NormalizedText) {
+				counts[term]++
+			}
+			for term := range counts {
+				docFreq[term]++
+			}
+			termCounts[blocks[i].ID] = counts
+			docs++
+		}
+	}
+	t := TFIDFSimilarity{vectors: make(map[int]map[string]float64, len(termCounts))}
+	for id, counts := range termCounts {
+		vec := make(map[string]float64, len(counts))
+		var norm float64
+		for term, n := range counts {
+			w := float64(n) * (math.Log(float64(1+docs)/float64(1+docFreq[term])) + 1)
+			vec[term] = w
+			norm += w * w
+		}
+		if norm > 0 {
+			norm = math.Sqrt(norm)
+			for term := range vec {
+				vec[term] /= norm
+			}
+		}
+		t.vectors[id] = vec
+	}
+	return t
+}
+
+func (t TFIDFSimilarity) Score(a, b *ContentBlock) float32 {
+	vecA, vecB := t.vectors[a.ID], t.vectors[b.ID]
+	if len(vecB) < len(vecA) {
+		vecA, vecB = vecB, vecA
+	}
+	var dot float64
+	for term, w := range vecA {
+		dot += w * vecB[term]
+	}
+	return float32(dot)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ShowToneShifts enables tone shift flagging of changed blocks (--tone).
+var ShowToneShifts bool
+
+const ToneMinRate = 0.03       // Share of words from one lexicon needed to give text that tone
+const ToneShiftMinDelta = 0.02 // Change in the new tone's share needed to flag a lexicon shift
+
+const ToneNeutral = "neutral"
+
+// toneLexicons lists the words that mark each non-neutral tone.
+var toneLexicons = []struct {
+	Tone  string
+	Words []string
+}{
+	{"promotional", []string{"amazing", "best", "breakthrough", "cutting-edge", "delighted", "exceptional", "exciting", "exclusive", "extraordinary", "incredible", "innovative", "leading", "outstanding", "powerful", "premier", "proud", "revolutionary", "seamless", "superior", "thrilled", "ultimate", "unmatched", "unparalleled", "world-class"}},
+	{"negative", []string{"bad", "breach", "complaint", "concern", "deficient", "deny", "fail", "failed", "failure", "inadequate", "liable", "loss", "penalty", "poor", "problem", "prohibited", "regret", "reject", "risk", "terminate", "unfortunately", "violation"}},
+	{"urgent", []string{"asap", "critical", "deadline", "immediately", "mandatory", "must", "now", "required", "shall", "urgent", "without delay"}},
+	{"tentative", []string{"approximately", "could", "generally", "may", "might", "perhaps", "possibly", "seem", "seems", "suggest", "typically", "usually"}},
+}
+
+// tonePrototypes are exemplar texts of each tone, embedded to classify blocks
+// when --embedding-url is available.
+var tonePrototypes = map[string]string{
+	ToneNeutral:   "The document describes the process and lists the steps involved.",
+	"promotional": "Our innovative, world-class solution delivers amazing results you will love!",
+	"negative":    "Unfortunately, the failure caused serious problems, losses and complaints.",
+	"urgent":      "You must act immediately; this is mandatory and the deadline is now.",
+	"tentative":   "This may possibly help in some cases, although results could vary.",
+}
+
+var toneWordRe = regexp.MustCompile(`[\p{L}'-]+`)
+
+// ToneReading is the tone of a text and the share of its words behind it.
+type ToneReading struct {
+	Tone  string
+	Rates map[string]float64 // Share of words from each tone's lexicon
+}
+
+// lexiconTone classifies text by the lexicon with the largest share of its words.
+func lexiconTone(text string) ToneReading {
+	reading := ToneReading{Tone: ToneNeutral, Rates: make(map[string]float64)}
+	lower := strings.ToLower(text)
+	words := toneWordRe.FindAllString(lower, -1)
+	if len(words) == 0 {
+		return reading
+	}
+	counts := make(map[string]int)
+	for _, w := range words {
+		counts[w]++
+	}
+	best := 0.0
+	for _, lex := range toneLexicons {
+		hits := 0
+		for _, w := range lex.Words {
+			if strings.Contains(w, " ") {
+				hits += strings.Count(lower, w)
+			} else {
+				hits += counts[w]
+			}
+		}
+		rate := float64(hits) / float64(len(words))
+		reading.Rates[lex.Tone] = rate
+		if rate >= ToneMinRate && rate > best {
+			reading.Tone, best = lex.Tone, rate
+		}
+	}
+	return reading
+}
+
+// ToneShift is a changed block pair whose tone changed markedly.
+type ToneShift struct {
+	Entry    DiffEntry
+	From, To ToneReading
+}
+
+// detectToneShifts classifies both sides of every changed block pair and returns
+// the pairs whose tone changed. Tones come from the embedding backend when
+// --embedding-url is reachable (nearest tone prototype), else from the lexicons.
+func detectToneShifts(diffs []DiffEntry, opts Options) (shifts []ToneShift, backend string) {
+	var pairs []DiffEntry
+	for _, e := range diffs {
+		if e.BlockA != nil && e.BlockB != nil && e.Similarity > 0 {
+			pairs = append(pairs, e)
+		}
+	}
+	if opts.EmbeddingURL != "" && len(pairs) > 0 {
+		if shifts, err := embeddingToneShifts(pairs, opts.EmbeddingURL); err == nil {
+			return shifts, opts.EmbeddingURL
+		} else {
+			debugf(opts.Verbosity, VerbosityDecisions, "backend_fallback", map[string]any{"backend": opts.EmbeddingURL, "error": err.Error()}, "Embedding backend unavailable for tone, using lexicons: %v", err)
+		}
+	}
+	for _, e := range pairs {
+		from, to := lexiconTone(e.BlockA.OriginalText), lexiconTone(e.BlockB.OriginalText)
+		if from.Tone != to.Tone && toneDelta(from, to) >= ToneShiftMinDelta {
+			shifts = append(shifts, ToneShift{Entry: e, From: from, To: to})
+		}
+	}
+	return shifts, "lexicon"
+}
+
+// shiftedTone is the tone a shift is about: the one gained, or the one lost when
+// the text became neutral.
+func shiftedTone(from, to ToneReading) string {
+	if to.Tone == ToneNeutral {
+		return from.Tone
+	}
+	return to.Tone
+}
+
+// toneDelta is how much the share of words of the shifted tone changed.
+func toneDelta(from, to ToneReading) float64 {
+	tone := shiftedTone(from, to)
+	if to.Tone == ToneNeutral {
+		return from.Rates[tone] - to.Rates[tone]
+	}
+	return to.Rates[tone] - from.Rates[tone]
+}
+
+// embeddingToneShifts classifies each side by its most similar tone prototype,
+// embedded by url.
+func embeddingToneShifts(pairs []DiffEntry, url string) ([]ToneShift, error) {
+	var tones, texts []string
+	for tone, prototype := range tonePrototypes {
+		tones = append(tones, tone)
+		texts = append(texts, prototype)
+	}
+	for _, e := range pairs {
+		texts = append(texts, e.BlockA.OriginalText, e.BlockB.OriginalText)
+	}
+	embeddings, err := fetchEmbeddings(url, texts)
+	if err != nil {
+		return nil, err
+	}
+	classify := func(v []float32) string {
+		best, bestSim := ToneNeutral, float32(-2)
+		for k, tone := range tones {
+			if sim := StubbedCosineSimilarity(v, embeddings[k]); sim > bestSim || sim == bestSim && tone < best {
+				best, bestSim = tone, sim
+			}
+		}
+		return best
+	}
+	var shifts []ToneShift
+	for i, e := range pairs {
+		from := ToneReading{Tone: classify(embeddings[len(tones)+2*i])}
+		to := ToneReading{Tone: classify(embeddings[len(tones)+2*i+1])}
+		if from.Tone != to.Tone {
+			shifts = append(shifts, ToneShift{Entry: e, From: from, To: to})
+		}
+	}
+	return shifts, nil
+}
+
+// printToneShifts prints the TONE SHIFTS section.
+func printToneShifts(diffs []DiffEntry, opts Options) {
+	shifts, backend := detectToneShifts(diffs, opts)
+	heading, item := fmt.Sprintf("\n# TONE SHIFTS (%s)\n", backend), "  "
+	if OutputFormat == "markdown" {
+		heading, item = fmt.Sprintf("\n## TONE SHIFTS (%s)\n\n", backend), "- "
+	}
+	fmt.Print(heading)
+	if len(shifts) == 0 {
+		fmt.Printf("%sNo changed block shifted tone markedly.\n", item)
+		return
+	}
+	for _, s := range shifts {
+		e := s.Entry
+		evidence := ""
+		if s.To.Rates != nil {
+			tone := shiftedTone(s.From, s.To)
+			evidence = fmt.Sprintf(" (%s words %.1f%% -> %.1f%%)", tone, 100*s.From.Rates[tone], 100*s.To.Rates[tone])
+		}
+		fmt.Printf("%s[%s] A L%d-%d -> B L%d-%d: %s -> %s%s\n", item, e.Type, e.BlockA.LineStart, e.BlockA.LineEnd, e.BlockB.LineStart, e.BlockB.LineEnd, s.From.Tone, s.To.Tone, evidence)
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+	"golang.org/x/term"
+)
+
+const TUIThresholdStep = 0.05
+const TUIMaxExpandedLines = 30
+
+// tuiState is the interactive browser's view of one diff result.
+type tuiState struct {
+	rawA, rawB     string
+	opts           Options
+	linesA, linesB []string
+	entries        []DiffEntry
+	byB            bool            // Order entries by File B position (destination view) instead of File A
+	cursor         int             // Index into entries of the selected entry
+	top            int             // First visible row
+	expanded       map[string]bool // Expanded entries, keyed by entryID
+	status         string
+}
+
+// tuiPosition is the line an entry sorts by: its File A start in the source view,
+// its File B start in the destination view, falling back to the other side.
+func tuiPosition(e DiffEntry, byB bool) int {
+	if byB && e.BlockB != nil || e.BlockA == nil {
+		return e.BlockB.LineStart
+	}
+	return e.BlockA.LineStart
+}
+
+// rediff diffs again at threshold. If the diff fails or times out, the
+// previous entries and threshold are kept and the error is shown.
+func (st *tuiState) rediff(threshold float64) {
+	opts := st.opts
+	opts.SimilarityThreshold, opts.LevelThresholds.Paragraph = threshold, threshold
+	entries, note, err := tuiDiff(st.rawA, st.rawB, opts)
+	if err != nil {
+		st.status = fmt.Sprintf("Re-diff at threshold %.2f failed, kept %.2f: %v", threshold, st.opts.SimilarityThreshold, err)
+		return
+	}
+	st.opts, st.entries = opts, entries
+	st.expanded = make(map[string]bool)
+	st.cursor, st.top = 0, 0
+	st.sortEntries()
+	st.status = fmt.Sprintf("Re-diffed at threshold %.2f", st.opts.SimilarityThreshold)
+	if note != "" {
+		st.status += " (" + note + ")"
+	}
+}
+
+// tuiDiff runs a diff of the browser, within --timeout.
+func tuiDiff(rawA, rawB string, opts Options) ([]DiffEntry, string, error) {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if DiffTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, DiffTimeout)
+	}
+	defer cancel()
+	entries, note, err := runDiff(ctx, rawA, rawB, opts)
+	if err == nil {
+		err = similarityPluginErr()
+	}
+	return entries, note, err
+}
+
+func (st *tuiState) sortEntries() {
+	sort.SliceStable(st.entries, func(i, j int) bool {
+		pi, pj := tuiPosition(st.entries[i], st.byB), tuiPosition(st.entries[j], st.byB)
+		if pi != pj {
+			return pi < pj
+		}
+		return st.entries[i].Type < st.entries[j].Type
+	})
+}
+
+// jumpSide switches between source (File A) and destination (File B) ordering,
+// keeping the selected entry selected so a moved block can be followed.
+func (st *tuiState) jumpSide() {
+	if len(st.entries) == 0 {
+		return
+	}
+	key := entryID(st.entries[st.cursor])
+	st.byB = !st.byB
+	st.sortEntries()
+	for i, e := range st.entries {
+		if entryID(e) == key {
+			st.cursor = i
+			break
+		}
+	}
+}
+
+func fitWidth(text string, width int) string {
+	if _, cut := truncateGraphemes(text, width); cut && width > 3 {
+		head, _ := truncateGraphemes(text, width-3)
+		return head + "..."
+	}
+	return text
+}
+
+func blockRange(cb *ContentBlock) string {
+	if cb == nil {
+		return "-"
+	}
+	return fmt.Sprintf("L%d-%d", cb.LineStart, cb.LineEnd)
+}
+
+// expandedRows renders the body of an expanded entry: line diffs for changed
+// blocks, otherwise the numbered source lines of the side being viewed.
+func (st *tuiState) expandedRows(e DiffEntry) []string {
+	var rows []string
+	if (e.Type == Modified || e.Type == MovedModified) && len(e.LineDiffs) > 0 {
+		for _, op := range e.LineDiffs {
+			for _, line := range strings.Split(strings.TrimSuffix(op.Text, "\n"), "\n") {
+				marker := "  "
+				switch op.Operation {
+				case diffmatchpatch.DiffInsert:
+					marker = "+ "
+				case diffmatchpatch.DiffDelete:
+					marker = "- "
+				}
+				rows = append(rows, "      "+marker+line)
+			}
+		}
+	} else {
+		cb, lines, side := e.BlockA, st.linesA, "A"
+		if e.BlockA == nil || (st.byB && e.BlockB != nil) {
+			cb, lines, side = e.BlockB, st.linesB, "B"
+		}
+		for n := cb.LineStart; n <= cb.LineEnd && n-1 < len(lines); n++ {
+			rows = append(rows, fmt.Sprintf("      %s%5d │ %s", side, n, lines[n-1]))
+		}
+	}
+	if len(rows) > TUIMaxExpandedLines {
+		more := len(rows) - TUIMaxExpandedLines
+		rows = append(rows[:TUIMaxExpandedLines], fmt.Sprintf("      ... %d more lines", more))
+	}
+	return rows
+}
+
+// render returns all rows of the list plus the row at which each entry starts.
+func (st *tuiState) render() ([]string, []int) {
+	var rows []string
+	entryRows := make([]int, len(st.entries))
+	for i, e := range st.entries {
+		entryRows[i] = len(rows)
+		cursor := "  "
+		if i == st.cursor {
+			cursor = "> "
+		}
+		fold := "[+]"
+		if st.expanded[entryID(e)] {
+			fold = "[-]"
+		}
+		line := fmt.Sprintf("%s%s %-18s A %-12s B %-12s", cursor, fold, e.Type, blockRange(e.BlockA), blockRange(e.BlockB))
+		if e.Similarity > 0 {
+			line += fmt.Sprintf(" sim %.2f", e.Similarity)
+		}
+		text := ""
+		if e.BlockA != nil {
+			text = e.BlockA.OriginalText
+		} else if e.BlockB != nil {
+			text = e.BlockB.OriginalText
+		}
+		rows = append(rows, line+"  "+summarizedText(text, false))
+		if st.expanded[entryID(e)] {
+			rows = append(rows, st.expandedRows(e)...)
+		}
+	}
+	return rows, entryRows
+}
+
+func (st *tuiState) draw(out *bufio.Writer) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 || height <= 3 {
+		width, height = 80, 24
+	}
+	listHeight := height - 2
+	rows, entryRows := st.render()
+	if len(st.entries) > 0 {
+		if r := entryRows[st.cursor]; r < st.top {
+			st.top = r
+		} else if r >= st.top+listHeight {
+			st.top = r - listHeight + 1
+		}
+	}
+
+	view := "source order (File A)"
+	if st.byB {
+		view = "destination order (File B)"
+	}
+	out.WriteString("\x1b[H\x1b[2J")
+	out.WriteString("\x1b[7m" + fitWidth(fmt.Sprintf(" go-semantic-diff | %d entries | threshold %.2f | %s", len(st.entries), st.opts.SimilarityThreshold, view), width) + "\x1b[0m\r\n")
+	for r := st.top; r < st.top+listHeight; r++ {
+		if r < len(rows) {
+			out.WriteString(fitWidth(rows[r], width))
+		}
+		out.WriteString("\r\n")
+	}
+	help := "↑/↓ move  PgUp/PgDn page  enter expand  tab jump A/B  +/- threshold  q quit"
+	if st.status != "" {
+		help = st.status + "  |  " + help
+	}
+	out.WriteString("\x1b[7m" + fitWidth(help, width) + "\x1b[0m")
+	out.Flush()
+}
+
+// runTUI runs the interactive browser until the user quits.
+func runTUI(rawContentA, rawContentB string, opts Options) error {
+	inFd := int(os.Stdin.Fd())
+	if !term.IsTerminal(inFd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return errors.New("--tui requires an interactive terminal")
+	}
+	entries, _, err := tuiDiff(rawContentA, rawContentB, opts)
+	if err != nil {
+		return fmt.Errorf("diff did not finish: %v", err)
+	}
+	oldState, err := term.MakeRaw(inFd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(inFd, oldState)
+
+	out := bufio.NewWriter(os.Stdout)
+	out.WriteString("\x1b[?1049h\x1b[?25l") // Alternate screen, hide cursor
+	defer func() {
+		out.WriteString("\x1b[?25h\x1b[?1049l")
+		out.Flush()
+	}()
+
+	st := &tuiState{
+		rawA:     rawContentA,
+		rawB:     rawContentB,
+		opts:     opts,
+		entries:  entries,
+		expanded: make(map[string]bool),
+		linesA:   strings.Split(strings.ReplaceAll(rawContentA, "\r\n", "\n"), "\n"),
+		linesB:   strings.Split(strings.ReplaceAll(rawContentB, "\r\n", "\n"), "\n"),
+	}
+	st.sortEntries()
+
+	in := bufio.NewReader(os.Stdin)
+	for {
+		st.draw(out)
+		key, err := in.ReadByte()
+		if err != nil {
+			return nil
+		}
+		_, height, _ := term.GetSize(int(os.Stdout.Fd()))
+		page := max(1, height-3)
+		switch key {
+		case 'q', 3: // q or Ctrl-C
+			return nil
+		case 'k':
+			st.cursor--
+		case 'j':
+			st.cursor++
+		case 'g':
+			st.cursor = 0
+		case 'G':
+			st.cursor = len(st.entries) - 1
+		case '\r', ' ':
+			if len(st.entries) > 0 {
+				k := entryID(st.entries[st.cursor])
+				st.expanded[k] = !st.expanded[k]
+			}
+		case '\t', 'm':
+			st.jumpSide()
+		case '+', '=':
+			if st.opts.SimilarityThreshold+TUIThresholdStep <= 1.0 {
+				st.rediff(st.opts.SimilarityThreshold + TUIThresholdStep)
+			}
+		case '-':
+			if st.opts.SimilarityThreshold-TUIThresholdStep >= 0.0 {
+				st.rediff(st.opts.SimilarityThreshold - TUIThresholdStep)
+			}
+		case 0x1b: // Escape sequences: arrows and paging keys
+			if b, _ := in.ReadByte(); b != '[' {
+				continue
+			}
+			code, _ := in.ReadByte()
+			switch code {
+			case 'A':
+				st.cursor--
+			case 'B':
+				st.cursor++
+			case '5', '6':
+				in.ReadByte() // Trailing '~'
+				if code == '5' {
+					st.cursor -= page
+				} else {
+					st.cursor += page
+				}
+			}
+		}
+		st.cursor = min(max(st.cursor, 0), max(len(st.entries)-1, 0))
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RecordUsage appends a UsageRecord of each run to the local usage file
+// (--usage-stats). Nothing is ever sent over the network.
+var RecordUsage bool
+
+// UsageStages are the PerformDiff stages timed in a UsageRecord, in pipeline order.
+var UsageStages = []string{"megablock matching", "segmentation", "semantic matching", "classification"}
+
+// UsageRecord describes one run without any of its content or file names.
+type UsageRecord struct {
+	Time         time.Time          `json:"time"`
+	Mode         string             `json:"mode"` // normal, hierarchical or windowed
+	BytesA       int64              `json:"bytes_a"`
+	BytesB       int64              `json:"bytes_b"`
+	LinesA       int64              `json:"lines_a"`
+	LinesB       int64              `json:"lines_b"`
+	ExitCode     int                `json:"exit_code"`
+	Seconds      float64            `json:"seconds"`
+	StageSeconds map[string]float64 `json:"stage_seconds"`
+}
+
+// usageRecorder accumulates the stage timings of a run; its methods do nothing
+// on a nil recorder, so PerformDiff can mark stages unconditionally.
+type usageRecorder struct {
+	mu         sync.Mutex
+	record     UsageRecord
+	stage      string
+	stageStart time.Time
+}
+
+// currentUsage is set by main when --usage-stats is given, nil otherwise.
+var currentUsage *usageRecorder
+
+func newUsageRecorder(fileAPath, fileBPath string) *usageRecorder {
+	u := &usageRecorder{record: UsageRecord{Time: time.Now(), Mode: "normal", StageSeconds: make(map[string]float64)}}
+	if HierarchicalMode {
+		u.record.Mode = "hierarchical"
+	}
+	if shape, err := scanInputShape(fileAPath); err == nil {
+		u.record.BytesA, u.record.LinesA = shape.bytes, shape.lines
+	}
+	if shape, err := scanInputShape(fileBPath); err == nil {
+		u.record.BytesB, u.record.LinesB = shape.bytes, shape.lines
+	}
+	return u
+}
+
+// mark ends the stage being timed and starts timing the given one; "" stops timing.
+func (u *usageRecorder) mark(stage string) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	now := time.Now()
+	if u.stage != "" {
+		u.record.StageSeconds[u.stage] += now.Sub(u.stageStart).Seconds()
+	}
+	u.stage, u.stageStart = stage, now
+}
+
+func (u *usageRecorder) setMode(mode string) {
+	if u != nil {
+		u.record.Mode = mode
+	}
+}
+
+// usageStatsPath is the usage file under the user's config directory.
+func usageStatsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "go-semantic-diff", "usage.jsonl"), nil
+}
+
+// save appends the finished run to the usage file as one JSON line.
+func (u *usageRecorder) save(exitCode int) error {
+	u.mark("")
+	u.record.ExitCode = exitCode
+	u.record.Seconds = time.Since(u.record.Time).Seconds()
+	path, err := usageStatsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	line, err := json.Marshal(u.record)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// readUsageRecords reads a usage file, skipping lines it cannot parse.
+func readUsageRecords(path string) ([]UsageRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []UsageRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r UsageRecord
+		if json.Unmarshal(scanner.Bytes(), &r) == nil {
+			records = append(records, r)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// formatByteSize formats a byte count with a binary unit, e.g. "12.3 MB".
+func formatByteSize(n float64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	k := 0
+	for n >= 1024 && k < len(units)-1 {
+		n /= 1024
+		k++
+	}
+	if k == 0 {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	return fmt.Sprintf("%.1f %s", n, units[k])
+}
+
+// median returns the middle value of values, sorting them in place.
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	return values[len(values)/2]
+}
+
+// runStatsReport implements "go-semantic-diff stats report [file]": it summarizes
+// the recorded runs, their input sizes and where their time went.
+func runStatsReport(args []string) int {
+	path := ""
+	switch len(args) {
+	case 0:
+		var err error
+		if path, err = usageStatsPath(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return ExitTrouble
+		}
+	case 1:
+		path = args[0]
+	default:
+		fmt.Fprintln(os.Stderr, "Usage: go-semantic-diff stats report [file]")
+		return ExitTrouble
+	}
+	records, err := readUsageRecords(path)
+	if os.IsNotExist(err) || err == nil && len(records) == 0 {
+		fmt.Printf("No usage statistics recorded in %s yet; run with --usage-stats to record them.\n", path)
+		return ExitIdentical
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", path, err)
+		return ExitTrouble
+	}
+
+	modes := make(map[string]int)
+	exits := make(map[int]int)
+	stageTotals := make(map[string]float64)
+	var lines, sizes, seconds []float64
+	total, staged := 0.0, 0.0
+	first, last := records[0].Time, records[0].Time
+	for _, r := range records {
+		modes[r.Mode]++
+		exits[r.ExitCode]++
+		lines = append(lines, float64(r.LinesA+r.LinesB))
+		sizes = append(sizes, float64(r.BytesA+r.BytesB))
+		seconds = append(seconds, r.Seconds)
+		total += r.Seconds
+		for stage, s := range r.StageSeconds {
+			stageTotals[stage] += s
+			staged += s
+		}
+		if r.Time.Before(first) {
+			first = r.Time
+		}
+		if r.Time.After(last) {
+			last = r.Time
+		}
+	}
+	// median sorts, so the maximum is the last value
+	medianSeconds, maxSeconds := median(seconds), seconds[len(seconds)-1]
+	medianLines, maxLines := median(lines), lines[len(lines)-1]
+	medianSize, maxSize := median(sizes), sizes[len(sizes)-1]
+	duration := func(s float64) time.Duration { return time.Duration(s * float64(time.Second)).Round(time.Millisecond) }
+
+	fmt.Printf("Usage statistics from %s\n", path)
+	fmt.Printf("  Runs: %d (normal %d, hierarchical %d, windowed %d), %s to %s\n", len(records), modes["normal"], modes["hierarchical"], modes["windowed"], first.Format("2006-01-02"), last.Format("2006-01-02"))
+	fmt.Printf("  Exit status: %d identical, %d different, %d trouble\n", exits[ExitIdentical], exits[ExitDifferent], exits[ExitTrouble])
+	fmt.Printf("  Input lines per run (A+B): median %.0f, max %.0f\n", medianLines, maxLines)
+	fmt.Printf("  Input size per run (A+B): median %s, max %s\n", formatByteSize(medianSize), formatByteSize(maxSize))
+	fmt.Printf("  Run time: total %s, median %s, max %s\n", duration(total), duration(medianSeconds), duration(maxSeconds))
+	fmt.Println("  Time by stage:")
+	var unknown []string
+	for stage := range stageTotals {
+		known := false
+		for _, s := range UsageStages {
+			known = known || s == stage
+		}
+		if !known {
+			unknown = append(unknown, stage)
+		}
+	}
+	sort.Strings(unknown)
+	stages := append(append([]string(nil), UsageStages...), unknown...)
+	share := func(s float64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return 100 * s / total
+	}
+	for _, stage := range stages {
+		fmt.Printf("    %-20s %12s %5.1f%%\n", stage, duration(stageTotals[stage]), share(stageTotals[stage]))
+	}
+	other := math.Max(total-staged, 0)
+	fmt.Printf("    %-20s %12s %5.1f%%  (reading inputs, reporting)\n", "other", duration(other), share(other))
+	return ExitIdentical
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// VerifyResult rebuilds File B from File A and the diff's block operations
+// after diffing, and fails the run if any line is lost or differs (--verify).
+var VerifyResult bool
+
+// VerifyMaxProblems is how many --verify problems are listed.
+const VerifyMaxProblems = 20
+
+// verifyReport is the outcome of verifyDiff.
+type verifyReport struct {
+	operations int
+	exact      int // File B lines rebuilt byte for byte
+	normalized int // File B lines equal to the rebuilt line after normalization (megablocks match normalized lines)
+	replaced   int // CHANGED blocks without a line diff, replaced rather than rebuilt
+	unverified int // File B lines of the replaced blocks
+	blank      int // Blank File B lines between blocks, which belong to no block
+	problems   []string
+}
+
+// rebuildBlock returns the File B text an entry's operation produces: NEW
+// inserts its text, UNCHANGED and MOVED copy the File A block, and CHANGED
+// applies its line diff to the File A block. A CHANGED entry without a line
+// diff, and any under --hierarchical, whose sentence diffs do not rebuild the
+// text, replaces the block with its File B text; replaced is then true, as
+// nothing was checked.
+func rebuildBlock(e DiffEntry) (text string, replaced bool, err error) {
+	switch {
+	case e.BlockA == nil:
+		return e.BlockB.OriginalText, false, nil
+	case e.Type == Unchanged || e.Type == Moved:
+		return e.BlockA.OriginalText, false, nil
+	case e.LineDiffs == nil, HierarchicalMode:
+		return e.BlockB.OriginalText, true, nil
+	}
+	var source, result strings.Builder
+	for _, op := range e.LineDiffs {
+		if op.Operation != diffmatchpatch.DiffInsert {
+			source.WriteString(op.Text)
+		}
+		if op.Operation != diffmatchpatch.DiffDelete {
+			result.WriteString(op.Text)
+		}
+	}
+	if source.String() != e.BlockA.OriginalText {
+		return "", false, fmt.Errorf("the line diff of A lines %d-%d does not apply to their text", e.BlockA.LineStart, e.BlockA.LineEnd)
+	}
+	return result.String(), false, nil
+}
+
+// verifyDiff checks that every non-blank line of both files is in exactly one
+// block, and that the block operations of diffs rebuild File B from File A.
+func verifyDiff(contentA, contentB string, diffs []DiffEntry, opts Options) verifyReport {
+	var report verifyReport
+	problem := func(format string, args ...any) {
+		report.problems = append(report.problems, fmt.Sprintf(format, args...))
+	}
+	linesA, linesB := getLinesWithInfo(contentA, "A", opts), getLinesWithInfo(contentB, "B", opts)
+	claimedA, claimedB := make([]bool, len(linesA)), make([]bool, len(linesB))
+	claim := func(claimed []bool, side string, cb *ContentBlock) {
+		for _, ref := range cb.SourceLineRefs {
+			switch n := ref.OriginalLineNum; {
+			case n < 1 || n > len(claimed):
+				problem("%s line %d of a block is past the end of File %s", side, n, side)
+			case claimed[n-1]:
+				problem("%s line %d is in more than one block", side, n)
+			default:
+				claimed[n-1] = true
+			}
+		}
+	}
+	for _, e := range diffs {
+		if e.BlockA != nil {
+			claim(claimedA, "A", e.BlockA)
+		}
+		if e.BlockB == nil {
+			continue
+		}
+		claim(claimedB, "B", e.BlockB)
+		text, replaced, err := rebuildBlock(e)
+		if replaced {
+			report.replaced++
+			report.unverified += len(e.BlockB.SourceLineRefs)
+			continue
+		}
+		report.operations++
+		if err != nil {
+			problem("%v", err)
+			continue
+		}
+		rebuilt, refs := strings.Split(text, "\n"), e.BlockB.SourceLineRefs
+		if len(rebuilt) != len(refs) { // --ignore-blank-lines megablocks differ in blank lines only
+			rebuilt, refs = nonBlankTexts(rebuilt), nonBlankRefs(refs)
+		}
+		if len(rebuilt) != len(refs) {
+			problem("B lines %d-%d: %s rebuilds %d lines for %d", e.BlockB.LineStart, e.BlockB.LineEnd, e.Type, len(rebuilt), len(refs))
+			continue
+		}
+		for k, ref := range refs {
+			if ref.OriginalLineNum < 1 || ref.OriginalLineNum > len(linesB) {
+				continue // Reported by claim
+			}
+			actual := linesB[ref.OriginalLineNum-1].OriginalText
+			switch {
+			case rebuilt[k] == actual:
+				report.exact++
+			case opts.normalize(rebuilt[k]) == opts.normalize(actual):
+				report.normalized++
+			default:
+				problem("B line %d: %s rebuilds %q, File B has %q", ref.OriginalLineNum, e.Type, rebuilt[k], actual)
+			}
+		}
+	}
+	for k, line := range linesA {
+		if !claimedA[k] && line.TrimmedText != "" {
+			problem("A line %d is in no block: %q", k+1, line.OriginalText)
+		}
+	}
+	for k, line := range linesB {
+		switch {
+		case claimedB[k]:
+		case line.TrimmedText == "":
+			report.blank++
+		default:
+			problem("B line %d is in no block: %q", k+1, line.OriginalText)
+		}
+	}
+	return report
+}
+
+func nonBlankTexts(lines []string) []string {
+	var kept []string
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			kept = append(kept, line)
+		}
+	}
+	return kept
+}
+
+func nonBlankRefs(refs []LineInfo) []LineInfo {
+	var kept []LineInfo
+	for _, ref := range refs {
+		if ref.TrimmedText != "" {
+			kept = append(kept, ref)
+		}
+	}
+	return kept
+}
+
+// printVerifyReport prints the --verify outcome on stderr and reports whether
+// the check passed.
+func printVerifyReport(report verifyReport) bool {
+	if len(report.problems) == 0 {
+		fmt.Fprintf(os.Stderr, "Verified: %d block operations rebuild File B from File A (%d lines exact, %d equal after normalization, %d blank lines between blocks).\n", report.operations, report.exact, report.normalized, report.blank)
+		if report.unverified > 0 {
+			fmt.Fprintf(os.Stderr, "  %d unverified replacements: CHANGED blocks without a line diff, whose %d lines were only checked to be in one block.\n", report.replaced, report.unverified)
+		}
+		return true
+	}
+	fmt.Fprintf(os.Stderr, "Error: --verify: the diff does not account for both files (%d problems):\n", len(report.problems))
+	for k, p := range report.problems {
+		if k == VerifyMaxProblems {
+			fmt.Fprintf(os.Stderr, "  ... and %d more\n", len(report.problems)-k)
+			break
+		}
+		fmt.Fprintf(os.Stderr, "  %s\n", p)
+	}
+	return false
+}
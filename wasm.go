@@ -0,0 +1,72 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"syscall/js"
+)
+
+func init() {
+	wasmMain = serveJS
+}
+
+// serveJS defines globalThis.semanticDiff(a, b, options) for pages that load
+// the WebAssembly build, then keeps the program alive to answer calls. It
+// returns a Promise of the POST /diff response object; options take the same
+// fields as the request body's and may be left out.
+func serveJS() {
+	js.Global().Set("semanticDiff", js.FuncOf(func(this js.Value, args []js.Value) any {
+		var req DiffRequest
+		var argErr error
+		if len(args) < 2 || args[0].Type() != js.TypeString || args[1].Type() != js.TypeString {
+			argErr = fmt.Errorf("semanticDiff(a, b, options): a and b must be strings")
+		} else {
+			req.A, req.B = args[0].String(), args[1].String()
+		}
+		if argErr == nil && len(args) > 2 && args[2].Truthy() {
+			optionsJSON := js.Global().Get("JSON").Call("stringify", args[2]).String()
+			dec := json.NewDecoder(strings.NewReader(optionsJSON))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&req.Options); err != nil {
+				argErr = fmt.Errorf("invalid options: %v", err)
+			}
+		}
+		var executor js.Func
+		executor = js.FuncOf(func(this js.Value, promise []js.Value) any {
+			resolve, reject := promise[0], promise[1]
+			go func() {
+				defer executor.Release() // Settled; the executor is not called again
+				result, err := diffForJS(req, argErr)
+				if err != nil {
+					reject.Invoke(js.Global().Get("Error").New(err.Error()))
+					return
+				}
+				resolve.Invoke(js.Global().Get("JSON").Call("parse", result))
+			}()
+			return nil
+		})
+		return js.Global().Get("Promise").New(executor)
+	}))
+	select {}
+}
+
+// diffForJS runs a request and returns the JSON of its response.
+func diffForJS(req DiffRequest, argErr error) (string, error) {
+	if argErr != nil {
+		return "", argErr
+	}
+	opts, err := req.Options.options()
+	if err != nil {
+		return "", err
+	}
+	diffs, note, err := runDiffRequest(context.Background(), req, opts, 0)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(newDiffResponse(diffs, note))
+	return string(data), err
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fileStamp is what --watch compares between polls to detect a change.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+func statFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size(), exists: true}
+}
+
+// watchAndReport clears the screen and reprints the report every time either
+// input changes. It watches the directories of the inputs with fsnotify, which
+// also catches editors that save by writing a new file and renaming it over
+// the old one, and falls back to polling every --watch-interval where file
+// events are unavailable. It runs until interrupted.
+func watchAndReport(fileAPath, fileBPath string, focusPattern *regexp.Regexp, opts Options) {
+	wait := watchEvents(fileAPath, fileBPath)
+	for {
+		stampA, stampB := statFile(fileAPath), statFile(fileBPath)
+		fmt.Print("\x1b[H\x1b[2J")
+		fmt.Printf("Watching %s and %s (Ctrl-C to stop). Last run: %s\n", fileAPath, fileBPath, time.Now().Format("15:04:05"))
+		reportOnce(fileAPath, fileBPath, focusPattern, opts)
+		if wait != nil && wait() {
+			continue
+		}
+		wait = nil
+		for statFile(fileAPath) == stampA && statFile(fileBPath) == stampB {
+			time.Sleep(WatchInterval)
+		}
+	}
+}
+
+// watchEvents returns a function that blocks until an event touches either
+// input and no further event arrives for --watch-interval, so a save that
+// writes in several steps re-diffs once. It returns false if the watcher
+// failed. watchEvents returns nil, with a warning, if file events are
+// unavailable.
+func watchEvents(paths ...string) func() bool {
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		for _, path := range paths {
+			if err = watcher.Add(filepath.Dir(path)); err != nil {
+				watcher.Close()
+				break
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: --watch: file events unavailable (%v); polling every %s\n", err, WatchInterval)
+		return nil
+	}
+	watched := map[string]bool{}
+	for _, path := range paths {
+		watched[filepath.Clean(path)] = true
+	}
+	return func() bool {
+		var settle <-chan time.Time // Set by the first event
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return false
+				}
+				if watched[filepath.Clean(event.Name)] && !event.Has(fsnotify.Chmod) {
+					settle = time.After(WatchInterval)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return false
+				}
+				fmt.Fprintf(os.Stderr, "Warning: --watch: %v; polling every %s\n", err, WatchInterval)
+				watcher.Close()
+				return false
+			case <-settle:
+				return true
+			}
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MaxMemory is the memory budget in bytes (--max-memory); 0 means unlimited.
+// Inputs whose estimated footprint exceeds it are diffed in windows.
+var MaxMemory int64
+
+// Rough cost of the in-memory pipeline: every input byte is held several times
+// (raw, line copies, normalized and block text) and every line carries a
+// LineInfo with a hex SHA-256 checksum.
+const MemoryBytesPerInputByte = 12
+const MemoryBytesPerLine = 400
+
+const MinWindowLines = 200
+const WindowOverlapFactor = 0.5 // File B windows extend this fraction past the File A window
+
+// parseByteSize parses sizes like "512MB", "2G", "64k" or a plain byte count.
+func parseByteSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		factor int64
+	}{{"GB", 1 << 30}, {"G", 1 << 30}, {"MB", 1 << 20}, {"M", 1 << 20}, {"KB", 1 << 10}, {"K", 1 << 10}, {"B", 1}}
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	factor := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(upper, u.suffix) {
+			upper, factor = strings.TrimSpace(strings.TrimSuffix(upper, u.suffix)), u.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (expected e.g. 512MB, 2G or a byte count)", s)
+	}
+	return n * factor, nil
+}
+
+// inputShape is the size and line count of an input file.
+type inputShape struct {
+	bytes, lines int64
+}
+
+func scanInputShape(path string) (inputShape, error) {
+	f, err := openInput(path)
+	if err != nil {
+		return inputShape{}, err
+	}
+	defer f.Close()
+	var shape inputShape
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := f.Read(buf)
+		shape.bytes += int64(n)
+		shape.lines += int64(strings.Count(string(buf[:n]), "\n"))
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return inputShape{}, err
+		}
+	}
+	return shape, nil
+}
+
+func estimateDiffMemory(a, b inputShape) int64 {
+	return (a.bytes+b.bytes)*MemoryBytesPerInputByte + (a.lines+b.lines+2)*MemoryBytesPerLine
+}
+
+// windowLinesForBudget sizes windows so that one File A window and its larger
+// File B window fit in maxMemory at the inputs' average line length.
+func windowLinesForBudget(a, b inputShape, maxMemory int64) int {
+	avgLine := a.bytes + b.bytes
+	if lines := a.lines + b.lines; lines > 0 {
+		avgLine /= lines
+	}
+	perLine := avgLine*MemoryBytesPerInputByte + MemoryBytesPerLine
+	return max(int(float64(maxMemory)/float64(perLine)/(2+WindowOverlapFactor)), MinWindowLines)
+}
+
+// lineWindow streams a file's lines, holding only those from first onwards.
+type lineWindow struct {
+	r     *bufio.Reader
+	lines []string
+	first int // Line number of lines[0]
+	eof   bool
+}
+
+// fill reads ahead until line end-1 is buffered or the file ends.
+func (w *lineWindow) fill(end int) error {
+	for !w.eof && w.first+len(w.lines) < end {
+		line, err := w.r.ReadString('\n')
+		if err == io.EOF {
+			w.eof = true
+			if line == "" {
+				break
+			}
+		} else if err != nil {
+			return err
+		}
+		w.lines = append(w.lines, strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"))
+	}
+	return nil
+}
+
+// last is the number of the last buffered line (first-1 when nothing is buffered).
+func (w *lineWindow) last() int { return w.first + len(w.lines) - 1 }
+
+func (w *lineWindow) text(from, to int) string {
+	return strings.Join(w.lines[from-w.first:to-w.first], "\n")
+}
+
+func (w *lineWindow) discardBefore(n int) {
+	drop := min(n-w.first, len(w.lines))
+	w.lines = append([]string(nil), w.lines[drop:]...)
+	w.first += drop
+}
+
+// windowedBlock moves a block into whole-file coordinates and drops the per-line
+// data that is only needed while matching.
+func windowedBlock(cb *ContentBlock, lineOffset, idOffset int) *ContentBlock {
+	moved := relocateBlock(cb, lineOffset, idOffset)
+	if moved != nil {
+		moved.SourceLineRefs, moved.Embedding = nil, nil
+	}
+	return moved
+}
+
+// PerformWindowedDiff diffs two files in windows of windowLines File A lines, each
+// against a File B window that is WindowOverlapFactor longer. The next File B window
+// starts after the last File B line paired in this one, so unpaired File B lines at
+// the end of a window are diffed again with the following File A window. Only the
+// current windows are held in memory. Moves are detected within a window and, by a
+// final LIS pass, across windows; content that moved further than a window is
+// reported as DELETED and NEW.
+func PerformWindowedDiff(ctx context.Context, pathA, pathB string, windowLines int, opts Options) ([]DiffEntry, error) {
+	opts = opts.begin()
+	fa, err := openInput(pathA)
+	if err != nil {
+		return nil, err
+	}
+	defer fa.Close()
+	fb, err := openInput(pathB)
+	if err != nil {
+		return nil, err
+	}
+	defer fb.Close()
+	winA := &lineWindow{r: bufio.NewReader(inputDecoder(fa, InputEncodings[0])), first: 1}
+	winB := &lineWindow{r: bufio.NewReader(inputDecoder(fb, InputEncodings[1])), first: 1}
+	overlap := int(float64(windowLines) * WindowOverlapFactor)
+	windowOpts := opts
+	windowOpts.RescueThreshold = 0 // Run once below, across windows
+	windowOpts.PairAdjacent = false
+
+	var pairedEntries, unpairedEntries []DiffEntry
+	defer currentRecovery.begin()()
+	currentRecovery.publish("window diffs", func() []DiffEntry { return append(append([]DiffEntry(nil), pairedEntries...), unpairedEntries...) })
+	idOffset := 0
+	a0, b0 := 1, 1
+	for {
+		if err := winA.fill(a0 + windowLines); err != nil {
+			return nil, err
+		}
+		if err := winB.fill(b0 + windowLines + overlap); err != nil {
+			return nil, err
+		}
+		aEnd, bEnd := winA.last()+1, winB.last()+1
+		if a0 >= aEnd && b0 >= bEnd {
+			break
+		}
+		debugf(opts.Verbosity, VerbositySummary, "window", map[string]any{"a_start": a0, "a_end": aEnd - 1, "b_start": b0, "b_end": bEnd - 1}, "Window: A lines %d-%d, B lines %d-%d", a0, aEnd-1, b0, bEnd-1)
+
+		var diffs []DiffEntry
+		switch {
+		case a0 >= aEnd: // File A is exhausted; the rest of File B is new
+			var blocks []ContentBlock
+			blocks, _ = SegmentGapText(getLinesWithInfo(winB.text(b0, bEnd), "B", opts), "B", 0, opts)
+			for k := range blocks {
+				diffs = append(diffs, DiffEntry{Type: Added, BlockB: &blocks[k]})
+			}
+		case b0 >= bEnd: // File B is exhausted; the rest of File A was deleted
+			var blocks []ContentBlock
+			blocks, _ = SegmentGapText(getLinesWithInfo(winA.text(a0, aEnd), "A", opts), "A", 0, opts)
+			for k := range blocks {
+				diffs = append(diffs, DiffEntry{Type: Deleted, BlockA: &blocks[k]})
+			}
+		default:
+			diffs, _ = PerformDiff(ctx, winA.text(a0, aEnd), winB.text(b0, bEnd), windowOpts) // Cancellation ends the loop below
+		}
+
+		// File B resumes after the last paired line, or without pairs in step with
+		// File A. Once either file is exhausted, the window is consumed whole.
+		nextB := b0
+		for _, e := range diffs {
+			if e.BlockA != nil && e.BlockB != nil {
+				nextB = max(nextB, e.BlockB.LineEnd+b0)
+			}
+		}
+		if nextB == b0 {
+			nextB = min(b0+aEnd-a0, bEnd)
+			for _, e := range diffs {
+				// Do not split a NEW block; it is re-examined whole with the next window.
+				if e.BlockB != nil && e.BlockB.LineStart+b0-1 < nextB && e.BlockB.LineEnd+b0-1 >= nextB {
+					nextB = e.BlockB.LineStart + b0 - 1
+				}
+			}
+		}
+		if a0 >= aEnd || b0 >= bEnd {
+			nextB = bEnd
+		}
+
+		maxID := 0
+		for _, e := range diffs {
+			if e.BlockB != nil && e.BlockB.LineEnd+b0-1 >= nextB {
+				continue // Re-examined with the next File A window
+			}
+			for _, cb := range []*ContentBlock{e.BlockA, e.BlockB} {
+				if cb != nil {
+					maxID = max(maxID, cb.ID)
+				}
+			}
+			e.BlockA = windowedBlock(e.BlockA, a0-1, idOffset)
+			e.BlockB = windowedBlock(e.BlockB, b0-1, idOffset)
+			e.NearMiss = windowedBlock(e.NearMiss, b0-1, idOffset)
+			switch e.Type {
+			case Added, Deleted:
+				unpairedEntries = append(unpairedEntries, e)
+			case Moved, MovedModified:
+				// Undo the per-window move classification; LIS is rerun globally below.
+				e.Type = Unchanged
+				if e.Similarity > 0 {
+					e.Type = Modified
+				}
+				fallthrough
+			default:
+				pairedEntries = append(pairedEntries, e)
+			}
+		}
+		idOffset += maxID + 1
+		a0, b0 = aEnd, nextB
+		winA.discardBefore(a0)
+		winB.discardBefore(b0)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	finalDiffs := pairedEntries
+	if !opts.Pipeline.SkipClassify {
+		finalDiffs = classifyPairedMatches(pairedEntries)
+	}
+	finalDiffs = append(finalDiffs, unpairedEntries...)
+	if opts.PairAdjacent {
+		finalDiffs, _ = pairAdjacentReplacements(finalDiffs, unpairedSimilarity(finalDiffs, opts), blockLineDiffs)
+	}
+	if opts.RescueThreshold > 0 {
+		linkPossiblyRelated(ctx, finalDiffs, unpairedSimilarity(finalDiffs, opts), opts.RescueThreshold)
+	}
+	sortDiffEntries(finalDiffs)
+	return finalDiffs, ctx.Err()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CheckCrossRefs enables the CROSS-REFERENCES section (--check-xrefs).
+var CheckCrossRefs bool
+
+// crossRefRe matches a reference to a numbered clause, e.g. "Section 7.2",
+// "clauses 3" or "§ 4.1"; group 1 or 2 is the clause number.
+var crossRefRe = regexp.MustCompile(`(?i)\b(?:sections?|clauses?|articles?)\s+(\d{1,3}(?:\.\d{1,3})*)|§\s*(\d{1,3}(?:\.\d{1,3})*)`)
+
+// CrossRef is a reference to a clause number on one line.
+type CrossRef struct {
+	Line   int
+	Text   string
+	Number string
+}
+
+// findCrossRefs returns the clause references on each line of content, keyed by
+// line number. The number of a clause heading line is not a reference.
+func findCrossRefs(content string) map[int][]CrossRef {
+	refs := make(map[int][]CrossRef)
+	for i, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		for _, m := range crossRefRe.FindAllStringSubmatchIndex(line, -1) {
+			if strings.TrimSpace(line[:m[0]]) == "" && clauseHeadingRe.MatchString(line) {
+				continue
+			}
+			g := 2
+			if m[g] < 0 {
+				g = 4
+			}
+			refs[i+1] = append(refs[i+1], CrossRef{Line: i + 1, Text: line[m[0]:m[1]], Number: line[m[g]:m[g+1]]})
+		}
+	}
+	return refs
+}
+
+// CrossRefProblem is a File B reference that points to the wrong clause.
+type CrossRefProblem struct {
+	Ref     CrossRef
+	Problem string
+}
+
+// checkCrossRefs checks every clause reference in File B against the clause map.
+// A reference on a line aligned to a File A line is paired with the reference in
+// the same position there; it must point to where the old target clause went.
+// Other references must at least name a clause that exists in File B.
+func checkCrossRefs(diffs []DiffEntry, mappings []ClauseMapping, rawContentA, rawContentB string) ([]CrossRefProblem, int) {
+	renumbered := make(map[string]*ClauseMapping)
+	inB := make(map[string]bool)
+	for k := range mappings {
+		m := &mappings[k]
+		if m.A != nil {
+			renumbered[m.A.Number] = m
+		}
+		if m.B != nil {
+			inB[m.B.Number] = true
+		}
+	}
+	alignedA := make(map[int]int) // File B line -> File A line
+	for _, e := range diffs {
+		if e.BlockA == nil || e.BlockB == nil {
+			continue
+		}
+		for _, r := range sideBySideRows(e) {
+			if r.lineA > 0 && r.lineB > 0 {
+				alignedA[r.lineB] = r.lineA
+			}
+		}
+	}
+	refsA, refsB := findCrossRefs(rawContentA), findCrossRefs(rawContentB)
+	var problems []CrossRefProblem
+	total := 0
+	for line := 1; line <= strings.Count(rawContentB, "\n")+1; line++ {
+		oldRefs := refsA[alignedA[line]]
+		for k, ref := range refsB[line] {
+			total++
+			if len(oldRefs) == len(refsB[line]) {
+				old := oldRefs[k].Number
+				if m, ok := renumbered[old]; ok {
+					switch {
+					case m.B == nil:
+						problems = append(problems, CrossRefProblem{ref, fmt.Sprintf("refers to old clause %s, which was deleted", old)})
+					case ref.Number == old && m.B.Number != old:
+						problems = append(problems, CrossRefProblem{ref, fmt.Sprintf("still points to old clause %s, now %s", old, m.B.Number)})
+					case ref.Number != m.B.Number:
+						problems = append(problems, CrossRefProblem{ref, fmt.Sprintf("points to %s, but old clause %s is now %s", ref.Number, old, m.B.Number)})
+					}
+					continue
+				}
+			}
+			if !inB[ref.Number] {
+				problems = append(problems, CrossRefProblem{ref, fmt.Sprintf("points to clause %s, which does not exist in File B", ref.Number)})
+			}
+		}
+	}
+	return problems, total
+}
+
+// printCrossRefProblems prints the CROSS-REFERENCES section.
+func printCrossRefProblems(problems []CrossRefProblem, total int) {
+	heading, item := "\n# CROSS-REFERENCES\n", "  "
+	if OutputFormat == "markdown" {
+		heading, item = "\n## CROSS-REFERENCES\n\n", "- "
+	}
+	fmt.Print(heading)
+	if len(problems) == 0 {
+		fmt.Printf("%sAll %d clause references in File B point to the right clauses.\n", item, total)
+		return
+	}
+	for _, p := range problems {
+		fmt.Printf("%sB L%d: %q %s\n", item, p.Ref.Line, p.Ref.Text, p.Problem)
+	}
+	fmt.Printf("%s%d of %d clause references need attention.\n", item, len(problems), total)
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	yamlKeyPattern         = regexp.MustCompile(`^("(?:[^"\\]|\\.)*"|'(?:[^']|'')*'|[^\s#'"{\[][^#]*?)\s*:(?:\s+(.*))?$`)
+	yamlBlockScalarPattern = regexp.MustCompile(`^(?:[&!]\S+\s+)*[|>][-+0-9]*\s*(?:#.*)?$`)
+)
+
+// parseYAMLDocument decodes the first YAML document of an input into the
+// values diffJSON compares: string-keyed objects, arrays, json.Number numbers
+// and other scalars.
+func parseYAMLDocument(content string) (any, error) {
+	var v any
+	if err := yaml.Unmarshal([]byte(content), &v); err != nil {
+		return nil, err
+	}
+	return yamlToJSONValue(v), nil
+}
+
+func yamlToJSONValue(v any) any {
+	switch v := v.(type) {
+	case map[any]any:
+		obj := make(map[string]any, len(v))
+		for k, value := range v {
+			obj[fmt.Sprint(k)] = yamlToJSONValue(value)
+		}
+		return obj
+	case []any:
+		arr := make([]any, len(v))
+		for k, value := range v {
+			arr[k] = yamlToJSONValue(value)
+		}
+		return arr
+	case int:
+		return json.Number(strconv.Itoa(v))
+	case int64:
+		return json.Number(strconv.FormatInt(v, 10))
+	case uint64:
+		return json.Number(strconv.FormatUint(v, 10))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Sprint(v) // JSON has no literal for these
+		}
+		return json.Number(strconv.FormatFloat(v, 'g', -1, 64))
+	case nil, bool, string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// yamlLineIndex maps the path of every mapping entry and sequence item of a
+// block-style YAML document to its 1-based line. Entries inside flow
+// collections ({...}, [...]) and block scalars are not indexed.
+func yamlLineIndex(content string) map[string]int {
+	type frame struct {
+		indent int
+		path   string
+		seq    bool
+		count  int
+	}
+	index := map[string]int{"$": 1}
+	var stack []*frame
+	pending, pendingIndent := "", 0 // A key or item whose value starts on a later line
+	scalarIndent := -1              // Lines indented deeper than this belong to a block scalar
+	for k, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "---") || strings.HasPrefix(line, "...") {
+			if len(stack) > 0 {
+				break // Only the first document is compared
+			}
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " "))
+		if scalarIndent >= 0 {
+			if n > scalarIndent {
+				continue
+			}
+			scalarIndent = -1
+		}
+		item := trimmed == "-" || strings.HasPrefix(trimmed, "- ")
+		if pending != "" && (n > pendingIndent || n == pendingIndent && item) {
+			stack = append(stack, &frame{indent: n, path: pending, seq: item})
+		} else {
+			for len(stack) > 0 {
+				top := stack[len(stack)-1]
+				if n < top.indent || n == top.indent && top.seq != item {
+					stack = stack[:len(stack)-1]
+					continue
+				}
+				break
+			}
+			if len(stack) == 0 {
+				stack = append(stack, &frame{indent: n, path: "$", seq: item})
+			}
+		}
+		pending = ""
+
+		// A sequence item may itself start a mapping ("- name: x"), possibly
+		// after further dashes ("- - a").
+		for {
+			top := stack[len(stack)-1]
+			if !top.seq || !(trimmed == "-" || strings.HasPrefix(trimmed, "- ")) {
+				break
+			}
+			itemPath := jsonIndexPath(top.path, top.count)
+			top.count++
+			index[itemPath] = k + 1
+			rest := strings.TrimLeft(strings.TrimPrefix(trimmed, "-"), " ")
+			restIndent := n + len(trimmed) - len(rest)
+			switch {
+			case rest == "" || strings.HasPrefix(rest, "#"):
+				pending, pendingIndent = itemPath, n
+				trimmed = ""
+			case strings.HasPrefix(rest, "- "), rest == "-":
+				stack = append(stack, &frame{indent: restIndent, path: itemPath, seq: true})
+				trimmed, n = rest, restIndent
+				continue
+			case yamlKeyPattern.MatchString(rest):
+				stack = append(stack, &frame{indent: restIndent, path: itemPath})
+				trimmed, n = rest, restIndent
+			default:
+				trimmed = "" // A scalar item
+			}
+			break
+		}
+		if trimmed == "" {
+			continue
+		}
+		top := stack[len(stack)-1]
+		m := yamlKeyPattern.FindStringSubmatch(trimmed)
+		if m == nil || top.seq {
+			continue // A continuation line of a multi-line plain or quoted scalar
+		}
+		path := jsonKeyPath(top.path, yamlUnquoteKey(m[1]))
+		index[path] = k + 1
+		value := strings.TrimSpace(m[2])
+		switch {
+		case value == "" || strings.HasPrefix(value, "#") || (strings.HasPrefix(value, "&") || strings.HasPrefix(value, "!")) && !strings.Contains(value, " "):
+			pending, pendingIndent = path, n
+		case yamlBlockScalarPattern.MatchString(value):
+			scalarIndent = n
+		}
+	}
+	return index
+}
+
+// yamlUnquoteKey returns the text of a plain, single- or double-quoted key.
+func yamlUnquoteKey(key string) string {
+	switch {
+	case strings.HasPrefix(key, `"`):
+		if s, err := strconv.Unquote(key); err == nil {
+			return s
+		}
+	case strings.HasPrefix(key, "'"):
+		return strings.ReplaceAll(key[1:len(key)-1], "''", "'")
+	}
+	return key
+}
+
+// jsonParentPath returns the path of the object or array holding a value.
+func jsonParentPath(path string) string {
+	if strings.HasSuffix(path, `"]`) {
+		if k := strings.LastIndex(path, `["`); k >= 0 {
+			return path[:k]
+		}
+	}
+	if k := strings.LastIndexAny(path, ".["); k >= 0 {
+		return path[:k]
+	}
+	return path
+}
+
+// yamlNode is a value of a DELETED or NEW change, or an object or array
+// nested in one, that pairMovedValues may pair.
+type yamlNode struct {
+	root  int // Index of the change in the change list
+	path  string
+	value any
+}
+
+// jsonPathWithin reports whether path is root or a path inside it.
+func jsonPathWithin(path, root string) bool {
+	return path == root || strings.HasPrefix(path, root+".") || strings.HasPrefix(path, root+"[")
+}
+
+// yamlNodes lists a change's value and every object and array nested in it.
+func yamlNodes(root int, path string, value any, nodes []yamlNode) []yamlNode {
+	nodes = append(nodes, yamlNode{root, path, value})
+	switch v := value.(type) {
+	case map[string]any:
+		for _, k := range sortedJSONKeys(v) {
+			if jsonKind(v[k]) != "scalar" {
+				nodes = yamlNodes(root, jsonKeyPath(path, k), v[k], nodes)
+			}
+		}
+	case []any:
+		for k, elem := range v {
+			if jsonKind(elem) != "scalar" {
+				nodes = yamlNodes(root, jsonIndexPath(path, k), elem, nodes)
+			}
+		}
+	}
+	return nodes
+}
+
+// yamlRemainder appends a change of type t for every part of value at path
+// that none of the used paths is within or contains.
+func yamlRemainder(t DiffType, path string, value any, used []string, changes []JSONChange) []JSONChange {
+	inside := false
+	for _, u := range used {
+		if jsonPathWithin(path, u) {
+			return changes // Paired as a whole
+		}
+		inside = inside || jsonPathWithin(u, path)
+	}
+	if !inside {
+		c := JSONChange{Type: t, PathA: path, A: value}
+		if t == Added {
+			c = JSONChange{Type: t, PathB: path, B: value}
+		}
+		return append(changes, c)
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		for _, k := range sortedJSONKeys(v) {
+			changes = yamlRemainder(t, jsonKeyPath(path, k), v[k], used, changes)
+		}
+	case []any:
+		for k, elem := range v {
+			changes = yamlRemainder(t, jsonIndexPath(path, k), elem, used, changes)
+		}
+	}
+	return changes
+}
+
+// pairMovedValues pairs DELETED and NEW values, or objects and arrays nested
+// in them, that are the same entry under another key or in another place:
+// objects and arrays scoring at least the threshold anywhere in the document, and
+// equal scalars under a renamed key of the same parent. Pairs become MOVED, or
+// MOVED_AND_CHANGED followed by their inner changes; what is left of a
+// DELETED or NEW value around a paired part stays DELETED or NEW.
+func pairMovedValues(changes []JSONChange, opts Options) []JSONChange {
+	var deleted, added []yamlNode
+	for k, c := range changes {
+		switch c.Type {
+		case Deleted:
+			deleted = yamlNodes(k, c.PathA, c.A, deleted)
+		case Added:
+			added = yamlNodes(k, c.PathB, c.B, added)
+		}
+	}
+	type candidate struct {
+		d, a  yamlNode
+		score float32
+	}
+	var candidates []candidate
+	for _, d := range deleted {
+		for _, a := range added {
+			if jsonKind(d.value) != jsonKind(a.value) {
+				continue
+			}
+			if jsonKind(d.value) == "scalar" {
+				if jsonEqual(d.value, a.value) && jsonParentPath(d.path) == jsonParentPath(a.path) {
+					candidates = append(candidates, candidate{d, a, 1})
+				}
+				continue
+			}
+			if score := jsonSimilarity(d.value, a.value, opts); float64(score) >= opts.SimilarityThreshold {
+				candidates = append(candidates, candidate{d, a, score})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(x, y int) bool { return candidates[x].score > candidates[y].score })
+	used := make(map[int][]string) // Paired paths by change
+	free := func(n yamlNode) bool {
+		for _, u := range used[n.root] {
+			if jsonPathWithin(n.path, u) || jsonPathWithin(u, n.path) {
+				return false
+			}
+		}
+		return true
+	}
+	var paired []JSONChange
+	for _, c := range candidates {
+		if !free(c.d) || !free(c.a) {
+			continue
+		}
+		used[c.d.root] = append(used[c.d.root], c.d.path)
+		used[c.a.root] = append(used[c.a.root], c.a.path)
+		if jsonEqual(c.d.value, c.a.value) {
+			paired = append(paired, JSONChange{Type: Moved, PathA: c.d.path, PathB: c.a.path, A: c.d.value, B: c.a.value, Similarity: 1})
+			continue
+		}
+		paired = append(paired, JSONChange{Type: MovedModified, PathA: c.d.path, PathB: c.a.path, A: c.d.value, B: c.a.value, Similarity: c.score})
+		diffJSONValues(c.d.path, c.a.path, c.d.value, c.a.value, opts, &paired)
+	}
+	var result []JSONChange
+	for k, c := range changes {
+		switch {
+		case len(used[k]) == 0:
+			result = append(result, c)
+		case c.Type == Deleted:
+			result = yamlRemainder(Deleted, c.PathA, c.A, used[k], result)
+		default:
+			result = yamlRemainder(Added, c.PathB, c.B, used[k], result)
+		}
+	}
+	return append(result, paired...)
+}
+
+// reportYAML diffs two YAML inputs by key path and prints the changes with
+// their line numbers, returning the process exit code.
+func reportYAML(fileAPath, fileBPath string, opts Options) int {
+	rawContentA, rawContentB, err := readInputs(fileAPath, fileBPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return ExitTrouble
+	}
+	a, err := parseYAMLDocument(rawContentA)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --mode yaml: %s: %v\n", fileAPath, err)
+		return ExitTrouble
+	}
+	b, err := parseYAMLDocument(rawContentB)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --mode yaml: %s: %v\n", fileBPath, err)
+		return ExitTrouble
+	}
+	changes := pairMovedValues(diffJSON(a, b, opts), opts)
+	if len(changes) == 0 {
+		fmt.Println("Files are semantically identical (the YAML values are equal).")
+		return ExitIdentical
+	}
+	linesA, linesB := yamlLineIndex(rawContentA), yamlLineIndex(rawContentB)
+	for k := range changes {
+		changes[k].LineA, changes[k].LineB = linesA[changes[k].PathA], linesB[changes[k].PathB]
+	}
+	printJSONChanges(changes)
+	return ExitDifferent
+}